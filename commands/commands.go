@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
 
@@ -18,6 +19,7 @@ import (
 	"github.com/docker/machine/libmachine/mcnutils"
 	"github.com/docker/machine/libmachine/persist"
 	"github.com/docker/machine/libmachine/ssh"
+	"golang.org/x/net/context"
 )
 
 var (
@@ -125,6 +127,28 @@ func fatalOnError(command func(commandLine CommandLine, api libmachine.API) erro
 	}
 }
 
+// interruptContext returns a context which is canceled when the process
+// receives an interrupt, so that long running operations such as
+// provisioning stop their remote commands instead of hanging.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+
+	go func() {
+		select {
+		case <-sigCh:
+			log.Info("Interrupt received, canceling...")
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sigCh)
+	}()
+
+	return ctx, cancel
+}
+
 func confirmInput(msg string) (bool, error) {
 	fmt.Printf("%s (y/n): ", msg)
 
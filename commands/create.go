@@ -70,6 +70,10 @@ var (
 			Name:  "engine-storage-driver",
 			Usage: "Specify a storage driver to use with the engine",
 		},
+		cli.StringFlag{
+			Name:  "engine-service-name",
+			Usage: "Specify the service the engine runs under when it isn't docker, like docker-ce",
+		},
 		cli.StringSliceFlag{
 			Name:  "engine-env",
 			Usage: "Specify environment variables to set in the engine",
@@ -177,14 +181,17 @@ func cmdCreateInner(c CommandLine, api libmachine.API) error {
 			ServerCertSANs:   c.StringSlice("tls-san"),
 		},
 		EngineOptions: &engine.Options{
-			ArbitraryFlags:   c.StringSlice("engine-opt"),
-			Env:              c.StringSlice("engine-env"),
-			InsecureRegistry: c.StringSlice("engine-insecure-registry"),
-			Labels:           c.StringSlice("engine-label"),
-			RegistryMirror:   c.StringSlice("engine-registry-mirror"),
-			StorageDriver:    c.String("engine-storage-driver"),
-			TLSVerify:        true,
-			InstallURL:       c.String("engine-install-url"),
+			ArbitraryFlags:      c.StringSlice("engine-opt"),
+			Env:                 c.StringSlice("engine-env"),
+			InsecureRegistry:    c.StringSlice("engine-insecure-registry"),
+			Labels:              c.StringSlice("engine-label"),
+			RegistryMirror:      c.StringSlice("engine-registry-mirror"),
+			StorageDriver:       c.String("engine-storage-driver"),
+			ServiceName:         c.String("engine-service-name"),
+			TLSVerify:           true,
+			InstallURL:          c.String("engine-install-url"),
+			BatchPackageInstall: true,
+			CleanAptCache:       true,
 		},
 		SwarmOptions: &swarm.Options{
 			IsSwarm:        c.Bool("swarm"),
@@ -218,7 +225,10 @@ func cmdCreateInner(c CommandLine, api libmachine.API) error {
 		return fmt.Errorf("Error setting machine configuration from flags provided: %s", err)
 	}
 
-	if err := api.Create(h); err != nil {
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	if err := api.Create(ctx, h); err != nil {
 		return fmt.Errorf("Error creating machine: %s", err)
 	}
 
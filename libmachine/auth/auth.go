@@ -12,6 +12,9 @@ type Options struct {
 	ServerKeyRemotePath  string
 	ClientCertPath       string
 	ServerCertSANs       []string
+	// ClientCertOutputDir is where ConfigureAuth copies the client bundle
+	// for the machine, StorePath when it is empty.
+	ClientCertOutputDir string
 	// StorePath is left in for historical reasons, but not really meant to
 	// be used directly.
 	StorePath string
@@ -21,6 +21,10 @@ import (
 
 var defaultGenerator = NewX509CertGenerator()
 
+// Generator creates and checks the TLS material of the machines. The
+// default implementation signs self-generated certificates with a local CA;
+// another one, e.g. backed by Vault, can be installed with
+// SetCertGenerator. Generators write PEM encoded files to the given paths.
 type Generator interface {
 	GenerateCACertificate(certFile, keyFile, org string, bits int) error
 	GenerateCert(hosts []string, certFile, keyFile, caFile, caKeyFile, org string, bits int) error
@@ -50,6 +54,8 @@ func ReadTLSConfig(addr string, authOptions *auth.Options) (*tls.Config, error)
 	return defaultGenerator.ReadTLSConfig(addr, authOptions)
 }
 
+// SetCertGenerator replaces the generator used by the package functions,
+// and so by the provisioners when they configure TLS.
 func SetCertGenerator(cg Generator) {
 	defaultGenerator = cg
 }
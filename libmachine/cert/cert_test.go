@@ -1,6 +1,9 @@
 package cert
 
 import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -68,3 +71,63 @@ func TestGenerateCert(t *testing.T) {
 		t.Fatalf("key not created at %s", keyPath)
 	}
 }
+
+func readTestCert(t *testing.T, path string) *x509.Certificate {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatalf("no PEM data in %s", path)
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert
+}
+
+func TestGenerateCertSharedCA(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// cleanup
+	defer os.RemoveAll(tmpDir)
+
+	caCertPath := filepath.Join(tmpDir, "ca.pem")
+	caKeyPath := filepath.Join(tmpDir, "ca-key.pem")
+	testOrg := "test-org"
+	bits := 2048
+	if err := GenerateCACertificate(caCertPath, caKeyPath, testOrg, bits); err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(readTestCert(t, caCertPath))
+
+	var certs []*x509.Certificate
+	for _, machine := range []string{"pi1", "pi2"} {
+		certPath := filepath.Join(tmpDir, machine+"-server.pem")
+		keyPath := filepath.Join(tmpDir, machine+"-server-key.pem")
+		if err := GenerateCert([]string{machine}, certPath, keyPath, caCertPath, caKeyPath, testOrg+"."+machine, bits); err != nil {
+			t.Fatal(err)
+		}
+
+		cert := readTestCert(t, certPath)
+		if _, err := cert.Verify(x509.VerifyOptions{DNSName: machine, Roots: roots}); err != nil {
+			t.Fatalf("expected the %s server cert to be signed by the shared CA: %s", machine, err)
+		}
+		certs = append(certs, cert)
+	}
+
+	first := certs[0].PublicKey.(*rsa.PublicKey)
+	second := certs[1].PublicKey.(*rsa.PublicKey)
+	if first.N.Cmp(second.N) == 0 {
+		t.Fatal("expected every server cert to have its own key")
+	}
+}
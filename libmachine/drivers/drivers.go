@@ -72,8 +72,20 @@ type Driver interface {
 	Stop() error
 }
 
+// Console is implemented by drivers whose hosts expose a console, such as
+// a cloud serial console, which can run commands before SSH is reachable.
+type Console interface {
+	// ConsoleCommand runs a shell command on the host's console and
+	// returns its output.
+	ConsoleCommand(command string) (string, error)
+}
+
 var ErrHostIsNotRunning = errors.New("Host is not running")
 
+// ErrNoConsole is returned by the ConsoleCommand of drivers wrapping
+// another one, like plugin drivers, when the wrapped driver has no console.
+var ErrNoConsole = errors.New("The driver does not provide a console")
+
 type DriverOptions interface {
 	String(key string) string
 	StringSlice(key string) []string
@@ -3,6 +3,7 @@ package rpcdriver
 import (
 	"fmt"
 	"net/rpc"
+	"strings"
 	"sync"
 	"time"
 
@@ -66,6 +67,7 @@ const (
 	RestartMethod            = `.Restart`
 	KillMethod               = `.Kill`
 	UpgradeMethod            = `.Upgrade`
+	ConsoleCommandMethod     = `.ConsoleCommand`
 )
 
 func (ic *InternalClient) Call(serviceMethod string, args interface{}, reply interface{}) error {
@@ -346,3 +348,19 @@ func (c *RPCClientDriver) Kill() error {
 func (c *RPCClientDriver) Upgrade() error {
 	return c.Client.Call(UpgradeMethod, struct{}{}, nil)
 }
+
+// ConsoleCommand runs a command over the console of the plugin's driver. It
+// returns drivers.ErrNoConsole when the driver has none, or the plugin
+// predates consoles.
+func (c *RPCClientDriver) ConsoleCommand(command string) (string, error) {
+	var output string
+
+	if err := c.Client.Call(ConsoleCommandMethod, command, &output); err != nil {
+		if err.Error() == drivers.ErrNoConsole.Error() || strings.HasPrefix(err.Error(), "rpc: can't find method") {
+			return "", drivers.ErrNoConsole
+		}
+		return output, err
+	}
+
+	return output, nil
+}
@@ -0,0 +1,57 @@
+package rpcdriver
+
+import (
+	"net"
+	"net/rpc"
+	"testing"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/drivers"
+)
+
+type consoleDriver struct {
+	fakedriver.Driver
+	commands []string
+}
+
+func (d *consoleDriver) ConsoleCommand(command string) (string, error) {
+	d.commands = append(d.commands, command)
+	return "ok\n", nil
+}
+
+// newPipeClientDriver serves d in process, as a plugin binary would.
+func newPipeClientDriver(t *testing.T, d drivers.Driver) *RPCClientDriver {
+	server := rpc.NewServer()
+	if err := server.RegisterName(RPCServiceNameV1, NewRPCServerDriver(d)); err != nil {
+		t.Fatal(err)
+	}
+
+	serverConn, clientConn := net.Pipe()
+	go server.ServeConn(serverConn)
+
+	return &RPCClientDriver{Client: NewInternalClient(rpc.NewClient(clientConn))}
+}
+
+func TestRPCClientDriverConsoleCommand(t *testing.T) {
+	d := &consoleDriver{}
+	c := newPipeClientDriver(t, d)
+
+	output, err := c.ConsoleCommand("sudo systemctl start ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "ok\n" {
+		t.Fatalf("expected the console output; received %q", output)
+	}
+	if len(d.commands) != 1 || d.commands[0] != "sudo systemctl start ssh" {
+		t.Fatalf("expected the command to run on the driver's console; received %v", d.commands)
+	}
+}
+
+func TestRPCClientDriverNoConsole(t *testing.T) {
+	c := newPipeClientDriver(t, &fakedriver.Driver{})
+
+	if _, err := c.ConsoleCommand("true"); err != drivers.ErrNoConsole {
+		t.Fatalf("expected %s; received %v", drivers.ErrNoConsole, err)
+	}
+}
@@ -191,6 +191,19 @@ func (r *RPCServerDriver) Stop(_ *struct{}, _ *struct{}) error {
 	return r.ActualDriver.Stop()
 }
 
+// ConsoleCommand runs a command over the console of the actual driver,
+// failing with drivers.ErrNoConsole when it has none.
+func (r *RPCServerDriver) ConsoleCommand(command string, reply *string) error {
+	console, ok := r.ActualDriver.(drivers.Console)
+	if !ok {
+		return drivers.ErrNoConsole
+	}
+
+	output, err := console.ConsoleCommand(command)
+	*reply = output
+	return err
+}
+
 func (r *RPCServerDriver) Heartbeat(_ *struct{}, _ *struct{}) error {
 	r.HeartbeatCh <- true
 	return nil
@@ -6,6 +6,7 @@ import (
 	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/mcnutils"
 	"github.com/docker/machine/libmachine/ssh"
+	"golang.org/x/net/context"
 )
 
 func GetSSHClientFromDriver(d Driver) (ssh.Client, error) {
@@ -42,6 +43,28 @@ func RunSSHCommandFromDriver(d Driver, command string) (string, error) {
 	log.Debugf("About to run SSH command:\n%s", command)
 
 	output, err := client.Output(command)
+	return sshCommandResult(command, output, err)
+}
+
+// RunSSHCommandFromDriverContext is like RunSSHCommandFromDriver but kills
+// the command if ctx is done before it completes.
+func RunSSHCommandFromDriverContext(ctx context.Context, d Driver, command string) (string, error) {
+	client, err := GetSSHClientFromDriver(d)
+	if err != nil {
+		return "", err
+	}
+
+	log.Debugf("About to run SSH command:\n%s", command)
+
+	output, err := client.OutputContext(ctx, command)
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	return sshCommandResult(command, output, err)
+}
+
+func sshCommandResult(command, output string, err error) (string, error) {
 	log.Debugf("SSH cmd err, output: %v: %s", err, output)
 	if err != nil {
 		return "", fmt.Errorf(`Something went wrong running an SSH command!
@@ -14,4 +14,231 @@ type Options struct {
 	TLSVerify        bool `json:"TlsVerify"`
 	RegistryMirror   []string
 	InstallURL       string
+	// InstallURLSHA256 is the expected checksum of the install script; the
+	// script is checked before it runs when it is set.
+	InstallURLSHA256 string
+	// InstallStrategy is how docker is installed: "script" runs InstallURL
+	// on the host and "docker-official" installs docker-ce from
+	// download.docker.com on Debian based hosts.
+	InstallStrategy string
+	// NoNewPrivileges keeps the processes of every container from gaining
+	// privileges, through setuid binaries for instance.
+	NoNewPrivileges bool
+	// RegistryCache makes the first machine provisioned run a pull-through
+	// cache of Docker Hub, which the following ones use as their registry
+	// mirror, through the store the machines share.
+	RegistryCache bool
+	// DisableLegacyRegistry stops the daemon from falling back to v1
+	// registries. It is left out on daemons which no longer have the
+	// option, from 19.03 on.
+	DisableLegacyRegistry bool
+	// EnableMemoryCgroup turns on the memory cgroup on the kernel command
+	// line of Raspberry Pi hosts; it takes effect after a reboot.
+	EnableMemoryCgroup bool
+	// ShutdownTimeout is how many seconds the daemon waits for containers
+	// to stop when it shuts down. The daemon default is kept when zero.
+	ShutdownTimeout int
+	// DefaultStopTimeout is rejected: the daemon has no such setting, the
+	// stop timeout can only be set per container.
+	DefaultStopTimeout int
+	// EnableNTP installs chrony and steps the clock before provisioning, for
+	// hosts without a hardware clock.
+	EnableNTP bool
+	// PullTimeout is rejected: the daemon has no pull timeout, lowering
+	// MaxConcurrentDownloads is the supported way to help slow links.
+	PullTimeout int
+	// MaxConcurrentDownloads is how many layers the daemon pulls at once.
+	// The daemon default is kept when zero.
+	MaxConcurrentDownloads int
+	// MaxDownloadAttempts is how often the daemon tries each image layer
+	// before giving up on a pull, set in daemon.json.
+	MaxDownloadAttempts int
+	// DataDisk is a block device, like /dev/sdb, formatted with
+	// DataDiskFilesystem, ext4 or xfs, and mounted on the docker data
+	// root. It is only formatted when it has no filesystem yet.
+	DataDisk           string
+	DataDiskFilesystem string
+	// DefaultShmSize, like 64M, is the /dev/shm size of the containers.
+	DefaultShmSize string
+	// JournalMaxUse, like 100M, caps the disk space of the systemd journal.
+	JournalMaxUse string
+	// ContainerLogRotateSize, like 10M, has the json-file logs of the
+	// containers rotated by logrotate once they reach the size.
+	ContainerLogRotateSize string
+	// ProvisionTimeout bounds a whole Provision run, in seconds; zero means
+	// no limit.
+	ProvisionTimeout int
+	// ContainerdSnapshotter switches the daemon to the containerd image
+	// store, which is only configurable in daemon.json.
+	ContainerdSnapshotter bool
+	// KubernetesReady sets up the kernel modules, sysctls and daemon
+	// settings kubeadm checks for. It needs a systemd host.
+	KubernetesReady bool
+	// StrictAptVerify makes apt fail on repositories or packages whose
+	// signature can't be verified.
+	StrictAptVerify bool
+	// DisableTCP keeps the daemon off the network: it only listens on its
+	// unix socket, reachable over SSH, and no TLS certs are set up.
+	DisableTCP bool
+	// DefaultNetworkOpts are key=value bridge driver options applied to
+	// every network created without them.
+	DefaultNetworkOpts []string
+	// AptProxy is the proxy apt uses on Debian based hosts, independent of
+	// the proxy given to the daemon.
+	AptProxy string
+	// AptParallelDownloads is the apt HTTP pipeline depth, between 1 and
+	// 16. The apt defaults are kept when zero.
+	AptParallelDownloads int
+	// AptMirrors are the mirrors apt tries in order, the first one being
+	// the mirror already in /etc/apt/sources.list.
+	AptMirrors []string
+	// CleanAptCache removes the downloaded packages from the apt cache
+	// after every install on Debian based hosts. It is set for new hosts,
+	// and has no effect on hosts without apt.
+	CleanAptCache bool
+	// AptLockTimeout is how many seconds apt waits for another process to
+	// release the dpkg lock. Zero waits 120 seconds, a negative value not
+	// at all.
+	AptLockTimeout int
+	// Timezone is an IANA zone name, like Europe/Berlin, the host clock is
+	// set to. The host default is kept when empty.
+	Timezone string
+	// BuilderGC turns on the BuildKit build cache garbage collection, so the
+	// cache doesn't fill the disk.
+	BuilderGC bool
+	// BuilderGCKeepStorage is the build cache size garbage collection keeps,
+	// like 10GB. The daemon default is used when empty.
+	BuilderGCKeepStorage string
+	// BatchPackageInstall installs the packages of a provisioning step in
+	// one apt transaction. Installing them one by one is slower, but tells
+	// exactly which package failed.
+	BatchPackageInstall bool
+	// CheckRegistryMirrors leaves the registry mirrors the host can't reach
+	// out of the daemon configuration.
+	CheckRegistryMirrors bool
+	// Pidfile and ExecRoot move the daemon pid file and its runtime state
+	// directory, for images with non-standard runtime directories. Both
+	// must be absolute paths.
+	Pidfile  string
+	ExecRoot string
+	// DockerGroupUser is added to the docker group, which owns the daemon
+	// socket, giving the user access to docker without sudo.
+	DockerGroupUser string
+	// RestartPolicy is the systemd Restart= policy of the docker service,
+	// like on-failure, with RestartSec seconds between restarts. The unit
+	// defaults are kept when it is empty.
+	RestartPolicy string
+	RestartSec    int
+	// OOMScoreAdjust, between -1000 and 1000, makes the kernel less likely
+	// to kill the daemon when the host runs out of memory.
+	OOMScoreAdjust int
+	// CPURTRuntime and CPURTPeriod, in microseconds, are the realtime
+	// scheduler budget of the daemon's parent cgroup, which containers
+	// running realtime tasks on RT kernels draw from. Set in daemon.json.
+	CPURTRuntime int
+	CPURTPeriod  int
+	// StopContainersOnReconfigure has the running containers stopped
+	// gracefully before a reconfiguration restarts the daemon, and started
+	// again afterwards.
+	StopContainersOnReconfigure bool
+	// ExportConfig keeps a local copy of the daemon configuration uploaded to
+	// the host, in the machine directory, for review or version control.
+	ExportConfig bool
+	// Sysctls are host kernel parameters, like net.core.somaxconn, set on
+	// provisioning and on every boot.
+	Sysctls map[string]string
+	// HostDNS makes the containers resolve through the upstream nameservers
+	// of the host, rather than the public servers Docker falls back to when
+	// the host only lists a local resolver. Useful with split-horizon DNS.
+	HostDNS bool
+	// FixedCIDRv6 is the IPv6 subnet of the default bridge, it needs Ipv6.
+	FixedCIDRv6 string
+	// SkipCloudInitWait starts provisioning without waiting for cloud-init
+	// to finish, CloudInitTimeout bounds the wait in seconds, 600 when zero.
+	SkipCloudInitWait bool
+	CloudInitTimeout  int
+	// RegistryCACerts maps private registries, like registry.local:5000, to
+	// the local file of the CA certificate their TLS certificate is signed
+	// with.
+	RegistryCACerts map[string]string
+	// SystemCACerts are local files of CA certificates added to the host
+	// trust store, like the CA of a proxy intercepting TLS, so that apt
+	// and the daemon trust them.
+	SystemCACerts []string
+	// ValidateDaemonConfig has dockerd validate daemon.json before it is
+	// put in place.
+	ValidateDaemonConfig bool
+	// BridgeName is a bridge created beforehand the default network uses
+	// instead of docker0, or none to not set up the default bridge.
+	BridgeName string
+	// InitBinary is the init run as PID 1 of containers started with
+	// --init, like tini. DefaultInit runs it for every container.
+	InitBinary  string
+	DefaultInit bool
+	// AllowAllInsecureRegistries lets the daemon talk plain HTTP to any
+	// registry. Only meant for isolated lab networks.
+	AllowAllInsecureRegistries bool
+	// WriteMotd replaces /etc/motd with a banner saying the machine is
+	// managed by docker-machine, with the Docker version and the time it
+	// was provisioned at.
+	WriteMotd bool
+	// PreloadImages are pulled at the end of provisioning, so the first
+	// containers start without waiting. Absolute paths of .tar, .tar.gz or
+	// .tgz archives already on the host are loaded instead.
+	PreloadImages []string
+	// InstallComposePlugin installs the Docker Compose CLI plugin,
+	// ComposePluginVersion or else the latest release.
+	InstallComposePlugin bool
+	ComposePluginVersion string
+	// SocketAliases are extra paths linked to the docker socket, for tools
+	// expecting it somewhere else. They need a systemd host.
+	SocketAliases []string
+	// Slice is an existing systemd slice, like system-docker.slice, the
+	// daemon and containerd are run in. It can't be combined with
+	// ResourceSlice, which sets up a slice of its own.
+	Slice string
+	// ResourceSlice caps the daemon and its containers together on
+	// systemd hosts. No slice is set up when it is empty.
+	ResourceSlice ResourceSlice
+	// ServiceLimits override the process limits of the docker unit on
+	// systemd hosts. The unit defaults are kept for empty values.
+	ServiceLimits ServiceLimits
+	// EnableMultiarch installs qemu-user-static and registers its binfmt
+	// handlers, so the host runs images built for other architectures.
+	EnableMultiarch bool
+	// BuildDNS and BuildDNSSearch are the nameservers and search domains
+	// of the RUN steps of BuildKit builds, written to buildkitd.toml, when
+	// builds need another resolver than the containers.
+	BuildDNS       []string
+	BuildDNSSearch []string
+	// HardenSSH installs fail2ban and turns off root and password SSH
+	// logins, for hosts exposed to the internet.
+	HardenSSH bool
+	// VsockAddress, like vsock://any:2376, serves the Docker API over vsock
+	// to the hypervisor host, on VMs which have a vsock device.
+	VsockAddress string
+	// ServiceName is the service the daemon runs under on hosts where it
+	// isn't "docker", like docker-ce. On systemd hosts the unit of that
+	// name is the one written.
+	ServiceName string
+	// ConfigDir is where daemon.json is kept instead of /etc/docker. It is
+	// set by provisioning on hosts whose root filesystem is read-only, and
+	// the daemon is pointed at it with --config-file.
+	ConfigDir string
+}
+
+// ServiceLimits holds the LimitNOFILE, LimitNPROC and LimitCORE settings of
+// the docker unit: a number, soft:hard numbers, or infinity.
+type ServiceLimits struct {
+	NOFILE string
+	NPROC  string
+	CORE   string
+}
+
+// ResourceSlice holds the limits of the systemd slice docker runs in.
+type ResourceSlice struct {
+	// CPUQuota is a percentage of one CPU, like 200% for two cores.
+	CPUQuota string
+	// MemoryMax is a size like 512M.
+	MemoryMax string
 }
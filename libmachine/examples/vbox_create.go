@@ -8,6 +8,7 @@ import (
 	"github.com/docker/machine/drivers/virtualbox"
 	"github.com/docker/machine/libmachine"
 	"github.com/docker/machine/libmachine/log"
+	"golang.org/x/net/context"
 )
 
 func main() {
@@ -39,7 +40,7 @@ func main() {
 
 	h.HostOptions.EngineOptions.StorageDriver = "overlay"
 
-	if err := client.Create(h); err != nil {
+	if err := client.Create(context.Background(), h); err != nil {
 		log.Fatal(err)
 	}
 
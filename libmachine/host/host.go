@@ -18,6 +18,7 @@ import (
 	"github.com/docker/machine/libmachine/ssh"
 	"github.com/docker/machine/libmachine/state"
 	"github.com/docker/machine/libmachine/swarm"
+	"golang.org/x/net/context"
 )
 
 var (
@@ -33,6 +34,9 @@ type Host struct {
 	HostOptions   *Options
 	Name          string
 	RawDriver     []byte `json:"-"`
+	// SharedStores are shared with the other machines of the store, they
+	// are handed to the provisioner.
+	SharedStores provision.SharedStores `json:"-"`
 }
 
 type Options struct {
@@ -150,13 +154,35 @@ func (h *Host) Upgrade() error {
 	}
 
 	log.Info("Upgrading docker...")
-	if err := provisioner.Package("docker", pkgaction.Upgrade); err != nil {
+	if err := provisioner.Package(context.Background(), "docker", pkgaction.Upgrade); err != nil {
 		crashreport.Send(err, "provisioner.Package", h.Driver.DriverName(), "Upgrade")
 		return err
 	}
 
 	log.Info("Restarting docker...")
-	return provisioner.Service("docker", serviceaction.Restart)
+	return provisioner.Service(context.Background(), "docker", serviceaction.Restart)
+}
+
+// UpdateProxy replaces the proxy the daemon uses, see provision.UpdateProxy.
+// The engine options are updated with the new environment, the caller saves
+// the host.
+func (h *Host) UpdateProxy(ctx context.Context, httpProxy, httpsProxy, noProxy string) error {
+	provisioner, err := provision.DetectProvisioner(h.Driver)
+	if err != nil {
+		return err
+	}
+
+	provisioner.SetAuthOptions(*h.HostOptions.AuthOptions)
+	provisioner.SetEngineOptions(*h.HostOptions.EngineOptions)
+
+	engineOptions, err := provision.UpdateProxy(ctx, provisioner, httpProxy, httpsProxy, noProxy)
+	if err != nil {
+		return err
+	}
+
+	*h.HostOptions.EngineOptions = engineOptions
+
+	return nil
 }
 
 func (h *Host) URL() (string, error) {
@@ -175,15 +201,19 @@ func (h *Host) ConfigureAuth() error {
 	if err != nil {
 		return err
 	}
+	provision.SetSharedStores(provisioner, h.SharedStores)
 
 	// TODO: This is kind of a hack (or is it?  I'm not really sure until
 	// we have more clearly defined outlook on what the responsibilities
 	// and modularity of the provisioners should be).
 	//
 	// Call provision to re-provision the certs properly.
-	if err := provisioner.Provision(swarm.Options{}, *h.HostOptions.AuthOptions, *h.HostOptions.EngineOptions); err != nil {
+	if err := provisioner.Provision(context.Background(), swarm.Options{}, *h.HostOptions.AuthOptions, *h.HostOptions.EngineOptions); err != nil {
 		return err
 	}
 
+	// the caller saves the host
+	provision.RecordRedirectedPaths(provisioner, h.HostOptions.AuthOptions, h.HostOptions.EngineOptions)
+
 	return nil
 }
@@ -19,13 +19,14 @@ import (
 	"github.com/docker/machine/libmachine/state"
 	"github.com/docker/machine/libmachine/swarm"
 	"github.com/docker/machine/libmachine/version"
+	"golang.org/x/net/context"
 )
 
 type API interface {
 	persist.Store
 	persist.PluginDriverFactory
 	NewHost(drivers.Driver) (*host.Host, error)
-	Create(h *host.Host) error
+	Create(ctx context.Context, h *host.Host) error
 }
 
 type Client struct {
@@ -33,14 +34,22 @@ type Client struct {
 	IsDebug        bool
 	SSHClientType  ssh.ClientType
 	GithubAPIToken string
+	// SharedStores are shared by the machines of the store, like their
+	// registry cache and swarm.
+	SharedStores provision.SharedStores
 }
 
 func NewClient(storePath string) *Client {
 	certsDir := filepath.Join(storePath, ".docker", "machine", "certs")
+
 	return &Client{
 		IsDebug:       false,
 		SSHClientType: ssh.External,
 		PluginStore:   persist.NewPluginStore(storePath, certsDir, certsDir),
+		SharedStores: provision.SharedStores{
+			RegistryCache: provision.NewFileRegistryCacheStore(filepath.Join(storePath, "registry-cache")),
+			SwarmTokens:   provision.NewFileSwarmTokenStore(filepath.Join(storePath, "swarm-cluster.json")),
+		},
 	}
 }
 
@@ -58,9 +67,11 @@ func (api *Client) NewHost(driver drivers.Driver) (*host.Host, error) {
 			ServerKeyPath:    filepath.Join(api.GetMachinesDir(), "server-key.pem"),
 		},
 		EngineOptions: &engine.Options{
-			InstallURL:    "https://get.docker.com",
-			StorageDriver: "aufs",
-			TLSVerify:     true,
+			InstallURL:          "https://get.docker.com",
+			StorageDriver:       "aufs",
+			TLSVerify:           true,
+			BatchPackageInstall: true,
+			CleanAptCache:       true,
 		},
 		SwarmOptions: &swarm.Options{
 			Host:     "tcp://0.0.0.0:3376",
@@ -75,12 +86,37 @@ func (api *Client) NewHost(driver drivers.Driver) (*host.Host, error) {
 		Driver:        driver,
 		DriverName:    driver.DriverName(),
 		HostOptions:   hostOptions,
+		SharedStores:  api.SharedStores,
 	}, nil
 }
 
+// Load loads a host by name, handing it the shared stores.
+func (api *Client) Load(name string) (*host.Host, error) {
+	h, err := api.PluginStore.Load(name)
+	if err != nil {
+		return nil, err
+	}
+
+	h.SharedStores = api.SharedStores
+
+	return h, nil
+}
+
+// Remove removes a machine from the store. When it ran the registry cache
+// of the store, the election is released for the next machine provisioned.
+func (api *Client) Remove(name string) error {
+	if api.SharedStores.RegistryCache != nil {
+		if err := api.SharedStores.RegistryCache.Release(name); err != nil {
+			log.Warnf("Error releasing the registry cache of %s: %s", name, err)
+		}
+	}
+
+	return api.PluginStore.Remove(name)
+}
+
 // Create is the wrapper method which covers all of the boilerplate around
 // actually creating, provisioning, and persisting an instance in the store.
-func (api *Client) Create(h *host.Host) error {
+func (api *Client) Create(ctx context.Context, h *host.Host) error {
 	if err := cert.BootstrapCertificates(h.HostOptions.AuthOptions); err != nil {
 		return fmt.Errorf("Error generating certificates: %s", err)
 	}
@@ -97,7 +133,7 @@ func (api *Client) Create(h *host.Host) error {
 
 	log.Info("Creating machine...")
 
-	if err := api.performCreate(h); err != nil {
+	if err := api.performCreate(ctx, h); err != nil {
 		sendCrashReport(err, api, h)
 		return err
 	}
@@ -107,7 +143,7 @@ func (api *Client) Create(h *host.Host) error {
 	return nil
 }
 
-func (api *Client) performCreate(h *host.Host) error {
+func (api *Client) performCreate(ctx context.Context, h *host.Host) error {
 
 	if err := h.Driver.Create(); err != nil {
 		return fmt.Errorf("Error in driver during machine creation: %s", err)
@@ -125,8 +161,14 @@ func (api *Client) performCreate(h *host.Host) error {
 		}
 
 		log.Info("Machine is running, waiting for SSH to be available...")
-		if err := drivers.WaitForSSH(h.Driver); err != nil {
-			return fmt.Errorf("Error waiting for SSH: %s", err)
+		if sshErr := drivers.WaitForSSH(h.Driver); sshErr != nil {
+			// plugin drivers always look like they have a console, the
+			// plugin tells when the actual driver has none
+			if err := provision.BootstrapSSH(ctx, h.Driver); err == provision.ErrNoConsole {
+				return fmt.Errorf("Error waiting for SSH: %s", sshErr)
+			} else if err != nil {
+				return fmt.Errorf("Error bootstrapping SSH over the console: %s", err)
+			}
 		}
 
 		log.Info("Detecting operating system of created instance...")
@@ -134,12 +176,23 @@ func (api *Client) performCreate(h *host.Host) error {
 		if err != nil {
 			return fmt.Errorf("Error detecting OS: %s", err)
 		}
+		provision.SetSharedStores(provisioner, api.SharedStores)
 
 		log.Infof("Provisioning with %s...", provisioner.String())
-		if err := provisioner.Provision(*h.HostOptions.SwarmOptions, *h.HostOptions.AuthOptions, *h.HostOptions.EngineOptions); err != nil {
+		if err := provisioner.Provision(ctx, *h.HostOptions.SwarmOptions, *h.HostOptions.AuthOptions, *h.HostOptions.EngineOptions); err != nil {
 			return fmt.Errorf("Error running provisioning: %s", err)
 		}
 
+		provision.RecordRedirectedPaths(provisioner, h.HostOptions.AuthOptions, h.HostOptions.EngineOptions)
+		if err := api.Save(h); err != nil {
+			return fmt.Errorf("Error saving host to store after provisioning: %s", err)
+		}
+
+		if h.HostOptions.EngineOptions.DisableTCP {
+			log.Info("Docker is up and running on its unix socket, use SSH to reach it.")
+			return nil
+		}
+
 		// We should check the connection to docker here
 		log.Info("Checking connection to Docker...")
 		if _, _, err = check.DefaultConnChecker.Check(h, false); err != nil {
@@ -6,6 +6,7 @@ import (
 	"github.com/docker/machine/libmachine/host"
 	"github.com/docker/machine/libmachine/mcnerror"
 	"github.com/docker/machine/libmachine/state"
+	"golang.org/x/net/context"
 )
 
 type FakeAPI struct {
@@ -20,7 +21,7 @@ func (api *FakeAPI) NewHost(driver drivers.Driver) (*host.Host, error) {
 	return nil, nil
 }
 
-func (api *FakeAPI) Create(h *host.Host) error {
+func (api *FakeAPI) Create(ctx context.Context, h *host.Host) error {
 	return nil
 }
 
@@ -0,0 +1,267 @@
+package provision
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/provision/pkgaction"
+	"golang.org/x/net/context"
+)
+
+const (
+	aptProxyConfPath = "/etc/apt/apt.conf.d/01proxy"
+
+	aptProxyConfTmpl = `Acquire::http::Proxy "%s";
+Acquire::https::Proxy "%s";
+`
+
+	aptDownloadsConfPath = "/etc/apt/apt.conf.d/99parallel-downloads"
+
+	aptDownloadsConfTmpl = `Acquire::Queue-Mode "host";
+Acquire::http::Pipeline-Depth "%d";
+`
+
+	maxAptParallelDownloads = 16
+
+	aptMirrorListPath = "/etc/apt/mirrors/docker-machine.list"
+
+	// defaultAptLockTimeout is how long apt waits for the dpkg lock, held
+	// by cloud-init or unattended-upgrades on a freshly booted host.
+	defaultAptLockTimeout = 120
+)
+
+// apt update only warns, with W: or E: lines, about repositories whose
+// signature or Release file can't be checked and keeps their old metadata
+var reAptUnverified = regexp.MustCompile(`(?m)^[WE]: .*(GPG error|NO_PUBKEY|is not signed|[Ss]ignature|Release)`)
+
+// apt refuses to run after an interrupted dpkg run until it is repaired
+var reDpkgInterrupted = regexp.MustCompile(`dpkg was interrupted`)
+
+// validateAptProxy checks the proxy is an http(s) URL which can be quoted
+// safely in the apt configuration.
+func validateAptProxy(proxy string) error {
+	u, err := url.Parse(proxy)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.ContainsAny(proxy, `'"`) {
+		return fmt.Errorf("Invalid apt proxy %q, expected a URL like http://proxy:3142", proxy)
+	}
+
+	return nil
+}
+
+// configureAptProxy points apt at its own proxy, which may differ from the
+// one the docker daemon uses.
+func configureAptProxy(ctx context.Context, p SSHCommander, proxy string) error {
+	if err := validateAptProxy(proxy); err != nil {
+		return err
+	}
+
+	if _, err := p.SSHCommand(ctx, fmt.Sprintf("printf '%%s' '%s' | sudo tee %s", fmt.Sprintf(aptProxyConfTmpl, proxy, proxy), aptProxyConfPath)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// configureAptDownloads lets apt fetch from every mirror at once and
+// pipeline up to n requests per connection, which pays off on high latency
+// links.
+func configureAptDownloads(ctx context.Context, p SSHCommander, n int) error {
+	if n < 1 || n > maxAptParallelDownloads {
+		return fmt.Errorf("Invalid number of parallel apt downloads %d, expected a value between 1 and %d", n, maxAptParallelDownloads)
+	}
+
+	if _, err := p.SSHCommand(ctx, fmt.Sprintf("printf '%%s' '%s' | sudo tee %s", fmt.Sprintf(aptDownloadsConfTmpl, n), aptDownloadsConfPath)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// aptMirrorList renders the mirror list for apt's mirror+file method, one
+// URL per line in the order they are tried.
+func aptMirrorList(mirrors []string) (string, error) {
+	if len(mirrors) == 0 {
+		return "", fmt.Errorf("Invalid apt mirrors, expected at least one mirror")
+	}
+
+	list := ""
+	for _, mirror := range mirrors {
+		u, err := url.Parse(mirror)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.ContainsAny(mirror, " '\"|") {
+			return "", fmt.Errorf("Invalid apt mirror %q, expected a URL like http://raspbian.raspberrypi.org/raspbian", mirror)
+		}
+		list += strings.TrimSuffix(mirror, "/") + "\n"
+	}
+
+	return list, nil
+}
+
+// configureAptMirrors lets apt fall back to the other mirrors when the
+// first one is down. The sources using the first mirror are switched to the
+// mirror list, which needs apt 1.6 or newer.
+func configureAptMirrors(ctx context.Context, p SSHCommander, mirrors []string) error {
+	list, err := aptMirrorList(mirrors)
+	if err != nil {
+		return err
+	}
+
+	primary := strings.Replace(strings.TrimSuffix(mirrors[0], "/"), ".", "\\.", -1)
+
+	commands := []string{
+		fmt.Sprintf("sudo mkdir -p %s", path.Dir(aptMirrorListPath)),
+		fmt.Sprintf("printf '%%s' '%s' | sudo tee %s", list, aptMirrorListPath),
+		fmt.Sprintf("sudo sed -i 's| %s/\\? | mirror+file:%s |' /etc/apt/sources.list", primary, aptMirrorListPath),
+	}
+
+	for _, cmd := range commands {
+		if _, err := p.SSHCommand(ctx, cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// aptLockTimeout maps the AptLockTimeout engine option to seconds: zero
+// picks the default wait, a negative value makes apt fail right away.
+func aptLockTimeout(timeout int) int {
+	if timeout == 0 {
+		return defaultAptLockTimeout
+	}
+	if timeout < 0 {
+		return 0
+	}
+
+	return timeout
+}
+
+func aptPackageName(name string) string {
+	switch name {
+	case "docker":
+		return "docker-engine"
+	}
+
+	return name
+}
+
+// aptPackages runs the package action on all the named packages, updating
+// the package metadata at most once. The packages go in a single apt-get
+// transaction with the BatchPackageInstall engine option, one by one
+// otherwise. With the StrictAptVerify engine option, unverifiable
+// repositories are an error rather than a warning. apt-get install refuses
+// unauthenticated packages by itself.
+func aptPackages(ctx context.Context, p Provisioner, names []string, action pkgaction.PackageAction) error {
+	var (
+		packageAction string
+		installOpts   string
+	)
+
+	if lockTimeout := aptLockTimeout(p.GetEngineOptions().AptLockTimeout); lockTimeout > 0 {
+		installOpts = fmt.Sprintf("-o DPkg::Lock::Timeout=%d", lockTimeout)
+	}
+
+	strict := p.GetEngineOptions().StrictAptVerify
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	updateMetadata := true
+
+	switch action {
+	case pkgaction.Install, pkgaction.Upgrade:
+		packageAction = "install"
+	case pkgaction.Remove, pkgaction.Purge:
+		packageAction = action.String()
+		updateMetadata = false
+	}
+
+	packages := []string{}
+	for _, name := range names {
+		packages = append(packages, aptPackageName(name))
+	}
+
+	if updateMetadata {
+		out, err := p.SSHCommand(ctx, "sudo apt-get update")
+		if err != nil {
+			return err
+		}
+
+		if strict && reAptUnverified.MatchString(out) {
+			return fmt.Errorf("Unable to verify the signature of an apt repository:\n%s", out)
+		}
+	}
+
+	for _, name := range packages {
+		// handle the new docker-engine package; we can probably remove this
+		// after we have a few versions
+		if action == pkgaction.Upgrade && name == "docker-engine" {
+			// run the force remove on the existing lxc-docker package
+			// and remove the existing apt source list
+
+			commands := []string{
+				"rm /etc/apt/sources.list.d/docker.list || true",
+				"apt-get remove -y lxc-docker || true",
+			}
+
+			for _, cmd := range commands {
+				command := fmt.Sprintf("sudo DEBIAN_FRONTEND=noninteractive %s", cmd)
+				if _, err := p.SSHCommand(ctx, command); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	log.Debugf("package: action=%s names=%s", action.String(), packages)
+
+	ctx = withCommandTimeout(ctx, installCommandTimeout)
+
+	if p.GetEngineOptions().BatchPackageInstall || len(packages) == 1 {
+		if err := runAptCommand(ctx, p, fmt.Sprintf("DEBIAN_FRONTEND=noninteractive sudo -E apt-get %s -y %s %s", packageAction, installOpts, strings.Join(packages, " "))); err != nil {
+			return err
+		}
+	} else {
+		for _, name := range packages {
+			if err := runAptCommand(ctx, p, fmt.Sprintf("DEBIAN_FRONTEND=noninteractive sudo -E apt-get %s -y %s %s", packageAction, installOpts, name)); err != nil {
+				return fmt.Errorf("Unable to %s package %s: %s", packageAction, name, err)
+			}
+		}
+	}
+
+	// the downloaded .deb files are of no use once installed, and take
+	// space on hosts with small disks or SD cards
+	if updateMetadata && p.GetEngineOptions().CleanAptCache {
+		return cleanAptCache(ctx, p)
+	}
+
+	return nil
+}
+
+// cleanAptCache removes the packages apt downloaded, once installed.
+func cleanAptCache(ctx context.Context, p SSHCommander) error {
+	_, err := p.SSHCommand(ctx, "sudo apt-get clean")
+	return err
+}
+
+// runAptCommand runs an apt-get command. When a previous run was
+// interrupted, dpkg refuses to do anything until its pending packages are
+// configured, so that is done before retrying once.
+func runAptCommand(ctx context.Context, p SSHCommander, command string) error {
+	_, err := p.SSHCommand(ctx, command)
+	if err == nil || !reDpkgInterrupted.MatchString(err.Error()) {
+		return err
+	}
+
+	log.Warn("dpkg was interrupted by an earlier run, configuring the pending packages before retrying...")
+	if _, err := p.SSHCommand(ctx, "sudo DEBIAN_FRONTEND=noninteractive dpkg --configure -a"); err != nil {
+		return err
+	}
+
+	_, err = p.SSHCommand(ctx, command)
+	return err
+}
@@ -0,0 +1,395 @@
+package provision
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/provision/pkgaction"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func TestAptPackagesBatchInstall(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+	p := newFakeDebianProvisioner(commander)
+	p.EngineOptions.BatchPackageInstall = true
+
+	if err := aptPackages(context.Background(), p, []string{"curl", "docker", "git"}, pkgaction.Install); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo apt-get update",
+		"DEBIAN_FRONTEND=noninteractive sudo -E apt-get install -y -o DPkg::Lock::Timeout=120 curl docker-engine git",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestAptPackagesRemove(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := aptPackages(context.Background(), newFakeDebianProvisioner(commander), []string{"docker"}, pkgaction.Remove); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"DEBIAN_FRONTEND=noninteractive sudo -E apt-get remove -y -o DPkg::Lock::Timeout=120 docker-engine",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestAptPackagesNone(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := aptPackages(context.Background(), newFakeDebianProvisioner(commander), []string{}, pkgaction.Install); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(commander.Commands) != 0 {
+		t.Fatalf("expected no commands; received %v", commander.Commands)
+	}
+}
+
+const aptUpdateGPGError = `Hit:1 http://deb.debian.org/debian stretch InRelease
+W: GPG error: https://example.com/repo stable InRelease: The following signatures couldn't be verified because the public key is not available: NO_PUBKEY 8D81803C0EBFCD88
+`
+
+func TestAptPackagesUnverifiedRepoLenient(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo apt-get update": aptUpdateGPGError,
+		},
+	}
+
+	if err := aptPackages(context.Background(), newFakeDebianProvisioner(commander), []string{"curl"}, pkgaction.Install); err != nil {
+		t.Fatalf("expected the GPG warning to be ignored; received %s", err)
+	}
+}
+
+func TestAptPackagesUnverifiedRepoStrict(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo apt-get update": aptUpdateGPGError,
+		},
+	}
+	p := newFakeDebianProvisioner(commander)
+	p.EngineOptions.StrictAptVerify = true
+
+	if err := aptPackages(context.Background(), p, []string{"curl"}, pkgaction.Install); err == nil {
+		t.Fatal("expected an error for an unverified repository")
+	}
+
+	if len(commander.Commands) != 1 {
+		t.Fatalf("expected nothing to be installed; received %v", commander.Commands)
+	}
+}
+
+func TestAptUnverified(t *testing.T) {
+	for out, unverified := range map[string]bool{
+		aptUpdateGPGError: true,
+		"E: The repository 'https://example.com/repo stable Release' does not have a Release file.\n":    true,
+		"W: An error occurred during the signature verification. The repository is not updated.\n":       true,
+		"Hit:1 http://deb.debian.org/debian stretch InRelease\nReading package lists...\n":               false,
+		"W: Target Packages (main/binary-amd64/Packages) is configured multiple times in sources.list\n": false,
+	} {
+		if reAptUnverified.MatchString(out) != unverified {
+			t.Errorf("expected %q to be unverified: %t", out, unverified)
+		}
+	}
+}
+
+func TestAptPackagesStrict(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+	p := newFakeDebianProvisioner(commander)
+	p.EngineOptions.StrictAptVerify = true
+
+	if err := aptPackages(context.Background(), p, []string{"curl"}, pkgaction.Install); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo apt-get update",
+		"DEBIAN_FRONTEND=noninteractive sudo -E apt-get install -y -o DPkg::Lock::Timeout=120 curl",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestConfigureAptProxy(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := configureAptProxy(context.Background(), commander, "http://proxy:3142"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"printf '%s' 'Acquire::http::Proxy \"http://proxy:3142\";\nAcquire::https::Proxy \"http://proxy:3142\";\n' | sudo tee /etc/apt/apt.conf.d/01proxy",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestConfigureAptProxyInvalid(t *testing.T) {
+	for _, proxy := range []string{"proxy:3142", "ftp://proxy", "http://", "http://proxy/'a'"} {
+		commander := &provisiontest.FakeSSHCommander{}
+
+		if err := configureAptProxy(context.Background(), commander, proxy); err == nil {
+			t.Fatalf("expected an error for apt proxy %q", proxy)
+		}
+
+		if len(commander.Commands) != 0 {
+			t.Fatalf("expected no commands for apt proxy %q; received %v", proxy, commander.Commands)
+		}
+	}
+}
+
+func TestConfigureAptDownloads(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := configureAptDownloads(context.Background(), commander, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"printf '%s' 'Acquire::Queue-Mode \"host\";\nAcquire::http::Pipeline-Depth \"4\";\n' | sudo tee /etc/apt/apt.conf.d/99parallel-downloads",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestConfigureAptDownloadsOutOfRange(t *testing.T) {
+	for _, n := range []int{-1, 0, 17} {
+		commander := &provisiontest.FakeSSHCommander{}
+
+		if err := configureAptDownloads(context.Background(), commander, n); err == nil {
+			t.Fatalf("expected an error for %d parallel downloads", n)
+		}
+
+		if len(commander.Commands) != 0 {
+			t.Fatalf("expected no commands for %d parallel downloads; received %v", n, commander.Commands)
+		}
+	}
+}
+
+func TestConfigureAptMirrors(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := configureAptMirrors(context.Background(), commander, []string{"http://raspbian.raspberrypi.org/raspbian/", "https://mirror.example.com/raspbian"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo mkdir -p /etc/apt/mirrors",
+		"printf '%s' 'http://raspbian.raspberrypi.org/raspbian\nhttps://mirror.example.com/raspbian\n' | sudo tee /etc/apt/mirrors/docker-machine.list",
+		"sudo sed -i 's| http://raspbian\\.raspberrypi\\.org/raspbian/\\? | mirror+file:/etc/apt/mirrors/docker-machine.list |' /etc/apt/sources.list",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestConfigureAptMirrorsInvalid(t *testing.T) {
+	for _, mirrors := range [][]string{
+		{},
+		{"raspbian.raspberrypi.org/raspbian"},
+		{"http://raspbian.raspberrypi.org/raspbian", "ftp://mirror.example.com/raspbian"},
+		{"http://mirror.example.com/it's"},
+	} {
+		commander := &provisiontest.FakeSSHCommander{}
+
+		if err := configureAptMirrors(context.Background(), commander, mirrors); err == nil {
+			t.Fatalf("expected an error for mirrors %v", mirrors)
+		}
+
+		if len(commander.Commands) != 0 {
+			t.Fatalf("expected no commands for mirrors %v; received %v", mirrors, commander.Commands)
+		}
+	}
+}
+
+func TestAptPackagesDpkgInterrupted(t *testing.T) {
+	install := "DEBIAN_FRONTEND=noninteractive sudo -E apt-get install -y -o DPkg::Lock::Timeout=120 curl"
+	commander := &provisiontest.FakeSSHCommander{
+		Errors: map[string]error{
+			install: errors.New("E: dpkg was interrupted, you must manually run 'sudo dpkg --configure -a' to correct the problem."),
+		},
+	}
+	recovered := &dpkgRecoveringCommander{commander}
+
+	if err := aptPackages(context.Background(), newFakeDebianProvisioner(recovered), []string{"curl"}, pkgaction.Install); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo apt-get update",
+		install,
+		"sudo DEBIAN_FRONTEND=noninteractive dpkg --configure -a",
+		install,
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestAptPackagesDpkgStillBroken(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Errors: map[string]error{
+			"DEBIAN_FRONTEND=noninteractive sudo -E apt-get install -y -o DPkg::Lock::Timeout=120 curl": errors.New("E: dpkg was interrupted, you must manually run 'sudo dpkg --configure -a' to correct the problem."),
+		},
+	}
+
+	if err := aptPackages(context.Background(), newFakeDebianProvisioner(commander), []string{"curl"}, pkgaction.Install); err == nil {
+		t.Fatal("expected an error when the retry fails too")
+	}
+
+	if len(commander.Commands) != 4 {
+		t.Fatalf("expected a single retry; received %v", commander.Commands)
+	}
+}
+
+func TestAptPackagesOtherErrorNotRetried(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Errors: map[string]error{
+			"DEBIAN_FRONTEND=noninteractive sudo -E apt-get install -y -o DPkg::Lock::Timeout=120 curl": errors.New("E: Unable to locate package curl"),
+		},
+	}
+
+	if err := aptPackages(context.Background(), newFakeDebianProvisioner(commander), []string{"curl"}, pkgaction.Install); err == nil {
+		t.Fatal("expected the install error")
+	}
+
+	if len(commander.Commands) != 2 {
+		t.Fatalf("expected no recovery attempt; received %v", commander.Commands)
+	}
+}
+
+// dpkgRecoveringCommander clears the registered errors once dpkg has been
+// reconfigured, like the host would.
+type dpkgRecoveringCommander struct {
+	*provisiontest.FakeSSHCommander
+}
+
+func (c *dpkgRecoveringCommander) SSHCommand(ctx context.Context, args string) (string, error) {
+	out, err := c.FakeSSHCommander.SSHCommand(ctx, args)
+	if args == "sudo DEBIAN_FRONTEND=noninteractive dpkg --configure -a" {
+		c.Errors = nil
+	}
+	return out, err
+}
+
+func TestAptPackagesIndividualInstall(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := aptPackages(context.Background(), newFakeDebianProvisioner(commander), []string{"curl", "docker", "git"}, pkgaction.Install); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo apt-get update",
+		"DEBIAN_FRONTEND=noninteractive sudo -E apt-get install -y -o DPkg::Lock::Timeout=120 curl",
+		"DEBIAN_FRONTEND=noninteractive sudo -E apt-get install -y -o DPkg::Lock::Timeout=120 docker-engine",
+		"DEBIAN_FRONTEND=noninteractive sudo -E apt-get install -y -o DPkg::Lock::Timeout=120 git",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestAptPackagesIndividualInstallFailure(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Errors: map[string]error{
+			"DEBIAN_FRONTEND=noninteractive sudo -E apt-get install -y -o DPkg::Lock::Timeout=120 docker-engine": errors.New("E: Unable to locate package docker-engine"),
+		},
+	}
+
+	err := aptPackages(context.Background(), newFakeDebianProvisioner(commander), []string{"curl", "docker", "git"}, pkgaction.Install)
+	if err == nil || !strings.Contains(err.Error(), "Unable to install package docker-engine") {
+		t.Fatalf("expected the failing package in the error; received %v", err)
+	}
+
+	if len(commander.Commands) != 3 {
+		t.Fatalf("expected the install to stop at the failing package; received %v", commander.Commands)
+	}
+}
+
+func TestAptPackagesLockTimeout(t *testing.T) {
+	for _, c := range []struct {
+		timeout  int
+		expected string
+	}{
+		{300, "DEBIAN_FRONTEND=noninteractive sudo -E apt-get install -y -o DPkg::Lock::Timeout=300 curl"},
+		{-1, "DEBIAN_FRONTEND=noninteractive sudo -E apt-get install -y  curl"},
+	} {
+		commander := &provisiontest.FakeSSHCommander{}
+		p := newFakeDebianProvisioner(commander)
+		p.EngineOptions.AptLockTimeout = c.timeout
+
+		if err := aptPackages(context.Background(), p, []string{"curl"}, pkgaction.Install); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []string{"sudo apt-get update", c.expected}
+		if !reflect.DeepEqual(commander.Commands, expected) {
+			t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+		}
+	}
+}
+
+func TestAptPackagesCleanCache(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+	p := newFakeDebianProvisioner(commander)
+	p.EngineOptions.CleanAptCache = true
+
+	if err := aptPackages(context.Background(), p, []string{"curl"}, pkgaction.Install); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo apt-get update",
+		"DEBIAN_FRONTEND=noninteractive sudo -E apt-get install -y -o DPkg::Lock::Timeout=120 curl",
+		"sudo apt-get clean",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestAptPackagesKeepCache(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := aptPackages(context.Background(), newFakeDebianProvisioner(commander), []string{"curl"}, pkgaction.Install); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cmd := range commander.Commands {
+		if cmd == "sudo apt-get clean" {
+			t.Fatalf("expected the apt cache to be kept; received %v", commander.Commands)
+		}
+	}
+}
+
+func TestAptPackagesRemoveCleanCache(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+	p := newFakeDebianProvisioner(commander)
+	p.EngineOptions.CleanAptCache = true
+
+	if err := aptPackages(context.Background(), p, []string{"docker"}, pkgaction.Remove); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"DEBIAN_FRONTEND=noninteractive sudo -E apt-get remove -y -o DPkg::Lock::Timeout=120 docker-engine",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
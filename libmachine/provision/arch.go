@@ -7,10 +7,10 @@ import (
 	"github.com/docker/machine/libmachine/drivers"
 	"github.com/docker/machine/libmachine/engine"
 	"github.com/docker/machine/libmachine/log"
-	"github.com/docker/machine/libmachine/mcnutils"
 	"github.com/docker/machine/libmachine/provision/pkgaction"
 	"github.com/docker/machine/libmachine/provision/serviceaction"
 	"github.com/docker/machine/libmachine/swarm"
+	"golang.org/x/net/context"
 )
 
 func init() {
@@ -37,7 +37,7 @@ func (provisioner *ArchProvisioner) CompatibleWithHost() bool {
 	return provisioner.OsReleaseInfo.ID == provisioner.OsReleaseID || provisioner.OsReleaseInfo.IDLike == provisioner.OsReleaseID
 }
 
-func (provisioner *ArchProvisioner) Package(name string, action pkgaction.PackageAction) error {
+func (provisioner *ArchProvisioner) Package(ctx context.Context, name string, action pkgaction.PackageAction) error {
 	var packageAction string
 
 	updateMetadata := true
@@ -45,7 +45,7 @@ func (provisioner *ArchProvisioner) Package(name string, action pkgaction.Packag
 	switch action {
 	case pkgaction.Install:
 		packageAction = "S"
-	case pkgaction.Remove:
+	case pkgaction.Remove, pkgaction.Purge:
 		packageAction = "R"
 		updateMetadata = false
 	case pkgaction.Upgrade:
@@ -68,17 +68,17 @@ func (provisioner *ArchProvisioner) Package(name string, action pkgaction.Packag
 
 	log.Debugf("package: action=%s name=%s", action.String(), name)
 
-	if _, err := provisioner.SSHCommand(command); err != nil {
+	if _, err := provisioner.SSHCommand(ctx, command); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (provisioner *ArchProvisioner) dockerDaemonResponding() bool {
+func (provisioner *ArchProvisioner) dockerDaemonResponding(ctx context.Context) bool {
 	log.Debug("checking docker daemon")
 
-	if out, err := provisioner.SSHCommand("sudo docker version"); err != nil {
+	if out, err := provisioner.SSHCommand(ctx, "sudo docker version"); err != nil {
 		log.Warnf("Error getting SSH command to check if the daemon is up: %s", err)
 		log.Debugf("'sudo docker version' output:\n%s", out)
 		return false
@@ -88,7 +88,14 @@ func (provisioner *ArchProvisioner) dockerDaemonResponding() bool {
 	return true
 }
 
-func (provisioner *ArchProvisioner) Provision(swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error {
+func (provisioner *ArchProvisioner) Provision(ctx context.Context, swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error {
+	ctx, cancel := provisionContext(ctx, engineOptions)
+	defer cancel()
+
+	if err := ValidateOptions(provisioner, swarmOptions, authOptions, engineOptions); err != nil {
+		return err
+	}
+
 	provisioner.SwarmOptions = swarmOptions
 	provisioner.AuthOptions = authOptions
 	provisioner.EngineOptions = engineOptions
@@ -98,43 +105,57 @@ func (provisioner *ArchProvisioner) Provision(swarmOptions swarm.Options, authOp
 		provisioner.EngineOptions.StorageDriver = "overlay"
 	}
 
+	// cloud-init may still be installing packages, so wait for it before
+	// the package manager is used at all
+	if !provisioner.EngineOptions.SkipCloudInitWait {
+		log.Debug("waiting for cloud-init")
+		if err := waitForCloudInit(ctx, provisioner, cloudInitTimeout(provisioner.EngineOptions.CloudInitTimeout)); err != nil {
+			return err
+		}
+	}
+
 	// HACK: since Arch does not come with sudo by default we install
 	log.Debug("Installing sudo")
-	if _, err := provisioner.SSHCommand("if ! type sudo; then pacman -Sy --noconfirm --noprogressbar sudo; fi"); err != nil {
+	if _, err := provisioner.SSHCommand(withCommandTimeout(ctx, installCommandTimeout), "if ! type sudo; then pacman -Sy --noconfirm --noprogressbar sudo; fi"); err != nil {
+		return err
+	}
+
+	log.Debug("checking for passwordless sudo")
+	if err := checkSudo(ctx, provisioner); err != nil {
 		return err
 	}
 
 	log.Debug("Setting hostname")
-	if err := provisioner.SetHostname(provisioner.Driver.GetMachineName()); err != nil {
+	if err := provisioner.SetHostname(ctx, provisioner.Driver.GetMachineName()); err != nil {
 		return err
 	}
 
 	log.Debug("Installing base packages")
 	for _, pkg := range provisioner.Packages {
-		if err := provisioner.Package(pkg, pkgaction.Install); err != nil {
+		if err := provisioner.Package(ctx, pkg, pkgaction.Install); err != nil {
 			return err
 		}
 	}
 
 	log.Debug("Installing docker")
-	if err := provisioner.Package("docker", pkgaction.Install); err != nil {
+	if err := provisioner.Package(ctx, "docker", pkgaction.Install); err != nil {
 		return err
 	}
 
 	log.Debug("Starting systemd docker service")
-	if err := provisioner.Service("docker", serviceaction.Start); err != nil {
+	if err := provisioner.Service(ctx, "docker", serviceaction.Start); err != nil {
 		return err
 	}
 
 	log.Debug("Waiting for docker daemon")
-	if err := mcnutils.WaitFor(provisioner.dockerDaemonResponding); err != nil {
+	if err := waitFor(ctx, provisioner.dockerDaemonResponding); err != nil {
 		return err
 	}
 
 	provisioner.AuthOptions = setRemoteAuthOptions(provisioner)
 
 	log.Debug("Configuring auth")
-	if err := ConfigureAuth(provisioner); err != nil {
+	if err := ConfigureAuth(ctx, provisioner); err != nil {
 		return err
 	}
 
@@ -145,7 +166,7 @@ func (provisioner *ArchProvisioner) Provision(swarmOptions swarm.Options, authOp
 
 	// enable in systemd
 	log.Debug("Enabling docker in systemd")
-	if err := provisioner.Service("docker", serviceaction.Enable); err != nil {
+	if err := provisioner.Service(ctx, "docker", serviceaction.Enable); err != nil {
 		return err
 	}
 
@@ -0,0 +1,29 @@
+package provision
+
+import (
+	"github.com/docker/machine/libmachine/provision/pkgaction"
+	"golang.org/x/net/context"
+)
+
+var multiarchPackages = []string{"qemu-user-static", "binfmt-support"}
+
+// binfmtCheckCommand fails unless a qemu handler got registered, which
+// doesn't happen on kernels built without binfmt_misc.
+const binfmtCheckCommand = "ls /proc/sys/fs/binfmt_misc | grep -q '^qemu-'"
+
+// enableMultiarch installs the static qemu emulators and registers them as
+// binfmt handlers. The packages register them with the fix-binary flag,
+// which lets containers use them without having qemu in their image.
+func enableMultiarch(ctx context.Context, p Provisioner) error {
+	if err := aptPackages(ctx, p, multiarchPackages, pkgaction.Install); err != nil {
+		return err
+	}
+
+	for _, cmd := range []string{"sudo update-binfmts --enable", binfmtCheckCommand} {
+		if _, err := p.SSHCommand(ctx, cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
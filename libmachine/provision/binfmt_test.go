@@ -0,0 +1,28 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func TestEnableMultiarch(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := enableMultiarch(context.Background(), newFakeDebianProvisioner(commander)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo apt-get update",
+		"DEBIAN_FRONTEND=noninteractive sudo -E apt-get install -y -o DPkg::Lock::Timeout=120 qemu-user-static",
+		"DEBIAN_FRONTEND=noninteractive sudo -E apt-get install -y -o DPkg::Lock::Timeout=120 binfmt-support",
+		"sudo update-binfmts --enable",
+		"ls /proc/sys/fs/binfmt_misc | grep -q '^qemu-'",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/docker/machine/libmachine/provision/serviceaction"
 	"github.com/docker/machine/libmachine/state"
 	"github.com/docker/machine/libmachine/swarm"
+	"golang.org/x/net/context"
 )
 
 func init() {
@@ -35,22 +36,36 @@ func NewBoot2DockerProvisioner(d drivers.Driver) Provisioner {
 
 type Boot2DockerProvisioner struct {
 	OsReleaseInfo *OsRelease
-	Driver        drivers.Driver
-	AuthOptions   auth.Options
-	EngineOptions engine.Options
-	SwarmOptions  swarm.Options
+	HostInfo      *HostInfo
+	// DockerServiceName is the init script the daemon runs under, when it
+	// isn't "docker".
+	DockerServiceName string
+	Driver            drivers.Driver
+	AuthOptions       auth.Options
+	EngineOptions     engine.Options
+	SwarmOptions      swarm.Options
 }
 
 func (provisioner *Boot2DockerProvisioner) String() string {
 	return "boot2docker"
 }
 
-func (provisioner *Boot2DockerProvisioner) Service(name string, action serviceaction.ServiceAction) error {
-	_, err := provisioner.SSHCommand(fmt.Sprintf("sudo /etc/init.d/%s %s", name, action.String()))
+// dockerService is the init script the daemon runs under, the one of the
+// engine options taking precedence over the one of the provisioner.
+func (provisioner *Boot2DockerProvisioner) dockerService() string {
+	if provisioner.EngineOptions.ServiceName != "" {
+		return provisioner.EngineOptions.ServiceName
+	}
+
+	return provisioner.DockerServiceName
+}
+
+func (provisioner *Boot2DockerProvisioner) Service(ctx context.Context, name string, action serviceaction.ServiceAction) error {
+	_, err := provisioner.SSHCommand(ctx, fmt.Sprintf("sudo /etc/init.d/%s %s", serviceName(name, provisioner.dockerService()), action.String()))
 	return err
 }
 
-func (provisioner *Boot2DockerProvisioner) upgradeIso() error {
+func (provisioner *Boot2DockerProvisioner) upgradeIso(ctx context.Context) error {
 	// TODO: Ideally, we should not read from mcndirs directory at all.
 	// The driver should be able to communicate how and where to place the
 	// relevant files.
@@ -95,21 +110,21 @@ func (provisioner *Boot2DockerProvisioner) upgradeIso() error {
 	return mcnutils.WaitFor(drivers.MachineInState(provisioner.Driver, state.Running))
 }
 
-func (provisioner *Boot2DockerProvisioner) Package(name string, action pkgaction.PackageAction) error {
+func (provisioner *Boot2DockerProvisioner) Package(ctx context.Context, name string, action pkgaction.PackageAction) error {
 	if name == "docker" && action == pkgaction.Upgrade {
-		if err := provisioner.upgradeIso(); err != nil {
+		if err := provisioner.upgradeIso(ctx); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (provisioner *Boot2DockerProvisioner) Hostname() (string, error) {
-	return provisioner.SSHCommand("hostname")
+func (provisioner *Boot2DockerProvisioner) Hostname(ctx context.Context) (string, error) {
+	return provisioner.SSHCommand(ctx, "hostname")
 }
 
-func (provisioner *Boot2DockerProvisioner) SetHostname(hostname string) error {
-	if _, err := provisioner.SSHCommand(fmt.Sprintf(
+func (provisioner *Boot2DockerProvisioner) SetHostname(ctx context.Context, hostname string) error {
+	if _, err := provisioner.SSHCommand(ctx, fmt.Sprintf(
 		"sudo /usr/bin/sethostname %s && echo %q | sudo tee /var/lib/boot2docker/etc/hostname",
 		hostname,
 		hostname,
@@ -128,11 +143,27 @@ func (provisioner *Boot2DockerProvisioner) GetAuthOptions() auth.Options {
 	return provisioner.AuthOptions
 }
 
+func (provisioner *Boot2DockerProvisioner) SetAuthOptions(authOptions auth.Options) {
+	provisioner.AuthOptions = authOptions
+}
+
+func (provisioner *Boot2DockerProvisioner) GetEngineOptions() engine.Options {
+	return provisioner.EngineOptions
+}
+
+func (provisioner *Boot2DockerProvisioner) SetEngineOptions(engineOptions engine.Options) {
+	provisioner.EngineOptions = engineOptions
+}
+
 func (provisioner *Boot2DockerProvisioner) GenerateDockerOptions(dockerPort int) (*DockerOptions, error) {
 	var (
 		engineCfg bytes.Buffer
 	)
 
+	if provisioner.EngineOptions.DisableTCP {
+		return nil, ErrDisableTCPUnsupported
+	}
+
 	driverNameLabel := fmt.Sprintf("provider=%s", provisioner.Driver.DriverName())
 	provisioner.EngineOptions.Labels = append(provisioner.EngineOptions.Labels, driverNameLabel)
 
@@ -141,7 +172,7 @@ EXTRA_ARGS='
 {{ range .EngineOptions.Labels }}--label {{.}}
 {{ end }}{{ range .EngineOptions.InsecureRegistry }}--insecure-registry {{.}}
 {{ end }}{{ range .EngineOptions.RegistryMirror }}--registry-mirror {{.}}
-{{ end }}{{ range .EngineOptions.ArbitraryFlags }}--{{.}}
+{{ end }}{{ range .EngineFlags }}--{{.}}
 {{ end }}
 '
 CACERT={{.AuthOptions.CaCertRemotePath}}
@@ -154,6 +185,11 @@ SERVERCERT={{.AuthOptions.ServerCertRemotePath}}
 {{range .EngineOptions.Env}}export \"{{ printf "%q" . }}\"
 {{end}}
 `
+	flags, err := engineFlags(provisioner.EngineOptions)
+	if err != nil {
+		return nil, err
+	}
+
 	t, err := template.New("engineConfig").Parse(engineConfigTmpl)
 	if err != nil {
 		return nil, err
@@ -163,6 +199,7 @@ SERVERCERT={{.AuthOptions.ServerCertRemotePath}}
 		DockerPort:    dockerPort,
 		AuthOptions:   provisioner.AuthOptions,
 		EngineOptions: provisioner.EngineOptions,
+		EngineFlags:   flags,
 	}
 
 	t.Execute(&engineCfg, engineConfigContext)
@@ -186,6 +223,18 @@ func (provisioner *Boot2DockerProvisioner) GetOsReleaseInfo() (*OsRelease, error
 	return provisioner.OsReleaseInfo, nil
 }
 
+func (provisioner *Boot2DockerProvisioner) GetHostInfo(ctx context.Context) (*HostInfo, error) {
+	if provisioner.HostInfo == nil {
+		info, err := fetchHostInfo(ctx, provisioner)
+		if err != nil {
+			return nil, err
+		}
+		provisioner.HostInfo = info
+	}
+
+	return provisioner.HostInfo, nil
+}
+
 func (provisioner *Boot2DockerProvisioner) AttemptIPContact(dockerPort int) {
 	ip, err := provisioner.Driver.GetIP()
 	if err != nil {
@@ -211,7 +260,14 @@ You also might want to clear any VirtualBox host only interfaces you are not usi
 	}
 }
 
-func (provisioner *Boot2DockerProvisioner) Provision(swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error {
+func (provisioner *Boot2DockerProvisioner) Provision(ctx context.Context, swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error {
+	ctx, cancel := provisionContext(ctx, engineOptions)
+	defer cancel()
+
+	if err := ValidateOptions(provisioner, swarmOptions, authOptions, engineOptions); err != nil {
+		return err
+	}
+
 	const (
 		dockerPort = 2376
 	)
@@ -235,23 +291,23 @@ func (provisioner *Boot2DockerProvisioner) Provision(swarmOptions swarm.Options,
 		provisioner.EngineOptions.StorageDriver = "aufs"
 	}
 
-	if err = provisioner.SetHostname(provisioner.Driver.GetMachineName()); err != nil {
+	if err = provisioner.SetHostname(ctx, provisioner.Driver.GetMachineName()); err != nil {
 		return err
 	}
 
 	// b2d hosts need to wait for the daemon to be up
 	// before continuing with provisioning
-	if err = waitForDocker(provisioner, dockerPort); err != nil {
+	if err = waitForDocker(ctx, provisioner, dockerPort); err != nil {
 		return err
 	}
 
-	if err = makeDockerOptionsDir(provisioner); err != nil {
+	if err = makeDockerOptionsDir(ctx, provisioner); err != nil {
 		return err
 	}
 
 	provisioner.AuthOptions = setRemoteAuthOptions(provisioner)
 
-	if err = ConfigureAuth(provisioner); err != nil {
+	if err = ConfigureAuth(ctx, provisioner); err != nil {
 		return err
 	}
 
@@ -262,8 +318,8 @@ func (provisioner *Boot2DockerProvisioner) Provision(swarmOptions swarm.Options,
 	return nil
 }
 
-func (provisioner *Boot2DockerProvisioner) SSHCommand(args string) (string, error) {
-	return drivers.RunSSHCommandFromDriver(provisioner.Driver, args)
+func (provisioner *Boot2DockerProvisioner) SSHCommand(ctx context.Context, args string) (string, error) {
+	return drivers.RunSSHCommandFromDriverContext(ctx, provisioner.Driver, args)
 }
 
 func (provisioner *Boot2DockerProvisioner) GetDriver() drivers.Driver {
@@ -0,0 +1,27 @@
+package provision
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// checkBridge makes sure the bridge the daemon is told to use exists on the
+// host, the daemon refuses to start otherwise.
+func checkBridge(ctx context.Context, p SSHCommander, bridge string) error {
+	if !reBridgeName.MatchString(bridge) {
+		return fmt.Errorf("Invalid bridge name %q, expected a network interface name", bridge)
+	}
+
+	out, err := p.SSHCommand(ctx, fmt.Sprintf("test -d /sys/class/net/%s/bridge && echo ok || true", bridge))
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(out) != "ok" {
+		return fmt.Errorf("The bridge %s doesn't exist on the host, it has to be created before provisioning", bridge)
+	}
+
+	return nil
+}
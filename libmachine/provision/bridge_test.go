@@ -0,0 +1,54 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func TestCheckBridge(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"test -d /sys/class/net/br-lan/bridge && echo ok || true": "ok\n",
+		},
+	}
+
+	if err := checkBridge(context.Background(), commander, "br-lan"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkBridge(context.Background(), commander, "br-missing"); err == nil {
+		t.Fatal("expected an error for a missing bridge")
+	}
+
+	if err := checkBridge(context.Background(), commander, "br0; reboot"); err == nil {
+		t.Fatal("expected an error for an invalid bridge name")
+	}
+
+	expected := []string{
+		"test -d /sys/class/net/br-lan/bridge && echo ok || true",
+		"test -d /sys/class/net/br-missing/bridge && echo ok || true",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestEngineFlagsBridgeName(t *testing.T) {
+	flags, err := engineFlags(engine.Options{BridgeName: "br-lan"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"bridge=br-lan"}
+	if !reflect.DeepEqual(flags, expected) {
+		t.Fatalf("expected flags %v; received %v", expected, flags)
+	}
+
+	if _, err := engineFlags(engine.Options{BridgeName: "a-very-long-bridge-name"}); err == nil {
+		t.Fatal("expected an error for a bridge name longer than 15 characters")
+	}
+}
@@ -0,0 +1,102 @@
+package provision
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/docker/machine/libmachine/engine"
+	"golang.org/x/net/context"
+)
+
+// buildkitdConfigPath is where buildkitd looks for its configuration when
+// it runs on the host. The builders buildx runs in a container read it
+// when created with --config.
+const buildkitdConfigPath = "/etc/buildkit/buildkitd.toml"
+
+var reSearchDomain = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?)*$`)
+
+func tomlStrings(values []string) string {
+	quoted := []string{}
+	for _, value := range values {
+		quoted = append(quoted, fmt.Sprintf("%q", value))
+	}
+
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// buildkitdConfig renders the dns section of buildkitd.toml, giving the
+// RUN steps of builds their own nameservers and search domains.
+func buildkitdConfig(engineOptions engine.Options) (string, error) {
+	if len(engineOptions.BuildDNS) == 0 {
+		return "", fmt.Errorf("Build DNS search domains are given without build nameservers")
+	}
+
+	for _, nameserver := range engineOptions.BuildDNS {
+		if net.ParseIP(nameserver) == nil {
+			return "", fmt.Errorf("Invalid build nameserver %q, expected an IP address", nameserver)
+		}
+	}
+
+	for _, domain := range engineOptions.BuildDNSSearch {
+		if !reSearchDomain.MatchString(domain) {
+			return "", fmt.Errorf("Invalid build DNS search domain %q", domain)
+		}
+	}
+
+	config := "[dns]\n"
+	config += fmt.Sprintf("  nameservers = %s\n", tomlStrings(engineOptions.BuildDNS))
+	if len(engineOptions.BuildDNSSearch) != 0 {
+		config += fmt.Sprintf("  searchDomains = %s\n", tomlStrings(engineOptions.BuildDNSSearch))
+	}
+
+	return config, nil
+}
+
+// buildDNSSupported tells whether the daemon version ships a BuildKit
+// which reads the dns section, added with BuildKit 0.8 in Docker 20.10.
+func buildDNSSupported(version string) (bool, error) {
+	major, minor, err := parseDockerVersion(version)
+	if err != nil {
+		return false, err
+	}
+
+	return major > 20 || major == 20 && minor >= 10, nil
+}
+
+// configureBuildDNS writes the build nameservers to buildkitd.toml, after
+// checking that the installed Docker version can use them.
+func configureBuildDNS(ctx context.Context, p Provisioner) error {
+	config, err := buildkitdConfig(p.GetEngineOptions())
+	if err != nil {
+		return err
+	}
+
+	version, err := p.SSHCommand(ctx, "sudo docker version --format '{{.Server.Version}}'")
+	if err != nil {
+		return err
+	}
+
+	supported, err := buildDNSSupported(version)
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return fmt.Errorf("Docker %s has no BuildKit DNS settings, build nameservers need Docker 20.10 or later", strings.TrimSpace(version))
+	}
+
+	commands := []string{
+		fmt.Sprintf("sudo mkdir -p %s", path.Dir(buildkitdConfigPath)),
+		fmt.Sprintf("printf '%%s' '%s' | sudo tee %s", config, buildkitdConfigPath),
+	}
+
+	for _, cmd := range commands {
+		if _, err := p.SSHCommand(ctx, cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func TestBuildkitdConfig(t *testing.T) {
+	config, err := buildkitdConfig(engine.Options{
+		BuildDNS:       []string{"10.0.0.53", "2001:db8::53"},
+		BuildDNSSearch: []string{"corp.example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "[dns]\n  nameservers = [\"10.0.0.53\", \"2001:db8::53\"]\n  searchDomains = [\"corp.example.com\"]\n"
+	if config != expected {
+		t.Fatalf("expected config %q; received %q", expected, config)
+	}
+
+	config, err = buildkitdConfig(engine.Options{BuildDNS: []string{"1.1.1.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "[dns]\n  nameservers = [\"1.1.1.1\"]\n"; config != expected {
+		t.Fatalf("expected config %q; received %q", expected, config)
+	}
+}
+
+func TestBuildkitdConfigInvalid(t *testing.T) {
+	for _, engineOptions := range []engine.Options{
+		{BuildDNS: []string{"dns.example.com"}},
+		{BuildDNS: []string{"1.1.1.1"}, BuildDNSSearch: []string{"-corp"}},
+		{BuildDNS: []string{"1.1.1.1"}, BuildDNSSearch: []string{"corp\"]"}},
+		{BuildDNSSearch: []string{"corp"}},
+	} {
+		if _, err := buildkitdConfig(engineOptions); err == nil {
+			t.Fatalf("expected an error for %+v", engineOptions)
+		}
+	}
+}
+
+func TestBuildDNSSupported(t *testing.T) {
+	for version, expected := range map[string]bool{
+		"19.03.15":   false,
+		"20.10.0":    true,
+		"24.0.7\n":   true,
+		"1.13.1":     false,
+		"17.09.1-ce": false,
+	} {
+		supported, err := buildDNSSupported(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if supported != expected {
+			t.Fatalf("expected %t for %q; received %t", expected, version, supported)
+		}
+	}
+}
+
+func TestConfigureBuildDNS(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo docker version --format '{{.Server.Version}}'": "24.0.7\n",
+		},
+	}
+	p := newFakeDebianProvisioner(commander)
+	p.EngineOptions.BuildDNS = []string{"10.0.0.53"}
+
+	if err := configureBuildDNS(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo docker version --format '{{.Server.Version}}'",
+		"sudo mkdir -p /etc/buildkit",
+		"printf '%s' '[dns]\n  nameservers = [\"10.0.0.53\"]\n' | sudo tee /etc/buildkit/buildkitd.toml",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestConfigureBuildDNSUnsupported(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo docker version --format '{{.Server.Version}}'": "19.03.15\n",
+		},
+	}
+	p := newFakeDebianProvisioner(commander)
+	p.EngineOptions.BuildDNS = []string{"10.0.0.53"}
+
+	if err := configureBuildDNS(context.Background(), p); err == nil {
+		t.Fatal("expected an error for a Docker version without BuildKit DNS settings")
+	}
+	if len(commander.Commands) != 1 {
+		t.Fatalf("expected nothing written; received %v", commander.Commands)
+	}
+}
@@ -0,0 +1,81 @@
+package provision
+
+// Capabilities lists the features a provisioner supports, so that callers
+// can reject engine options it can't honour before running Provision.
+type Capabilities struct {
+	// Systemd is set when the docker service is managed by systemd.
+	Systemd bool
+	// DaemonConfig is set when settings written to /etc/docker/daemon.json
+	// are picked up and kept across reboots.
+	DaemonConfig bool
+	// SwarmMode is set when the installed engine can run in swarm mode.
+	SwarmMode bool
+	// Rootless is set when the daemon can be run as an unprivileged user.
+	Rootless bool
+	// HostConfig is set when Provision applies the host level engine
+	// options, like the drop-ins of the docker service, sysctls or a data
+	// disk.
+	HostConfig bool
+	// Apt is set when the host installs its packages with apt, and
+	// Provision applies the apt engine options.
+	Apt bool
+}
+
+func (provisioner *GenericProvisioner) Capabilities() Capabilities {
+	return Capabilities{
+		DaemonConfig: true,
+		SwarmMode:    true,
+	}
+}
+
+func (p *SystemdProvisioner) Capabilities() Capabilities {
+	capabilities := p.GenericProvisioner.Capabilities()
+	capabilities.Systemd = true
+	return capabilities
+}
+
+// Debian and Ubuntu run the host level steps of Provision, the other
+// systemd provisioners only install and configure the daemon.
+func (provisioner *DebianProvisioner) Capabilities() Capabilities {
+	capabilities := provisioner.SystemdProvisioner.Capabilities()
+	capabilities.HostConfig = true
+	capabilities.Apt = true
+	return capabilities
+}
+
+func (provisioner *UbuntuSystemdProvisioner) Capabilities() Capabilities {
+	capabilities := provisioner.SystemdProvisioner.Capabilities()
+	capabilities.HostConfig = true
+	capabilities.Apt = true
+	return capabilities
+}
+
+// Ubuntu with upstart only applies the apt options, the timezone and the
+// system CA certificates of the host.
+func (provisioner *UbuntuProvisioner) Capabilities() Capabilities {
+	capabilities := provisioner.GenericProvisioner.Capabilities()
+	capabilities.Apt = true
+	return capabilities
+}
+
+func (provisioner *SUSEProvisioner) Capabilities() Capabilities {
+	capabilities := provisioner.GenericProvisioner.Capabilities()
+	capabilities.Systemd = true
+	return capabilities
+}
+
+// RancherOS keeps the docker configuration under /var/lib/rancher/conf,
+// /etc/docker is not used by its system docker.
+func (provisioner *RancherProvisioner) Capabilities() Capabilities {
+	return Capabilities{
+		SwarmMode: true,
+	}
+}
+
+// The boot2docker root filesystem lives in memory, so only files under
+// /var/lib/boot2docker survive a reboot.
+func (provisioner *Boot2DockerProvisioner) Capabilities() Capabilities {
+	return Capabilities{
+		SwarmMode: true,
+	}
+}
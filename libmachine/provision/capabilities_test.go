@@ -0,0 +1,36 @@
+package provision
+
+import (
+	"testing"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/drivers"
+)
+
+func TestCapabilities(t *testing.T) {
+	systemd := Capabilities{Systemd: true, DaemonConfig: true, SwarmMode: true}
+	hostConfig := Capabilities{Systemd: true, DaemonConfig: true, SwarmMode: true, HostConfig: true, Apt: true}
+
+	cases := []struct {
+		new      func(d drivers.Driver) Provisioner
+		expected Capabilities
+	}{
+		{NewArchProvisioner, systemd},
+		{NewCentosProvisioner, systemd},
+		{NewCoreOSProvisioner, systemd},
+		{NewDebianProvisioner, hostConfig},
+		{NewFedoraProvisioner, systemd},
+		{NewOpenSUSEProvisioner, systemd},
+		{NewUbuntuSystemdProvisioner, hostConfig},
+		{NewUbuntuProvisioner, Capabilities{DaemonConfig: true, SwarmMode: true, Apt: true}},
+		{NewRancherProvisioner, Capabilities{SwarmMode: true}},
+		{NewBoot2DockerProvisioner, Capabilities{SwarmMode: true}},
+	}
+
+	for _, c := range cases {
+		p := c.new(&fakedriver.Driver{})
+		if capabilities := p.Capabilities(); capabilities != c.expected {
+			t.Errorf("%s: expected capabilities %+v; received %+v", p, c.expected, capabilities)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package provision
+
+import (
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+	"golang.org/x/net/context"
+)
+
+// defaultCloudInitTimeout bounds the wait for cloud-init, in seconds.
+const defaultCloudInitTimeout = 600
+
+// waitForCloudInit waits for cloud-init to finish its first boot run, which
+// otherwise fights over the apt lock and the services with the provisioning.
+// Hosts without cloud-init are left alone. A cloud-init run which fails or
+// outlasts timeout only gets a warning, the provisioning carries on. It
+// runs before sudo is installed on the hosts lacking it, reading the status
+// doesn't need root anyway.
+func waitForCloudInit(ctx context.Context, p SSHCommander, timeout time.Duration) error {
+	out, err := p.SSHCommand(ctx, "command -v cloud-init || true")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(out) == "" {
+		return nil
+	}
+
+	log.Info("Waiting for cloud-init to finish...")
+	if _, err := p.SSHCommand(withCommandTimeout(ctx, timeout), "cloud-init status --wait"); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Warnf("cloud-init didn't finish cleanly, provisioning anyway: %s", err)
+	}
+
+	return nil
+}
+
+// cloudInitTimeout maps the CloudInitTimeout engine option, in seconds, to
+// a duration, zero picking the default.
+func cloudInitTimeout(timeout int) time.Duration {
+	if timeout <= 0 {
+		timeout = defaultCloudInitTimeout
+	}
+
+	return time.Duration(timeout) * time.Second
+}
@@ -0,0 +1,98 @@
+package provision
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"github.com/docker/machine/libmachine/swarm"
+	"golang.org/x/net/context"
+)
+
+func TestWaitForCloudInit(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"command -v cloud-init || true": "/usr/bin/cloud-init\n",
+		},
+	}
+
+	if err := waitForCloudInit(context.Background(), commander, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"command -v cloud-init || true",
+		"cloud-init status --wait",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestWaitForCloudInitAbsent(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := waitForCloudInit(context.Background(), commander, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"command -v cloud-init || true"}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestWaitForCloudInitFailed(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"command -v cloud-init || true": "/usr/bin/cloud-init\n",
+		},
+		Errors: map[string]error{
+			"cloud-init status --wait": errors.New("status: error"),
+		},
+	}
+
+	if err := waitForCloudInit(context.Background(), commander, time.Minute); err != nil {
+		t.Fatalf("expected a failed cloud-init run to only be a warning; received %s", err)
+	}
+}
+
+func TestCloudInitTimeout(t *testing.T) {
+	if timeout := cloudInitTimeout(0); timeout != 10*time.Minute {
+		t.Fatalf("expected the default timeout; received %s", timeout)
+	}
+
+	if timeout := cloudInitTimeout(30); timeout != 30*time.Second {
+		t.Fatalf("expected the configured timeout; received %s", timeout)
+	}
+}
+
+func TestProvisionWaitsForCloudInitBeforeApt(t *testing.T) {
+	installSudo := "if ! type sudo; then apt-get update && DEBIAN_FRONTEND=noninteractive apt-get install -y sudo; fi"
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"command -v cloud-init || true": "/usr/bin/cloud-init\n",
+		},
+		Errors: map[string]error{
+			installSudo: errors.New("stop here"),
+		},
+	}
+	p := newFakeDebianProvisioner(commander)
+
+	if err := p.Provision(context.Background(), swarm.Options{}, auth.Options{}, engine.Options{}); err == nil {
+		t.Fatal("expected provisioning to stop at the sudo install")
+	}
+
+	expected := []string{
+		"command -v cloud-init || true",
+		"cloud-init status --wait",
+		installSudo,
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
@@ -0,0 +1,70 @@
+package provision
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// bootCmdlinePaths are where the kernel command line of Raspberry Pi hosts
+// is, under /boot/firmware on Ubuntu and recent Raspberry Pi OS releases.
+var bootCmdlinePaths = []string{"/boot/firmware/cmdline.txt", "/boot/cmdline.txt"}
+
+// memoryCgroupKernelArgs enable the memory cgroup on Raspberry Pi kernels,
+// where it is disabled by default and docker cannot enforce memory limits.
+var memoryCgroupKernelArgs = []string{"cgroup_enable=memory", "cgroup_memory=1"}
+
+// appendKernelArgs adds the args missing from the single line kernel
+// command line and reports whether anything had to be added.
+func appendKernelArgs(cmdline string, args []string) (string, bool) {
+	fields := strings.Fields(cmdline)
+	changed := false
+
+	for _, arg := range args {
+		found := false
+		for _, field := range fields {
+			if field == arg {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fields = append(fields, arg)
+			changed = true
+		}
+	}
+
+	return strings.Join(fields, " "), changed
+}
+
+// enableMemoryCgroup turns on the memory cgroup in the cmdline.txt of the
+// host. It returns true when the file was changed, in which case the
+// machine has to be rebooted for the setting to take effect.
+func enableMemoryCgroup(ctx context.Context, p SSHCommander) (bool, error) {
+	out, err := p.SSHCommand(ctx, fmt.Sprintf("for f in %s; do if [ -f $f ]; then echo $f; break; fi; done", strings.Join(bootCmdlinePaths, " ")))
+	if err != nil {
+		return false, err
+	}
+
+	bootCmdlinePath := strings.TrimSpace(out)
+	if bootCmdlinePath == "" {
+		return false, fmt.Errorf("None of %s exists, the memory cgroup can only be enabled on Raspberry Pi hosts", strings.Join(bootCmdlinePaths, ", "))
+	}
+
+	cmdline, err := p.SSHCommand(ctx, fmt.Sprintf("cat %s", bootCmdlinePath))
+	if err != nil {
+		return false, fmt.Errorf("Error reading %s: %s", bootCmdlinePath, err)
+	}
+
+	updated, changed := appendKernelArgs(cmdline, memoryCgroupKernelArgs)
+	if !changed {
+		return false, nil
+	}
+
+	if _, err := p.SSHCommand(ctx, fmt.Sprintf("printf '%%s\\n' '%s' | sudo tee %s", updated, bootCmdlinePath)); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,147 @@
+package provision
+
+import (
+	"testing"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+const locateCmdlineCmd = "for f in /boot/firmware/cmdline.txt /boot/cmdline.txt; do if [ -f $f ]; then echo $f; break; fi; done"
+
+const piCmdline = "dwc_otg.lpm_enable=0 console=serial0,115200 console=tty1 root=/dev/mmcblk0p2 rootfstype=ext4 elevator=deadline rootwait\n"
+
+func TestAppendKernelArgs(t *testing.T) {
+	cmdline, changed := appendKernelArgs(piCmdline, memoryCgroupKernelArgs)
+	if !changed {
+		t.Fatal("expected the kernel command line to be changed")
+	}
+
+	expected := "dwc_otg.lpm_enable=0 console=serial0,115200 console=tty1 root=/dev/mmcblk0p2 rootfstype=ext4 elevator=deadline rootwait cgroup_enable=memory cgroup_memory=1"
+	if cmdline != expected {
+		t.Fatalf("expected %q; received %q", expected, cmdline)
+	}
+
+	again, changed := appendKernelArgs(cmdline, memoryCgroupKernelArgs)
+	if changed {
+		t.Fatal("expected appending the same args twice to be a no-op")
+	}
+	if again != cmdline {
+		t.Fatalf("expected %q; received %q", cmdline, again)
+	}
+}
+
+func TestAppendKernelArgsPartiallyPresent(t *testing.T) {
+	cmdline, changed := appendKernelArgs("root=/dev/mmcblk0p2 cgroup_enable=memory", memoryCgroupKernelArgs)
+	if !changed {
+		t.Fatal("expected the missing arg to be added")
+	}
+
+	expected := "root=/dev/mmcblk0p2 cgroup_enable=memory cgroup_memory=1"
+	if cmdline != expected {
+		t.Fatalf("expected %q; received %q", expected, cmdline)
+	}
+}
+
+func TestEnableMemoryCgroup(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			locateCmdlineCmd:        "/boot/cmdline.txt\n",
+			"cat /boot/cmdline.txt": piCmdline,
+		},
+	}
+
+	rebootRequired, err := enableMemoryCgroup(context.Background(), commander)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rebootRequired {
+		t.Fatal("expected a reboot to be required")
+	}
+	if len(commander.Commands) != 3 {
+		t.Fatalf("expected the cmdline to be read and written; received %v", commander.Commands)
+	}
+}
+
+func TestEnableMemoryCgroupAlreadyEnabled(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			locateCmdlineCmd:        "/boot/cmdline.txt\n",
+			"cat /boot/cmdline.txt": "root=/dev/mmcblk0p2 rootwait cgroup_enable=memory cgroup_memory=1\n",
+		},
+	}
+
+	rebootRequired, err := enableMemoryCgroup(context.Background(), commander)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebootRequired {
+		t.Fatal("expected no reboot when the memory cgroup is already enabled")
+	}
+	if len(commander.Commands) != 2 {
+		t.Fatalf("expected only the cmdline to be read; received %v", commander.Commands)
+	}
+}
+
+func TestEnableMemoryCgroupUbuntu(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			locateCmdlineCmd:                 "/boot/firmware/cmdline.txt\n",
+			"cat /boot/firmware/cmdline.txt": "console=serial0,115200 root=LABEL=writable rootwait\n",
+		},
+	}
+
+	if _, err := enableMemoryCgroup(context.Background(), commander); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "printf '%s\\n' 'console=serial0,115200 root=LABEL=writable rootwait cgroup_enable=memory cgroup_memory=1' | sudo tee /boot/firmware/cmdline.txt"
+	if last := commander.Commands[len(commander.Commands)-1]; last != expected {
+		t.Fatalf("expected %q; received %q", expected, last)
+	}
+}
+
+func TestEnableMemoryCgroupNoCmdline(t *testing.T) {
+	if _, err := enableMemoryCgroup(context.Background(), &provisiontest.FakeSSHCommander{}); err == nil {
+		t.Fatal("expected an error on a host without cmdline.txt")
+	}
+}
+
+const raspbianOsRelease = `PRETTY_NAME="Raspbian GNU/Linux 11 (bullseye)"
+NAME="Raspbian GNU/Linux"
+VERSION_ID="11"
+VERSION="11 (bullseye)"
+VERSION_CODENAME=bullseye
+ID=raspbian
+ID_LIKE=debian
+HOME_URL="http://www.raspbian.org/"
+SUPPORT_URL="http://www.raspbian.org/RaspbianForums"
+BUG_REPORT_URL="http://www.raspbian.org/RaspbianBugs"
+`
+
+func TestRaspbianDetection(t *testing.T) {
+	info, err := NewOsRelease([]byte(raspbianOsRelease))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &fakedriver.Driver{}
+	for _, p := range []Provisioner{
+		NewDebianProvisioner(d),
+		NewUbuntuSystemdProvisioner(d),
+		NewUbuntuProvisioner(d),
+	} {
+		p.SetOsReleaseInfo(info)
+
+		if compatible := p.String() == "debian"; p.CompatibleWithHost() != compatible {
+			t.Fatalf("expected %s to be compatible with Raspbian: %t", p, compatible)
+		}
+	}
+
+	ubuntu := NewDebianProvisioner(d)
+	ubuntu.SetOsReleaseInfo(&OsRelease{ID: "ubuntu", IDLike: "debian", VersionID: "22.04"})
+	if ubuntu.CompatibleWithHost() {
+		t.Fatal("expected Ubuntu to be left to its own provisioner")
+	}
+}
@@ -0,0 +1,89 @@
+package provision
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	composePluginDir    = "/usr/local/lib/docker/cli-plugins"
+	composeDownloadPath = "/tmp/docker-compose"
+)
+
+var reComposeVersion = regexp.MustCompile(`^v?[0-9]+\.[0-9]+\.[0-9]+$`)
+
+// compose release names for the architectures uname reports
+var composeArches = map[string]string{
+	"x86_64":  "x86_64",
+	"amd64":   "x86_64",
+	"aarch64": "aarch64",
+	"arm64":   "aarch64",
+	"armv7l":  "armv7",
+	"armv6l":  "armv6",
+	"ppc64le": "ppc64le",
+	"s390x":   "s390x",
+	"riscv64": "riscv64",
+}
+
+// composePluginURL returns the release download of the compose plugin for
+// the architecture, the latest release when no version is given.
+func composePluginURL(version, arch string) (string, error) {
+	composeArch, ok := composeArches[arch]
+	if !ok {
+		return "", fmt.Errorf("Docker Compose is not available for the %s architecture", arch)
+	}
+
+	if version == "" {
+		return fmt.Sprintf("https://github.com/docker/compose/releases/latest/download/docker-compose-linux-%s", composeArch), nil
+	}
+
+	if !reComposeVersion.MatchString(version) {
+		return "", fmt.Errorf("Invalid Docker Compose version %q, expected a version like v2.24.6", version)
+	}
+
+	return fmt.Sprintf("https://github.com/docker/compose/releases/download/v%s/docker-compose-linux-%s", strings.TrimPrefix(version, "v"), composeArch), nil
+}
+
+// installComposePlugin installs the compose CLI plugin for the host's
+// architecture, checked against the checksum published with the release,
+// and checks `docker compose` works.
+func installComposePlugin(ctx context.Context, p Provisioner, version string) error {
+	info, err := p.GetHostInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	url, err := composePluginURL(version, info.Arch)
+	if err != nil {
+		return err
+	}
+
+	// every release asset has its checksum published next to it
+	out, err := p.SSHCommand(ctx, fmt.Sprintf("curl -fsSL %s.sha256", url))
+	if err != nil {
+		return fmt.Errorf("Error fetching the Docker Compose checksum: %s", err)
+	}
+
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return fmt.Errorf("Empty Docker Compose checksum at %s.sha256", url)
+	}
+
+	// the plugin is tens of MB, downloadAndVerify allows minutes for it
+	if err := downloadAndVerify(ctx, p, url, fields[0], composeDownloadPath); err != nil {
+		return err
+	}
+
+	if _, err := p.SSHCommand(ctx, fmt.Sprintf("sudo mkdir -p %s && sudo install -m 755 %s %s/docker-compose && rm -f %s", composePluginDir, composeDownloadPath, composePluginDir, composeDownloadPath)); err != nil {
+		return err
+	}
+
+	if out, err := p.SSHCommand(ctx, "sudo docker compose version"); err != nil {
+		return fmt.Errorf("Docker Compose doesn't work after its install: %s\n%s", err, out)
+	}
+
+	return nil
+}
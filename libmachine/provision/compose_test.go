@@ -0,0 +1,114 @@
+package provision
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func fakeHostInfoResponses(arch string) map[string]string {
+	return map[string]string{
+		"uname -m":          arch + "\n",
+		"uname -r":          "6.1.0-rpi7-rpi-v8\n",
+		"nproc":             "4\n",
+		"cat /proc/meminfo": "MemTotal:        3884524 kB\n",
+	}
+}
+
+const composeSHA256 = "5c3a4bf4d36b9f2eb6e0b8d2f1a7c9e0d4b6a8f2c1e3d5b7a9c0e2f4d6b8a1c3"
+
+func TestInstallComposePlugin(t *testing.T) {
+	responses := fakeHostInfoResponses("armv7l")
+	responses["curl -fsSL https://github.com/docker/compose/releases/download/v2.24.6/docker-compose-linux-armv7.sha256"] = composeSHA256 + " *docker-compose-linux-armv7\n"
+	responses["sha256sum /tmp/docker-compose"] = composeSHA256 + "  /tmp/docker-compose\n"
+	commander := &provisiontest.FakeSSHCommander{Responses: responses}
+
+	if err := installComposePlugin(context.Background(), newFakeDebianProvisioner(commander), "2.24.6"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"uname -m",
+		"uname -r",
+		"nproc",
+		"cat /proc/meminfo",
+		"curl -fsSL https://github.com/docker/compose/releases/download/v2.24.6/docker-compose-linux-armv7.sha256",
+		"curl -sSL -o /tmp/docker-compose https://github.com/docker/compose/releases/download/v2.24.6/docker-compose-linux-armv7",
+		"sha256sum /tmp/docker-compose",
+		"sudo mkdir -p /usr/local/lib/docker/cli-plugins && sudo install -m 755 /tmp/docker-compose /usr/local/lib/docker/cli-plugins/docker-compose && rm -f /tmp/docker-compose",
+		"sudo docker compose version",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestInstallComposePluginLatest(t *testing.T) {
+	responses := fakeHostInfoResponses("aarch64")
+	responses["curl -fsSL https://github.com/docker/compose/releases/latest/download/docker-compose-linux-aarch64.sha256"] = composeSHA256 + " *docker-compose-linux-aarch64\n"
+	responses["sha256sum /tmp/docker-compose"] = composeSHA256 + "  /tmp/docker-compose\n"
+	commander := &provisiontest.FakeSSHCommander{Responses: responses}
+
+	if err := installComposePlugin(context.Background(), newFakeDebianProvisioner(commander), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	download := "curl -sSL -o /tmp/docker-compose https://github.com/docker/compose/releases/latest/download/docker-compose-linux-aarch64"
+	if commander.Commands[5] != download {
+		t.Fatalf("expected %q; received %q", download, commander.Commands[5])
+	}
+}
+
+func TestInstallComposePluginChecksumMismatch(t *testing.T) {
+	responses := fakeHostInfoResponses("x86_64")
+	responses["curl -fsSL https://github.com/docker/compose/releases/download/v2.24.6/docker-compose-linux-x86_64.sha256"] = composeSHA256 + " *docker-compose-linux-x86_64\n"
+	responses["sha256sum /tmp/docker-compose"] = "0000000000000000000000000000000000000000000000000000000000000000  /tmp/docker-compose\n"
+	commander := &provisiontest.FakeSSHCommander{Responses: responses}
+
+	if err := installComposePlugin(context.Background(), newFakeDebianProvisioner(commander), "v2.24.6"); err == nil {
+		t.Fatal("expected an error on a checksum mismatch")
+	}
+
+	for _, cmd := range commander.Commands {
+		if strings.Contains(cmd, "install -m 755") {
+			t.Fatalf("expected the plugin not to be installed; received %v", commander.Commands)
+		}
+	}
+}
+
+func TestInstallComposePluginVerifyFails(t *testing.T) {
+	responses := fakeHostInfoResponses("x86_64")
+	responses["curl -fsSL https://github.com/docker/compose/releases/download/v2.24.6/docker-compose-linux-x86_64.sha256"] = composeSHA256 + " *docker-compose-linux-x86_64\n"
+	responses["sha256sum /tmp/docker-compose"] = composeSHA256 + "  /tmp/docker-compose\n"
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: responses,
+		Errors: map[string]error{
+			"sudo docker compose version": errors.New("exit status 1"),
+		},
+	}
+
+	if err := installComposePlugin(context.Background(), newFakeDebianProvisioner(commander), "v2.24.6"); err == nil {
+		t.Fatal("expected an error when docker compose doesn't work")
+	}
+}
+
+func TestInstallComposePluginInvalid(t *testing.T) {
+	for arch, version := range map[string]string{
+		"mips":   "v2.24.6",
+		"x86_64": "latest",
+	} {
+		commander := &provisiontest.FakeSSHCommander{Responses: fakeHostInfoResponses(arch)}
+
+		if err := installComposePlugin(context.Background(), newFakeDebianProvisioner(commander), version); err == nil {
+			t.Fatalf("expected an error for %s %s", arch, version)
+		}
+
+		if len(commander.Commands) != 4 {
+			t.Fatalf("expected only the host info commands for %s %s; received %v", arch, version, commander.Commands)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package provision
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/provision/serviceaction"
+	"golang.org/x/net/context"
+)
+
+// configBackupManifest lists the files of a backup bundle and where they
+// go on the host, so a bundle restores to the paths it was taken from.
+const configBackupManifest = "manifest.json"
+
+const (
+	backupDaemonConfig  = "daemon.json"
+	backupDockerOptions = "docker-options"
+	backupCaCert        = "ca.pem"
+	backupServerCert    = "server.pem"
+	backupServerKey     = "server-key.pem"
+)
+
+type configBackupEntry struct {
+	Name       string `json:"name"`
+	RemotePath string `json:"remote_path"`
+}
+
+// configBackupEntries lists the daemon configuration files of the host:
+// daemon.json, the file holding DOCKER_OPTS and, unless the daemon is
+// restricted to the unix socket, its TLS certificates.
+func configBackupEntries(p Provisioner) ([]configBackupEntry, error) {
+	dockerPort, err := getDockerPort(p.GetDriver())
+	if err != nil {
+		return nil, err
+	}
+
+	// rendering gives the config path, and adds the provider label to the
+	// engine options
+	engineOptions := p.GetEngineOptions()
+	defer p.SetEngineOptions(engineOptions)
+
+	dkrcfg, err := p.GenerateDockerOptions(dockerPort)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []configBackupEntry{
+		{backupDaemonConfig, daemonConfigFile(engineOptions)},
+		{backupDockerOptions, dkrcfg.EngineOptionsPath},
+	}
+
+	if !engineOptions.DisableTCP {
+		authOptions := setRemoteAuthOptions(p)
+		entries = append(entries,
+			configBackupEntry{backupCaCert, authOptions.CaCertRemotePath},
+			configBackupEntry{backupServerCert, authOptions.ServerCertRemotePath},
+			configBackupEntry{backupServerKey, authOptions.ServerKeyRemotePath},
+		)
+	}
+
+	return entries, nil
+}
+
+// BackupConfig downloads the daemon configuration and certificates of the
+// host into localDir, as a bundle RestoreConfig puts back, so that the
+// host can be snapshotted before a risky change.
+func BackupConfig(ctx context.Context, p Provisioner, localDir string) error {
+	entries, err := configBackupEntries(p)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(localDir, 0700); err != nil {
+		return err
+	}
+
+	manifest := []configBackupEntry{}
+	for _, entry := range entries {
+		content, err := p.SSHCommand(ctx, fmt.Sprintf("sudo cat %s 2>/dev/null || true", entry.RemotePath))
+		if err != nil {
+			return err
+		}
+
+		if content == "" {
+			if entry.Name != backupDaemonConfig {
+				return fmt.Errorf("No %s found at %s", entry.Name, entry.RemotePath)
+			}
+			// no daemon.json is a valid configuration, restored by
+			// removing the file
+			continue
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(localDir, entry.Name), []byte(content), 0600); err != nil {
+			return err
+		}
+		manifest = append(manifest, entry)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(localDir, configBackupManifest), data, 0600)
+}
+
+func validateBackupFile(name string, content []byte) error {
+	switch name {
+	case backupDaemonConfig:
+		var cfg map[string]interface{}
+		if err := json.Unmarshal(content, &cfg); err != nil {
+			return fmt.Errorf("Invalid %s in the backup: %s", name, err)
+		}
+	case backupDockerOptions:
+		if strings.TrimSpace(string(content)) == "" {
+			return fmt.Errorf("Empty %s in the backup", name)
+		}
+	case backupCaCert, backupServerCert:
+		if block, _ := pem.Decode(content); block == nil || block.Type != "CERTIFICATE" {
+			return fmt.Errorf("Invalid %s in the backup, expected a PEM certificate", name)
+		}
+	case backupServerKey:
+		if block, _ := pem.Decode(content); block == nil || !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			return fmt.Errorf("Invalid %s in the backup, expected a PEM private key", name)
+		}
+	default:
+		return fmt.Errorf("Unknown file %s in the backup", name)
+	}
+
+	return nil
+}
+
+// readConfigBackup reads and checks the bundle in localDir, before
+// anything is changed on the host.
+func readConfigBackup(localDir string) ([]configBackupEntry, map[string][]byte, error) {
+	data, err := ioutil.ReadFile(filepath.Join(localDir, configBackupManifest))
+	if err != nil {
+		return nil, nil, fmt.Errorf("Reading the backup manifest failed: %s", err)
+	}
+
+	var manifest []configBackupEntry
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("Invalid backup manifest: %s", err)
+	}
+
+	files := map[string][]byte{}
+	for _, entry := range manifest {
+		if !path.IsAbs(entry.RemotePath) {
+			return nil, nil, fmt.Errorf("Invalid remote path %q of %s in the backup", entry.RemotePath, entry.Name)
+		}
+
+		content, err := ioutil.ReadFile(filepath.Join(localDir, entry.Name))
+		if err != nil {
+			return nil, nil, fmt.Errorf("Reading %s from the backup failed: %s", entry.Name, err)
+		}
+
+		if err := validateBackupFile(entry.Name, content); err != nil {
+			return nil, nil, err
+		}
+		files[entry.Name] = content
+	}
+
+	if _, ok := files[backupDockerOptions]; !ok {
+		return nil, nil, fmt.Errorf("The backup has no %s", backupDockerOptions)
+	}
+
+	return manifest, files, nil
+}
+
+// RestoreConfig uploads the bundle BackupConfig wrote to localDir back to
+// the host and restarts the daemon with it. The bundle is checked first,
+// so an incomplete or corrupted one changes nothing.
+func RestoreConfig(ctx context.Context, p Provisioner, localDir string) error {
+	manifest, files, err := readConfigBackup(localDir)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Restoring the daemon configuration on the remote machine...")
+
+	for _, entry := range manifest {
+		commands := []string{
+			fmt.Sprintf("sudo mkdir -p %s", path.Dir(entry.RemotePath)),
+			fmt.Sprintf("printf '%%s' '%s' | sudo tee %s", string(files[entry.Name]), entry.RemotePath),
+		}
+
+		for _, cmd := range commands {
+			if _, err := p.SSHCommand(ctx, cmd); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, ok := files[backupDaemonConfig]; !ok {
+		if _, err := p.SSHCommand(ctx, fmt.Sprintf("sudo rm -f %s", daemonConfigFile(p.GetEngineOptions()))); err != nil {
+			return err
+		}
+	}
+
+	dockerPort, err := getDockerPort(p.GetDriver())
+	if err != nil {
+		return err
+	}
+
+	if err := p.Service(ctx, "docker", serviceaction.Restart); err != nil {
+		return err
+	}
+
+	return waitForDocker(ctx, p, dockerPort)
+}
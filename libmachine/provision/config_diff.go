@@ -0,0 +1,165 @@
+package provision
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// diffContext is the number of unchanged lines shown around a change.
+const diffContext = 3
+
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// diffLines computes the line edit script turning a into b from their
+// longest common subsequence, which is plenty for config files.
+func diffLines(a, b []string) []diffLine {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	lines := []diffLine{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+
+	return lines
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// unifiedDiff renders the changes from a to b in the unified diff format,
+// it is empty when they are the same.
+func unifiedDiff(a, b, fromName, toName string) string {
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	out := ""
+	for start := 0; start < len(lines); {
+		if lines[start].op == ' ' {
+			start++
+			continue
+		}
+
+		// grow the hunk until the next change is too far away
+		first := start - diffContext
+		if first < 0 {
+			first = 0
+		}
+		end := start
+		for k := start; k < len(lines) && k <= end+2*diffContext; k++ {
+			if lines[k].op != ' ' {
+				end = k
+			}
+		}
+		last := end + diffContext
+		if last >= len(lines) {
+			last = len(lines) - 1
+		}
+
+		// count the lines of both sides before and within the hunk
+		aStart, bStart, aLen, bLen := 0, 0, 0, 0
+		for k := 0; k <= last; k++ {
+			inHunk := k >= first
+			if lines[k].op != '+' {
+				if inHunk {
+					aLen++
+				} else {
+					aStart++
+				}
+			}
+			if lines[k].op != '-' {
+				if inHunk {
+					bLen++
+				} else {
+					bStart++
+				}
+			}
+		}
+
+		if out == "" {
+			out = fmt.Sprintf("--- %s\n+++ %s\n", fromName, toName)
+		}
+		out += fmt.Sprintf("@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+		for k := first; k <= last; k++ {
+			out += fmt.Sprintf("%c%s\n", lines[k].op, lines[k].text)
+		}
+
+		start = last + 1
+	}
+
+	return out
+}
+
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+// DiffEngineConfig compares the daemon configuration Provision would write
+// with the one on the host and returns the changes as a unified diff, so
+// the drift can be reviewed before provisioning again. The diff is empty
+// when the host is up to date.
+func DiffEngineConfig(ctx context.Context, p Provisioner) (string, error) {
+	p.SetAuthOptions(setRemoteAuthOptions(p))
+
+	// rendering adds the provider label to the engine options
+	engineOptions := p.GetEngineOptions()
+	defer p.SetEngineOptions(engineOptions)
+
+	dockerPort, err := getDockerPort(p.GetDriver())
+	if err != nil {
+		return "", err
+	}
+
+	dkrcfg, err := p.GenerateDockerOptions(dockerPort)
+	if err != nil {
+		return "", err
+	}
+
+	current, err := p.SSHCommand(ctx, fmt.Sprintf("sudo cat %s 2>/dev/null || true", dkrcfg.EngineOptionsPath))
+	if err != nil {
+		return "", err
+	}
+
+	return unifiedDiff(current, dkrcfg.EngineOptions, dkrcfg.EngineOptionsPath, dkrcfg.EngineOptionsPath+" (desired)"), nil
+}
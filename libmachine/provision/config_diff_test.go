@@ -0,0 +1,104 @@
+package provision
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"github.com/docker/machine/libmachine/state"
+	"golang.org/x/net/context"
+)
+
+func TestUnifiedDiffSame(t *testing.T) {
+	if diff := unifiedDiff("a\nb\n", "a\nb\n", "old", "new"); diff != "" {
+		t.Fatalf("expected no diff; received %q", diff)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n"
+	b := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n17\n"
+
+	expected := `--- old
++++ new
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -14,3 +14,4 @@
+ 14
+ 15
+ 16
++17
+`
+	if diff := unifiedDiff(a, b, "old", "new"); diff != expected {
+		t.Fatalf("expected diff:\n%s\nreceived:\n%s", expected, diff)
+	}
+}
+
+func TestUnifiedDiffEmpty(t *testing.T) {
+	expected := `--- old
++++ new
+@@ -0,0 +1,2 @@
++a
++b
+`
+	if diff := unifiedDiff("", "a\nb\n", "old", "new"); diff != expected {
+		t.Fatalf("expected diff:\n%s\nreceived:\n%s", expected, diff)
+	}
+}
+
+func TestDiffEngineConfig(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{Responses: map[string]string{}}
+	p := NewDebianProvisioner(&fakedriver.Driver{
+		MockState: state.Running,
+		MockIP:    "1.2.3.4",
+	}).(*DebianProvisioner)
+	p.SSHCommander = commander
+	p.EngineOptions = engine.Options{StorageDriver: "overlay2", Labels: []string{"env=prod"}}
+	p.AuthOptions = setRemoteAuthOptions(p)
+
+	dkrcfg, err := p.GenerateDockerOptions(2376)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.EngineOptions = engine.Options{StorageDriver: "overlay2", Labels: []string{"env=prod"}}
+
+	catCmd := "sudo cat /etc/systemd/system/docker.service 2>/dev/null || true"
+	commander.Responses[catCmd] = dkrcfg.EngineOptions
+
+	diff, err := DiffEngineConfig(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != "" {
+		t.Fatalf("expected no drift; received:\n%s", diff)
+	}
+
+	commander.Responses[catCmd] = strings.Replace(dkrcfg.EngineOptions, "overlay2", "aufs", 1)
+
+	diff, err = DiffEngineConfig(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(diff, "--- /etc/systemd/system/docker.service\n+++ /etc/systemd/system/docker.service (desired)\n") {
+		t.Fatalf("expected a diff of the docker unit; received:\n%s", diff)
+	}
+	for _, line := range strings.Split(diff, "\n") {
+		if strings.HasPrefix(line, "-ExecStart") && !strings.Contains(line, "--storage-driver aufs") {
+			t.Fatalf("expected the host's storage driver to be removed; received %q", line)
+		}
+		if strings.HasPrefix(line, "+ExecStart") && !strings.Contains(line, "--storage-driver overlay2") {
+			t.Fatalf("expected the desired storage driver to be added; received %q", line)
+		}
+	}
+	if !strings.Contains(diff, "\n-ExecStart") || !strings.Contains(diff, "\n+ExecStart") {
+		t.Fatalf("expected the ExecStart line to change; received:\n%s", diff)
+	}
+}
@@ -3,6 +3,7 @@ package provision
 import (
 	"fmt"
 	"net/url"
+	"regexp"
 	"strings"
 
 	"github.com/docker/machine/libmachine/auth"
@@ -12,11 +13,32 @@ import (
 	"github.com/samalba/dockerclient"
 )
 
+var swarmImageDigestRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9._/:-]*@sha256:[a-f0-9]{64}$`)
+
+// validateSwarmImage accepts a tagged image as well as an image pinned by
+// digest, like swarm@sha256:<hex>. Both are handed to the daemon unchanged.
+func validateSwarmImage(image string) error {
+	if strings.Contains(image, "@") && !swarmImageDigestRegexp.MatchString(image) {
+		return fmt.Errorf("Invalid swarm image digest %q, expected repository@sha256:<64 hex characters>", image)
+	}
+
+	return nil
+}
+
 func configureSwarm(p Provisioner, swarmOptions swarm.Options, authOptions auth.Options) error {
 	if !swarmOptions.IsSwarm {
 		return nil
 	}
 
+	if p.GetEngineOptions().DisableTCP {
+		log.Warn("Swarm needs the Docker API over TCP, skipping the swarm configuration.")
+		return nil
+	}
+
+	if err := validateSwarmImage(swarmOptions.Image); err != nil {
+		return err
+	}
+
 	log.Info("Configuring swarm...")
 
 	ip, err := p.GetDriver().GetIP()
@@ -0,0 +1,29 @@
+package provision
+
+import "testing"
+
+func TestValidateSwarmImage(t *testing.T) {
+	for _, image := range []string{
+		"swarm:latest",
+		"swarm",
+		"swarm@sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		"registry.local:5000/team/swarm@sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+	} {
+		if err := validateSwarmImage(image); err != nil {
+			t.Fatalf("expected %q to be accepted; received %s", image, err)
+		}
+	}
+}
+
+func TestValidateSwarmImageInvalidDigest(t *testing.T) {
+	for _, image := range []string{
+		"swarm@sha256:abc",
+		"swarm@md5:0123456789abcdef0123456789abcdef",
+		"@sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		"swarm@sha256:" + "0123456789ABCDEF0123456789abcdef0123456789abcdef0123456789abcdef",
+	} {
+		if err := validateSwarmImage(image); err == nil {
+			t.Fatalf("expected an error for %q", image)
+		}
+	}
+}
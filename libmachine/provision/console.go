@@ -0,0 +1,49 @@
+package provision
+
+import (
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+	"golang.org/x/net/context"
+)
+
+// sshBootstrapCommand starts the SSH server on hosts which don't run it on
+// first boot, with systemd or a SysV style init. Debian based hosts call
+// it ssh, Red Hat and SUSE based ones sshd.
+const sshBootstrapCommand = "if [ -e /etc/init.d/ssh ] || systemctl cat ssh.service >/dev/null 2>&1; then unit=ssh; else unit=sshd; fi; sudo systemctl enable $unit && sudo systemctl start $unit || sudo service $unit start"
+
+// ConsoleCommander runs commands over the console a driver provides, for
+// the time before SSH is available.
+type ConsoleCommander struct {
+	Console drivers.Console
+}
+
+func (cmder ConsoleCommander) SSHCommand(ctx context.Context, args string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	return cmder.Console.ConsoleCommand(args)
+}
+
+func bootstrapSSH(ctx context.Context, p SSHCommander) error {
+	log.Info("SSH is not available, starting it over the console...")
+	_, err := p.SSHCommand(ctx, sshBootstrapCommand)
+	return err
+}
+
+// BootstrapSSH starts the SSH server over the driver's console and waits
+// for SSH to come up, after which provisioning carries on over SSH. It
+// returns ErrNoConsole when the driver, or the one a plugin wraps, has no
+// console.
+func BootstrapSSH(ctx context.Context, d drivers.Driver) error {
+	console, ok := d.(drivers.Console)
+	if !ok {
+		return ErrNoConsole
+	}
+
+	if err := bootstrapSSH(ctx, ConsoleCommander{Console: console}); err != nil {
+		return err
+	}
+
+	return drivers.WaitForSSH(d)
+}
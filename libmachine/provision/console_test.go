@@ -0,0 +1,50 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"golang.org/x/net/context"
+)
+
+type fakeConsole struct {
+	commands []string
+}
+
+func (c *fakeConsole) ConsoleCommand(command string) (string, error) {
+	c.commands = append(c.commands, command)
+	return "", nil
+}
+
+func TestBootstrapSSHOverConsole(t *testing.T) {
+	console := &fakeConsole{}
+
+	if err := bootstrapSSH(context.Background(), ConsoleCommander{Console: console}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{sshBootstrapCommand}
+	if !reflect.DeepEqual(console.commands, expected) {
+		t.Fatalf("expected console commands %v; received %v", expected, console.commands)
+	}
+}
+
+func TestConsoleCommanderCanceled(t *testing.T) {
+	console := &fakeConsole{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := (ConsoleCommander{Console: console}).SSHCommand(ctx, "true"); err != context.Canceled {
+		t.Fatalf("expected %s; received %v", context.Canceled, err)
+	}
+	if len(console.commands) != 0 {
+		t.Fatalf("expected nothing to run on the console; received %v", console.commands)
+	}
+}
+
+func TestBootstrapSSHWithoutConsole(t *testing.T) {
+	if err := BootstrapSSH(context.Background(), &fakedriver.Driver{}); err != ErrNoConsole {
+		t.Fatalf("expected %s; received %v", ErrNoConsole, err)
+	}
+}
@@ -0,0 +1,65 @@
+package provision
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"golang.org/x/net/context"
+)
+
+// StopAllContainers gracefully stops the running containers and returns
+// their IDs, so that they can be started again with StartContainers. Each
+// container gets timeout seconds to stop, or its own stop timeout when
+// timeout is zero.
+func StopAllContainers(ctx context.Context, p SSHCommander, timeout int) ([]string, error) {
+	if timeout < 0 {
+		return nil, fmt.Errorf("Invalid stop timeout %d, it must not be negative", timeout)
+	}
+
+	out, err := p.SSHCommand(ctx, "sudo docker ps -q --no-trunc")
+	if err != nil {
+		return nil, err
+	}
+
+	ids := strings.Fields(out)
+	if len(ids) == 0 {
+		return ids, nil
+	}
+
+	command := "sudo docker stop"
+	if timeout > 0 {
+		command += fmt.Sprintf(" -t %d", timeout)
+	}
+
+	log.Infof("Stopping %d running containers...", len(ids))
+
+	if _, err := p.SSHCommand(withCommandTimeout(ctx, installCommandTimeout), fmt.Sprintf("%s %s", command, strings.Join(ids, " "))); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// StartContainers starts the containers StopAllContainers stopped.
+func StartContainers(ctx context.Context, p SSHCommander, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	log.Infof("Starting %d stopped containers...", len(ids))
+
+	_, err := p.SSHCommand(ctx, fmt.Sprintf("sudo docker start %s", strings.Join(ids, " ")))
+	return err
+}
+
+// stopContainersForReconfigure stops the running containers before the
+// daemon is restarted with a new configuration, when the
+// StopContainersOnReconfigure engine option asks for it.
+func stopContainersForReconfigure(ctx context.Context, p Provisioner) ([]string, error) {
+	if !p.GetEngineOptions().StopContainersOnReconfigure {
+		return nil, nil
+	}
+
+	return StopAllContainers(ctx, p, 0)
+}
@@ -0,0 +1,89 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func TestStopAllContainers(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo docker ps -q --no-trunc": "abc123\ndef456\n",
+		},
+	}
+
+	stopped, err := StopAllContainers(context.Background(), commander, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{"abc123", "def456"}; !reflect.DeepEqual(stopped, expected) {
+		t.Fatalf("expected stopped containers %v; received %v", expected, stopped)
+	}
+
+	expected := []string{
+		"sudo docker ps -q --no-trunc",
+		"sudo docker stop -t 30 abc123 def456",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestStopAllContainersOwnTimeout(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo docker ps -q --no-trunc": "abc123\n",
+		},
+	}
+
+	if _, err := StopAllContainers(context.Background(), commander, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "sudo docker stop abc123"; commander.Commands[1] != expected {
+		t.Fatalf("expected %q; received %q", expected, commander.Commands[1])
+	}
+}
+
+func TestStopAllContainersNoneRunning(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	stopped, err := StopAllContainers(context.Background(), commander, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stopped) != 0 || len(commander.Commands) != 1 {
+		t.Fatalf("expected nothing to be stopped; received %v after %v", stopped, commander.Commands)
+	}
+}
+
+func TestUpdateProxyStopContainers(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo docker ps -q --no-trunc": "abc123\n",
+		},
+	}
+	p := newFakeDebianProvisioner(commander)
+	p.EngineOptions.StopContainersOnReconfigure = true
+
+	if _, err := UpdateProxy(context.Background(), p, "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo rm -f /etc/systemd/system/docker.service.d/http-proxy.conf",
+		"sudo docker ps -q --no-trunc",
+		"sudo docker stop abc123",
+		"sudo systemctl daemon-reload",
+		"sudo systemctl -f restart docker",
+		"sudo docker start abc123",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
@@ -0,0 +1,74 @@
+package provision
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/docker/machine/libmachine/engine"
+	"golang.org/x/net/context"
+)
+
+const (
+	// defaultCommandTimeout bounds a single SSH command, so one stuck on a
+	// dead mirror doesn't hang the provisioning forever.
+	defaultCommandTimeout = 2 * time.Minute
+	// installCommandTimeout is given to installs, downloads, disk formats
+	// and swarm joins, which legitimately take long on slow links and SD
+	// cards.
+	installCommandTimeout = 20 * time.Minute
+)
+
+type commandTimeoutKey struct{}
+
+// withCommandTimeout returns a context whose SSH commands may each run for
+// timeout, instead of the commander's default.
+func withCommandTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, commandTimeoutKey{}, timeout)
+}
+
+// commandTimeout returns the timeout set with withCommandTimeout, or the
+// given default when there is none.
+func commandTimeout(ctx context.Context, timeout time.Duration) time.Duration {
+	if t, ok := ctx.Value(commandTimeoutKey{}).(time.Duration); ok {
+		return t
+	}
+
+	if timeout <= 0 {
+		return defaultCommandTimeout
+	}
+
+	return timeout
+}
+
+// provisionContext derives the context a Provision run is bound to. When
+// the engine options carry a ProvisionTimeout (in seconds) the returned
+// context is canceled once it elapses.
+func provisionContext(ctx context.Context, engineOptions engine.Options) (context.Context, context.CancelFunc) {
+	if engineOptions.ProvisionTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, time.Duration(engineOptions.ProvisionTimeout)*time.Second)
+}
+
+// waitForSpecific is the context aware equivalent of
+// mcnutils.WaitForSpecific: it stops retrying as soon as ctx is done.
+func waitForSpecific(ctx context.Context, f func(context.Context) bool, maxAttempts int, waitInterval time.Duration) error {
+	for i := 0; i < maxAttempts; i++ {
+		if f(ctx) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(waitInterval):
+		}
+	}
+
+	return fmt.Errorf("Maximum number of retries (%d) exceeded", maxAttempts)
+}
+
+func waitFor(ctx context.Context, f func(context.Context) bool) error {
+	return waitForSpecific(ctx, f, 60, 3*time.Second)
+}
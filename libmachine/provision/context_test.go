@@ -0,0 +1,95 @@
+package provision
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"github.com/docker/machine/libmachine/swarm"
+	"golang.org/x/net/context"
+)
+
+func TestProvisionTimeout(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Delay: 10 * time.Second,
+	}
+	p := newFakeDebianProvisioner(commander)
+
+	start := time.Now()
+	err := p.Provision(context.Background(), swarm.Options{}, auth.Options{}, engine.Options{ProvisionTimeout: 1})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected %s; received %v", context.DeadlineExceeded, err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected Provision to give up after the timeout; took %s", elapsed)
+	}
+
+	if len(commander.Commands) != 1 {
+		t.Fatalf("expected no command to run after the timeout; received %v", commander.Commands)
+	}
+}
+
+func TestProvisionCanceled(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Delay: 10 * time.Second,
+	}
+	p := newFakeDebianProvisioner(commander)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	err := p.Provision(ctx, swarm.Options{}, auth.Options{}, engine.Options{})
+	if err != context.Canceled {
+		t.Fatalf("expected %s; received %v", context.Canceled, err)
+	}
+
+	if len(commander.Commands) != 1 {
+		t.Fatalf("expected no command to run after the cancellation; received %v", commander.Commands)
+	}
+}
+
+func TestProvisionContextNoTimeout(t *testing.T) {
+	ctx, cancel := provisionContext(context.Background(), engine.Options{})
+	defer cancel()
+
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatal("expected no deadline without a ProvisionTimeout")
+	}
+}
+
+func TestWaitForSpecificCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	attempts := 0
+	err := waitForSpecific(ctx, func(context.Context) bool {
+		attempts++
+		cancel()
+		return false
+	}, 10, time.Minute)
+	if err != context.Canceled {
+		t.Fatalf("expected %s; received %v", context.Canceled, err)
+	}
+
+	if attempts != 1 {
+		t.Fatalf("expected a single attempt; received %d", attempts)
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	if timeout := commandTimeout(ctx, 0); timeout != defaultCommandTimeout {
+		t.Fatalf("expected the default timeout %s; received %s", defaultCommandTimeout, timeout)
+	}
+
+	if timeout := commandTimeout(ctx, time.Second); timeout != time.Second {
+		t.Fatalf("expected the configured timeout; received %s", timeout)
+	}
+
+	if timeout := commandTimeout(withCommandTimeout(ctx, installCommandTimeout), time.Second); timeout != installCommandTimeout {
+		t.Fatalf("expected the install timeout %s; received %s", installCommandTimeout, timeout)
+	}
+}
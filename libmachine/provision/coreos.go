@@ -11,6 +11,7 @@ import (
 	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/provision/pkgaction"
 	"github.com/docker/machine/libmachine/swarm"
+	"golang.org/x/net/context"
 )
 
 const (
@@ -42,14 +43,14 @@ func (provisioner *CoreOSProvisioner) String() string {
 	return "coreOS"
 }
 
-func (provisioner *CoreOSProvisioner) SetHostname(hostname string) error {
+func (provisioner *CoreOSProvisioner) SetHostname(ctx context.Context, hostname string) error {
 	log.Debugf("SetHostname: %s", hostname)
 
-	if _, err := provisioner.SSHCommand(fmt.Sprintf(hostTmpl, hostname)); err != nil {
+	if _, err := provisioner.SSHCommand(ctx, fmt.Sprintf(hostTmpl, hostname)); err != nil {
 		return err
 	}
 
-	if _, err := provisioner.SSHCommand("sudo systemctl start system-cloudinit@var-tmp-hostname.yml.service"); err != nil {
+	if _, err := provisioner.SSHCommand(ctx, "sudo systemctl start system-cloudinit@var-tmp-hostname.yml.service"); err != nil {
 		return err
 	}
 
@@ -75,12 +76,17 @@ EnvironmentFile=-/run/flannel_docker_opts.env
 MountFlags=slave
 LimitNOFILE=1048576
 LimitNPROC=1048576
-ExecStart=/usr/lib/coreos/dockerd --daemon --host=unix:///var/run/docker.sock --host=tcp://0.0.0.0:{{.DockerPort}} --tlsverify --tlscacert {{.AuthOptions.CaCertRemotePath}} --tlscert {{.AuthOptions.ServerCertRemotePath}} --tlskey {{.AuthOptions.ServerKeyRemotePath}}{{ range .EngineOptions.Labels }} --label {{.}}{{ end }}{{ range .EngineOptions.InsecureRegistry }} --insecure-registry {{.}}{{ end }}{{ range .EngineOptions.RegistryMirror }} --registry-mirror {{.}}{{ end }}{{ range .EngineOptions.ArbitraryFlags }} --{{.}}{{ end }} \$DOCKER_OPTS \$DOCKER_OPT_BIP \$DOCKER_OPT_MTU \$DOCKER_OPT_IPMASQ
+ExecStart=/usr/lib/coreos/dockerd --daemon --host=unix:///var/run/docker.sock{{ if not .EngineOptions.DisableTCP }} --host=tcp://0.0.0.0:{{.DockerPort}} --tlsverify --tlscacert {{.AuthOptions.CaCertRemotePath}} --tlscert {{.AuthOptions.ServerCertRemotePath}} --tlskey {{.AuthOptions.ServerKeyRemotePath}}{{ end }}{{ range .EngineOptions.Labels }} --label {{.}}{{ end }}{{ range .EngineOptions.InsecureRegistry }} --insecure-registry {{.}}{{ end }}{{ range .EngineOptions.RegistryMirror }} --registry-mirror {{.}}{{ end }}{{ range .EngineFlags }} --{{.}}{{ end }} \$DOCKER_OPTS \$DOCKER_OPT_BIP \$DOCKER_OPT_MTU \$DOCKER_OPT_IPMASQ
 
 [Install]
 WantedBy=multi-user.target
 `
 
+	flags, err := engineFlags(provisioner.EngineOptions)
+	if err != nil {
+		return nil, err
+	}
+
 	t, err := template.New("engineConfig").Parse(engineConfigTmpl)
 	if err != nil {
 		return nil, err
@@ -90,30 +96,50 @@ WantedBy=multi-user.target
 		DockerPort:    dockerPort,
 		AuthOptions:   provisioner.AuthOptions,
 		EngineOptions: provisioner.EngineOptions,
+		EngineFlags:   flags,
 	}
 
 	t.Execute(&engineCfg, engineConfigContext)
 
 	return &DockerOptions{
 		EngineOptions:     engineCfg.String(),
-		EngineOptionsPath: provisioner.DaemonOptionsFile,
+		EngineOptionsPath: provisioner.daemonOptionsFile(),
 	}, nil
 }
 
-func (provisioner *CoreOSProvisioner) Package(name string, action pkgaction.PackageAction) error {
+func (provisioner *CoreOSProvisioner) Package(ctx context.Context, name string, action pkgaction.PackageAction) error {
 	return nil
 }
 
-func (provisioner *CoreOSProvisioner) Provision(swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error {
+func (provisioner *CoreOSProvisioner) Provision(ctx context.Context, swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error {
+	ctx, cancel := provisionContext(ctx, engineOptions)
+	defer cancel()
+
+	if err := ValidateOptions(provisioner, swarmOptions, authOptions, engineOptions); err != nil {
+		return err
+	}
+
 	provisioner.SwarmOptions = swarmOptions
 	provisioner.AuthOptions = authOptions
 	provisioner.EngineOptions = engineOptions
 
-	if err := provisioner.SetHostname(provisioner.Driver.GetMachineName()); err != nil {
+	log.Debug("checking for passwordless sudo")
+	if err := checkSudo(ctx, provisioner); err != nil {
+		return err
+	}
+
+	if !provisioner.EngineOptions.SkipCloudInitWait {
+		log.Debug("waiting for cloud-init")
+		if err := waitForCloudInit(ctx, provisioner, cloudInitTimeout(provisioner.EngineOptions.CloudInitTimeout)); err != nil {
+			return err
+		}
+	}
+
+	if err := provisioner.SetHostname(ctx, provisioner.Driver.GetMachineName()); err != nil {
 		return err
 	}
 
-	if err := makeDockerOptionsDir(provisioner); err != nil {
+	if err := makeDockerOptionsDir(ctx, provisioner); err != nil {
 		return err
 	}
 
@@ -121,7 +147,7 @@ func (provisioner *CoreOSProvisioner) Provision(swarmOptions swarm.Options, auth
 	provisioner.AuthOptions = setRemoteAuthOptions(provisioner)
 
 	log.Debugf("Setting up certificates")
-	if err := ConfigureAuth(provisioner); err != nil {
+	if err := ConfigureAuth(ctx, provisioner); err != nil {
 		return err
 	}
 
@@ -0,0 +1,334 @@
+package provision
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/log"
+	"golang.org/x/net/context"
+)
+
+const daemonConfigPath = "/etc/docker/daemon.json"
+
+// daemonConfigFile returns the path of daemon.json on the host, in the
+// ConfigDir of the engine options when the root filesystem is read-only.
+func daemonConfigFile(engineOptions engine.Options) string {
+	if engineOptions.ConfigDir != "" {
+		return path.Join(engineOptions.ConfigDir, "daemon.json")
+	}
+
+	return daemonConfigPath
+}
+
+var storageSizeRegexp = regexp.MustCompile(`^(?i)[0-9]+(\.[0-9]+)?\s*([kmgtp]i?)?b?$`)
+
+// daemonConfig holds the daemon settings written to daemon.json, mostly the
+// ones without a command line flag. A setting must not be given both ways,
+// the daemon refuses to start then.
+type daemonConfig struct {
+	Features            map[string]bool `json:"features,omitempty"`
+	Builder             *builderConfig  `json:"builder,omitempty"`
+	MaxDownloadAttempts int             `json:"max-download-attempts,omitempty"`
+	OOMScoreAdjust      int             `json:"oom-score-adjust,omitempty"`
+	CPURTRuntime        int             `json:"cpu-rt-runtime,omitempty"`
+	CPURTPeriod         int             `json:"cpu-rt-period,omitempty"`
+}
+
+type builderConfig struct {
+	GC builderGCConfig `json:"gc"`
+}
+
+type builderGCConfig struct {
+	Enabled            bool   `json:"enabled"`
+	DefaultKeepStorage string `json:"defaultKeepStorage,omitempty"`
+}
+
+// daemonFeatures returns the daemon.json features map for the engine
+// options, or nil when none is enabled.
+func daemonFeatures(engineOptions engine.Options) map[string]bool {
+	var features map[string]bool
+
+	if engineOptions.ContainerdSnapshotter {
+		features = map[string]bool{
+			"containerd-snapshotter": true,
+		}
+	}
+
+	return features
+}
+
+// daemonBuilder returns the daemon.json builder settings for the engine
+// options, or nil when build cache garbage collection isn't configured.
+func daemonBuilder(engineOptions engine.Options) (*builderConfig, error) {
+	if !engineOptions.BuilderGC && engineOptions.BuilderGCKeepStorage == "" {
+		return nil, nil
+	}
+
+	if engineOptions.BuilderGCKeepStorage != "" && !storageSizeRegexp.MatchString(engineOptions.BuilderGCKeepStorage) {
+		return nil, fmt.Errorf("Invalid builder GC keep storage %q, expected a size like 10GB", engineOptions.BuilderGCKeepStorage)
+	}
+
+	return &builderConfig{
+		GC: builderGCConfig{
+			Enabled:            engineOptions.BuilderGC,
+			DefaultKeepStorage: engineOptions.BuilderGCKeepStorage,
+		},
+	}, nil
+}
+
+// validateCPURealtime checks the realtime CPU budget, the runtime can't
+// exceed the period it is given in.
+func validateCPURealtime(runtime, period int) error {
+	if runtime < 0 || period < 0 {
+		return fmt.Errorf("Invalid realtime CPU runtime %d and period %d, they must be positive", runtime, period)
+	}
+
+	if runtime != 0 && period != 0 && runtime > period {
+		return fmt.Errorf("The realtime CPU runtime %d exceeds its period %d", runtime, period)
+	}
+
+	return nil
+}
+
+// managedDaemonConfigKeys are the daemon.json settings the engine options
+// own, with the key they own inside the nested ones. Other settings of the
+// file are kept as they are.
+var managedDaemonConfigKeys = map[string]string{
+	"features":              "containerd-snapshotter",
+	"builder":               "gc",
+	"max-download-attempts": "",
+	"oom-score-adjust":      "",
+	"cpu-rt-runtime":        "",
+	"cpu-rt-period":         "",
+}
+
+// daemonConfigSettings returns the daemon.json settings of the engine
+// options, keyed as in the file.
+func daemonConfigSettings(engineOptions engine.Options) (map[string]interface{}, error) {
+	builder, err := daemonBuilder(engineOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if engineOptions.MaxDownloadAttempts < 0 {
+		return nil, fmt.Errorf("Invalid maximum download attempts %d, it must be positive", engineOptions.MaxDownloadAttempts)
+	}
+
+	if err := validateOOMScoreAdjust(engineOptions.OOMScoreAdjust); err != nil {
+		return nil, err
+	}
+
+	if err := validateCPURealtime(engineOptions.CPURTRuntime, engineOptions.CPURTPeriod); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(daemonConfig{
+		Features:            daemonFeatures(engineOptions),
+		Builder:             builder,
+		MaxDownloadAttempts: engineOptions.MaxDownloadAttempts,
+		OOMScoreAdjust:      engineOptions.OOMScoreAdjust,
+		CPURTRuntime:        engineOptions.CPURTRuntime,
+		CPURTPeriod:         engineOptions.CPURTPeriod,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	settings := map[string]interface{}{}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// mergeDaemonConfig sets the settings in the daemon.json content existing.
+// The managed settings the engine options no longer give are removed, so
+// turning an option off takes it out of the file.
+func mergeDaemonConfig(existing string, settings map[string]interface{}) (map[string]interface{}, error) {
+	cfg := map[string]interface{}{}
+	if strings.TrimSpace(existing) != "" {
+		if err := json.Unmarshal([]byte(existing), &cfg); err != nil {
+			return nil, fmt.Errorf("Invalid daemon.json on the host: %s", err)
+		}
+	}
+
+	for key, nestedKey := range managedDaemonConfigKeys {
+		if nestedKey == "" {
+			delete(cfg, key)
+			continue
+		}
+
+		if nested, ok := cfg[key].(map[string]interface{}); ok {
+			delete(nested, nestedKey)
+			if len(nested) == 0 {
+				delete(cfg, key)
+			}
+		}
+	}
+
+	for key, value := range settings {
+		nested, ok := value.(map[string]interface{})
+		existingNested, exists := cfg[key].(map[string]interface{})
+		if !ok || !exists {
+			cfg[key] = value
+			continue
+		}
+
+		for nestedKey, nestedValue := range nested {
+			existingNested[nestedKey] = nestedValue
+		}
+	}
+
+	return cfg, nil
+}
+
+// sameDaemonConfig tells whether the daemon.json content existing already
+// holds the rendered configuration.
+func sameDaemonConfig(existing string, rendered []byte) bool {
+	var cfg map[string]interface{}
+	if err := json.Unmarshal([]byte(existing), &cfg); err != nil {
+		return false
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return false
+	}
+
+	return string(data) == string(rendered)
+}
+
+// writeDaemonConfig merges the settings of the engine options into the
+// daemon.json of the host, keeping the settings written by hand, and
+// removes the file once nothing is left in it.
+func writeDaemonConfig(ctx context.Context, p SSHCommander, engineOptions engine.Options) error {
+	settings, err := daemonConfigSettings(engineOptions)
+	if err != nil {
+		return err
+	}
+
+	configPath := daemonConfigFile(engineOptions)
+
+	existing, err := p.SSHCommand(ctx, fmt.Sprintf("sudo cat %s 2>/dev/null || true", configPath))
+	if err != nil {
+		return err
+	}
+
+	cfg, err := mergeDaemonConfig(existing, settings)
+	if err != nil {
+		return err
+	}
+
+	rendered, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	if engineOptions.ContainerdSnapshotter && !sameDaemonConfig(existing, rendered) {
+		log.Warn("The containerd snapshotter uses a separate image store, images pulled before enabling it won't be visible.")
+	}
+
+	if engineOptions.ValidateDaemonConfig {
+		flags, err := daemonValidateFlags(engineOptions)
+		if err != nil {
+			return err
+		}
+
+		return writeValidatedDaemonConfig(ctx, p, configPath, rendered, flags, len(cfg) == 0)
+	}
+
+	if len(cfg) == 0 {
+		if strings.TrimSpace(existing) == "" {
+			return nil
+		}
+
+		_, err := p.SSHCommand(ctx, fmt.Sprintf("sudo rm -f %s", configPath))
+		return err
+	}
+
+	if sameDaemonConfig(existing, rendered) {
+		return nil
+	}
+
+	if _, err := p.SSHCommand(ctx, fmt.Sprintf("sudo mkdir -p %s && printf '%%s' '%s' | sudo tee %s", path.Dir(configPath), rendered, configPath)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// daemonValidateFlags returns the command line flags the daemon is started
+// with, but for the listen addresses and TLS files, so that dockerd
+// validates them along with daemon.json, and catches a setting given both
+// ways.
+func daemonValidateFlags(engineOptions engine.Options) ([]string, error) {
+	flags := []string{}
+
+	if engineOptions.StorageDriver != "" {
+		flags = append(flags, fmt.Sprintf("--storage-driver %s", engineOptions.StorageDriver))
+	}
+	for _, label := range engineOptions.Labels {
+		flags = append(flags, fmt.Sprintf("--label %s", label))
+	}
+	for _, registry := range engineOptions.InsecureRegistry {
+		flags = append(flags, fmt.Sprintf("--insecure-registry %s", registry))
+	}
+	for _, mirror := range engineOptions.RegistryMirror {
+		flags = append(flags, fmt.Sprintf("--registry-mirror %s", mirror))
+	}
+
+	engineFlags, err := engineFlags(engineOptions)
+	if err != nil {
+		return nil, err
+	}
+	for _, flag := range engineFlags {
+		// the new daemon.json is validated in place of the current one
+		if strings.HasPrefix(flag, "config-file=") {
+			continue
+		}
+		flags = append(flags, "--"+flag)
+	}
+
+	return flags, nil
+}
+
+// writeValidatedDaemonConfig has dockerd check the new daemon.json, with
+// the daemon flags, before it replaces the one the running daemon uses, so
+// a bad setting is reported here instead of as a daemon failing to
+// restart. An empty configuration is checked, then removed rather than
+// installed. Daemons predating --validate (Docker 23.0) get the file
+// unchecked.
+func writeValidatedDaemonConfig(ctx context.Context, p SSHCommander, configPath string, cfg []byte, flags []string, remove bool) error {
+	newConfigPath := configPath + ".new"
+
+	if _, err := p.SSHCommand(ctx, fmt.Sprintf("sudo mkdir -p %s && printf '%%s' '%s' | sudo tee %s", path.Dir(configPath), cfg, newConfigPath)); err != nil {
+		return err
+	}
+
+	validateCmd := append([]string{"sudo dockerd --validate --config-file", newConfigPath}, flags...)
+	if _, err := p.SSHCommand(ctx, strings.Join(validateCmd, " ")+" 2>&1"); err != nil {
+		if !strings.Contains(err.Error(), "unknown flag: --validate") {
+			if _, rmErr := p.SSHCommand(ctx, fmt.Sprintf("sudo rm -f %s", newConfigPath)); rmErr != nil {
+				log.Debugf("Unable to remove %s: %s", newConfigPath, rmErr)
+			}
+			return fmt.Errorf("The daemon rejected the generated configuration: %s", err)
+		}
+		log.Warn("The daemon can't validate its configuration, it is installed unchecked.")
+	}
+
+	if remove {
+		_, err := p.SSHCommand(ctx, fmt.Sprintf("sudo rm -f %s %s", newConfigPath, configPath))
+		return err
+	}
+
+	if _, err := p.SSHCommand(ctx, fmt.Sprintf("sudo mv %s %s", newConfigPath, configPath)); err != nil {
+		return err
+	}
+
+	return nil
+}
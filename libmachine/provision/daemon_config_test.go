@@ -0,0 +1,342 @@
+package provision
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func TestDaemonFeatures(t *testing.T) {
+	if features := daemonFeatures(engine.Options{}); features != nil {
+		t.Fatalf("expected no features by default; received %v", features)
+	}
+
+	features := daemonFeatures(engine.Options{ContainerdSnapshotter: true})
+	expected := map[string]bool{"containerd-snapshotter": true}
+	if !reflect.DeepEqual(features, expected) {
+		t.Fatalf("expected features %v; received %v", expected, features)
+	}
+}
+
+func TestWriteDaemonConfig(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := writeDaemonConfig(context.Background(), commander, engine.Options{ContainerdSnapshotter: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo cat /etc/docker/daemon.json 2>/dev/null || true",
+		`sudo mkdir -p /etc/docker && printf '%s' '{"features":{"containerd-snapshotter":true}}' | sudo tee /etc/docker/daemon.json`,
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestWriteDaemonConfigNothingToWrite(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := writeDaemonConfig(context.Background(), commander, engine.Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(commander.Commands) != 1 {
+		t.Fatalf("expected daemon.json to be left alone; received %v", commander.Commands)
+	}
+}
+
+func TestWriteDaemonConfigBuilderGC(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+	engineOptions := engine.Options{
+		ContainerdSnapshotter: true,
+		BuilderGC:             true,
+		BuilderGCKeepStorage:  "10GB",
+	}
+
+	if err := writeDaemonConfig(context.Background(), commander, engineOptions); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo cat /etc/docker/daemon.json 2>/dev/null || true",
+		`sudo mkdir -p /etc/docker && printf '%s' '{"builder":{"gc":{"defaultKeepStorage":"10GB","enabled":true}},"features":{"containerd-snapshotter":true}}' | sudo tee /etc/docker/daemon.json`,
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestDaemonBuilder(t *testing.T) {
+	builder, err := daemonBuilder(engine.Options{BuilderGC: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &builderConfig{GC: builderGCConfig{Enabled: true}}
+	if !reflect.DeepEqual(builder, expected) {
+		t.Fatalf("expected builder %+v; received %+v", expected, builder)
+	}
+
+	for _, size := range []string{"512MB", "1.5GiB", "20gb", "1000000"} {
+		if _, err := daemonBuilder(engine.Options{BuilderGC: true, BuilderGCKeepStorage: size}); err != nil {
+			t.Fatalf("expected %q to be accepted; received %s", size, err)
+		}
+	}
+}
+
+func TestDaemonBuilderInvalidStorage(t *testing.T) {
+	for _, size := range []string{"lots", "10XB", "-1GB", "10GB'"} {
+		commander := &provisiontest.FakeSSHCommander{}
+
+		if err := writeDaemonConfig(context.Background(), commander, engine.Options{BuilderGC: true, BuilderGCKeepStorage: size}); err == nil {
+			t.Fatalf("expected an error for keep storage %q", size)
+		}
+		if len(commander.Commands) != 0 {
+			t.Fatalf("expected daemon.json to be left alone; received %v", commander.Commands)
+		}
+	}
+}
+
+func TestWriteDaemonConfigMaxDownloadAttempts(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := writeDaemonConfig(context.Background(), commander, engine.Options{MaxDownloadAttempts: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo cat /etc/docker/daemon.json 2>/dev/null || true",
+		`sudo mkdir -p /etc/docker && printf '%s' '{"max-download-attempts":10}' | sudo tee /etc/docker/daemon.json`,
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+
+	if err := writeDaemonConfig(context.Background(), commander, engine.Options{MaxDownloadAttempts: -1}); err == nil {
+		t.Fatal("expected an error for a negative number of attempts")
+	}
+}
+
+func TestWriteDaemonConfigValidated(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := writeDaemonConfig(context.Background(), commander, engine.Options{MaxDownloadAttempts: 10, ValidateDaemonConfig: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo cat /etc/docker/daemon.json 2>/dev/null || true",
+		`sudo mkdir -p /etc/docker && printf '%s' '{"max-download-attempts":10}' | sudo tee /etc/docker/daemon.json.new`,
+		"sudo dockerd --validate --config-file /etc/docker/daemon.json.new 2>&1",
+		"sudo mv /etc/docker/daemon.json.new /etc/docker/daemon.json",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestWriteDaemonConfigValidationFailed(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Errors: map[string]error{
+			"sudo dockerd --validate --config-file /etc/docker/daemon.json.new 2>&1": errors.New(`unable to configure the Docker daemon with file /etc/docker/daemon.json.new: the following directives don't match any configuration option: max-download-attempts`),
+		},
+	}
+
+	err := writeDaemonConfig(context.Background(), commander, engine.Options{MaxDownloadAttempts: 10, ValidateDaemonConfig: true})
+	if err == nil || !strings.Contains(err.Error(), "don't match any configuration option") {
+		t.Fatalf("expected the validation error; received %v", err)
+	}
+
+	if last := commander.Commands[len(commander.Commands)-1]; last != "sudo rm -f /etc/docker/daemon.json.new" {
+		t.Fatalf("expected the rejected config to be removed and the live one kept; received %v", commander.Commands)
+	}
+}
+
+func TestWriteDaemonConfigValidateUnsupported(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Errors: map[string]error{
+			"sudo dockerd --validate --config-file /etc/docker/daemon.json.new 2>&1": errors.New("unknown flag: --validate"),
+		},
+	}
+
+	if err := writeDaemonConfig(context.Background(), commander, engine.Options{MaxDownloadAttempts: 10, ValidateDaemonConfig: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if last := commander.Commands[len(commander.Commands)-1]; last != "sudo mv /etc/docker/daemon.json.new /etc/docker/daemon.json" {
+		t.Fatalf("expected the config to be installed unchecked; received %v", commander.Commands)
+	}
+}
+
+func TestWriteDaemonConfigCPURealtime(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := writeDaemonConfig(context.Background(), commander, engine.Options{CPURTRuntime: 950000, CPURTPeriod: 1000000}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo cat /etc/docker/daemon.json 2>/dev/null || true",
+		`sudo mkdir -p /etc/docker && printf '%s' '{"cpu-rt-period":1000000,"cpu-rt-runtime":950000}' | sudo tee /etc/docker/daemon.json`,
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestValidateCPURealtime(t *testing.T) {
+	for _, tc := range []struct {
+		runtime, period int
+		valid           bool
+	}{
+		{0, 0, true},
+		{950000, 0, true},
+		{950000, 1000000, true},
+		{-1, 1000000, false},
+		{950000, -1, false},
+		{1000001, 1000000, false},
+	} {
+		err := validateCPURealtime(tc.runtime, tc.period)
+		if tc.valid && err != nil {
+			t.Fatalf("expected runtime %d and period %d to be valid; received %v", tc.runtime, tc.period, err)
+		}
+		if !tc.valid && err == nil {
+			t.Fatalf("expected an error for runtime %d and period %d", tc.runtime, tc.period)
+		}
+	}
+}
+
+func TestWriteDaemonConfigMerge(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo cat /etc/docker/daemon.json 2>/dev/null || true": `{"log-opts":{"max-size":"10m"},"max-download-attempts":3,"features":{"buildkit":true}}`,
+		},
+	}
+
+	if err := writeDaemonConfig(context.Background(), commander, engine.Options{ContainerdSnapshotter: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo cat /etc/docker/daemon.json 2>/dev/null || true",
+		`sudo mkdir -p /etc/docker && printf '%s' '{"features":{"buildkit":true,"containerd-snapshotter":true},"log-opts":{"max-size":"10m"}}' | sudo tee /etc/docker/daemon.json`,
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestWriteDaemonConfigUnchanged(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo cat /etc/docker/daemon.json 2>/dev/null || true": "{\n  \"max-download-attempts\": 10\n}\n",
+		},
+	}
+
+	if err := writeDaemonConfig(context.Background(), commander, engine.Options{MaxDownloadAttempts: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(commander.Commands) != 1 {
+		t.Fatalf("expected daemon.json to be left alone; received %v", commander.Commands)
+	}
+}
+
+func TestWriteDaemonConfigRemoved(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo cat /etc/docker/daemon.json 2>/dev/null || true": `{"max-download-attempts":10,"features":{"containerd-snapshotter":true}}`,
+		},
+	}
+
+	if err := writeDaemonConfig(context.Background(), commander, engine.Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo cat /etc/docker/daemon.json 2>/dev/null || true",
+		"sudo rm -f /etc/docker/daemon.json",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestWriteDaemonConfigInvalidExisting(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo cat /etc/docker/daemon.json 2>/dev/null || true": `{"max-download-attempts":`,
+		},
+	}
+
+	if err := writeDaemonConfig(context.Background(), commander, engine.Options{MaxDownloadAttempts: 10}); err == nil {
+		t.Fatal("expected an error for an invalid daemon.json on the host")
+	}
+	if len(commander.Commands) != 1 {
+		t.Fatalf("expected the invalid daemon.json to be left alone; received %v", commander.Commands)
+	}
+}
+
+func TestWriteDaemonConfigValidatedFlags(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+	engineOptions := engine.Options{
+		StorageDriver:        "overlay2",
+		Labels:               []string{"zone=eu"},
+		ShutdownTimeout:      30,
+		MaxDownloadAttempts:  10,
+		ValidateDaemonConfig: true,
+	}
+
+	if err := writeDaemonConfig(context.Background(), commander, engineOptions); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "sudo dockerd --validate --config-file /etc/docker/daemon.json.new --storage-driver overlay2 --label zone=eu --shutdown-timeout=30 2>&1"
+	if commander.Commands[2] != expected {
+		t.Fatalf("expected the daemon flags to be validated with %q; received %v", expected, commander.Commands)
+	}
+}
+
+func TestWriteDaemonConfigValidatedEmpty(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := writeDaemonConfig(context.Background(), commander, engine.Options{StorageDriver: "overlay2", ValidateDaemonConfig: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo cat /etc/docker/daemon.json 2>/dev/null || true",
+		`sudo mkdir -p /etc/docker && printf '%s' '{}' | sudo tee /etc/docker/daemon.json.new`,
+		"sudo dockerd --validate --config-file /etc/docker/daemon.json.new --storage-driver overlay2 2>&1",
+		"sudo rm -f /etc/docker/daemon.json.new /etc/docker/daemon.json",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestWriteDockerOptionsRejectedFlags(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Errors: map[string]error{
+			"sudo dockerd --validate --config-file /etc/docker/daemon.json.new --storage-driver overlay2 --label provider=Driver --bogus 2>&1": errors.New("unknown flag: --bogus"),
+		},
+	}
+	p := newFakeDebianProvisioner(commander)
+	p.EngineOptions = engine.Options{StorageDriver: "overlay2", ArbitraryFlags: []string{"bogus"}, ValidateDaemonConfig: true}
+
+	if err := writeDockerOptions(context.Background(), p, 2376); err == nil {
+		t.Fatal("expected the rejected flag to be reported")
+	}
+
+	for _, cmd := range commander.Commands {
+		if strings.HasSuffix(cmd, "| sudo tee /etc/systemd/system/docker.service") {
+			t.Fatalf("expected the docker unit to be left alone; received %v", commander.Commands)
+		}
+	}
+}
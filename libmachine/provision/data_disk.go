@@ -0,0 +1,106 @@
+package provision
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"golang.org/x/net/context"
+)
+
+const dockerDataRoot = "/var/lib/docker"
+
+// setupDataDisk formats device with fsType if it does not hold a filesystem
+// yet, mounts it on the docker data root and persists the mount in
+// /etc/fstab. A device which already holds a filesystem, a partition table
+// or any other signature is never formatted.
+func setupDataDisk(ctx context.Context, p SSHCommander, device, fsType string) error {
+	if fsType == "" {
+		fsType = "ext4"
+	}
+
+	if fsType != "ext4" && fsType != "xfs" {
+		return fmt.Errorf("Unsupported data disk filesystem %q, expected ext4 or xfs", fsType)
+	}
+
+	if !path.IsAbs(device) {
+		return fmt.Errorf("Invalid data disk device %q, expected an absolute path", device)
+	}
+
+	existingFsType, err := blkidValue(ctx, p, device, "TYPE")
+	if err != nil {
+		return err
+	}
+
+	if existingFsType != "" {
+		log.Infof("Data disk %s already has a %s filesystem, not formatting it", device, existingFsType)
+		fsType = existingFsType
+	} else {
+		if err := checkNoSignatures(ctx, p, device); err != nil {
+			return err
+		}
+
+		log.Infof("Formatting data disk %s with %s...", device, fsType)
+		if _, err := p.SSHCommand(withCommandTimeout(ctx, installCommandTimeout), fmt.Sprintf("sudo mkfs.%s %s", fsType, device)); err != nil {
+			return err
+		}
+	}
+
+	// device names can change across reboots, the filesystem UUID doesn't
+	uuid, err := blkidValue(ctx, p, device, "UUID")
+	if err != nil {
+		return err
+	}
+	if uuid == "" {
+		return fmt.Errorf("The %s filesystem of data disk %s has no UUID to mount it by", fsType, device)
+	}
+
+	commands := []string{
+		fmt.Sprintf("sudo mkdir -p %s", dockerDataRoot),
+		fmt.Sprintf("if ! grep -qs '^UUID=%s ' /etc/fstab; then sudo sed -i '\\|[[:space:]]%s[[:space:]]|d' /etc/fstab && echo 'UUID=%s %s %s defaults 0 2' | sudo tee -a /etc/fstab; fi", uuid, dockerDataRoot, uuid, dockerDataRoot, fsType),
+		fmt.Sprintf("if ! mountpoint -q %s; then sudo mount %s; fi", dockerDataRoot, dockerDataRoot),
+	}
+
+	for _, cmd := range commands {
+		if _, err := p.SSHCommand(ctx, cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// blkidValue returns the tag of device, empty when the device doesn't
+// have it. blkid exits with 2 then, any other failure is an error.
+func blkidValue(ctx context.Context, p SSHCommander, device, tag string) (string, error) {
+	out, err := p.SSHCommand(ctx, fmt.Sprintf("sudo blkid -o value -s %s %s || [ $? -eq 2 ]", tag, device))
+	if err != nil {
+		return "", fmt.Errorf("Error probing data disk %s: %s", device, err)
+	}
+
+	return strings.TrimSpace(out), nil
+}
+
+// checkNoSignatures makes sure a device without a filesystem is blank:
+// a partition table or any other signature, of a RAID member or an LVM
+// physical volume for instance, means it holds data.
+func checkNoSignatures(ctx context.Context, p SSHCommander, device string) error {
+	ptType, err := blkidValue(ctx, p, device, "PTTYPE")
+	if err != nil {
+		return err
+	}
+	if ptType != "" {
+		return fmt.Errorf("Data disk %s has a %s partition table, not formatting it: give one of its partitions instead", device, ptType)
+	}
+
+	signatures, err := p.SSHCommand(ctx, fmt.Sprintf("sudo wipefs -n %s", device))
+	if err != nil {
+		return fmt.Errorf("Error probing data disk %s: %s", device, err)
+	}
+	if strings.TrimSpace(signatures) != "" {
+		return fmt.Errorf("Data disk %s holds signatures, not formatting it:\n%s", device, strings.TrimSpace(signatures))
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package provision
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+const (
+	blkidTypeCmd   = "sudo blkid -o value -s TYPE /dev/sdb || [ $? -eq 2 ]"
+	blkidPTTypeCmd = "sudo blkid -o value -s PTTYPE /dev/sdb || [ $? -eq 2 ]"
+	blkidUUIDCmd   = "sudo blkid -o value -s UUID /dev/sdb || [ $? -eq 2 ]"
+	dataDiskUUID   = "0f3c6d2e-8a4b-4c1e-9d7f-2b5a6e8c1d3f"
+)
+
+func TestSetupDataDiskUnformatted(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			blkidUUIDCmd: dataDiskUUID + "\n",
+		},
+	}
+
+	if err := setupDataDisk(context.Background(), commander, "/dev/sdb", "xfs"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		blkidTypeCmd,
+		blkidPTTypeCmd,
+		"sudo wipefs -n /dev/sdb",
+		"sudo mkfs.xfs /dev/sdb",
+		blkidUUIDCmd,
+		"sudo mkdir -p /var/lib/docker",
+		"if ! grep -qs '^UUID=" + dataDiskUUID + " ' /etc/fstab; then sudo sed -i '\\|[[:space:]]/var/lib/docker[[:space:]]|d' /etc/fstab && echo 'UUID=" + dataDiskUUID + " /var/lib/docker xfs defaults 0 2' | sudo tee -a /etc/fstab; fi",
+		"if ! mountpoint -q /var/lib/docker; then sudo mount /var/lib/docker; fi",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestSetupDataDiskAlreadyFormatted(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			blkidTypeCmd: "ext4\n",
+			blkidUUIDCmd: dataDiskUUID + "\n",
+		},
+	}
+
+	if err := setupDataDisk(context.Background(), commander, "/dev/sdb", "xfs"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		blkidTypeCmd,
+		blkidUUIDCmd,
+		"sudo mkdir -p /var/lib/docker",
+		"if ! grep -qs '^UUID=" + dataDiskUUID + " ' /etc/fstab; then sudo sed -i '\\|[[:space:]]/var/lib/docker[[:space:]]|d' /etc/fstab && echo 'UUID=" + dataDiskUUID + " /var/lib/docker ext4 defaults 0 2' | sudo tee -a /etc/fstab; fi",
+		"if ! mountpoint -q /var/lib/docker; then sudo mount /var/lib/docker; fi",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestSetupDataDiskNotBlank(t *testing.T) {
+	for _, responses := range []map[string]string{
+		{blkidPTTypeCmd: "gpt\n"},
+		{"sudo wipefs -n /dev/sdb": "DEVICE OFFSET TYPE              UUID LABEL\nsdb    0x1000 linux_raid_member\n"},
+	} {
+		commander := &provisiontest.FakeSSHCommander{Responses: responses}
+
+		if err := setupDataDisk(context.Background(), commander, "/dev/sdb", "ext4"); err == nil {
+			t.Fatalf("expected an error for a disk with %v", responses)
+		}
+
+		for _, cmd := range commander.Commands {
+			if strings.HasPrefix(cmd, "sudo mkfs") {
+				t.Fatalf("expected the disk not to be formatted; received %v", commander.Commands)
+			}
+		}
+	}
+}
+
+func TestSetupDataDiskProbeError(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Errors: map[string]error{
+			blkidTypeCmd: errors.New("exit status 4"),
+		},
+	}
+
+	if err := setupDataDisk(context.Background(), commander, "/dev/sdb", "ext4"); err == nil {
+		t.Fatal("expected a blkid failure to be reported")
+	}
+	if len(commander.Commands) != 1 {
+		t.Fatalf("expected nothing to be run after the failed probe; received %v", commander.Commands)
+	}
+}
+
+func TestSetupDataDiskInvalidOptions(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := setupDataDisk(context.Background(), commander, "/dev/sdb", "btrfs"); err == nil {
+		t.Fatal("expected an error for an unsupported filesystem")
+	}
+
+	if err := setupDataDisk(context.Background(), commander, "sdb", ""); err == nil {
+		t.Fatal("expected an error for a relative device path")
+	}
+
+	if len(commander.Commands) != 0 {
+		t.Fatalf("expected no commands to be run; received %v", commander.Commands)
+	}
+}
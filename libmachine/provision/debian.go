@@ -1,16 +1,16 @@
 package provision
 
 import (
-	"fmt"
+	"time"
 
 	"github.com/docker/machine/libmachine/auth"
 	"github.com/docker/machine/libmachine/drivers"
 	"github.com/docker/machine/libmachine/engine"
 	"github.com/docker/machine/libmachine/log"
-	"github.com/docker/machine/libmachine/mcnutils"
 	"github.com/docker/machine/libmachine/provision/pkgaction"
 	"github.com/docker/machine/libmachine/provision/serviceaction"
 	"github.com/docker/machine/libmachine/swarm"
+	"golang.org/x/net/context"
 )
 
 func init() {
@@ -33,118 +33,376 @@ func (provisioner *DebianProvisioner) String() string {
 	return "debian"
 }
 
-func (provisioner *DebianProvisioner) Package(name string, action pkgaction.PackageAction) error {
-	var packageAction string
+// CompatibleWithHost also matches the derivatives of Debian, like Raspbian,
+// which give it as ID_LIKE. Ubuntu has a provisioner of its own.
+func (provisioner *DebianProvisioner) CompatibleWithHost() bool {
+	info := provisioner.OsReleaseInfo
+	return info.ID == provisioner.OsReleaseID || (info.IDLike == provisioner.OsReleaseID && info.ID != "ubuntu")
+}
+
+func (provisioner *DebianProvisioner) Package(ctx context.Context, name string, action pkgaction.PackageAction) error {
+	return aptPackages(ctx, provisioner, []string{name}, action)
+}
+
+func (provisioner *DebianProvisioner) dockerDaemonResponding(ctx context.Context) bool {
+	log.Debug("checking docker daemon")
+
+	if out, err := provisioner.SSHCommand(ctx, "sudo docker version"); err != nil {
+		log.Warnf("Error getting SSH command to check if the daemon is up: %s", err)
+		log.Debugf("'sudo docker version' output:\n%s", out)
+		return false
+	}
+
+	// The daemon is up if the command worked.  Carry on.
+	return true
+}
 
-	updateMetadata := true
+func (provisioner *DebianProvisioner) Provision(ctx context.Context, swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error {
+	ctx, cancel := provisionContext(ctx, engineOptions)
+	defer cancel()
 
-	switch action {
-	case pkgaction.Install, pkgaction.Upgrade:
-		packageAction = "install"
-	case pkgaction.Remove:
-		packageAction = "remove"
-		updateMetadata = false
+	if err := ValidateOptions(provisioner, swarmOptions, authOptions, engineOptions); err != nil {
+		return err
 	}
 
-	switch name {
-	case "docker":
-		name = "docker-engine"
+	provisioner.SwarmOptions = swarmOptions
+	provisioner.AuthOptions = authOptions
+	provisioner.EngineOptions = engineOptions
+	swarmOptions.Env = engineOptions.Env
+
+	if provisioner.EngineOptions.StorageDriver == "" {
+		provisioner.EngineOptions.StorageDriver = "aufs"
 	}
 
-	if updateMetadata {
-		if _, err := provisioner.SSHCommand("sudo apt-get update"); err != nil {
+	// cloud-init may still be installing packages, so wait for it before
+	// the package manager is used at all
+	if !provisioner.EngineOptions.SkipCloudInitWait {
+		log.Debug("waiting for cloud-init")
+		if err := waitForCloudInit(ctx, provisioner, cloudInitTimeout(provisioner.EngineOptions.CloudInitTimeout)); err != nil {
 			return err
 		}
 	}
 
-	// handle the new docker-engine package; we can probably remove this
-	// after we have a few versions
-	if action == pkgaction.Upgrade && name == "docker-engine" {
-		// run the force remove on the existing lxc-docker package
-		// and remove the existing apt source list
+	// HACK: since debian does not come with sudo by default we install
+	log.Debug("installing sudo")
+	if _, err := provisioner.SSHCommand(withCommandTimeout(ctx, installCommandTimeout), "if ! type sudo; then apt-get update && DEBIAN_FRONTEND=noninteractive apt-get install -y sudo; fi"); err != nil {
+		return err
+	}
+
+	log.Debug("checking for passwordless sudo")
+	if err := checkSudo(ctx, provisioner); err != nil {
+		return err
+	}
+
+	log.Debug("setting hostname")
+	if err := provisioner.SetHostname(ctx, provisioner.Driver.GetMachineName()); err != nil {
+		return err
+	}
 
-		commands := []string{
-			"rm /etc/apt/sources.list.d/docker.list || true",
-			"apt-get remove -y lxc-docker || true",
+	if provisioner.EngineOptions.Timezone != "" {
+		log.Debug("setting the timezone")
+		if err := setTimezone(ctx, provisioner, provisioner.EngineOptions.Timezone); err != nil {
+			return err
 		}
+	}
 
-		for _, cmd := range commands {
-			command := fmt.Sprintf("sudo DEBIAN_FRONTEND=noninteractive %s", cmd)
-			if _, err := provisioner.SSHCommand(command); err != nil {
-				return err
-			}
+	if len(provisioner.EngineOptions.SystemCACerts) != 0 {
+		log.Debug("installing the system CA certificates")
+		if err := installSystemCACerts(ctx, provisioner, provisioner.EngineOptions.SystemCACerts); err != nil {
+			return err
+		}
+	}
+
+	if provisioner.EngineOptions.AptProxy != "" {
+		log.Debug("configuring the apt proxy")
+		if err := configureAptProxy(ctx, provisioner, provisioner.EngineOptions.AptProxy); err != nil {
+			return err
 		}
 	}
 
-	command := fmt.Sprintf("DEBIAN_FRONTEND=noninteractive sudo -E apt-get %s -y  %s", packageAction, name)
+	if provisioner.EngineOptions.AptParallelDownloads != 0 {
+		log.Debug("configuring parallel apt downloads")
+		if err := configureAptDownloads(ctx, provisioner, provisioner.EngineOptions.AptParallelDownloads); err != nil {
+			return err
+		}
+	}
 
-	log.Debugf("package: action=%s name=%s", action.String(), name)
+	if len(provisioner.EngineOptions.AptMirrors) != 0 {
+		log.Debug("configuring the apt mirrors")
+		if err := configureAptMirrors(ctx, provisioner, provisioner.EngineOptions.AptMirrors); err != nil {
+			return err
+		}
+	}
 
-	if _, err := provisioner.SSHCommand(command); err != nil {
+	if provisioner.EngineOptions.EnableMemoryCgroup {
+		log.Debug("enabling the memory cgroup")
+		rebootRequired, err := enableMemoryCgroup(ctx, provisioner)
+		if err != nil {
+			return err
+		}
+		if rebootRequired {
+			log.Warn("The memory cgroup has been enabled on the kernel command line, the machine needs a reboot for docker to enforce memory limits")
+		}
+	}
+
+	if provisioner.EngineOptions.EnableNTP {
+		log.Debug("enabling time synchronization")
+		if err := enableTimeSync(ctx, provisioner); err != nil {
+			return err
+		}
+	}
+
+	log.Debug("installing base packages")
+	if err := aptPackages(ctx, provisioner, provisioner.Packages, pkgaction.Install); err != nil {
 		return err
 	}
 
-	return nil
-}
+	if provisioner.EngineOptions.EnableMultiarch {
+		log.Debug("registering the binfmt handlers")
+		if err := enableMultiarch(ctx, provisioner); err != nil {
+			return err
+		}
+	}
 
-func (provisioner *DebianProvisioner) dockerDaemonResponding() bool {
-	log.Debug("checking docker daemon")
+	if provisioner.EngineOptions.HardenSSH {
+		log.Debug("hardening SSH")
+		if err := hardenSSH(ctx, provisioner); err != nil {
+			return err
+		}
+	}
 
-	if out, err := provisioner.SSHCommand("sudo docker version"); err != nil {
-		log.Warnf("Error getting SSH command to check if the daemon is up: %s", err)
-		log.Debugf("'sudo docker version' output:\n%s", out)
-		return false
+	if provisioner.EngineOptions.JournalMaxUse != "" {
+		log.Debug("limiting the journal size")
+		if err := limitJournalSize(ctx, provisioner, provisioner.EngineOptions.JournalMaxUse); err != nil {
+			return err
+		}
 	}
 
-	// The daemon is up if the command worked.  Carry on.
-	return true
-}
+	if provisioner.EngineOptions.ContainerLogRotateSize != "" {
+		log.Debug("configuring container log rotation")
+		if err := rotateContainerLogs(ctx, provisioner, provisioner.EngineOptions.ContainerLogRotateSize); err != nil {
+			return err
+		}
+	}
 
-func (provisioner *DebianProvisioner) Provision(swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error {
-	provisioner.SwarmOptions = swarmOptions
-	provisioner.AuthOptions = authOptions
-	provisioner.EngineOptions = engineOptions
-	swarmOptions.Env = engineOptions.Env
+	if provisioner.EngineOptions.KubernetesReady {
+		log.Debug("preparing the host for kubernetes")
+		if err := prepareKubernetes(ctx, provisioner); err != nil {
+			return err
+		}
+	}
 
-	if provisioner.EngineOptions.StorageDriver == "" {
-		provisioner.EngineOptions.StorageDriver = "aufs"
+	if len(provisioner.EngineOptions.Sysctls) != 0 {
+		log.Debug("applying the sysctls")
+		if err := applySysctls(ctx, provisioner, provisioner.EngineOptions.Sysctls); err != nil {
+			return err
+		}
 	}
 
-	// HACK: since debian does not come with sudo by default we install
-	log.Debug("installing sudo")
-	if _, err := provisioner.SSHCommand("if ! type sudo; then apt-get update && DEBIAN_FRONTEND=noninteractive apt-get install -y sudo; fi"); err != nil {
-		return err
+	if provisioner.EngineOptions.DataDisk != "" {
+		log.Debug("setting up the data disk")
+		if err := setupDataDisk(ctx, provisioner, provisioner.EngineOptions.DataDisk, provisioner.EngineOptions.DataDiskFilesystem); err != nil {
+			return err
+		}
 	}
 
-	log.Debug("setting hostname")
-	if err := provisioner.SetHostname(provisioner.Driver.GetMachineName()); err != nil {
+	log.Debug("removing the drop-ins of unset options")
+	if err := removeUnsetDropIns(ctx, provisioner, provisioner.EngineOptions); err != nil {
 		return err
 	}
 
-	log.Debug("installing base packages")
-	for _, pkg := range provisioner.Packages {
-		if err := provisioner.Package(pkg, pkgaction.Install); err != nil {
+	if hasResourceSlice(provisioner.EngineOptions.ResourceSlice) {
+		log.Debug("setting up the docker resource slice")
+		if err := writeResourceSlice(ctx, provisioner, provisioner.EngineOptions.ResourceSlice); err != nil {
 			return err
 		}
 	}
 
+	if provisioner.EngineOptions.DockerGroupUser != "" {
+		log.Debug("adding the user to the docker group")
+		if err := addDockerGroupUser(ctx, provisioner, provisioner.EngineOptions.DockerGroupUser); err != nil {
+			return err
+		}
+	}
+
+	if provisioner.EngineOptions.RestartPolicy != "" {
+		log.Debug("configuring the docker restart policy")
+		if err := configureRestartPolicy(ctx, provisioner, provisioner.EngineOptions.RestartPolicy, provisioner.EngineOptions.RestartSec); err != nil {
+			return err
+		}
+	}
+
+	if provisioner.EngineOptions.OOMScoreAdjust != 0 {
+		log.Debug("configuring the OOM score adjustment")
+		if err := configureOOMScoreAdjust(ctx, provisioner, provisioner.EngineOptions.OOMScoreAdjust); err != nil {
+			return err
+		}
+	}
+
+	if hasServiceLimits(provisioner.EngineOptions.ServiceLimits) {
+		log.Debug("configuring the service limits")
+		if err := configureServiceLimits(ctx, provisioner, provisioner.EngineOptions.ServiceLimits); err != nil {
+			return err
+		}
+	}
+
+	if provisioner.EngineOptions.Slice != "" {
+		log.Debug("configuring the slice")
+		if err := configureSlice(ctx, provisioner, provisioner.EngineOptions.Slice); err != nil {
+			return err
+		}
+	}
+
+	if provisioner.EngineOptions.HostDNS {
+		log.Debug("reading the host nameservers")
+		nameservers, err := hostNameservers(ctx, provisioner)
+		if err != nil {
+			return err
+		}
+		if len(nameservers) == 0 {
+			log.Warn("The host has no usable upstream nameserver, the containers keep the Docker DNS defaults.")
+		}
+		provisioner.EngineOptions.DNS = append(provisioner.EngineOptions.DNS, nameservers...)
+	}
+
+	if len(provisioner.EngineOptions.RegistryCACerts) != 0 {
+		log.Debug("installing the registry CA certificates")
+		if err := installRegistryCACerts(ctx, provisioner, provisioner.EngineOptions.RegistryCACerts); err != nil {
+			return err
+		}
+	}
+
+	if len(provisioner.EngineOptions.SocketAliases) != 0 {
+		log.Debug("creating the docker socket aliases")
+		if err := createSocketAliases(ctx, provisioner, provisioner.EngineOptions.SocketAliases); err != nil {
+			return err
+		}
+	}
+
+	if provisioner.EngineOptions.CheckRegistryMirrors {
+		log.Debug("checking the registry mirrors")
+		provisioner.EngineOptions.RegistryMirror = reachableMirrors(ctx, provisioner, provisioner.EngineOptions.RegistryMirror)
+	}
+
+	if ipForwardNeeded(provisioner.EngineOptions) {
+		log.Debug("enabling IP forwarding")
+		if err := enableIPForward(ctx, provisioner); err != nil {
+			return err
+		}
+	}
+
+	log.Debug("checking the kernel config")
+	if err := CheckKernelConfig(ctx, provisioner, provisioner.EngineOptions); err != nil {
+		return err
+	}
+
 	log.Debug("installing docker")
-	if err := installDockerGeneric(provisioner, engineOptions.InstallURL); err != nil {
+	if err := installDockerGeneric(ctx, provisioner, engineOptions.InstallURL); err != nil {
 		return err
 	}
 
+	// the install script fetches the docker packages through apt
+	if provisioner.EngineOptions.CleanAptCache {
+		log.Debug("cleaning the apt cache")
+		if err := cleanAptCache(ctx, provisioner); err != nil {
+			return err
+		}
+	}
+
 	log.Debug("waiting for docker daemon")
-	if err := mcnutils.WaitFor(provisioner.dockerDaemonResponding); err != nil {
+	if err := waitFor(ctx, provisioner.dockerDaemonResponding); err != nil {
 		return err
 	}
 
+	if len(provisioner.EngineOptions.BuildDNS) != 0 {
+		log.Debug("configuring the build nameservers")
+		if err := configureBuildDNS(ctx, provisioner); err != nil {
+			return err
+		}
+	}
+
+	if bridge := provisioner.EngineOptions.BridgeName; bridge != "" && bridge != "docker0" && bridge != "none" {
+		log.Debug("checking the bridge")
+		if err := checkBridge(ctx, provisioner, bridge); err != nil {
+			return err
+		}
+	}
+
+	if provisioner.EngineOptions.InitBinary != "" {
+		log.Debug("checking the init binary")
+		if err := checkInitBinary(ctx, provisioner, provisioner.EngineOptions.InitBinary); err != nil {
+			return err
+		}
+	}
+
+	runCache := false
+	if provisioner.EngineOptions.RegistryCache {
+		log.Debug("electing the registry cache")
+		elected, err := electRegistryCache(provisioner, provisioner.SharedStores.RegistryCache)
+		if err != nil {
+			return err
+		}
+		runCache = elected
+	}
+
+	rejoinSwarm := false
+	if swarmOptions.RejoinTimeout > 0 {
+		log.Debug("checking the swarm membership")
+		member, err := isSwarmMember(ctx, provisioner)
+		if err != nil {
+			return err
+		}
+		rejoinSwarm = member
+	}
+
 	provisioner.AuthOptions = setRemoteAuthOptions(provisioner)
 
 	log.Debug("configuring auth")
-	if err := ConfigureAuth(provisioner); err != nil {
+	if err := ConfigureAuth(ctx, provisioner); err != nil {
 		return err
 	}
 
+	if rejoinSwarm {
+		log.Debug("waiting for the node to rejoin the swarm")
+		timeout := time.Duration(swarmOptions.RejoinTimeout) * time.Second
+		if err := waitForSwarmRejoin(ctx, provisioner, int(timeout/swarmReadyInterval)+1, swarmReadyInterval); err != nil {
+			return err
+		}
+	}
+
+	if runCache {
+		log.Debug("running the registry cache")
+		if err := runRegistryCache(ctx, provisioner); err != nil {
+			return err
+		}
+	}
+
+	if provisioner.EngineOptions.InstallComposePlugin {
+		log.Debug("installing the compose plugin")
+		if err := installComposePlugin(ctx, provisioner, provisioner.EngineOptions.ComposePluginVersion); err != nil {
+			return err
+		}
+	}
+
+	if swarmOptions.AutoRole {
+		log.Debug("joining swarm mode")
+		role, err := configureSwarmAutoRole(ctx, provisioner, swarmOptions, provisioner.SharedStores.SwarmTokens)
+		if err != nil {
+			return err
+		}
+
+		if len(swarmOptions.NodeLabelManifest) != 0 {
+			if role == "manager" {
+				log.Debug("applying the swarm node labels")
+				if err := ApplySwarmNodeLabels(ctx, provisioner, swarmOptions.NodeLabelManifest); err != nil {
+					return err
+				}
+			} else {
+				log.Info("Only a manager can label swarm nodes, the labels of this worker are set once ApplySwarmNodeLabels runs on the manager")
+			}
+		}
+	}
+
 	log.Debug("configuring swarm")
 	if err := configureSwarm(provisioner, swarmOptions, provisioner.AuthOptions); err != nil {
 		return err
@@ -152,9 +410,28 @@ func (provisioner *DebianProvisioner) Provision(swarmOptions swarm.Options, auth
 
 	// enable in systemd
 	log.Debug("enabling docker in systemd")
-	if err := provisioner.Service("docker", serviceaction.Enable); err != nil {
+	if err := provisioner.Service(ctx, "docker", serviceaction.Enable); err != nil {
 		return err
 	}
 
+	if provisioner.EngineOptions.VsockAddress != "" {
+		log.Debug("serving the Docker API over vsock")
+		if err := serveVsock(ctx, provisioner, provisioner.EngineOptions.VsockAddress); err != nil {
+			return err
+		}
+	}
+
+	if len(provisioner.EngineOptions.PreloadImages) != 0 {
+		log.Info("Preloading images...")
+		preloadImages(ctx, provisioner, provisioner.EngineOptions.PreloadImages)
+	}
+
+	if provisioner.EngineOptions.WriteMotd {
+		log.Debug("writing the motd banner")
+		if err := writeMotd(ctx, provisioner, time.Now()); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
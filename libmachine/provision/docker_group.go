@@ -0,0 +1,34 @@
+package provision
+
+import (
+	"fmt"
+	"regexp"
+
+	"golang.org/x/net/context"
+)
+
+const dockerGroup = "docker"
+
+var reUserName = regexp.MustCompile(`^[a-z_][a-z0-9_-]*\$?$`)
+
+// addDockerGroupUser makes sure the docker group exists and adds user to
+// it, so the user can reach the daemon socket without sudo. The daemon is
+// told to hand the socket to that group through its flags.
+func addDockerGroupUser(ctx context.Context, p SSHCommander, user string) error {
+	if !reUserName.MatchString(user) {
+		return fmt.Errorf("Invalid docker group user %q", user)
+	}
+
+	commands := []string{
+		fmt.Sprintf("sudo groupadd -f %s", dockerGroup),
+		fmt.Sprintf("sudo usermod -aG %s %s", dockerGroup, user),
+	}
+
+	for _, cmd := range commands {
+		if _, err := p.SSHCommand(ctx, cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func TestAddDockerGroupUser(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := addDockerGroupUser(context.Background(), commander, "pirate"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo groupadd -f docker",
+		"sudo usermod -aG docker pirate",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestAddDockerGroupUserInvalid(t *testing.T) {
+	for _, user := range []string{"", "Pirate", "pi rate", "pirate;reboot"} {
+		commander := &provisiontest.FakeSSHCommander{}
+
+		if err := addDockerGroupUser(context.Background(), commander, user); err == nil {
+			t.Fatalf("expected an error for user %q", user)
+		}
+		if len(commander.Commands) != 0 {
+			t.Fatalf("expected no commands for user %q; received %v", user, commander.Commands)
+		}
+	}
+}
+
+func TestEngineFlagsDockerGroup(t *testing.T) {
+	flags, err := engineFlags(engine.Options{DockerGroupUser: "pirate"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"group=docker"}
+	if !reflect.DeepEqual(flags, expected) {
+		t.Fatalf("expected flags %v; received %v", expected, flags)
+	}
+}
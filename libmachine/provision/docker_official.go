@@ -0,0 +1,89 @@
+package provision
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/machine/libmachine/provision/pkgaction"
+	"golang.org/x/net/context"
+)
+
+const (
+	dockerOfficialRepoURL = "https://download.docker.com/linux"
+	dockerOfficialKeyPath = "/etc/apt/keyrings/docker.asc"
+)
+
+// the packages InstallStrategyDockerOfficial installs
+var dockerOfficialPackages = []string{"docker-ce", "docker-ce-cli", "containerd.io"}
+
+// dockerOfficialDistro returns the directory of download.docker.com holding
+// the repository for the host distribution.
+func dockerOfficialDistro(info *OsRelease) (string, error) {
+	if info == nil {
+		return "", fmt.Errorf("The %s install strategy needs the host distribution, which is unknown", InstallStrategyDockerOfficial)
+	}
+
+	switch info.ID {
+	case "debian", "ubuntu", "raspbian":
+		return info.ID, nil
+	}
+
+	if isDebianBased(info) {
+		return "debian", nil
+	}
+
+	return "", fmt.Errorf("The %s install strategy needs a Debian based host, not %s", InstallStrategyDockerOfficial, info.ID)
+}
+
+// dockerOfficialRepoCommands returns the commands adding the signing key
+// and the apt source of Docker's repository for the distribution, release
+// codename and dpkg architecture of the host.
+func dockerOfficialRepoCommands(distro, codename, arch string) []string {
+	source := fmt.Sprintf("deb [arch=%s signed-by=%s] %s/%s %s stable", arch, dockerOfficialKeyPath, dockerOfficialRepoURL, distro, codename)
+
+	return []string{
+		"sudo install -m 0755 -d /etc/apt/keyrings",
+		fmt.Sprintf("sudo curl -fsSL %s/%s/gpg -o %s", dockerOfficialRepoURL, distro, dockerOfficialKeyPath),
+		fmt.Sprintf("sudo chmod a+r %s", dockerOfficialKeyPath),
+		fmt.Sprintf("printf '%%s\\n' '%s' | sudo tee %s", source, dockerAptSourcePath),
+	}
+}
+
+// installDockerOfficial installs docker with the
+// InstallStrategyDockerOfficial strategy, unless docker is already there.
+func installDockerOfficial(ctx context.Context, p Provisioner) error {
+	out, err := p.SSHCommand(ctx, "command -v docker || true")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(out) != "" {
+		return nil
+	}
+
+	info, err := p.GetOsReleaseInfo()
+	if err != nil {
+		return err
+	}
+
+	distro, err := dockerOfficialDistro(info)
+	if err != nil {
+		return err
+	}
+
+	if info.VersionCodename == "" {
+		return fmt.Errorf("The %s install strategy needs the release codename, which %s doesn't give in /etc/os-release", InstallStrategyDockerOfficial, info.PrettyName)
+	}
+
+	arch, err := p.SSHCommand(ctx, "dpkg --print-architecture")
+	if err != nil {
+		return err
+	}
+
+	for _, cmd := range dockerOfficialRepoCommands(distro, info.VersionCodename, strings.TrimSpace(arch)) {
+		if _, err := p.SSHCommand(ctx, cmd); err != nil {
+			return err
+		}
+	}
+
+	return aptPackages(ctx, p, dockerOfficialPackages, pkgaction.Install)
+}
@@ -0,0 +1,84 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func TestDockerOfficialDistro(t *testing.T) {
+	for expected, info := range map[string]*OsRelease{
+		"debian":   {ID: "debian"},
+		"ubuntu":   {ID: "ubuntu", IDLike: "debian"},
+		"raspbian": {ID: "raspbian", IDLike: "debian"},
+	} {
+		distro, err := dockerOfficialDistro(info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if distro != expected {
+			t.Fatalf("expected distro %q; received %q", expected, distro)
+		}
+	}
+
+	for _, info := range []*OsRelease{nil, {ID: "fedora"}} {
+		if _, err := dockerOfficialDistro(info); err == nil {
+			t.Fatalf("expected an error for %v", info)
+		}
+	}
+}
+
+func TestDockerOfficialRepoCommands(t *testing.T) {
+	expected := []string{
+		"sudo install -m 0755 -d /etc/apt/keyrings",
+		"sudo curl -fsSL https://download.docker.com/linux/debian/gpg -o /etc/apt/keyrings/docker.asc",
+		"sudo chmod a+r /etc/apt/keyrings/docker.asc",
+		"printf '%s\\n' 'deb [arch=arm64 signed-by=/etc/apt/keyrings/docker.asc] https://download.docker.com/linux/debian bookworm stable' | sudo tee /etc/apt/sources.list.d/docker.list",
+	}
+
+	if commands := dockerOfficialRepoCommands("debian", "bookworm", "arm64"); !reflect.DeepEqual(commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commands)
+	}
+}
+
+func TestInstallDockerOfficial(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"dpkg --print-architecture": "armhf\n",
+		},
+	}
+	p := newFakeDebianProvisioner(commander)
+	p.EngineOptions.InstallStrategy = InstallStrategyDockerOfficial
+	p.EngineOptions.BatchPackageInstall = true
+	p.OsReleaseInfo = &OsRelease{ID: "raspbian", IDLike: "debian", VersionCodename: "bullseye"}
+
+	if err := installDockerGeneric(context.Background(), p, "https://get.docker.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"command -v docker || true",
+		"dpkg --print-architecture",
+		"sudo install -m 0755 -d /etc/apt/keyrings",
+		"sudo curl -fsSL https://download.docker.com/linux/raspbian/gpg -o /etc/apt/keyrings/docker.asc",
+		"sudo chmod a+r /etc/apt/keyrings/docker.asc",
+		"printf '%s\\n' 'deb [arch=armhf signed-by=/etc/apt/keyrings/docker.asc] https://download.docker.com/linux/raspbian bullseye stable' | sudo tee /etc/apt/sources.list.d/docker.list",
+		"sudo apt-get update",
+		"DEBIAN_FRONTEND=noninteractive sudo -E apt-get install -y -o DPkg::Lock::Timeout=120 docker-ce docker-ce-cli containerd.io",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestInstallDockerOfficialNoCodename(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+	p := newFakeDebianProvisioner(commander)
+	p.OsReleaseInfo = &OsRelease{ID: "debian", PrettyName: "Debian GNU/Linux 8 (jessie)"}
+
+	if err := installDockerOfficial(context.Background(), p); err == nil {
+		t.Fatal("expected an error without a release codename")
+	}
+}
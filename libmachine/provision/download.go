@@ -0,0 +1,39 @@
+package provision
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+var reSHA256 = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// downloadAndVerify downloads url to dest on the host and checks the file
+// against the expected sha256 checksum, so a corrupted or tampered download
+// is never used. The file is removed when the checksum doesn't match.
+func downloadAndVerify(ctx context.Context, p SSHCommander, url, sha256, dest string) error {
+	if !reSHA256.MatchString(sha256) {
+		return fmt.Errorf("Invalid sha256 checksum %q, expected 64 lowercase hex characters", sha256)
+	}
+
+	if _, err := p.SSHCommand(withCommandTimeout(ctx, installCommandTimeout), fmt.Sprintf("curl -sSL -o %s %s", dest, url)); err != nil {
+		return err
+	}
+
+	out, err := p.SSHCommand(ctx, fmt.Sprintf("sha256sum %s", dest))
+	if err != nil {
+		return err
+	}
+
+	fields := strings.Fields(out)
+	if len(fields) == 0 || fields[0] != sha256 {
+		if _, err := p.SSHCommand(ctx, fmt.Sprintf("rm -f %s", dest)); err != nil {
+			return err
+		}
+		return fmt.Errorf("Checksum mismatch for %s: expected %s, received %q", url, sha256, out)
+	}
+
+	return nil
+}
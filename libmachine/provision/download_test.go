@@ -0,0 +1,87 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+const testSHA256 = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+func TestDownloadAndVerify(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sha256sum /tmp/script.sh": testSHA256 + "  /tmp/script.sh\n",
+		},
+	}
+
+	if err := downloadAndVerify(context.Background(), commander, "https://get.docker.com", testSHA256, "/tmp/script.sh"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"curl -sSL -o /tmp/script.sh https://get.docker.com",
+		"sha256sum /tmp/script.sh",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestDownloadAndVerifyMismatch(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sha256sum /tmp/script.sh": "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  /tmp/script.sh\n",
+		},
+	}
+
+	if err := downloadAndVerify(context.Background(), commander, "https://get.docker.com", testSHA256, "/tmp/script.sh"); err == nil {
+		t.Fatal("expected a checksum mismatch error")
+	}
+
+	expected := []string{
+		"curl -sSL -o /tmp/script.sh https://get.docker.com",
+		"sha256sum /tmp/script.sh",
+		"rm -f /tmp/script.sh",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestDownloadAndVerifyInvalidChecksum(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := downloadAndVerify(context.Background(), commander, "https://get.docker.com", "abc", "/tmp/script.sh"); err == nil {
+		t.Fatal("expected an error for an invalid checksum")
+	}
+	if len(commander.Commands) != 0 {
+		t.Fatalf("expected nothing to be downloaded; received %v", commander.Commands)
+	}
+}
+
+func TestInstallDockerGenericVerified(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sha256sum /tmp/install-docker.sh": testSHA256 + "  /tmp/install-docker.sh\n",
+		},
+	}
+	p := newFakeDebianProvisioner(commander)
+	p.EngineOptions.InstallURLSHA256 = testSHA256
+
+	if err := installDockerGeneric(context.Background(), p, "https://get.docker.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"command -v docker || true",
+		"curl -sSL -o /tmp/install-docker.sh https://get.docker.com",
+		"sha256sum /tmp/install-docker.sh",
+		"sh /tmp/install-docker.sh && rm -f /tmp/install-docker.sh",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
@@ -9,5 +9,8 @@ type EngineConfigContext struct {
 	DockerPort       int
 	AuthOptions      auth.Options
 	EngineOptions    engine.Options
+	EngineFlags      []string
 	DockerOptionsDir string
+	// Slice is the systemd slice the docker service runs in, if any.
+	Slice string
 }
@@ -0,0 +1,255 @@
+package provision
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker/pkg/units"
+	"github.com/docker/machine/libmachine/engine"
+)
+
+// allInsecureRegistriesCIDR matches every registry reachable over IPv4
+const allInsecureRegistriesCIDR = "0.0.0.0/0"
+
+var reEnvName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// network interface names are at most 15 characters
+var reBridgeName = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,15}$`)
+
+// bridge driver options the daemon accepts as defaults for new networks
+var defaultNetworkOptKeys = map[string]bool{
+	"com.docker.network.driver.mtu":                  true,
+	"com.docker.network.bridge.enable_icc":           true,
+	"com.docker.network.bridge.enable_ip_masquerade": true,
+	"com.docker.network.bridge.host_binding_ipv4":    true,
+	"com.docker.network.bridge.gateway_mode_ipv4":    true,
+	"com.docker.network.bridge.gateway_mode_ipv6":    true,
+	"com.docker.network.bridge.inhibit_ipv4":         true,
+	"com.docker.network.container_iface_prefix":      true,
+}
+
+// bridge driver options which only make sense for a single network
+var perNetworkOptKeys = map[string]bool{
+	"com.docker.network.bridge.name":           true,
+	"com.docker.network.bridge.default_bridge": true,
+}
+
+// validateEngineEnv checks that every engine environment entry is a
+// KEY=value pair with a valid variable name, since the entries end up
+// verbatim in shell profiles and systemd units.
+func validateEngineEnv(env []string) error {
+	for _, e := range env {
+		parts := strings.SplitN(e, "=", 2)
+		if len(parts) != 2 || !reEnvName.MatchString(parts[0]) {
+			return fmt.Errorf("Invalid engine environment variable %q, expected KEY=value", e)
+		}
+	}
+
+	return nil
+}
+
+// validateHostPath checks that p is an absolute path on the host which can
+// be put on the daemon command line as is.
+func validateHostPath(name, p string) error {
+	if !path.IsAbs(p) || strings.ContainsAny(p, " \t\n'\"") {
+		return fmt.Errorf("Invalid %s %q, expected an absolute path without spaces or quotes", name, p)
+	}
+
+	return nil
+}
+
+// ipv6Flags returns the flags enabling IPv6 on the default bridge. The
+// ip6tables rules follow the iptables ones: turning iptables off in the
+// arbitrary flags turns ip6tables off too.
+func ipv6Flags(engineOptions engine.Options) ([]string, error) {
+	if !engineOptions.Ipv6 {
+		if engineOptions.FixedCIDRv6 != "" {
+			return nil, fmt.Errorf("The fixed IPv6 subnet %s needs IPv6 to be enabled", engineOptions.FixedCIDRv6)
+		}
+		return nil, nil
+	}
+
+	flags := []string{"ipv6"}
+
+	if engineOptions.FixedCIDRv6 != "" {
+		ip, _, err := net.ParseCIDR(engineOptions.FixedCIDRv6)
+		if err != nil || ip.To4() != nil {
+			return nil, fmt.Errorf("Invalid fixed IPv6 subnet %q, expected an IPv6 CIDR like 2001:db8:1::/64", engineOptions.FixedCIDRv6)
+		}
+		flags = append(flags, fmt.Sprintf("fixed-cidr-v6=%s", engineOptions.FixedCIDRv6))
+	}
+
+	for _, flag := range engineOptions.ArbitraryFlags {
+		if flag == "iptables=false" {
+			flags = append(flags, "ip6tables=false")
+			break
+		}
+	}
+
+	return flags, nil
+}
+
+// defaultNetworkOptFlags turns the key=value bridge options into
+// default-network-opt flags.
+func defaultNetworkOptFlags(opts []string) ([]string, error) {
+	flags := []string{}
+
+	for _, opt := range opts {
+		parts := strings.SplitN(opt, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid default network option %q, expected key=value", opt)
+		}
+
+		key := parts[0]
+		if perNetworkOptKeys[key] {
+			return nil, fmt.Errorf("The network option %q can only be set per network, use 'docker network create -o' instead", key)
+		}
+		if !defaultNetworkOptKeys[key] {
+			return nil, fmt.Errorf("Unsupported default network option %q", key)
+		}
+
+		flags = append(flags, fmt.Sprintf("default-network-opt=bridge=%s", opt))
+	}
+
+	return flags, nil
+}
+
+// engineFlags validates the engine options and returns the daemon flags,
+// without their leading dashes, for the typed engine options followed by
+// the user supplied arbitrary flags.
+func engineFlags(engineOptions engine.Options) ([]string, error) {
+	flags := []string{}
+
+	if err := validateEngineEnv(engineOptions.Env); err != nil {
+		return nil, err
+	}
+
+	if err := validateRegistryMirrors(engineOptions.RegistryMirror); err != nil {
+		return nil, err
+	}
+
+	if engineOptions.AllowAllInsecureRegistries {
+		flags = append(flags, fmt.Sprintf("insecure-registry=%s", allInsecureRegistriesCIDR))
+	}
+
+	if engineOptions.NoNewPrivileges {
+		flags = append(flags, "no-new-privileges")
+	}
+
+	if engineOptions.DisableLegacyRegistry {
+		flags = append(flags, "disable-legacy-registry")
+	}
+
+	v6Flags, err := ipv6Flags(engineOptions)
+	if err != nil {
+		return nil, err
+	}
+	flags = append(flags, v6Flags...)
+
+	for _, dns := range engineOptions.DNS {
+		if net.ParseIP(dns) == nil {
+			return nil, fmt.Errorf("Invalid DNS server %q, expected an IP address", dns)
+		}
+		flags = append(flags, fmt.Sprintf("dns=%s", dns))
+	}
+
+	if engineOptions.SelinuxEnabled {
+		flags = append(flags, "selinux-enabled")
+	}
+
+	switch engineOptions.LogLevel {
+	case "":
+	case "debug", "info", "warn", "error", "fatal":
+		flags = append(flags, fmt.Sprintf("log-level=%s", engineOptions.LogLevel))
+	default:
+		return nil, fmt.Errorf("Invalid daemon log level %q, expected debug, info, warn, error or fatal", engineOptions.LogLevel)
+	}
+
+	if engineOptions.ShutdownTimeout < 0 {
+		return nil, fmt.Errorf("Invalid shutdown timeout %d, it must not be negative", engineOptions.ShutdownTimeout)
+	}
+	if engineOptions.ShutdownTimeout > 0 {
+		flags = append(flags, fmt.Sprintf("shutdown-timeout=%d", engineOptions.ShutdownTimeout))
+	}
+
+	if engineOptions.DefaultStopTimeout != 0 {
+		return nil, ErrDefaultStopTimeoutUnsupported
+	}
+
+	if engineOptions.PullTimeout != 0 {
+		return nil, ErrPullTimeoutUnsupported
+	}
+
+	if engineOptions.MaxConcurrentDownloads < 0 {
+		return nil, fmt.Errorf("Invalid maximum concurrent downloads %d, it must not be negative", engineOptions.MaxConcurrentDownloads)
+	}
+	if engineOptions.MaxConcurrentDownloads > 0 {
+		flags = append(flags, fmt.Sprintf("max-concurrent-downloads=%d", engineOptions.MaxConcurrentDownloads))
+	}
+
+	if engineOptions.DefaultShmSize != "" {
+		size, err := units.RAMInBytes(engineOptions.DefaultShmSize)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("Invalid default shm size %q, expected a size like 64M", engineOptions.DefaultShmSize)
+		}
+		flags = append(flags, fmt.Sprintf("default-shm-size=%s", engineOptions.DefaultShmSize))
+	}
+
+	if engineOptions.Pidfile != "" {
+		if err := validateHostPath("pidfile", engineOptions.Pidfile); err != nil {
+			return nil, err
+		}
+		flags = append(flags, fmt.Sprintf("pidfile=%s", engineOptions.Pidfile))
+	}
+
+	if engineOptions.ExecRoot != "" {
+		if err := validateHostPath("exec root", engineOptions.ExecRoot); err != nil {
+			return nil, err
+		}
+		flags = append(flags, fmt.Sprintf("exec-root=%s", engineOptions.ExecRoot))
+	}
+
+	if engineOptions.ConfigDir != "" {
+		if err := validateHostPath("daemon config directory", engineOptions.ConfigDir); err != nil {
+			return nil, err
+		}
+		flags = append(flags, fmt.Sprintf("config-file=%s", daemonConfigFile(engineOptions)))
+	}
+
+	if engineOptions.BridgeName != "" {
+		if !reBridgeName.MatchString(engineOptions.BridgeName) {
+			return nil, fmt.Errorf("Invalid bridge name %q, expected a network interface name", engineOptions.BridgeName)
+		}
+		flags = append(flags, fmt.Sprintf("bridge=%s", engineOptions.BridgeName))
+	}
+
+	if engineOptions.InitBinary != "" {
+		if err := validateHostPath("init binary", engineOptions.InitBinary); err != nil {
+			return nil, err
+		}
+		flags = append(flags, fmt.Sprintf("init-path=%s", engineOptions.InitBinary))
+	}
+
+	if engineOptions.DefaultInit {
+		flags = append(flags, "init")
+	}
+
+	if engineOptions.DockerGroupUser != "" {
+		flags = append(flags, fmt.Sprintf("group=%s", dockerGroup))
+	}
+
+	networkFlags, err := defaultNetworkOptFlags(engineOptions.DefaultNetworkOpts)
+	if err != nil {
+		return nil, err
+	}
+	flags = append(flags, networkFlags...)
+
+	if engineOptions.KubernetesReady {
+		flags = append(flags, kubernetesEngineFlags...)
+	}
+
+	return append(flags, engineOptions.ArbitraryFlags...), nil
+}
@@ -0,0 +1,325 @@
+package provision
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/engine"
+)
+
+func TestEngineFlagsDefault(t *testing.T) {
+	flags, err := engineFlags(engine.Options{
+		ArbitraryFlags: []string{"debug"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"debug"}
+	if !reflect.DeepEqual(flags, expected) {
+		t.Fatalf("expected flags %v; received %v", expected, flags)
+	}
+}
+
+func TestEngineFlagsNoNewPrivileges(t *testing.T) {
+	flags, err := engineFlags(engine.Options{
+		NoNewPrivileges: true,
+		ArbitraryFlags:  []string{"debug"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"no-new-privileges", "debug"}
+	if !reflect.DeepEqual(flags, expected) {
+		t.Fatalf("expected flags %v; received %v", expected, flags)
+	}
+}
+
+func TestGenerateDockerOptionsNoNewPrivileges(t *testing.T) {
+	p := NewDebianProvisioner(&fakedriver.Driver{}).(*DebianProvisioner)
+
+	dockerCfg, err := p.GenerateDockerOptions(2376)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(dockerCfg.EngineOptions, "--no-new-privileges") {
+		t.Fatal("expected --no-new-privileges to be opt-in")
+	}
+
+	p.EngineOptions.NoNewPrivileges = true
+
+	dockerCfg, err = p.GenerateDockerOptions(2376)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dockerCfg.EngineOptions, "--no-new-privileges ") {
+		t.Fatalf("expected --no-new-privileges in engine config; received %s", dockerCfg.EngineOptions)
+	}
+}
+
+func TestEngineFlagsShutdownTimeout(t *testing.T) {
+	flags, err := engineFlags(engine.Options{
+		ShutdownTimeout: 30,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"shutdown-timeout=30"}
+	if !reflect.DeepEqual(flags, expected) {
+		t.Fatalf("expected flags %v; received %v", expected, flags)
+	}
+
+	if _, err := engineFlags(engine.Options{ShutdownTimeout: -1}); err == nil {
+		t.Fatal("expected an error for a negative shutdown timeout")
+	}
+}
+
+func TestEngineFlagsDefaultStopTimeoutUnsupported(t *testing.T) {
+	if _, err := engineFlags(engine.Options{DefaultStopTimeout: 30}); err != ErrDefaultStopTimeoutUnsupported {
+		t.Fatalf("expected %s; received %v", ErrDefaultStopTimeoutUnsupported, err)
+	}
+}
+
+func TestValidateEngineEnv(t *testing.T) {
+	valid := []string{"DOCKER_RAMDISK=1", "HTTP_PROXY=http://proxy:3128", "_EMPTY="}
+	if err := validateEngineEnv(valid); err != nil {
+		t.Fatalf("expected %v to be valid; received %s", valid, err)
+	}
+
+	for _, e := range []string{"DOCKER_RAMDISK", "1DOCKER=1", "DOCKER-RAMDISK=1", "=1"} {
+		if err := validateEngineEnv([]string{e}); err == nil {
+			t.Fatalf("expected %q to be rejected", e)
+		}
+	}
+}
+
+func TestGenerateDockerOptionsSystemdEnv(t *testing.T) {
+	p := NewDebianProvisioner(&fakedriver.Driver{}).(*DebianProvisioner)
+	p.EngineOptions.Env = []string{"DOCKER_RAMDISK=1", "HTTP_PROXY=http://proxy:3128"}
+
+	dockerCfg, err := p.GenerateDockerOptions(2376)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `Environment="DOCKER_RAMDISK=1" "HTTP_PROXY=http://proxy:3128"`
+	if !strings.Contains(dockerCfg.EngineOptions, expected) {
+		t.Fatalf("expected %s in engine config; received %s", expected, dockerCfg.EngineOptions)
+	}
+
+	p.EngineOptions.Env = []string{"NOT-VALID=1"}
+	if _, err := p.GenerateDockerOptions(2376); err == nil {
+		t.Fatal("expected an error for an invalid environment variable name")
+	}
+}
+
+func TestEngineFlagsMaxConcurrentDownloads(t *testing.T) {
+	flags, err := engineFlags(engine.Options{
+		MaxConcurrentDownloads: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"max-concurrent-downloads=1"}
+	if !reflect.DeepEqual(flags, expected) {
+		t.Fatalf("expected flags %v; received %v", expected, flags)
+	}
+
+	if _, err := engineFlags(engine.Options{MaxConcurrentDownloads: -1}); err == nil {
+		t.Fatal("expected an error for a negative number of downloads")
+	}
+}
+
+func TestEngineFlagsPullTimeoutUnsupported(t *testing.T) {
+	if _, err := engineFlags(engine.Options{PullTimeout: 600}); err != ErrPullTimeoutUnsupported {
+		t.Fatalf("expected %s; received %v", ErrPullTimeoutUnsupported, err)
+	}
+}
+
+func TestEngineFlagsDefaultShmSize(t *testing.T) {
+	flags, err := engineFlags(engine.Options{
+		DefaultShmSize: "128M",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"default-shm-size=128M"}
+	if !reflect.DeepEqual(flags, expected) {
+		t.Fatalf("expected flags %v; received %v", expected, flags)
+	}
+
+	for _, size := range []string{"lots", "-64M", "0"} {
+		if _, err := engineFlags(engine.Options{DefaultShmSize: size}); err == nil {
+			t.Fatalf("expected an error for shm size %q", size)
+		}
+	}
+}
+
+func TestEngineFlagsDefaultNetworkOpts(t *testing.T) {
+	flags, err := engineFlags(engine.Options{
+		DefaultNetworkOpts: []string{
+			"com.docker.network.driver.mtu=1400",
+			"com.docker.network.bridge.enable_icc=false",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"default-network-opt=bridge=com.docker.network.driver.mtu=1400",
+		"default-network-opt=bridge=com.docker.network.bridge.enable_icc=false",
+	}
+	if !reflect.DeepEqual(flags, expected) {
+		t.Fatalf("expected flags %v; received %v", expected, flags)
+	}
+}
+
+func TestEngineFlagsDefaultNetworkOptsRejected(t *testing.T) {
+	for _, opt := range []string{
+		"com.docker.network.bridge.name=br0",
+		"com.docker.network.bridge.default_bridge=true",
+		"com.example.unknown=1",
+		"com.docker.network.driver.mtu",
+	} {
+		if _, err := engineFlags(engine.Options{DefaultNetworkOpts: []string{opt}}); err == nil {
+			t.Fatalf("expected %q to be rejected", opt)
+		}
+	}
+
+	_, err := engineFlags(engine.Options{DefaultNetworkOpts: []string{"com.docker.network.bridge.name=br0"}})
+	if err == nil || !strings.Contains(err.Error(), "per network") {
+		t.Fatalf("expected a per network error; received %v", err)
+	}
+}
+
+func TestEngineFlagsSelinuxEnabled(t *testing.T) {
+	flags, err := engineFlags(engine.Options{SelinuxEnabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"selinux-enabled"}
+	if !reflect.DeepEqual(flags, expected) {
+		t.Fatalf("expected flags %v; received %v", expected, flags)
+	}
+}
+
+func TestEngineFlagsLogLevel(t *testing.T) {
+	flags, err := engineFlags(engine.Options{LogLevel: "warn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"log-level=warn"}
+	if !reflect.DeepEqual(flags, expected) {
+		t.Fatalf("expected flags %v; received %v", expected, flags)
+	}
+
+	for _, level := range []string{"verbose", "WARN", "warning"} {
+		if _, err := engineFlags(engine.Options{LogLevel: level}); err == nil {
+			t.Fatalf("expected an error for log level %q", level)
+		}
+	}
+}
+
+func TestGenerateDockerOptionsLogLevel(t *testing.T) {
+	p := NewDebianProvisioner(&fakedriver.Driver{}).(*DebianProvisioner)
+	p.EngineOptions.LogLevel = "debug"
+
+	dockerCfg, err := p.GenerateDockerOptions(2376)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dockerCfg.EngineOptions, "--log-level=debug ") {
+		t.Fatalf("expected --log-level=debug in engine config; received %s", dockerCfg.EngineOptions)
+	}
+}
+
+func TestEngineFlagsPidfileExecRoot(t *testing.T) {
+	flags, err := engineFlags(engine.Options{
+		Pidfile:  "/run/docker/docker.pid",
+		ExecRoot: "/run/docker-exec",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"pidfile=/run/docker/docker.pid", "exec-root=/run/docker-exec"}
+	if !reflect.DeepEqual(flags, expected) {
+		t.Fatalf("expected flags %v; received %v", expected, flags)
+	}
+
+	for _, engineOptions := range []engine.Options{
+		{Pidfile: "docker.pid"},
+		{Pidfile: "/run/my docker.pid"},
+		{ExecRoot: "run/docker"},
+		{ExecRoot: "/run/'docker'"},
+	} {
+		if _, err := engineFlags(engineOptions); err == nil {
+			t.Fatalf("expected an error for %+v", engineOptions)
+		}
+	}
+}
+
+func TestEngineFlagsIpv6(t *testing.T) {
+	flags, err := engineFlags(engine.Options{
+		Ipv6:        true,
+		FixedCIDRv6: "2001:db8:1::/64",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"ipv6", "fixed-cidr-v6=2001:db8:1::/64"}
+	if !reflect.DeepEqual(flags, expected) {
+		t.Fatalf("expected flags %v; received %v", expected, flags)
+	}
+
+	flags, err = engineFlags(engine.Options{
+		Ipv6:           true,
+		ArbitraryFlags: []string{"iptables=false"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = []string{"ipv6", "ip6tables=false", "iptables=false"}
+	if !reflect.DeepEqual(flags, expected) {
+		t.Fatalf("expected flags %v; received %v", expected, flags)
+	}
+}
+
+func TestEngineFlagsFixedCIDRv6Invalid(t *testing.T) {
+	for _, engineOptions := range []engine.Options{
+		{FixedCIDRv6: "2001:db8:1::/64"},
+		{Ipv6: true, FixedCIDRv6: "10.0.0.0/24"},
+		{Ipv6: true, FixedCIDRv6: "2001:db8:1::"},
+	} {
+		if _, err := engineFlags(engineOptions); err == nil {
+			t.Fatalf("expected an error for %+v", engineOptions)
+		}
+	}
+}
+
+func TestEngineFlagsAllowAllInsecureRegistries(t *testing.T) {
+	flags, err := engineFlags(engine.Options{AllowAllInsecureRegistries: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"insecure-registry=0.0.0.0/0"}
+	if !reflect.DeepEqual(flags, expected) {
+		t.Fatalf("expected flags %v; received %v", expected, flags)
+	}
+
+	if flags, err := engineFlags(engine.Options{}); err != nil || len(flags) != 0 {
+		t.Fatalf("expected no flags without the opt-in; received %v, %v", flags, err)
+	}
+}
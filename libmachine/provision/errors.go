@@ -3,10 +3,21 @@ package provision
 import (
 	"errors"
 	"fmt"
+	"strings"
+
+	"github.com/docker/machine/libmachine/drivers"
 )
 
 var (
 	ErrDetectionFailed = errors.New("OS type not recognized")
+	ErrNotSwarmManager = errors.New("Host is not a swarm mode manager")
+	ErrNoConsole       = drivers.ErrNoConsole
+	ErrSwarmLocked     = errors.New("The swarm mode manager is locked after the restart, unlock it with 'docker swarm unlock' and its unlock key")
+
+	ErrDefaultStopTimeoutUnsupported = errors.New("The Docker daemon has no default stop timeout, use 'docker run --stop-timeout' per container instead")
+	ErrPullTimeoutUnsupported        = errors.New("The Docker daemon has no image pull timeout, lower the maximum concurrent downloads on slow links instead")
+	ErrDisableTCPUnsupported         = errors.New("boot2docker always serves the Docker API over TCP, it can't be restricted to the unix socket")
+	ErrLiveRestoreDisabled           = errors.New("Rotating the server certificate with the containers running needs live-restore enabled on the daemon")
 )
 
 type ErrDaemonAvailable struct {
@@ -22,3 +33,13 @@ func NewErrDaemonAvailable(err error) ErrDaemonAvailable {
 		wrappedErr: err,
 	}
 }
+
+// ErrInvalidOptions lists every problem ValidateOptions found with the
+// options of a Provision run.
+type ErrInvalidOptions struct {
+	Problems []string
+}
+
+func (e ErrInvalidOptions) Error() string {
+	return fmt.Sprintf("Invalid provisioning options:\n  %s", strings.Join(e.Problems, "\n  "))
+}
@@ -0,0 +1,38 @@
+package provision
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// electFile writes data to path unless the file exists already, and returns
+// the content of the file. The data is written to a temporary file linked
+// into place, so concurrent machine processes never see a partial file and
+// only one of them gets elected.
+func electFile(path string, data []byte) ([]byte, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	tmp, err := ioutil.TempFile(dir, filepath.Base(path)+".")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := os.Link(tmp.Name(), path); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+
+	return ioutil.ReadFile(path)
+}
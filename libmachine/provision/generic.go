@@ -3,12 +3,15 @@ package provision
 import (
 	"bytes"
 	"fmt"
+	"path"
 	"text/template"
+	"time"
 
 	"github.com/docker/machine/libmachine/auth"
 	"github.com/docker/machine/libmachine/drivers"
 	"github.com/docker/machine/libmachine/engine"
 	"github.com/docker/machine/libmachine/swarm"
+	"golang.org/x/net/context"
 )
 
 type GenericProvisioner struct {
@@ -18,26 +21,71 @@ type GenericProvisioner struct {
 	DaemonOptionsFile string
 	Packages          []string
 	OsReleaseInfo     *OsRelease
+	HostInfo          *HostInfo
+	// DockerServiceName is the service the daemon runs under, when it
+	// isn't "docker".
+	DockerServiceName string
 	Driver            drivers.Driver
 	AuthOptions       auth.Options
 	EngineOptions     engine.Options
 	SwarmOptions      swarm.Options
+	SharedStores      SharedStores
 }
 
 type GenericSSHCommander struct {
 	Driver drivers.Driver
+	// Timeout bounds every command, the remote process is killed once it
+	// elapses. defaultCommandTimeout is used when it is zero.
+	Timeout time.Duration
 }
 
-func (sshCmder GenericSSHCommander) SSHCommand(args string) (string, error) {
-	return drivers.RunSSHCommandFromDriver(sshCmder.Driver, args)
+func (sshCmder GenericSSHCommander) SSHCommand(ctx context.Context, args string) (string, error) {
+	timeout := commandTimeout(ctx, sshCmder.Timeout)
+
+	cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	output, err := drivers.RunSSHCommandFromDriverContext(cmdCtx, sshCmder.Driver, args)
+	if err != nil && ctx.Err() == nil && cmdCtx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("SSH command timed out after %s: %s", timeout, args)
+	}
+
+	return output, err
+}
+
+// dockerService is the service the daemon runs under, the one of the
+// engine options taking precedence over the one of the provisioner.
+func (provisioner *GenericProvisioner) dockerService() string {
+	if provisioner.EngineOptions.ServiceName != "" {
+		return provisioner.EngineOptions.ServiceName
+	}
+
+	return provisioner.DockerServiceName
 }
 
-func (provisioner *GenericProvisioner) Hostname() (string, error) {
-	return provisioner.SSHCommand("hostname")
+// daemonOptionsFile is where the daemon options are written. A docker unit
+// is named after the service the daemon runs under, and goes to
+// /run/systemd/system once the daemon config was moved off a read-only
+// root.
+func (provisioner *GenericProvisioner) daemonOptionsFile() string {
+	dir := path.Dir(provisioner.DaemonOptionsFile)
+	if dir != systemdUnitDir {
+		return provisioner.DaemonOptionsFile
+	}
+
+	if provisioner.EngineOptions.ConfigDir != "" {
+		dir = runtimeUnitDir
+	}
+
+	return path.Join(dir, serviceName("docker", provisioner.dockerService())+".service")
 }
 
-func (provisioner *GenericProvisioner) SetHostname(hostname string) error {
-	if _, err := provisioner.SSHCommand(fmt.Sprintf(
+func (provisioner *GenericProvisioner) Hostname(ctx context.Context) (string, error) {
+	return provisioner.SSHCommand(ctx, "hostname")
+}
+
+func (provisioner *GenericProvisioner) SetHostname(ctx context.Context, hostname string) error {
+	if _, err := provisioner.SSHCommand(ctx, fmt.Sprintf(
 		"sudo hostname %s && echo %q | sudo tee /etc/hostname",
 		hostname,
 		hostname,
@@ -46,7 +94,7 @@ func (provisioner *GenericProvisioner) SetHostname(hostname string) error {
 	}
 
 	// ubuntu/debian use 127.0.1.1 for non "localhost" loopback hostnames: https://www.debian.org/doc/manuals/debian-reference/ch05.en.html#_the_hostname_resolution
-	if _, err := provisioner.SSHCommand(fmt.Sprintf(`
+	if _, err := provisioner.SSHCommand(ctx, fmt.Sprintf(`
 		if ! grep -xq .*%s /etc/hosts; then
 			if grep -xq 127.0.1.1.* /etc/hosts; then 
 				sudo sed -i 's/^127.0.1.1.*/127.0.1.1 %s/g' /etc/hosts; 
@@ -76,6 +124,26 @@ func (provisioner *GenericProvisioner) GetAuthOptions() auth.Options {
 	return provisioner.AuthOptions
 }
 
+func (provisioner *GenericProvisioner) SetAuthOptions(authOptions auth.Options) {
+	provisioner.AuthOptions = authOptions
+}
+
+func (provisioner *GenericProvisioner) GetEngineOptions() engine.Options {
+	return provisioner.EngineOptions
+}
+
+func (provisioner *GenericProvisioner) SetEngineOptions(engineOptions engine.Options) {
+	provisioner.EngineOptions = engineOptions
+}
+
+func (provisioner *GenericProvisioner) GetSharedStores() SharedStores {
+	return provisioner.SharedStores
+}
+
+func (provisioner *GenericProvisioner) SetSharedStores(stores SharedStores) {
+	provisioner.SharedStores = stores
+}
+
 func (provisioner *GenericProvisioner) SetOsReleaseInfo(info *OsRelease) {
 	provisioner.OsReleaseInfo = info
 }
@@ -84,6 +152,18 @@ func (provisioner *GenericProvisioner) GetOsReleaseInfo() (*OsRelease, error) {
 	return provisioner.OsReleaseInfo, nil
 }
 
+func (provisioner *GenericProvisioner) GetHostInfo(ctx context.Context) (*HostInfo, error) {
+	if provisioner.HostInfo == nil {
+		info, err := fetchHostInfo(ctx, provisioner)
+		if err != nil {
+			return nil, err
+		}
+		provisioner.HostInfo = info
+	}
+
+	return provisioner.HostInfo, nil
+}
+
 func (provisioner *GenericProvisioner) GenerateDockerOptions(dockerPort int) (*DockerOptions, error) {
 	var (
 		engineCfg bytes.Buffer
@@ -94,22 +174,27 @@ func (provisioner *GenericProvisioner) GenerateDockerOptions(dockerPort int) (*D
 
 	engineConfigTmpl := `
 DOCKER_OPTS='
--H tcp://0.0.0.0:{{.DockerPort}}
--H unix:///var/run/docker.sock
+{{ if not .EngineOptions.DisableTCP }}-H tcp://0.0.0.0:{{.DockerPort}}
+{{ end }}-H unix:///var/run/docker.sock
 --storage-driver {{.EngineOptions.StorageDriver}}
---tlsverify
+{{ if not .EngineOptions.DisableTCP }}--tlsverify
 --tlscacert {{.AuthOptions.CaCertRemotePath}}
 --tlscert {{.AuthOptions.ServerCertRemotePath}}
 --tlskey {{.AuthOptions.ServerKeyRemotePath}}
-{{ range .EngineOptions.Labels }}--label {{.}}
+{{ end }}{{ range .EngineOptions.Labels }}--label {{.}}
 {{ end }}{{ range .EngineOptions.InsecureRegistry }}--insecure-registry {{.}}
 {{ end }}{{ range .EngineOptions.RegistryMirror }}--registry-mirror {{.}}
-{{ end }}{{ range .EngineOptions.ArbitraryFlags }}--{{.}}
+{{ end }}{{ range .EngineFlags }}--{{.}}
 {{ end }}
 '
 {{range .EngineOptions.Env}}export \"{{ printf "%q" . }}\"
 {{end}}
 `
+	flags, err := engineFlags(provisioner.EngineOptions)
+	if err != nil {
+		return nil, err
+	}
+
 	t, err := template.New("engineConfig").Parse(engineConfigTmpl)
 	if err != nil {
 		return nil, err
@@ -119,13 +204,14 @@ DOCKER_OPTS='
 		DockerPort:    dockerPort,
 		AuthOptions:   provisioner.AuthOptions,
 		EngineOptions: provisioner.EngineOptions,
+		EngineFlags:   flags,
 	}
 
 	t.Execute(&engineCfg, engineConfigContext)
 
 	return &DockerOptions{
 		EngineOptions:     engineCfg.String(),
-		EngineOptionsPath: provisioner.DaemonOptionsFile,
+		EngineOptionsPath: provisioner.daemonOptionsFile(),
 	}, nil
 }
 
@@ -0,0 +1,65 @@
+package provision
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"golang.org/x/net/context"
+)
+
+// fakeBlockingSSH puts an ssh binary which never returns first in PATH.
+func fakeBlockingSSH(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "ssh"), []byte("#!/bin/sh\nexec sleep 60\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+
+	return func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestGenericSSHCommanderTimeout(t *testing.T) {
+	defer fakeBlockingSSH(t)()
+
+	commander := GenericSSHCommander{
+		Driver:  &fakedriver.Driver{},
+		Timeout: 100 * time.Millisecond,
+	}
+
+	start := time.Now()
+	_, err := commander.SSHCommand(context.Background(), "sudo apt-get update")
+	if err == nil || !strings.Contains(err.Error(), "timed out after 100ms") {
+		t.Fatalf("expected a timeout error; received %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected the command to be killed after the timeout; took %s", elapsed)
+	}
+}
+
+func TestGenericSSHCommanderCanceled(t *testing.T) {
+	defer fakeBlockingSSH(t)()
+
+	commander := GenericSSHCommander{Driver: &fakedriver.Driver{}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	if _, err := commander.SSHCommand(ctx, "sudo apt-get update"); err != context.Canceled {
+		t.Fatalf("expected %s; received %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,45 @@
+package provision
+
+import (
+	"net"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// systemd-resolved keeps the real upstream servers out of /etc/resolv.conf,
+// which only lists its local stub.
+const hostResolvConfCmd = "cat /run/systemd/resolve/resolv.conf 2>/dev/null || cat /etc/resolv.conf"
+
+// parseNameservers returns the nameservers of a resolv.conf, leaving out the
+// loopback ones which are unreachable from inside the containers.
+func parseNameservers(resolvConf string) []string {
+	nameservers := []string{}
+
+	for _, line := range strings.Split(resolvConf, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+
+		ip := net.ParseIP(fields[1])
+		if ip == nil || ip.IsLoopback() {
+			continue
+		}
+		nameservers = append(nameservers, fields[1])
+	}
+
+	return nameservers
+}
+
+// hostNameservers returns the upstream nameservers the host resolves with.
+// Handing them to the daemon makes the containers, and the embedded DNS of
+// user defined networks, resolve like the host does.
+func hostNameservers(ctx context.Context, p SSHCommander) ([]string, error) {
+	out, err := p.SSHCommand(ctx, hostResolvConfCmd)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseNameservers(out), nil
+}
@@ -0,0 +1,53 @@
+package provision
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func TestHostNameservers(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			hostResolvConfCmd: `# This file is managed by systemd-resolved
+nameserver 10.0.0.53
+nameserver 127.0.0.53
+nameserver ::1
+nameserver fd00::53
+search corp.example.com
+`,
+		},
+	}
+
+	nameservers, err := hostNameservers(context.Background(), commander)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"10.0.0.53", "fd00::53"}
+	if !reflect.DeepEqual(nameservers, expected) {
+		t.Fatalf("expected nameservers %v; received %v", expected, nameservers)
+	}
+}
+
+func TestGenerateDockerOptionsDNS(t *testing.T) {
+	p := NewDebianProvisioner(&fakedriver.Driver{}).(*DebianProvisioner)
+	p.EngineOptions.DNS = []string{"10.0.0.53", "fd00::53"}
+
+	dockerCfg, err := p.GenerateDockerOptions(2376)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dockerCfg.EngineOptions, "--dns=10.0.0.53 --dns=fd00::53 ") {
+		t.Fatalf("expected the nameservers in the engine config; received %s", dockerCfg.EngineOptions)
+	}
+
+	p.EngineOptions.DNS = []string{"dns.example.com"}
+	if _, err := p.GenerateDockerOptions(2376); err == nil {
+		t.Fatal("expected an error for a DNS server which isn't an IP")
+	}
+}
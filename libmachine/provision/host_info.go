@@ -0,0 +1,80 @@
+package provision
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// HostInfo describes the hardware and kernel of the host, callers use it to
+// pick images and resource defaults.
+type HostInfo struct {
+	Arch          string
+	KernelVersion string
+	// MemTotal is the total memory of the host in bytes.
+	MemTotal uint64
+	CPUs     int
+}
+
+// parseMemTotal reads the MemTotal line of /proc/meminfo, which is given in
+// kB, and returns it in bytes.
+func parseMemTotal(meminfo string) (uint64, error) {
+	scanner := bufio.NewScanner(strings.NewReader(meminfo))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid MemTotal in /proc/meminfo: %s", scanner.Text())
+		}
+
+		return kb * 1024, nil
+	}
+
+	return 0, fmt.Errorf("No MemTotal found in /proc/meminfo")
+}
+
+func fetchHostInfo(ctx context.Context, p SSHCommander) (*HostInfo, error) {
+	arch, err := p.SSHCommand(ctx, "uname -m")
+	if err != nil {
+		return nil, err
+	}
+
+	kernel, err := p.SSHCommand(ctx, "uname -r")
+	if err != nil {
+		return nil, err
+	}
+
+	nproc, err := p.SSHCommand(ctx, "nproc")
+	if err != nil {
+		return nil, err
+	}
+
+	cpus, err := strconv.Atoi(strings.TrimSpace(nproc))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid CPU count %q: %s", strings.TrimSpace(nproc), err)
+	}
+
+	meminfo, err := p.SSHCommand(ctx, "cat /proc/meminfo")
+	if err != nil {
+		return nil, err
+	}
+
+	memTotal, err := parseMemTotal(meminfo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HostInfo{
+		Arch:          strings.TrimSpace(arch),
+		KernelVersion: strings.TrimSpace(kernel),
+		MemTotal:      memTotal,
+		CPUs:          cpus,
+	}, nil
+}
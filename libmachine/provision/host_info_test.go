@@ -0,0 +1,63 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+const sampleMeminfo = `MemTotal:        2041180 kB
+MemFree:          113460 kB
+MemAvailable:    1435164 kB
+Buffers:           81924 kB
+`
+
+func TestGetHostInfo(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"uname -m":          "aarch64\n",
+			"uname -r":          "5.10.0-21-arm64\n",
+			"nproc":             "4\n",
+			"cat /proc/meminfo": sampleMeminfo,
+		},
+	}
+	p := newFakeDebianProvisioner(commander)
+
+	info, err := p.GetHostInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &HostInfo{
+		Arch:          "aarch64",
+		KernelVersion: "5.10.0-21-arm64",
+		MemTotal:      2041180 * 1024,
+		CPUs:          4,
+	}
+	if !reflect.DeepEqual(info, expected) {
+		t.Fatalf("expected %+v; received %+v", expected, info)
+	}
+
+	if _, err := p.GetHostInfo(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(commander.Commands) != 4 {
+		t.Fatalf("expected the host info to be cached; received commands %v", commander.Commands)
+	}
+}
+
+func TestGetHostInfoInvalid(t *testing.T) {
+	for _, responses := range []map[string]string{
+		{"nproc": "four", "cat /proc/meminfo": sampleMeminfo},
+		{"nproc": "4", "cat /proc/meminfo": "MemFree: 113460 kB\n"},
+		{"nproc": "4", "cat /proc/meminfo": "MemTotal: lots kB\n"},
+	} {
+		p := newFakeDebianProvisioner(&provisiontest.FakeSSHCommander{Responses: responses})
+
+		if _, err := p.GetHostInfo(context.Background()); err == nil {
+			t.Fatalf("expected an error for %v", responses)
+		}
+	}
+}
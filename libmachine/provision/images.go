@@ -0,0 +1,114 @@
+package provision
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/pkg/units"
+	"github.com/docker/machine/libmachine/log"
+	"golang.org/x/net/context"
+)
+
+var reImageRef = regexp.MustCompile(`^[a-z0-9]+([._/:@-][a-zA-Z0-9]+)*$`)
+
+var reReclaimedSpace = regexp.MustCompile(`Total reclaimed space:\s*([0-9.]+)\s*([kKMGTP]?)B`)
+
+// decimal size units docker uses in its human readable sizes
+var sizeUnits = map[string]float64{
+	"":  1,
+	"k": units.KB,
+	"K": units.KB,
+	"M": units.MB,
+	"G": units.GB,
+	"T": units.TB,
+	"P": units.PB,
+}
+
+// parseReclaimedSpace returns the bytes freed according to the output of a
+// docker prune command.
+func parseReclaimedSpace(out string) (int64, error) {
+	matches := reReclaimedSpace.FindStringSubmatch(out)
+	if matches == nil {
+		return 0, fmt.Errorf("Unable to find the reclaimed space in %q", out)
+	}
+
+	size, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid reclaimed space %q: %s", matches[0], err)
+	}
+
+	return int64(size * sizeUnits[matches[2]]), nil
+}
+
+// PruneImages removes the dangling images on the host, or with all every
+// image no container uses, and returns the disk space reclaimed in bytes.
+func PruneImages(ctx context.Context, p Provisioner, all bool) (int64, error) {
+	command := "sudo docker image prune -f"
+	if all {
+		command += " -a"
+	}
+
+	out, err := p.SSHCommand(ctx, command)
+	if err != nil {
+		return 0, err
+	}
+
+	reclaimed, err := parseReclaimedSpace(out)
+	if err != nil {
+		return 0, err
+	}
+
+	log.Debugf("pruning the images reclaimed %s", units.HumanSize(float64(reclaimed)))
+
+	return reclaimed, nil
+}
+
+// imageArchive tells whether the preload entry is an image archive on the
+// host, loaded with docker load, rather than an image to pull.
+func imageArchive(image string) bool {
+	return path.IsAbs(image) && (strings.HasSuffix(image, ".tar") || strings.HasSuffix(image, ".tar.gz") || strings.HasSuffix(image, ".tgz"))
+}
+
+// preloadImages pulls the images, or loads the archives already uploaded to
+// the host, so the first containers don't wait for a pull. A failing image
+// doesn't stop the others, the images which failed are reported and
+// returned with the ones which succeeded.
+func preloadImages(ctx context.Context, p SSHCommander, images []string) (succeeded, failed []string) {
+	for _, image := range images {
+		var command string
+
+		switch {
+		case imageArchive(image):
+			if err := validateHostPath("image archive", image); err != nil {
+				log.Warn(err)
+				failed = append(failed, image)
+				continue
+			}
+			command = fmt.Sprintf("sudo docker load -i %s", image)
+		case reImageRef.MatchString(image):
+			command = fmt.Sprintf("sudo docker pull %s", image)
+		default:
+			log.Warnf("Invalid image to preload %q", image)
+			failed = append(failed, image)
+			continue
+		}
+
+		if out, err := p.SSHCommand(withCommandTimeout(ctx, installCommandTimeout), command); err != nil {
+			log.Warnf("Unable to preload %s: %s\n%s", image, err, out)
+			failed = append(failed, image)
+			continue
+		}
+
+		succeeded = append(succeeded, image)
+	}
+
+	log.Infof("Preloaded %d of %d images", len(succeeded), len(images))
+	if len(failed) != 0 {
+		log.Warnf("Unable to preload %s", strings.Join(failed, ", "))
+	}
+
+	return succeeded, failed
+}
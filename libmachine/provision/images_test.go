@@ -0,0 +1,94 @@
+package provision
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func TestPruneImages(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo docker image prune -f":    "Deleted Images:\ndeleted: sha256:3c3c9b4f1cbb\n\nTotal reclaimed space: 1.5GB\n",
+			"sudo docker image prune -f -a": "Deleted Images:\nuntagged: nginx:latest\ndeleted: sha256:3c3c9b4f1cbb\n\nTotal reclaimed space: 142.3MB\n",
+		},
+	}
+	p := newFakeDebianProvisioner(commander)
+
+	reclaimed, err := PruneImages(context.Background(), p, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reclaimed != 1500000000 {
+		t.Fatalf("expected 1500000000 bytes reclaimed; received %d", reclaimed)
+	}
+
+	reclaimed, err = PruneImages(context.Background(), p, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reclaimed != 142300000 {
+		t.Fatalf("expected 142300000 bytes reclaimed; received %d", reclaimed)
+	}
+
+	expected := []string{"sudo docker image prune -f", "sudo docker image prune -f -a"}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestParseReclaimedSpace(t *testing.T) {
+	for out, expected := range map[string]int64{
+		"Total reclaimed space: 0B\n":    0,
+		"Total reclaimed space: 512B\n":  512,
+		"Total reclaimed space: 3.2kB\n": 3200,
+		"Total reclaimed space: 2TB\n":   2000000000000,
+	} {
+		reclaimed, err := parseReclaimedSpace(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reclaimed != expected {
+			t.Fatalf("expected %d bytes for %q; received %d", expected, out, reclaimed)
+		}
+	}
+
+	if _, err := parseReclaimedSpace("permission denied"); err == nil {
+		t.Fatal("expected an error without the reclaimed space")
+	}
+}
+
+func TestPreloadImages(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Errors: map[string]error{
+			"sudo docker pull registry.local/missing:1.0": errors.New("manifest unknown"),
+		},
+	}
+
+	succeeded, failed := preloadImages(context.Background(), commander, []string{
+		"nginx:1.25-alpine",
+		"/home/pi/images/app.tar.gz",
+		"registry.local/missing:1.0",
+		"nginx; reboot",
+		"/home/pi/my images/app.tar",
+	})
+
+	if expected := []string{"nginx:1.25-alpine", "/home/pi/images/app.tar.gz"}; !reflect.DeepEqual(succeeded, expected) {
+		t.Fatalf("expected %v to succeed; received %v", expected, succeeded)
+	}
+	if expected := []string{"registry.local/missing:1.0", "nginx; reboot", "/home/pi/my images/app.tar"}; !reflect.DeepEqual(failed, expected) {
+		t.Fatalf("expected %v to fail; received %v", expected, failed)
+	}
+
+	expected := []string{
+		"sudo docker pull nginx:1.25-alpine",
+		"sudo docker load -i /home/pi/images/app.tar.gz",
+		"sudo docker pull registry.local/missing:1.0",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
@@ -0,0 +1,28 @@
+package provision
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// checkInitBinary makes sure the init binary is an executable on the host.
+// The daemon only looks for it when a container is started with --init, so
+// a wrong path would otherwise go unnoticed until then.
+func checkInitBinary(ctx context.Context, p SSHCommander, initPath string) error {
+	if err := validateHostPath("init binary", initPath); err != nil {
+		return err
+	}
+
+	out, err := p.SSHCommand(ctx, fmt.Sprintf("test -x %s && echo ok || true", initPath))
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(out) != "ok" {
+		return fmt.Errorf("The init binary %s is not an executable on the host", initPath)
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func TestCheckInitBinary(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"test -x /usr/bin/tini && echo ok || true": "ok\n",
+		},
+	}
+
+	if err := checkInitBinary(context.Background(), commander, "/usr/bin/tini"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkInitBinary(context.Background(), commander, "/usr/local/bin/tini"); err == nil {
+		t.Fatal("expected an error for a missing init binary")
+	}
+
+	if err := checkInitBinary(context.Background(), commander, "tini"); err == nil {
+		t.Fatal("expected an error for a relative init binary")
+	}
+
+	expected := []string{
+		"test -x /usr/bin/tini && echo ok || true",
+		"test -x /usr/local/bin/tini && echo ok || true",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestEngineFlagsInit(t *testing.T) {
+	flags, err := engineFlags(engine.Options{InitBinary: "/usr/bin/tini", DefaultInit: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"init-path=/usr/bin/tini", "init"}
+	if !reflect.DeepEqual(flags, expected) {
+		t.Fatalf("expected flags %v; received %v", expected, flags)
+	}
+
+	if _, err := engineFlags(engine.Options{InitBinary: "/usr/bin/my tini"}); err == nil {
+		t.Fatal("expected an error for an init binary with a space")
+	}
+}
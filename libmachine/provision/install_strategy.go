@@ -0,0 +1,20 @@
+package provision
+
+import "fmt"
+
+const (
+	// InstallStrategyScript runs the install script on the host, the default.
+	InstallStrategyScript = "script"
+	// InstallStrategyDockerOfficial installs docker-ce from Docker's apt
+	// repository on Debian based hosts, without an install script.
+	InstallStrategyDockerOfficial = "docker-official"
+)
+
+func validateInstallStrategy(strategy string) error {
+	switch strategy {
+	case "", InstallStrategyScript, InstallStrategyDockerOfficial:
+		return nil
+	}
+
+	return fmt.Errorf("Invalid install strategy %q, expected %s or %s", strategy, InstallStrategyScript, InstallStrategyDockerOfficial)
+}
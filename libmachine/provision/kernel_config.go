@@ -0,0 +1,106 @@
+package provision
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/log"
+	"golang.org/x/net/context"
+)
+
+// kernelConfigCommand prints the configuration the running kernel was
+// built with, exposed by the kernel itself or installed next to it.
+const kernelConfigCommand = "zcat /proc/config.gz 2>/dev/null || cat /boot/config-$(uname -r) 2>/dev/null || true"
+
+// kernelFeature is a daemon feature and the kernel options it needs.
+type kernelFeature struct {
+	name    string
+	options []string
+}
+
+// parseKernelConfig returns the options set in a kernel config, built in
+// (y) or as a module (m). Options which are not set are left out.
+func parseKernelConfig(config string) map[string]string {
+	options := map[string]string{}
+
+	scanner := bufio.NewScanner(strings.NewReader(config))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "CONFIG_") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || parts[1] == "n" {
+			continue
+		}
+
+		options[parts[0]] = parts[1]
+	}
+
+	return options
+}
+
+// requiredKernelFeatures lists the features the engine options enable which
+// depend on optional kernel support.
+func requiredKernelFeatures(engineOptions engine.Options) []kernelFeature {
+	features := []kernelFeature{}
+
+	switch engineOptions.StorageDriver {
+	case "overlay", "overlay2":
+		features = append(features, kernelFeature{
+			name:    fmt.Sprintf("the %s storage driver", engineOptions.StorageDriver),
+			options: []string{"CONFIG_OVERLAY_FS"},
+		})
+	}
+
+	if hasArbitraryFlag(engineOptions, "userns-remap") {
+		features = append(features, kernelFeature{
+			name:    "user namespace remapping",
+			options: []string{"CONFIG_USER_NS"},
+		})
+	}
+
+	if engineOptions.Ipv6 {
+		features = append(features, kernelFeature{
+			name:    "IPv6",
+			options: []string{"CONFIG_IPV6"},
+		})
+	}
+
+	return features
+}
+
+// CheckKernelConfig fails with the missing feature when the host kernel
+// lacks an option the engine options need, rather than leaving the daemon
+// to fail at start. Kernels which don't expose their config are not
+// checked.
+func CheckKernelConfig(ctx context.Context, p SSHCommander, engineOptions engine.Options) error {
+	features := requiredKernelFeatures(engineOptions)
+	if len(features) == 0 {
+		return nil
+	}
+
+	out, err := p.SSHCommand(ctx, kernelConfigCommand)
+	if err != nil {
+		return err
+	}
+
+	config := parseKernelConfig(out)
+	if len(config) == 0 {
+		log.Warn("Unable to read the kernel config, not checking the kernel supports the requested features.")
+		return nil
+	}
+
+	for _, feature := range features {
+		for _, option := range feature.options {
+			if _, ok := config[option]; !ok {
+				return fmt.Errorf("The host kernel is built without %s, which %s needs", option, feature.name)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package provision
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+const sampleKernelConfig = `#
+# Automatically generated file; DO NOT EDIT.
+# Linux/arm 4.19.66 Kernel Configuration
+#
+CONFIG_NAMESPACES=y
+CONFIG_USER_NS=y
+CONFIG_OVERLAY_FS=m
+# CONFIG_IPV6 is not set
+CONFIG_LOCALVERSION="-v7+"
+`
+
+func TestParseKernelConfig(t *testing.T) {
+	expected := map[string]string{
+		"CONFIG_NAMESPACES":   "y",
+		"CONFIG_USER_NS":      "y",
+		"CONFIG_OVERLAY_FS":   "m",
+		"CONFIG_LOCALVERSION": `"-v7+"`,
+	}
+
+	if config := parseKernelConfig(sampleKernelConfig); !reflect.DeepEqual(config, expected) {
+		t.Fatalf("expected config %v; received %v", expected, config)
+	}
+}
+
+func TestCheckKernelConfig(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{kernelConfigCommand: sampleKernelConfig},
+	}
+
+	engineOptions := engine.Options{
+		StorageDriver:  "overlay2",
+		ArbitraryFlags: []string{"userns-remap=default"},
+	}
+	if err := CheckKernelConfig(context.Background(), commander, engineOptions); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckKernelConfigMissingFeature(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{kernelConfigCommand: sampleKernelConfig},
+	}
+
+	err := CheckKernelConfig(context.Background(), commander, engine.Options{Ipv6: true})
+	if err == nil || !strings.Contains(err.Error(), "CONFIG_IPV6") || !strings.Contains(err.Error(), "IPv6") {
+		t.Fatalf("expected an error naming CONFIG_IPV6; received %v", err)
+	}
+}
+
+func TestCheckKernelConfigUnreadable(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := CheckKernelConfig(context.Background(), commander, engine.Options{Ipv6: true}); err != nil {
+		t.Fatalf("expected an unreadable config to be skipped; received %v", err)
+	}
+}
+
+func TestCheckKernelConfigNothingNeeded(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := CheckKernelConfig(context.Background(), commander, engine.Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(commander.Commands) != 0 {
+		t.Fatalf("expected no commands; received %v", commander.Commands)
+	}
+}
@@ -0,0 +1,47 @@
+package provision
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	kubernetesModulesPath = "/etc/modules-load.d/k8s.conf"
+	kubernetesSysctlPath  = "/etc/sysctl.d/k8s.conf"
+
+	kubernetesModules = `br_netfilter
+`
+	kubernetesSysctls = `net.bridge.bridge-nf-call-iptables = 1
+net.bridge.bridge-nf-call-ip6tables = 1
+net.ipv4.ip_forward = 1
+`
+)
+
+// kubernetesEngineFlags are the daemon settings the kubeadm preflight
+// checks expect: the systemd cgroup driver, shared with the kubelet, and
+// bounded json-file logs.
+var kubernetesEngineFlags = []string{
+	"exec-opt=native.cgroupdriver=systemd",
+	"log-driver=json-file",
+	"log-opt=max-size=100m",
+}
+
+// prepareKubernetes loads br_netfilter and enables bridged traffic
+// filtering and IP forwarding, now and on every boot.
+func prepareKubernetes(ctx context.Context, p SSHCommander) error {
+	commands := []string{
+		fmt.Sprintf("printf '%%s' '%s' | sudo tee %s", kubernetesModules, kubernetesModulesPath),
+		"sudo modprobe br_netfilter",
+		fmt.Sprintf("printf '%%s' '%s' | sudo tee %s", kubernetesSysctls, kubernetesSysctlPath),
+		"sudo sysctl --system",
+	}
+
+	for _, cmd := range commands {
+		if _, err := p.SSHCommand(ctx, cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func TestPrepareKubernetes(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := prepareKubernetes(context.Background(), commander); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"printf '%s' 'br_netfilter\n' | sudo tee /etc/modules-load.d/k8s.conf",
+		"sudo modprobe br_netfilter",
+		"printf '%s' 'net.bridge.bridge-nf-call-iptables = 1\nnet.bridge.bridge-nf-call-ip6tables = 1\nnet.ipv4.ip_forward = 1\n' | sudo tee /etc/sysctl.d/k8s.conf",
+		"sudo sysctl --system",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestEngineFlagsKubernetesReady(t *testing.T) {
+	flags, err := engineFlags(engine.Options{
+		KubernetesReady: true,
+		ArbitraryFlags:  []string{"debug"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"exec-opt=native.cgroupdriver=systemd",
+		"log-driver=json-file",
+		"log-opt=max-size=100m",
+		"debug",
+	}
+	if !reflect.DeepEqual(flags, expected) {
+		t.Fatalf("expected flags %v; received %v", expected, flags)
+	}
+}
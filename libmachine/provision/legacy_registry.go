@@ -0,0 +1,79 @@
+package provision
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"golang.org/x/net/context"
+)
+
+// parseDockerVersion returns the major and minor version of a daemon
+// version like 17.09.1-ce or 1.13.1.
+func parseDockerVersion(version string) (int, int, error) {
+	parts := strings.SplitN(strings.TrimSpace(version), ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("Invalid docker version %q", version)
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid docker version %q", version)
+	}
+
+	minor, err := strconv.Atoi(strings.SplitN(parts[1], "-", 2)[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid docker version %q", version)
+	}
+
+	return major, minor, nil
+}
+
+// legacyRegistryFlagSupported tells whether the daemon version knows the
+// disable-legacy-registry flag, added in 1.10 and removed in 19.03.
+func legacyRegistryFlagSupported(version string) (bool, error) {
+	major, minor, err := parseDockerVersion(version)
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case major == 1:
+		return minor >= 10, nil
+	case major < 19:
+		return true, nil
+	case major == 19:
+		return minor < 3, nil
+	}
+
+	return false, nil
+}
+
+// gateLegacyRegistry leaves the DisableLegacyRegistry engine option out
+// when the installed daemon would refuse to start with it. Daemons without
+// the flag don't talk to v1 registries anymore, so nothing is lost.
+func gateLegacyRegistry(ctx context.Context, p Provisioner) error {
+	engineOptions := p.GetEngineOptions()
+	if !engineOptions.DisableLegacyRegistry {
+		return nil
+	}
+
+	version, err := p.SSHCommand(ctx, "sudo docker version --format '{{.Server.Version}}'")
+	if err != nil {
+		return err
+	}
+
+	supported, err := legacyRegistryFlagSupported(version)
+	if err != nil {
+		return err
+	}
+
+	if !supported {
+		log.Warnf("Docker %s has no disable-legacy-registry option, leaving it out of the daemon configuration.", strings.TrimSpace(version))
+		engineOptions.DisableLegacyRegistry = false
+		p.SetEngineOptions(engineOptions)
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func TestLegacyRegistryFlagSupported(t *testing.T) {
+	for version, expected := range map[string]bool{
+		"1.9.1":       false,
+		"1.10.0":      true,
+		"1.13.1":      true,
+		"17.09.1-ce":  true,
+		"18.09.9":     true,
+		"19.03.0":     false,
+		"24.0.7\n":    false,
+		"19.03.0-rc1": false,
+	} {
+		supported, err := legacyRegistryFlagSupported(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if supported != expected {
+			t.Fatalf("expected support %t for %q; received %t", expected, version, supported)
+		}
+	}
+
+	if _, err := legacyRegistryFlagSupported("dev"); err == nil {
+		t.Fatal("expected an error for an invalid version")
+	}
+}
+
+func TestEngineFlagsDisableLegacyRegistry(t *testing.T) {
+	flags, err := engineFlags(engine.Options{DisableLegacyRegistry: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"disable-legacy-registry"}
+	if !reflect.DeepEqual(flags, expected) {
+		t.Fatalf("expected flags %v; received %v", expected, flags)
+	}
+}
+
+func TestGateLegacyRegistry(t *testing.T) {
+	for version, expected := range map[string]bool{
+		"17.09.1-ce\n": true,
+		"24.0.7\n":     false,
+	} {
+		commander := &provisiontest.FakeSSHCommander{
+			Responses: map[string]string{
+				"sudo docker version --format '{{.Server.Version}}'": version,
+			},
+		}
+		p := newFakeDebianProvisioner(commander)
+		p.EngineOptions.DisableLegacyRegistry = true
+
+		if err := gateLegacyRegistry(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+
+		if p.EngineOptions.DisableLegacyRegistry != expected {
+			t.Fatalf("expected the option to be %t on %q; received %t", expected, version, p.EngineOptions.DisableLegacyRegistry)
+		}
+	}
+}
+
+func TestGateLegacyRegistryNotSet(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := gateLegacyRegistry(context.Background(), newFakeDebianProvisioner(commander)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(commander.Commands) != 0 {
+		t.Fatalf("expected no commands; received %v", commander.Commands)
+	}
+}
@@ -0,0 +1,73 @@
+package provision
+
+import (
+	"fmt"
+	"regexp"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	journaldDropInPath        = "/etc/systemd/journald.conf.d/docker-machine.conf"
+	containerLogRotateCfgPath = "/etc/logrotate.d/docker-containers"
+
+	journaldDropInTmpl = `[Journal]
+SystemMaxUse=%s
+`
+	containerLogRotateTmpl = `/var/lib/docker/containers/*/*.log {
+	rotate 2
+	size %s
+	missingok
+	notifempty
+	compress
+	copytruncate
+}
+`
+)
+
+// journald and logrotate both understand sizes like 500K, 50M or 1G
+var reLogSize = regexp.MustCompile(`^[0-9]+[KMG]?$`)
+
+func validateLogSize(size string) error {
+	if !reLogSize.MatchString(size) {
+		return fmt.Errorf("Invalid log size %q, expected a size like 50M", size)
+	}
+
+	return nil
+}
+
+// limitJournalSize caps the disk space used by the systemd journal, which
+// otherwise grows up to 10% of the filesystem on small SD cards.
+func limitJournalSize(ctx context.Context, p SSHCommander, maxUse string) error {
+	if err := validateLogSize(maxUse); err != nil {
+		return err
+	}
+
+	commands := []string{
+		"sudo mkdir -p /etc/systemd/journald.conf.d",
+		fmt.Sprintf("printf '%%s' '%s' | sudo tee %s", fmt.Sprintf(journaldDropInTmpl, maxUse), journaldDropInPath),
+		"sudo systemctl restart systemd-journald",
+	}
+
+	for _, cmd := range commands {
+		if _, err := p.SSHCommand(ctx, cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rotateContainerLogs installs a logrotate config for the json-file logs of
+// the containers, keeping each log below size.
+func rotateContainerLogs(ctx context.Context, p SSHCommander, size string) error {
+	if err := validateLogSize(size); err != nil {
+		return err
+	}
+
+	if _, err := p.SSHCommand(ctx, fmt.Sprintf("printf '%%s' '%s' | sudo tee %s", fmt.Sprintf(containerLogRotateTmpl, size), containerLogRotateCfgPath)); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func TestLimitJournalSize(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := limitJournalSize(context.Background(), commander, "50M"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo mkdir -p /etc/systemd/journald.conf.d",
+		"printf '%s' '[Journal]\nSystemMaxUse=50M\n' | sudo tee /etc/systemd/journald.conf.d/docker-machine.conf",
+		"sudo systemctl restart systemd-journald",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestRotateContainerLogs(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := rotateContainerLogs(context.Background(), commander, "10M"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"printf '%s' '/var/lib/docker/containers/*/*.log {\n\trotate 2\n\tsize 10M\n\tmissingok\n\tnotifempty\n\tcompress\n\tcopytruncate\n}\n' | sudo tee /etc/logrotate.d/docker-containers",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestLogLimitsInvalidSize(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := limitJournalSize(context.Background(), commander, "50 MB"); err == nil {
+		t.Fatal("expected an error for an invalid journal size")
+	}
+
+	if err := rotateContainerLogs(context.Background(), commander, "-1"); err == nil {
+		t.Fatal("expected an error for an invalid log rotation size")
+	}
+
+	if len(commander.Commands) != 0 {
+		t.Fatalf("expected no commands to be run; received %v", commander.Commands)
+	}
+}
@@ -0,0 +1,42 @@
+package provision
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const motdPath = "/etc/motd"
+
+// motdBanner renders the banner telling operators logging in that the
+// machine is managed by docker-machine.
+func motdBanner(machineName, dockerVersion string, provisionedAt time.Time) string {
+	return fmt.Sprintf(`This machine (%s) is managed by docker-machine.
+Docker %s, provisioned at %s.
+Changes made by hand may be lost when it is provisioned again.
+`, machineName, dockerVersion, provisionedAt.UTC().Format(time.RFC3339))
+}
+
+// writeMotd replaces /etc/motd with the docker-machine banner.
+func writeMotd(ctx context.Context, p Provisioner, provisionedAt time.Time) error {
+	version, err := p.SSHCommand(ctx, "sudo docker version --format '{{.Server.Version}}'")
+	if err != nil {
+		return err
+	}
+
+	banner := motdBanner(p.GetDriver().GetMachineName(), strings.TrimSpace(version), provisionedAt)
+
+	if _, err := p.SSHCommand(ctx, fmt.Sprintf("printf '%%s' '%s' | sudo tee %s", banner, motdPath)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetMotd returns the message of the day of the host, which holds the
+// provisioning banner when the WriteMotd engine option was set.
+func GetMotd(ctx context.Context, p Provisioner) (string, error) {
+	return p.SSHCommand(ctx, fmt.Sprintf("cat %s 2>/dev/null || true", motdPath))
+}
@@ -0,0 +1,51 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func TestWriteMotd(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo docker version --format '{{.Server.Version}}'": "24.0.7\n",
+		},
+	}
+	p := NewDebianProvisioner(&fakedriver.Driver{MockName: "pi-01"}).(*DebianProvisioner)
+	p.SSHCommander = commander
+
+	provisionedAt := time.Date(2024, 3, 1, 12, 30, 0, 0, time.FixedZone("CET", 3600))
+	if err := writeMotd(context.Background(), p, provisionedAt); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo docker version --format '{{.Server.Version}}'",
+		"printf '%s' 'This machine (pi-01) is managed by docker-machine.\nDocker 24.0.7, provisioned at 2024-03-01T11:30:00Z.\nChanges made by hand may be lost when it is provisioned again.\n' | sudo tee /etc/motd",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestGetMotd(t *testing.T) {
+	banner := motdBanner("pi-01", "24.0.7", time.Date(2024, 3, 1, 11, 30, 0, 0, time.UTC))
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"cat /etc/motd 2>/dev/null || true": banner,
+		},
+	}
+
+	motd, err := GetMotd(context.Background(), newFakeDebianProvisioner(commander))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if motd != banner {
+		t.Fatalf("expected %q; received %q", banner, motd)
+	}
+}
@@ -0,0 +1,38 @@
+package provision
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+)
+
+const oomDropInName = "oom.conf"
+
+func validateOOMScoreAdjust(adjust int) error {
+	if adjust < -1000 || adjust > 1000 {
+		return fmt.Errorf("Invalid OOM score adjustment %d, expected a value between -1000 and 1000", adjust)
+	}
+
+	return nil
+}
+
+// oomDropIn renders the docker.service drop-in for the OOM score adjustment.
+func oomDropIn(adjust int) (string, error) {
+	if err := validateOOMScoreAdjust(adjust); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("[Service]\nOOMScoreAdjust=%d\n", adjust), nil
+}
+
+// configureOOMScoreAdjust has systemd start the daemon with the OOM score
+// adjustment, a negative one keeps the kernel from killing it under memory
+// pressure. Hosts without the drop-in get it from daemon.json instead.
+func configureOOMScoreAdjust(ctx context.Context, p SSHCommander, adjust int) error {
+	dropIn, err := oomDropIn(adjust)
+	if err != nil {
+		return err
+	}
+
+	return writeDockerDropIn(ctx, p, dockerDropInPath(p, oomDropInName), dropIn)
+}
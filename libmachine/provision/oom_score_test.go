@@ -0,0 +1,75 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func TestConfigureOOMScoreAdjust(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := configureOOMScoreAdjust(context.Background(), commander, -500); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo mkdir -p /etc/systemd/system/docker.service.d",
+		"printf '%s' '[Service]\nOOMScoreAdjust=-500\n' | sudo tee /etc/systemd/system/docker.service.d/oom.conf",
+		"sudo systemctl daemon-reload",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestConfigureOOMScoreAdjustOutOfRange(t *testing.T) {
+	for _, adjust := range []int{-1001, 1001} {
+		commander := &provisiontest.FakeSSHCommander{}
+
+		if err := configureOOMScoreAdjust(context.Background(), commander, adjust); err == nil {
+			t.Fatalf("expected an error for %d", adjust)
+		}
+
+		if len(commander.Commands) != 0 {
+			t.Fatalf("expected no commands for %d; received %v", adjust, commander.Commands)
+		}
+	}
+}
+
+func TestWriteDaemonConfigOOMScoreAdjust(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := writeDaemonConfig(context.Background(), commander, engine.Options{OOMScoreAdjust: -500}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo cat /etc/docker/daemon.json 2>/dev/null || true",
+		`sudo mkdir -p /etc/docker && printf '%s' '{"oom-score-adjust":-500}' | sudo tee /etc/docker/daemon.json`,
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+
+	if err := writeDaemonConfig(context.Background(), commander, engine.Options{OOMScoreAdjust: 1500}); err == nil {
+		t.Fatal("expected an error for an out of range adjustment")
+	}
+}
+
+func TestWriteDockerOptionsOOMScoreAdjustSystemd(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+	p := newFakeDebianProvisioner(commander)
+	p.EngineOptions = engine.Options{StorageDriver: "overlay2", OOMScoreAdjust: -500}
+
+	if err := writeDockerOptions(context.Background(), p, 2376); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(commander.Commands) != 2 {
+		t.Fatalf("expected only the docker unit on a systemd host, the adjustment is in a drop-in; received %v", commander.Commands)
+	}
+}
@@ -17,16 +17,19 @@ import (
 // Values in this struct must always be string
 // or the reflection will not work properly.
 type OsRelease struct {
-	AnsiColor    string `osr:"ANSI_COLOR"`
-	Name         string `osr:"NAME"`
-	Version      string `osr:"VERSION"`
-	ID           string `osr:"ID"`
-	IDLike       string `osr:"ID_LIKE"`
-	PrettyName   string `osr:"PRETTY_NAME"`
-	VersionID    string `osr:"VERSION_ID"`
-	HomeURL      string `osr:"HOME_URL"`
-	SupportURL   string `osr:"SUPPORT_URL"`
-	BugReportURL string `osr:"BUG_REPORT_URL"`
+	AnsiColor  string `osr:"ANSI_COLOR"`
+	Name       string `osr:"NAME"`
+	Version    string `osr:"VERSION"`
+	ID         string `osr:"ID"`
+	IDLike     string `osr:"ID_LIKE"`
+	PrettyName string `osr:"PRETTY_NAME"`
+	VersionID  string `osr:"VERSION_ID"`
+	// VersionCodename is the release name, like bookworm. Older releases
+	// don't set it.
+	VersionCodename string `osr:"VERSION_CODENAME"`
+	HomeURL         string `osr:"HOME_URL"`
+	SupportURL      string `osr:"SUPPORT_URL"`
+	BugReportURL    string `osr:"BUG_REPORT_URL"`
 }
 
 func stripQuotes(val string) string {
@@ -6,12 +6,16 @@ const (
 	Install PackageAction = iota
 	Remove
 	Upgrade
+	// Purge removes the package along with its configuration files, where
+	// the package manager keeps them apart.
+	Purge
 )
 
 var packageActions = []string{
 	"install",
 	"remove",
 	"upgrade",
+	"purge",
 }
 
 func (s PackageAction) String() string {
@@ -10,13 +10,14 @@ import (
 	"github.com/docker/machine/libmachine/provision/pkgaction"
 	"github.com/docker/machine/libmachine/provision/serviceaction"
 	"github.com/docker/machine/libmachine/swarm"
+	"golang.org/x/net/context"
 )
 
 var provisioners = make(map[string]*RegisteredProvisioner)
 
 type SSHCommander interface {
 	// Short-hand for accessing an SSH command from the driver.
-	SSHCommand(args string) (string, error)
+	SSHCommand(ctx context.Context, args string) (string, error)
 }
 
 // Provisioner defines distribution specific actions
@@ -33,28 +34,40 @@ type Provisioner interface {
 	// Return the auth options used to configure remote connection for the daemon.
 	GetAuthOptions() auth.Options
 
+	// Set the auth options used to configure remote connection for the daemon.
+	SetAuthOptions(authOptions auth.Options)
+
+	// Get the engine options the daemon configuration is generated from.
+	GetEngineOptions() engine.Options
+
+	// Set the engine options the daemon configuration is generated from.
+	SetEngineOptions(engineOptions engine.Options)
+
 	// Run a package action e.g. install
-	Package(name string, action pkgaction.PackageAction) error
+	Package(ctx context.Context, name string, action pkgaction.PackageAction) error
 
 	// Get Hostname
-	Hostname() (string, error)
+	Hostname(ctx context.Context) (string, error)
 
 	// Set hostname
-	SetHostname(hostname string) error
+	SetHostname(ctx context.Context, hostname string) error
 
 	// Figure out if this is the right provisioner to use based on /etc/os-release info
 	CompatibleWithHost() bool
 
+	// Report which features the provisioner supports.
+	Capabilities() Capabilities
+
 	// Do the actual provisioning piece:
 	//     1. Set the hostname on the instance.
 	//     2. Install Docker if it is not present.
 	//     3. Configure the daemon to accept connections over TLS.
 	//     4. Copy the needed certificates to the server and local config dir.
 	//     5. Configure / activate swarm if applicable.
-	Provision(swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error
+	Provision(ctx context.Context, swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error
 
 	// Perform action on a named service e.g. stop
-	Service(name string, action serviceaction.ServiceAction) error
+	Service(ctx context.Context, name string, action serviceaction.ServiceAction) error
 
 	// Get the driver which is contained in the provisioner.
 	GetDriver() drivers.Driver
@@ -65,6 +78,10 @@ type Provisioner interface {
 
 	// Get the OS Release info for the current provisioner
 	GetOsReleaseInfo() (*OsRelease, error)
+
+	// Get the architecture, kernel, memory and CPU count of the host. The
+	// result is cached after the first call.
+	GetHostInfo(ctx context.Context) (*HostInfo, error)
 }
 
 // RegisteredProvisioner creates a new provisioner
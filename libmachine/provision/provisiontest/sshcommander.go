@@ -0,0 +1,39 @@
+// Package provisiontest provides utilities for testing provisioners
+package provisiontest
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// FakeSSHCommander is an implementation of provision.SSHCommander which
+// records every command it is asked to run. Commands found in Responses or
+// Errors get the registered output; any other command succeeds silently.
+// A non zero Delay makes every command take that long, unless the context
+// is done first.
+type FakeSSHCommander struct {
+	Responses map[string]string
+	Errors    map[string]error
+	Commands  []string
+	Delay     time.Duration
+}
+
+// SSHCommand records the command and returns the registered response
+func (sshCmder *FakeSSHCommander) SSHCommand(ctx context.Context, args string) (string, error) {
+	sshCmder.Commands = append(sshCmder.Commands, args)
+
+	if sshCmder.Delay > 0 {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(sshCmder.Delay):
+		}
+	}
+
+	if err, ok := sshCmder.Errors[args]; ok {
+		return sshCmder.Responses[args], err
+	}
+
+	return sshCmder.Responses[args], nil
+}
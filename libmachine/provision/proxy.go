@@ -0,0 +1,134 @@
+package provision
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/provision/serviceaction"
+	"golang.org/x/net/context"
+)
+
+const proxyDropInName = "http-proxy.conf"
+
+// proxyDropIn renders the docker service drop-in setting the proxy
+// environment of the daemon. Empty values are left out.
+func proxyDropIn(httpProxy, httpsProxy, noProxy string) (string, error) {
+	for _, proxy := range []string{httpProxy, httpsProxy} {
+		if proxy == "" {
+			continue
+		}
+		u, err := url.Parse(proxy)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.ContainsAny(proxy, `'" `) {
+			return "", fmt.Errorf("Invalid proxy %q, expected a URL like http://proxy:3128", proxy)
+		}
+	}
+
+	if strings.ContainsAny(noProxy, `'" `) {
+		return "", fmt.Errorf("Invalid no proxy list %q, expected comma separated hosts", noProxy)
+	}
+
+	dropIn := "[Service]\n"
+	for _, env := range []struct{ name, value string }{
+		{"HTTP_PROXY", httpProxy},
+		{"HTTPS_PROXY", httpsProxy},
+		{"NO_PROXY", noProxy},
+	} {
+		if env.value != "" {
+			dropIn += fmt.Sprintf("Environment=\"%s=%s\"\n", env.name, env.value)
+		}
+	}
+
+	return dropIn, nil
+}
+
+// proxyEnv replaces the proxy variables in the engine environment env,
+// leaving out the empty values.
+func proxyEnv(env []string, httpProxy, httpsProxy, noProxy string) []string {
+	proxyEnv := []string{}
+	for _, e := range env {
+		switch strings.ToUpper(strings.SplitN(e, "=", 2)[0]) {
+		case "HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY":
+			continue
+		}
+		proxyEnv = append(proxyEnv, e)
+	}
+
+	for _, env := range []struct{ name, value string }{
+		{"HTTP_PROXY", httpProxy},
+		{"HTTPS_PROXY", httpsProxy},
+		{"NO_PROXY", noProxy},
+	} {
+		if env.value != "" {
+			proxyEnv = append(proxyEnv, fmt.Sprintf("%s=%s", env.name, env.value))
+		}
+	}
+
+	return proxyEnv
+}
+
+// writeProxyEnv exports the proxy in the file holding DOCKER_OPTS, for the
+// hosts without systemd, which start the daemon from a script sourcing it.
+// It returns the engine options with the new environment.
+func writeProxyEnv(ctx context.Context, p Provisioner, httpProxy, httpsProxy, noProxy string) (engine.Options, error) {
+	engineOptions := p.GetEngineOptions()
+	engineOptions.Env = proxyEnv(engineOptions.Env, httpProxy, httpsProxy, noProxy)
+
+	p.SetEngineOptions(engineOptions)
+	p.SetAuthOptions(setRemoteAuthOptions(p))
+
+	dockerPort, err := getDockerPort(p.GetDriver())
+	if err != nil {
+		return engine.Options{}, err
+	}
+
+	if err := writeDockerOptions(ctx, p, dockerPort); err != nil {
+		return engine.Options{}, err
+	}
+
+	return engineOptions, nil
+}
+
+// UpdateProxy replaces the proxy the daemon uses and restarts it, leaving
+// the rest of its configuration alone. On systemd hosts the proxy drop-in
+// is removed when all values are empty. The other hosts get the proxy from
+// the engine environment, so the engine options of p must be the ones the
+// host was provisioned with. The returned engine options are the ones to
+// save the host with, the environment is updated on hosts without systemd.
+func UpdateProxy(ctx context.Context, p Provisioner, httpProxy, httpsProxy, noProxy string) (engine.Options, error) {
+	dropIn, err := proxyDropIn(httpProxy, httpsProxy, noProxy)
+	if err != nil {
+		return engine.Options{}, err
+	}
+
+	engineOptions := p.GetEngineOptions()
+	proxyDropInPath := dockerDropInPath(p, proxyDropInName)
+
+	if !p.Capabilities().Systemd {
+		if engineOptions, err = writeProxyEnv(ctx, p, httpProxy, httpsProxy, noProxy); err != nil {
+			return engine.Options{}, err
+		}
+	} else if httpProxy == "" && httpsProxy == "" && noProxy == "" {
+		if _, err := p.SSHCommand(ctx, fmt.Sprintf("sudo rm -f %s", proxyDropInPath)); err != nil {
+			return engine.Options{}, err
+		}
+	} else if err := writeDockerDropIn(ctx, p, proxyDropInPath, dropIn); err != nil {
+		return engine.Options{}, err
+	}
+
+	stopped, err := stopContainersForReconfigure(ctx, p)
+	if err != nil {
+		return engine.Options{}, err
+	}
+
+	if err := p.Service(ctx, "docker", serviceaction.Restart); err != nil {
+		return engine.Options{}, err
+	}
+
+	if err := StartContainers(ctx, p, stopped); err != nil {
+		return engine.Options{}, err
+	}
+
+	return engineOptions, nil
+}
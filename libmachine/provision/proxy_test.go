@@ -0,0 +1,122 @@
+package provision
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"github.com/docker/machine/libmachine/state"
+	"golang.org/x/net/context"
+)
+
+func TestProxyDropIn(t *testing.T) {
+	dropIn, err := proxyDropIn("http://proxy:3128", "", "localhost,.corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "[Service]\nEnvironment=\"HTTP_PROXY=http://proxy:3128\"\nEnvironment=\"NO_PROXY=localhost,.corp\"\n"
+	if dropIn != expected {
+		t.Fatalf("expected drop-in %q; received %q", expected, dropIn)
+	}
+
+	for _, proxy := range []string{"proxy:3128", "ftp://proxy", "http://proxy:3128/'"} {
+		if _, err := proxyDropIn(proxy, "", ""); err == nil {
+			t.Fatalf("expected an error for %q", proxy)
+		}
+	}
+
+	if _, err := proxyDropIn("", "", "localhost, .corp"); err == nil {
+		t.Fatal("expected an error for a no proxy list with a space")
+	}
+}
+
+func TestUpdateProxy(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+	p := newFakeDebianProvisioner(commander)
+
+	if _, err := UpdateProxy(context.Background(), p, "http://proxy:3128", "http://proxy:3128", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo mkdir -p /etc/systemd/system/docker.service.d",
+		"printf '%s' '[Service]\nEnvironment=\"HTTP_PROXY=http://proxy:3128\"\nEnvironment=\"HTTPS_PROXY=http://proxy:3128\"\n' | sudo tee /etc/systemd/system/docker.service.d/http-proxy.conf",
+		"sudo systemctl daemon-reload",
+		"sudo systemctl daemon-reload",
+		"sudo systemctl -f restart docker",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %q; received %q", expected, commander.Commands)
+	}
+}
+
+func TestUpdateProxyRemove(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+	p := newFakeDebianProvisioner(commander)
+
+	if _, err := UpdateProxy(context.Background(), p, "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo rm -f /etc/systemd/system/docker.service.d/http-proxy.conf",
+		"sudo systemctl daemon-reload",
+		"sudo systemctl -f restart docker",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %q; received %q", expected, commander.Commands)
+	}
+}
+
+func TestUpdateProxyNotSystemd(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+	p := NewUbuntuProvisioner(&fakedriver.Driver{MockState: state.Running, MockIP: "1.2.3.4"}).(*UbuntuProvisioner)
+	p.SSHCommander = commander
+	p.EngineOptions = engine.Options{StorageDriver: "aufs", Env: []string{"TZ=UTC", "http_proxy=http://old:3128"}}
+
+	engineOptions, err := UpdateProxy(context.Background(), p, "http://proxy:3128", "", "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedEnv := []string{"TZ=UTC", "HTTP_PROXY=http://proxy:3128", "NO_PROXY=localhost"}
+	if !reflect.DeepEqual(engineOptions.Env, expectedEnv) {
+		t.Fatalf("expected the engine environment %v to be returned; received %v", expectedEnv, engineOptions.Env)
+	}
+
+	var config string
+	for _, cmd := range commander.Commands {
+		if strings.HasSuffix(cmd, "| sudo tee /etc/default/docker") {
+			config = cmd
+		}
+	}
+	if config == "" {
+		t.Fatalf("expected the DOCKER_OPTS file to be written; received %q", commander.Commands)
+	}
+
+	for _, env := range []string{"TZ=UTC", "HTTP_PROXY=http://proxy:3128", "NO_PROXY=localhost"} {
+		if !strings.Contains(config, env) {
+			t.Fatalf("expected %s in the engine environment; received %s", env, config)
+		}
+	}
+	if strings.Contains(config, "old:3128") {
+		t.Fatalf("expected the old proxy to be replaced; received %s", config)
+	}
+
+	if last := commander.Commands[len(commander.Commands)-1]; last != "sudo service docker restart" {
+		t.Fatalf("expected docker to be restarted; received %q", commander.Commands)
+	}
+}
+
+func TestProxyEnv(t *testing.T) {
+	env := proxyEnv([]string{"HTTPS_PROXY=http://old:3128", "TZ=UTC"}, "", "http://proxy:3128", "")
+
+	expected := []string{"TZ=UTC", "HTTPS_PROXY=http://proxy:3128"}
+	if !reflect.DeepEqual(env, expected) {
+		t.Fatalf("expected environment %v; received %v", expected, env)
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/docker/machine/libmachine/provision/serviceaction"
 	"github.com/docker/machine/libmachine/state"
 	"github.com/docker/machine/libmachine/swarm"
+	"golang.org/x/net/context"
 )
 
 const (
@@ -56,27 +57,27 @@ func (provisioner *RancherProvisioner) String() string {
 	return "rancheros"
 }
 
-func (provisioner *RancherProvisioner) Service(name string, action serviceaction.ServiceAction) error {
-	command := fmt.Sprintf("sudo system-docker %s %s", action.String(), name)
+func (provisioner *RancherProvisioner) Service(ctx context.Context, name string, action serviceaction.ServiceAction) error {
+	command := fmt.Sprintf("sudo system-docker %s %s", action.String(), serviceName(name, provisioner.dockerService()))
 
-	if _, err := provisioner.SSHCommand(command); err != nil {
+	if _, err := provisioner.SSHCommand(ctx, command); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (provisioner *RancherProvisioner) Package(name string, action pkgaction.PackageAction) error {
+func (provisioner *RancherProvisioner) Package(ctx context.Context, name string, action pkgaction.PackageAction) error {
 	var packageAction string
 
 	if name == "docker" && action == pkgaction.Upgrade {
-		return provisioner.upgrade()
+		return provisioner.upgrade(ctx)
 	}
 
 	switch action {
 	case pkgaction.Install:
 		packageAction = "enabled"
-	case pkgaction.Remove:
+	case pkgaction.Remove, pkgaction.Purge:
 		packageAction = "disable"
 	case pkgaction.Upgrade:
 		// TODO: support upgrade
@@ -85,14 +86,21 @@ func (provisioner *RancherProvisioner) Package(name string, action pkgaction.Pac
 
 	command := fmt.Sprintf("sudo rancherctl service %s %s", packageAction, name)
 
-	if _, err := provisioner.SSHCommand(command); err != nil {
+	if _, err := provisioner.SSHCommand(ctx, command); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (provisioner *RancherProvisioner) Provision(swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error {
+func (provisioner *RancherProvisioner) Provision(ctx context.Context, swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error {
+	ctx, cancel := provisionContext(ctx, engineOptions)
+	defer cancel()
+
+	if err := ValidateOptions(provisioner, swarmOptions, authOptions, engineOptions); err != nil {
+		return err
+	}
+
 	provisioner.SwarmOptions = swarmOptions
 	provisioner.AuthOptions = authOptions
 	provisioner.EngineOptions = engineOptions
@@ -105,13 +113,13 @@ func (provisioner *RancherProvisioner) Provision(swarmOptions swarm.Options, aut
 	}
 
 	log.Debugf("Setting hostname %s", provisioner.Driver.GetMachineName())
-	if err := provisioner.SetHostname(provisioner.Driver.GetMachineName()); err != nil {
+	if err := provisioner.SetHostname(ctx, provisioner.Driver.GetMachineName()); err != nil {
 		return err
 	}
 
 	for _, pkg := range provisioner.Packages {
 		log.Debugf("Installing package %s", pkg)
-		if err := provisioner.Package(pkg, pkgaction.Install); err != nil {
+		if err := provisioner.Package(ctx, pkg, pkgaction.Install); err != nil {
 			return err
 		}
 	}
@@ -120,7 +128,7 @@ func (provisioner *RancherProvisioner) Provision(swarmOptions swarm.Options, aut
 	provisioner.AuthOptions = setRemoteAuthOptions(provisioner)
 
 	log.Debugf("Setting up certificates")
-	if err := ConfigureAuth(provisioner); err != nil {
+	if err := ConfigureAuth(ctx, provisioner); err != nil {
 		return err
 	}
 
@@ -132,42 +140,42 @@ func (provisioner *RancherProvisioner) Provision(swarmOptions swarm.Options, aut
 	return nil
 }
 
-func (provisioner *RancherProvisioner) SetHostname(hostname string) error {
+func (provisioner *RancherProvisioner) SetHostname(ctx context.Context, hostname string) error {
 	// /etc/hosts is bind mounted from Docker, this is hack to that the generic provisioner doesn't try to mv /etc/hosts
-	if _, err := provisioner.SSHCommand("sed /127.0.1.1/d /etc/hosts > /tmp/hosts && cat /tmp/hosts | sudo tee /etc/hosts"); err != nil {
+	if _, err := provisioner.SSHCommand(ctx, "sed /127.0.1.1/d /etc/hosts > /tmp/hosts && cat /tmp/hosts | sudo tee /etc/hosts"); err != nil {
 		return err
 	}
 
-	if err := provisioner.GenericProvisioner.SetHostname(hostname); err != nil {
+	if err := provisioner.GenericProvisioner.SetHostname(ctx, hostname); err != nil {
 		return err
 	}
 
-	if _, err := provisioner.SSHCommand(fmt.Sprintf(hostnameTmpl, hostname)); err != nil {
+	if _, err := provisioner.SSHCommand(ctx, fmt.Sprintf(hostnameTmpl, hostname)); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (provisioner *RancherProvisioner) upgrade() error {
+func (provisioner *RancherProvisioner) upgrade(ctx context.Context) error {
 	switch provisioner.Driver.DriverName() {
 	case "virtualbox":
-		return provisioner.upgradeIso()
+		return provisioner.upgradeIso(ctx)
 	default:
 		log.Infof("Running upgrade")
-		if _, err := provisioner.SSHCommand("sudo rancherctl os upgrade -f --no-reboot"); err != nil {
+		if _, err := provisioner.SSHCommand(ctx, "sudo rancherctl os upgrade -f --no-reboot"); err != nil {
 			return err
 		}
 
 		log.Infof("Upgrade succeeded, rebooting")
 		// ignore errors here because the SSH connection will close
-		provisioner.SSHCommand("sudo reboot")
+		provisioner.SSHCommand(ctx, "sudo reboot")
 
 		return nil
 	}
 }
 
-func (provisioner *RancherProvisioner) upgradeIso() error {
+func (provisioner *RancherProvisioner) upgradeIso(ctx context.Context) error {
 	// Largely copied from Boot2Docker provisioner, we should find a way to share this code
 	log.Info("Stopping machine to do the upgrade...")
 
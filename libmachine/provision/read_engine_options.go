@@ -0,0 +1,300 @@
+package provision
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/docker/machine/libmachine/engine"
+	"golang.org/x/net/context"
+)
+
+// the storage driver of the boot2docker profile
+var reDockerStorage = regexp.MustCompile(`(?m)^DOCKER_STORAGE=(\S+)$`)
+
+// the daemon flags rendered with their value as a separate argument
+var separateValueFlags = map[string]bool{
+	"-H":                  true,
+	"--host":              true,
+	"--storage-driver":    true,
+	"--tlscacert":         true,
+	"--tlscert":           true,
+	"--tlskey":            true,
+	"--label":             true,
+	"--insecure-registry": true,
+	"--registry-mirror":   true,
+}
+
+// engineConfigArgs returns the daemon arguments of an engine config: the
+// ExecStart command of a systemd unit, or DOCKER_OPTS or EXTRA_ARGS of a
+// shell config. Variables expanded by systemd are left out.
+func engineConfigArgs(config string) []string {
+	for _, line := range strings.Split(config, "\n") {
+		fields := strings.Fields(strings.TrimPrefix(line, "ExecStart="))
+		if !strings.HasPrefix(line, "ExecStart=") || len(fields) == 0 {
+			continue
+		}
+
+		args := []string{}
+		for _, field := range fields[1:] {
+			if field == "-d" || field == "--daemon" || strings.HasPrefix(field, "$") || strings.HasPrefix(field, `\$`) {
+				continue
+			}
+			args = append(args, field)
+		}
+
+		return args
+	}
+
+	for _, variable := range []string{"DOCKER_OPTS='", "EXTRA_ARGS='"} {
+		start := strings.Index(config, variable)
+		if start == -1 {
+			continue
+		}
+
+		rest := config[start+len(variable):]
+		if end := strings.Index(rest, "'"); end != -1 {
+			return strings.Fields(rest[:end])
+		}
+	}
+
+	return nil
+}
+
+// unquoteList splits a list of Go quoted strings separated by spaces, as
+// rendered in the Environment of a systemd unit.
+func unquoteList(list string) []string {
+	values := []string{}
+
+	rest := strings.TrimSpace(list)
+	for rest != "" {
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			break
+		}
+
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			break
+		}
+
+		values = append(values, value)
+		rest = strings.TrimSpace(rest[len(quoted):])
+	}
+
+	return values
+}
+
+// engineConfigEnv returns the daemon environment of an engine config.
+func engineConfigEnv(config string) []string {
+	var env []string
+
+	for _, line := range strings.Split(config, "\n") {
+		switch {
+		case strings.HasPrefix(line, "Environment="):
+			env = append(env, unquoteList(strings.TrimPrefix(line, "Environment="))...)
+		case strings.HasPrefix(line, `export \"`) && strings.HasSuffix(line, `\"`):
+			if value, err := strconv.Unquote(strings.TrimSuffix(strings.TrimPrefix(line, `export \"`), `\"`)); err == nil {
+				env = append(env, value)
+			}
+		}
+	}
+
+	return env
+}
+
+// parseEngineArgs sets the engine options matching the daemon arguments.
+// Arguments without a typed option go to the arbitrary flags, so that the
+// config rendered from the options passes the same arguments. The provider
+// label and the TLS and host arguments are left out, they are rendered
+// from the driver and the auth options.
+func parseEngineArgs(args []string, engineOptions *engine.Options) {
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := args[i], "", false
+		if parts := strings.SplitN(name, "=", 2); len(parts) == 2 {
+			name, value, hasValue = parts[0], parts[1], true
+		} else if separateValueFlags[name] && i+1 < len(args) {
+			i++
+			value, hasValue = args[i], true
+		}
+
+		if parseEngineArg(name, value, engineOptions) {
+			continue
+		}
+
+		flag := strings.TrimPrefix(name, "--")
+		if hasValue {
+			flag += "=" + value
+		}
+		engineOptions.ArbitraryFlags = append(engineOptions.ArbitraryFlags, flag)
+	}
+
+	// ip6tables=false is rendered from iptables=false when IPv6 is enabled
+	iptablesOff := false
+	for _, flag := range engineOptions.ArbitraryFlags {
+		iptablesOff = iptablesOff || flag == "iptables=false"
+	}
+
+	if engineOptions.Ipv6 && iptablesOff {
+		flags := []string{}
+		for _, flag := range engineOptions.ArbitraryFlags {
+			if flag != "ip6tables=false" {
+				flags = append(flags, flag)
+			}
+		}
+		engineOptions.ArbitraryFlags = flags
+	}
+}
+
+// parseEngineArg sets the typed engine option of a daemon argument, and
+// tells whether there is one.
+func parseEngineArg(name, value string, engineOptions *engine.Options) bool {
+	switch name {
+	case "-H", "--host", "--tlscacert", "--tlscert", "--tlskey":
+	case "--tlsverify":
+		engineOptions.TLSVerify = true
+	case "--storage-driver":
+		engineOptions.StorageDriver = value
+	case "--label":
+		if !strings.HasPrefix(value, "provider=") {
+			engineOptions.Labels = append(engineOptions.Labels, value)
+		}
+	case "--insecure-registry":
+		if value == allInsecureRegistriesCIDR {
+			engineOptions.AllowAllInsecureRegistries = true
+		} else {
+			engineOptions.InsecureRegistry = append(engineOptions.InsecureRegistry, value)
+		}
+	case "--registry-mirror":
+		engineOptions.RegistryMirror = append(engineOptions.RegistryMirror, value)
+	case "--dns":
+		engineOptions.DNS = append(engineOptions.DNS, value)
+	case "--ipv6":
+		engineOptions.Ipv6 = true
+	case "--fixed-cidr-v6":
+		engineOptions.FixedCIDRv6 = value
+	case "--selinux-enabled":
+		engineOptions.SelinuxEnabled = true
+	case "--no-new-privileges":
+		engineOptions.NoNewPrivileges = true
+	case "--disable-legacy-registry":
+		engineOptions.DisableLegacyRegistry = true
+	case "--log-level":
+		engineOptions.LogLevel = value
+	case "--default-shm-size":
+		engineOptions.DefaultShmSize = value
+	case "--pidfile":
+		engineOptions.Pidfile = value
+	case "--exec-root":
+		engineOptions.ExecRoot = value
+	case "--bridge":
+		engineOptions.BridgeName = value
+	case "--init-path":
+		engineOptions.InitBinary = value
+	case "--init":
+		engineOptions.DefaultInit = true
+	case "--config-file":
+		engineOptions.ConfigDir = path.Dir(value)
+	case "--default-network-opt":
+		if !strings.HasPrefix(value, "bridge=") {
+			return false
+		}
+		engineOptions.DefaultNetworkOpts = append(engineOptions.DefaultNetworkOpts, strings.TrimPrefix(value, "bridge="))
+	case "--shutdown-timeout":
+		return parseIntArg(value, &engineOptions.ShutdownTimeout)
+	case "--max-concurrent-downloads":
+		return parseIntArg(value, &engineOptions.MaxConcurrentDownloads)
+	default:
+		return false
+	}
+
+	return true
+}
+
+func parseIntArg(value string, dst *int) bool {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return false
+	}
+
+	*dst = n
+	return true
+}
+
+// parseDaemonConfig sets the engine options kept in daemon.json.
+func parseDaemonConfig(data string, engineOptions *engine.Options) error {
+	if strings.TrimSpace(data) == "" {
+		return nil
+	}
+
+	var cfg daemonConfig
+	if err := json.Unmarshal([]byte(data), &cfg); err != nil {
+		return fmt.Errorf("Invalid daemon.json: %s", err)
+	}
+
+	engineOptions.ContainerdSnapshotter = cfg.Features["containerd-snapshotter"]
+	if cfg.Builder != nil {
+		engineOptions.BuilderGC = cfg.Builder.GC.Enabled
+		engineOptions.BuilderGCKeepStorage = cfg.Builder.GC.DefaultKeepStorage
+	}
+	engineOptions.MaxDownloadAttempts = cfg.MaxDownloadAttempts
+	engineOptions.OOMScoreAdjust = cfg.OOMScoreAdjust
+	engineOptions.CPURTRuntime = cfg.CPURTRuntime
+	engineOptions.CPURTPeriod = cfg.CPURTPeriod
+
+	return nil
+}
+
+// ReadEngineOptions reconstructs the engine options from the daemon
+// configuration on the host, its command line options and daemon.json,
+// so that tooling can compare them with the stored ones. Only what the
+// daemon sees can be recovered: options acting on the host, like the apt
+// settings, are left empty.
+func ReadEngineOptions(ctx context.Context, p Provisioner) (engine.Options, error) {
+	// rendering gives the config path, and adds the provider label to the
+	// engine options
+	engineOptions := p.GetEngineOptions()
+	defer p.SetEngineOptions(engineOptions)
+
+	dockerPort, err := getDockerPort(p.GetDriver())
+	if err != nil {
+		return engine.Options{}, err
+	}
+
+	dkrcfg, err := p.GenerateDockerOptions(dockerPort)
+	if err != nil {
+		return engine.Options{}, err
+	}
+
+	config, err := p.SSHCommand(ctx, fmt.Sprintf("sudo cat %s 2>/dev/null || true", dkrcfg.EngineOptionsPath))
+	if err != nil {
+		return engine.Options{}, err
+	}
+	if strings.TrimSpace(config) == "" {
+		return engine.Options{}, fmt.Errorf("No daemon configuration found at %s", dkrcfg.EngineOptionsPath)
+	}
+
+	read := engine.Options{
+		DisableTCP: !strings.Contains(config, "tcp://"),
+		Env:        engineConfigEnv(config),
+	}
+	parseEngineArgs(engineConfigArgs(config), &read)
+
+	if storage := reDockerStorage.FindStringSubmatch(config); storage != nil {
+		read.StorageDriver = storage[1]
+	}
+
+	daemonJSON, err := p.SSHCommand(ctx, fmt.Sprintf("sudo cat %s 2>/dev/null || true", daemonConfigFile(read)))
+	if err != nil {
+		return engine.Options{}, err
+	}
+
+	if err := parseDaemonConfig(daemonJSON, &read); err != nil {
+		return engine.Options{}, err
+	}
+
+	return read, nil
+}
@@ -0,0 +1,138 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"github.com/docker/machine/libmachine/state"
+	"golang.org/x/net/context"
+)
+
+const genericEngineConfig = `
+DOCKER_OPTS='
+-H tcp://0.0.0.0:2376
+-H unix:///var/run/docker.sock
+--storage-driver aufs
+--tlsverify
+--tlscacert /etc/docker/ca.pem
+--tlscert /etc/docker/server.pem
+--tlskey /etc/docker/server-key.pem
+--label env=prod
+--label provider=generic
+--insecure-registry registry.local:5000
+--dns=8.8.8.8
+--max-concurrent-downloads=2
+--iptables=false
+
+'
+export \""HTTP_PROXY=http://proxy:3128"\"
+
+`
+
+func TestParseGenericEngineConfig(t *testing.T) {
+	read := engine.Options{
+		DisableTCP: false,
+		Env:        engineConfigEnv(genericEngineConfig),
+	}
+	parseEngineArgs(engineConfigArgs(genericEngineConfig), &read)
+
+	expected := engine.Options{
+		StorageDriver:          "aufs",
+		TLSVerify:              true,
+		Labels:                 []string{"env=prod"},
+		InsecureRegistry:       []string{"registry.local:5000"},
+		DNS:                    []string{"8.8.8.8"},
+		MaxConcurrentDownloads: 2,
+		ArbitraryFlags:         []string{"iptables=false"},
+		Env:                    []string{"HTTP_PROXY=http://proxy:3128"},
+	}
+	if !reflect.DeepEqual(read, expected) {
+		t.Fatalf("expected options %+v; received %+v", expected, read)
+	}
+}
+
+func TestParseDaemonConfig(t *testing.T) {
+	read := engine.Options{}
+
+	daemonJSON := `{"features":{"containerd-snapshotter":true},"builder":{"gc":{"enabled":true,"defaultKeepStorage":"10GB"}},"max-download-attempts":10,"oom-score-adjust":-500}`
+	if err := parseDaemonConfig(daemonJSON, &read); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := engine.Options{
+		ContainerdSnapshotter: true,
+		BuilderGC:             true,
+		BuilderGCKeepStorage:  "10GB",
+		MaxDownloadAttempts:   10,
+		OOMScoreAdjust:        -500,
+	}
+	if !reflect.DeepEqual(read, expected) {
+		t.Fatalf("expected options %+v; received %+v", expected, read)
+	}
+
+	if err := parseDaemonConfig("{", &read); err == nil {
+		t.Fatal("expected an error for invalid JSON")
+	}
+}
+
+func TestReadEngineOptions(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{Responses: map[string]string{}}
+	p := NewDebianProvisioner(&fakedriver.Driver{
+		MockState: state.Running,
+		MockIP:    "1.2.3.4",
+	}).(*DebianProvisioner)
+	p.SSHCommander = commander
+
+	engineOptions := engine.Options{
+		StorageDriver:      "overlay2",
+		TLSVerify:          true,
+		Labels:             []string{"env=prod"},
+		RegistryMirror:     []string{"https://mirror.local"},
+		Env:                []string{"HTTP_PROXY=http://proxy:3128"},
+		Ipv6:               true,
+		FixedCIDRv6:        "2001:db8:1::/64",
+		LogLevel:           "warn",
+		DefaultNetworkOpts: []string{"com.docker.network.driver.mtu=1400"},
+		ArbitraryFlags:     []string{"iptables=false"},
+		CPURTRuntime:       950000,
+	}
+	p.EngineOptions = engineOptions
+	p.AuthOptions = setRemoteAuthOptions(p)
+
+	dkrcfg, err := p.GenerateDockerOptions(2376)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.EngineOptions = engineOptions
+
+	commander.Responses["sudo cat /etc/systemd/system/docker.service 2>/dev/null || true"] = dkrcfg.EngineOptions
+	commander.Responses["sudo cat /etc/docker/daemon.json 2>/dev/null || true"] = `{"cpu-rt-runtime":950000}`
+
+	read, err := ReadEngineOptions(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(read, engineOptions) {
+		t.Fatalf("expected options %+v; received %+v", engineOptions, read)
+	}
+
+	if !reflect.DeepEqual(p.EngineOptions, engineOptions) {
+		t.Fatalf("expected the provisioner options to be left alone; received %+v", p.EngineOptions)
+	}
+}
+
+func TestReadEngineOptionsMissing(t *testing.T) {
+	p := NewDebianProvisioner(&fakedriver.Driver{
+		MockState: state.Running,
+		MockIP:    "1.2.3.4",
+	}).(*DebianProvisioner)
+	p.SSHCommander = &provisiontest.FakeSSHCommander{}
+
+	if _, err := ReadEngineOptions(context.Background(), p); err == nil {
+		t.Fatal("expected an error without a daemon configuration")
+	}
+}
@@ -0,0 +1,178 @@
+package provision
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/log"
+	"golang.org/x/net/context"
+)
+
+const (
+	systemdUnitDir = "/etc/systemd/system"
+	// runtimeUnitDir holds units until the next reboot, it is used for the
+	// docker units when /etc can't be written to
+	runtimeUnitDir = "/run/systemd/system"
+)
+
+// writableCertDirs are the places tried for the server certs when the root
+// filesystem is read-only, hardened images keep /var or /data writable.
+var writableCertDirs = []string{
+	"/var/lib/docker-machine/certs",
+	"/data/docker-machine/certs",
+}
+
+// writableConfigDirs are the places tried for daemon.json in the same case.
+var writableConfigDirs = []string{
+	"/var/lib/docker-machine",
+	"/data/docker-machine",
+}
+
+// daemonOptionsFiler is implemented by the provisioners writing the daemon
+// options to a file of their own.
+type daemonOptionsFiler interface {
+	daemonOptionsFile() string
+}
+
+// rootReadOnly tells whether / is mounted read-only, going by the last
+// mount of / in case an overlay was mounted on top.
+func rootReadOnly(ctx context.Context, p SSHCommander) (bool, error) {
+	out, err := p.SSHCommand(ctx, "awk '$2 == \"/\" {o=$4} END {print o}' /proc/mounts")
+	if err != nil {
+		return false, err
+	}
+
+	for _, opt := range strings.Split(strings.TrimSpace(out), ",") {
+		if opt == "ro" {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// remoteWritable tells whether dir, or the closest of its parents which
+// exists, can be written to on the host.
+func remoteWritable(ctx context.Context, p SSHCommander, dir string) (bool, error) {
+	out, err := p.SSHCommand(ctx, fmt.Sprintf("d=%s; while [ ! -e \"$d\" ]; do d=$(dirname \"$d\"); done; sudo test -w \"$d\" && echo ok || true", dir))
+	if err != nil {
+		return false, err
+	}
+
+	return strings.TrimSpace(out) == "ok", nil
+}
+
+// redirectReadOnlyRoot moves the server certs to a writable directory when
+// the root filesystem is read-only and their directory isn't writable.
+func redirectReadOnlyRoot(ctx context.Context, p SSHCommander, authOptions auth.Options) (auth.Options, error) {
+	readOnly, err := rootReadOnly(ctx, p)
+	if err != nil || !readOnly {
+		return authOptions, err
+	}
+
+	writable, err := remoteWritable(ctx, p, path.Dir(authOptions.ServerCertRemotePath))
+	if err != nil || writable {
+		return authOptions, err
+	}
+
+	for _, dir := range writableCertDirs {
+		writable, err := remoteWritable(ctx, p, dir)
+		if err != nil {
+			return authOptions, err
+		}
+		if !writable {
+			continue
+		}
+
+		log.Infof("The root filesystem is read-only, storing the server certs in %s", dir)
+
+		authOptions.CaCertRemotePath = path.Join(dir, "ca.pem")
+		authOptions.ServerCertRemotePath = path.Join(dir, "server.pem")
+		authOptions.ServerKeyRemotePath = path.Join(dir, "server-key.pem")
+
+		return authOptions, nil
+	}
+
+	return authOptions, fmt.Errorf("The root filesystem is read-only and none of %s is writable, set the remote cert paths to a writable location", strings.Join(append([]string{path.Dir(authOptions.ServerCertRemotePath)}, writableCertDirs...), ", "))
+}
+
+// redirectDaemonConfig moves daemon.json to a writable directory when the
+// root filesystem is read-only and /etc/docker isn't writable. The docker
+// unit and its drop-ins follow to /run/systemd/system, where they last
+// until the next reboot; other daemon options files can't be moved.
+func redirectDaemonConfig(ctx context.Context, p Provisioner, engineOptions engine.Options) (engine.Options, error) {
+	if engineOptions.ConfigDir != "" {
+		return engineOptions, nil
+	}
+
+	readOnly, err := rootReadOnly(ctx, p)
+	if err != nil || !readOnly {
+		return engineOptions, err
+	}
+
+	writable, err := remoteWritable(ctx, p, path.Dir(daemonConfigPath))
+	if err != nil || writable {
+		return engineOptions, err
+	}
+
+	unit := false
+	if filer, ok := p.(daemonOptionsFiler); ok {
+		optionsFile := filer.daemonOptionsFile()
+		unit = path.Dir(optionsFile) == systemdUnitDir
+
+		if !unit {
+			writable, err := remoteWritable(ctx, p, path.Dir(optionsFile))
+			if err != nil {
+				return engineOptions, err
+			}
+			if !writable {
+				return engineOptions, fmt.Errorf("The root filesystem is read-only and the %s provisioner can't write the daemon options to %s", p.String(), optionsFile)
+			}
+		}
+	}
+
+	for _, dir := range writableConfigDirs {
+		writable, err := remoteWritable(ctx, p, dir)
+		if err != nil {
+			return engineOptions, err
+		}
+		if !writable {
+			continue
+		}
+
+		log.Infof("The root filesystem is read-only, storing the daemon configuration in %s", dir)
+		if unit {
+			log.Warnf("The docker unit is written to %s, which is cleared on reboot: provision the machine again after restarting it.", runtimeUnitDir)
+		}
+
+		engineOptions.ConfigDir = dir
+
+		return engineOptions, nil
+	}
+
+	return engineOptions, fmt.Errorf("The root filesystem is read-only and none of %s is writable, the daemon configuration can't be stored", strings.Join(append([]string{path.Dir(daemonConfigPath)}, writableConfigDirs...), ", "))
+}
+
+// dockerUnitDir is the directory of the docker units on the host of p.
+func dockerUnitDir(p SSHCommander) string {
+	if provisioner, ok := p.(Provisioner); ok && provisioner.GetEngineOptions().ConfigDir != "" {
+		return runtimeUnitDir
+	}
+
+	return systemdUnitDir
+}
+
+// RecordRedirectedPaths copies the remote paths provisioning moved off a
+// read-only root from p to the options of the host, so that they are
+// saved with it and used by the later reconfigurations.
+func RecordRedirectedPaths(p Provisioner, authOptions *auth.Options, engineOptions *engine.Options) {
+	provisionedAuth := p.GetAuthOptions()
+
+	authOptions.CaCertRemotePath = provisionedAuth.CaCertRemotePath
+	authOptions.ServerCertRemotePath = provisionedAuth.ServerCertRemotePath
+	authOptions.ServerKeyRemotePath = provisionedAuth.ServerKeyRemotePath
+	engineOptions.ConfigDir = p.GetEngineOptions().ConfigDir
+}
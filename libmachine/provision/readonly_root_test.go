@@ -0,0 +1,184 @@
+package provision
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+const (
+	rootMountCmd         = "awk '$2 == \"/\" {o=$4} END {print o}' /proc/mounts"
+	etcDockerWritableCmd = "d=/etc/docker; while [ ! -e \"$d\" ]; do d=$(dirname \"$d\"); done; sudo test -w \"$d\" && echo ok || true"
+	varCertsWritableCmd  = "d=/var/lib/docker-machine/certs; while [ ! -e \"$d\" ]; do d=$(dirname \"$d\"); done; sudo test -w \"$d\" && echo ok || true"
+)
+
+var etcDockerAuthOptions = auth.Options{
+	CaCertRemotePath:     "/etc/docker/ca.pem",
+	ServerCertRemotePath: "/etc/docker/server.pem",
+	ServerKeyRemotePath:  "/etc/docker/server-key.pem",
+}
+
+func TestRedirectReadOnlyRootWritable(t *testing.T) {
+	for _, responses := range []map[string]string{
+		{rootMountCmd: "rw,relatime\n"},
+		{rootMountCmd: "ro,relatime\n", etcDockerWritableCmd: "ok\n"},
+	} {
+		commander := &provisiontest.FakeSSHCommander{Responses: responses}
+
+		authOptions, err := redirectReadOnlyRoot(context.Background(), commander, etcDockerAuthOptions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if authOptions.ServerCertRemotePath != "/etc/docker/server.pem" {
+			t.Fatalf("expected the certs to stay in /etc/docker with %v; received %+v", responses, authOptions)
+		}
+	}
+}
+
+func TestRedirectReadOnlyRoot(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			rootMountCmd:        "ro,relatime\n",
+			varCertsWritableCmd: "ok\n",
+		},
+	}
+
+	authOptions, err := redirectReadOnlyRoot(context.Background(), commander, etcDockerAuthOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := auth.Options{
+		CaCertRemotePath:     "/var/lib/docker-machine/certs/ca.pem",
+		ServerCertRemotePath: "/var/lib/docker-machine/certs/server.pem",
+		ServerKeyRemotePath:  "/var/lib/docker-machine/certs/server-key.pem",
+	}
+	if authOptions.CaCertRemotePath != expected.CaCertRemotePath || authOptions.ServerCertRemotePath != expected.ServerCertRemotePath || authOptions.ServerKeyRemotePath != expected.ServerKeyRemotePath {
+		t.Fatalf("expected the certs in /var/lib/docker-machine/certs; received %+v", authOptions)
+	}
+}
+
+func TestRedirectReadOnlyRootNoWritableDir(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			rootMountCmd: "ro\n",
+		},
+	}
+
+	if _, err := redirectReadOnlyRoot(context.Background(), commander, etcDockerAuthOptions); err == nil {
+		t.Fatal("expected an error without a writable directory")
+	}
+}
+
+func TestMakeDockerOptionsDirReadOnlyRoot(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			rootMountCmd: "ro,relatime\n",
+		},
+	}
+
+	if err := makeDockerOptionsDir(context.Background(), newFakeDebianProvisioner(commander)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cmd := range commander.Commands {
+		if cmd == "sudo mkdir -p /etc/docker" {
+			t.Fatalf("expected the read-only options dir not to be created; received %v", commander.Commands)
+		}
+	}
+}
+
+const varConfigWritableCmd = "d=/var/lib/docker-machine; while [ ! -e \"$d\" ]; do d=$(dirname \"$d\"); done; sudo test -w \"$d\" && echo ok || true"
+
+func TestRedirectDaemonConfig(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			rootMountCmd:         "ro,relatime\n",
+			varConfigWritableCmd: "ok\n",
+		},
+	}
+	p := newFakeDebianProvisioner(commander)
+
+	engineOptions, err := redirectDaemonConfig(context.Background(), p, engine.Options{StorageDriver: "overlay2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if engineOptions.ConfigDir != "/var/lib/docker-machine" {
+		t.Fatalf("expected daemon.json in /var/lib/docker-machine; received %q", engineOptions.ConfigDir)
+	}
+	p.SetEngineOptions(engineOptions)
+
+	dkrcfg, err := p.GenerateDockerOptions(2376)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dkrcfg.EngineOptionsPath != "/run/systemd/system/docker.service" {
+		t.Fatalf("expected the unit in /run/systemd/system; received %s", dkrcfg.EngineOptionsPath)
+	}
+	if !strings.Contains(dkrcfg.EngineOptions, "--config-file=/var/lib/docker-machine/daemon.json") {
+		t.Fatalf("expected the daemon to be pointed at the moved daemon.json; received %s", dkrcfg.EngineOptions)
+	}
+
+	if dropIn := dockerDropInPath(p, restartDropInName); dropIn != "/run/systemd/system/docker.service.d/"+restartDropInName {
+		t.Fatalf("expected the drop-ins in /run/systemd/system; received %s", dropIn)
+	}
+}
+
+func TestRedirectDaemonConfigWritableEtc(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			rootMountCmd:         "ro,relatime\n",
+			etcDockerWritableCmd: "ok\n",
+		},
+	}
+
+	engineOptions, err := redirectDaemonConfig(context.Background(), newFakeDebianProvisioner(commander), engine.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if engineOptions.ConfigDir != "" {
+		t.Fatalf("expected daemon.json to stay in /etc/docker; received %q", engineOptions.ConfigDir)
+	}
+}
+
+func TestRedirectDaemonConfigOptionsFile(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			rootMountCmd:         "ro,relatime\n",
+			varConfigWritableCmd: "ok\n",
+		},
+	}
+	p := NewUbuntuProvisioner(&fakedriver.Driver{}).(*UbuntuProvisioner)
+	p.SSHCommander = commander
+
+	if _, err := redirectDaemonConfig(context.Background(), p, engine.Options{}); err == nil {
+		t.Fatal("expected an error when /etc/default can't be written to")
+	}
+}
+
+func TestRecordRedirectedPaths(t *testing.T) {
+	p := newFakeDebianProvisioner(&provisiontest.FakeSSHCommander{})
+	p.SetAuthOptions(auth.Options{
+		StorePath:            "/store",
+		CaCertRemotePath:     "/var/lib/docker-machine/certs/ca.pem",
+		ServerCertRemotePath: "/var/lib/docker-machine/certs/server.pem",
+		ServerKeyRemotePath:  "/var/lib/docker-machine/certs/server-key.pem",
+	})
+	p.SetEngineOptions(engine.Options{ConfigDir: "/var/lib/docker-machine", Labels: []string{"provider=fake"}})
+
+	authOptions := &auth.Options{StorePath: "/machines/test"}
+	engineOptions := &engine.Options{Labels: []string{"env=test"}}
+	RecordRedirectedPaths(p, authOptions, engineOptions)
+
+	if authOptions.StorePath != "/machines/test" || authOptions.ServerCertRemotePath != "/var/lib/docker-machine/certs/server.pem" || authOptions.CaCertRemotePath != "/var/lib/docker-machine/certs/ca.pem" || authOptions.ServerKeyRemotePath != "/var/lib/docker-machine/certs/server-key.pem" {
+		t.Fatalf("expected only the remote cert paths to be recorded; received %+v", authOptions)
+	}
+	if engineOptions.ConfigDir != "/var/lib/docker-machine" || len(engineOptions.Labels) != 1 {
+		t.Fatalf("expected only the config dir to be recorded; received %+v", engineOptions)
+	}
+}
@@ -10,10 +10,10 @@ import (
 	"github.com/docker/machine/libmachine/drivers"
 	"github.com/docker/machine/libmachine/engine"
 	"github.com/docker/machine/libmachine/log"
-	"github.com/docker/machine/libmachine/mcnutils"
 	"github.com/docker/machine/libmachine/provision/pkgaction"
 	"github.com/docker/machine/libmachine/provision/serviceaction"
 	"github.com/docker/machine/libmachine/swarm"
+	"golang.org/x/net/context"
 )
 
 var (
@@ -27,7 +27,7 @@ enabled=1
 gpgkey=https://yum.dockerproject.org/gpg
 `
 	engineConfigTemplate = `[Service]
-ExecStart=/usr/bin/docker -d -H tcp://0.0.0.0:{{.DockerPort}} -H unix:///var/run/docker.sock --storage-driver {{.EngineOptions.StorageDriver}} --tlsverify --tlscacert {{.AuthOptions.CaCertRemotePath}} --tlscert {{.AuthOptions.ServerCertRemotePath}} --tlskey {{.AuthOptions.ServerKeyRemotePath}} {{ range .EngineOptions.Labels }}--label {{.}} {{ end }}{{ range .EngineOptions.InsecureRegistry }}--insecure-registry {{.}} {{ end }}{{ range .EngineOptions.RegistryMirror }}--registry-mirror {{.}} {{ end }}{{ range .EngineOptions.ArbitraryFlags }}--{{.}} {{ end }}
+ExecStart=/usr/bin/docker -d {{ if not .EngineOptions.DisableTCP }}-H tcp://0.0.0.0:{{.DockerPort}} {{ end }}-H unix:///var/run/docker.sock --storage-driver {{.EngineOptions.StorageDriver}} {{ if not .EngineOptions.DisableTCP }}--tlsverify --tlscacert {{.AuthOptions.CaCertRemotePath}} --tlscert {{.AuthOptions.ServerCertRemotePath}} --tlskey {{.AuthOptions.ServerKeyRemotePath}} {{ end }}{{ range .EngineOptions.Labels }}--label {{.}} {{ end }}{{ range .EngineOptions.InsecureRegistry }}--insecure-registry {{.}} {{ end }}{{ range .EngineOptions.RegistryMirror }}--registry-mirror {{.}} {{ end }}{{ range .EngineFlags }}--{{.}} {{ end }}
 MountFlags=slave
 LimitNOFILE=1048576
 LimitNPROC=1048576
@@ -65,10 +65,10 @@ func (provisioner *RedHatProvisioner) String() string {
 	return "redhat"
 }
 
-func (provisioner *RedHatProvisioner) SetHostname(hostname string) error {
+func (provisioner *RedHatProvisioner) SetHostname(ctx context.Context, hostname string) error {
 	// we have to have SetHostname here as well to use the RedHat provisioner
 	// SSHCommand to add the tty allocation
-	if _, err := provisioner.SSHCommand(fmt.Sprintf(
+	if _, err := provisioner.SSHCommand(ctx, fmt.Sprintf(
 		"sudo hostname %s && echo %q | sudo tee /etc/hostname",
 		hostname,
 		hostname,
@@ -77,7 +77,7 @@ func (provisioner *RedHatProvisioner) SetHostname(hostname string) error {
 	}
 
 	// ubuntu/debian use 127.0.1.1 for non "localhost" loopback hostnames: https://www.debian.org/doc/manuals/debian-reference/ch05.en.html#_the_hostname_resolution
-	if _, err := provisioner.SSHCommand(fmt.Sprintf(
+	if _, err := provisioner.SSHCommand(ctx, fmt.Sprintf(
 		"if grep -xq 127.0.1.1.* /etc/hosts; then sudo sed -i 's/^127.0.1.1.*/127.0.1.1 %s/g' /etc/hosts; else echo '127.0.1.1 %s' | sudo tee -a /etc/hosts; fi",
 		hostname,
 		hostname,
@@ -88,13 +88,13 @@ func (provisioner *RedHatProvisioner) SetHostname(hostname string) error {
 	return nil
 }
 
-func (provisioner *RedHatProvisioner) Package(name string, action pkgaction.PackageAction) error {
+func (provisioner *RedHatProvisioner) Package(ctx context.Context, name string, action pkgaction.PackageAction) error {
 	var packageAction string
 
 	switch action {
 	case pkgaction.Install:
 		packageAction = "install"
-	case pkgaction.Remove:
+	case pkgaction.Remove, pkgaction.Purge:
 		packageAction = "remove"
 	case pkgaction.Upgrade:
 		packageAction = "upgrade"
@@ -102,47 +102,47 @@ func (provisioner *RedHatProvisioner) Package(name string, action pkgaction.Pack
 
 	command := fmt.Sprintf("sudo -E yum %s -y %s", packageAction, name)
 
-	if _, err := provisioner.SSHCommand(command); err != nil {
+	if _, err := provisioner.SSHCommand(ctx, command); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func installDocker(provisioner *RedHatProvisioner) error {
-	if err := provisioner.installOfficialDocker(); err != nil {
+func installDocker(ctx context.Context, provisioner *RedHatProvisioner) error {
+	if err := provisioner.installOfficialDocker(ctx); err != nil {
 		return err
 	}
 
-	if err := provisioner.Service("docker", serviceaction.Restart); err != nil {
+	if err := provisioner.Service(ctx, "docker", serviceaction.Restart); err != nil {
 		return err
 	}
 
-	if err := provisioner.Service("docker", serviceaction.Enable); err != nil {
+	if err := provisioner.Service(ctx, "docker", serviceaction.Enable); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (provisioner *RedHatProvisioner) installOfficialDocker() error {
+func (provisioner *RedHatProvisioner) installOfficialDocker(ctx context.Context) error {
 	log.Debug("installing docker")
 
-	if err := provisioner.ConfigurePackageList(); err != nil {
+	if err := provisioner.ConfigurePackageList(ctx); err != nil {
 		return err
 	}
 
-	if _, err := provisioner.SSHCommand("sudo yum install -y docker-engine"); err != nil {
+	if _, err := provisioner.SSHCommand(ctx, "sudo yum install -y docker-engine"); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (provisioner *RedHatProvisioner) dockerDaemonResponding() bool {
+func (provisioner *RedHatProvisioner) dockerDaemonResponding(ctx context.Context) bool {
 	log.Debug("checking docker daemon")
 
-	if out, err := provisioner.SSHCommand("sudo docker version"); err != nil {
+	if out, err := provisioner.SSHCommand(ctx, "sudo docker version"); err != nil {
 		log.Warnf("Error getting SSH command to check if the daemon is up: %s", err)
 		log.Debugf("'sudo docker version' output:\n%s", out)
 		return false
@@ -152,7 +152,14 @@ func (provisioner *RedHatProvisioner) dockerDaemonResponding() bool {
 	return true
 }
 
-func (provisioner *RedHatProvisioner) Provision(swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error {
+func (provisioner *RedHatProvisioner) Provision(ctx context.Context, swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error {
+	ctx, cancel := provisionContext(ctx, engineOptions)
+	defer cancel()
+
+	if err := ValidateOptions(provisioner, swarmOptions, authOptions, engineOptions); err != nil {
+		return err
+	}
+
 	provisioner.SwarmOptions = swarmOptions
 	provisioner.AuthOptions = authOptions
 	provisioner.EngineOptions = engineOptions
@@ -163,38 +170,50 @@ func (provisioner *RedHatProvisioner) Provision(swarmOptions swarm.Options, auth
 		provisioner.EngineOptions.StorageDriver = "devicemapper"
 	}
 
-	if err := provisioner.SetHostname(provisioner.Driver.GetMachineName()); err != nil {
+	log.Debug("checking for passwordless sudo")
+	if err := checkSudo(ctx, provisioner); err != nil {
+		return err
+	}
+
+	if !provisioner.EngineOptions.SkipCloudInitWait {
+		log.Debug("waiting for cloud-init")
+		if err := waitForCloudInit(ctx, provisioner, cloudInitTimeout(provisioner.EngineOptions.CloudInitTimeout)); err != nil {
+			return err
+		}
+	}
+
+	if err := provisioner.SetHostname(ctx, provisioner.Driver.GetMachineName()); err != nil {
 		return err
 	}
 
 	for _, pkg := range provisioner.Packages {
 		log.Debugf("installing base package: name=%s", pkg)
-		if err := provisioner.Package(pkg, pkgaction.Install); err != nil {
+		if err := provisioner.Package(ctx, pkg, pkgaction.Install); err != nil {
 			return err
 		}
 	}
 
 	// update OS -- this is needed for libdevicemapper and the docker install
-	if _, err := provisioner.SSHCommand("sudo yum -y update"); err != nil {
+	if _, err := provisioner.SSHCommand(ctx, "sudo yum -y update"); err != nil {
 		return err
 	}
 
 	// install docker
-	if err := installDocker(provisioner); err != nil {
+	if err := installDocker(ctx, provisioner); err != nil {
 		return err
 	}
 
-	if err := mcnutils.WaitFor(provisioner.dockerDaemonResponding); err != nil {
+	if err := waitFor(ctx, provisioner.dockerDaemonResponding); err != nil {
 		return err
 	}
 
-	if err := makeDockerOptionsDir(provisioner); err != nil {
+	if err := makeDockerOptionsDir(ctx, provisioner); err != nil {
 		return err
 	}
 
 	provisioner.AuthOptions = setRemoteAuthOptions(provisioner)
 
-	if err := ConfigureAuth(provisioner); err != nil {
+	if err := ConfigureAuth(ctx, provisioner); err != nil {
 		return err
 	}
 
@@ -208,12 +227,17 @@ func (provisioner *RedHatProvisioner) Provision(swarmOptions swarm.Options, auth
 func (provisioner *RedHatProvisioner) GenerateDockerOptions(dockerPort int) (*DockerOptions, error) {
 	var (
 		engineCfg  bytes.Buffer
-		configPath = provisioner.DaemonOptionsFile
+		configPath = provisioner.daemonOptionsFile()
 	)
 
 	driverNameLabel := fmt.Sprintf("provider=%s", provisioner.Driver.DriverName())
 	provisioner.EngineOptions.Labels = append(provisioner.EngineOptions.Labels, driverNameLabel)
 
+	flags, err := engineFlags(provisioner.EngineOptions)
+	if err != nil {
+		return nil, err
+	}
+
 	// systemd / redhat will not load options if they are on newlines
 	// instead, it just continues with a different set of options; yeah...
 	t, err := template.New("engineConfig").Parse(engineConfigTemplate)
@@ -226,6 +250,7 @@ func (provisioner *RedHatProvisioner) GenerateDockerOptions(dockerPort int) (*Do
 		AuthOptions:      provisioner.AuthOptions,
 		EngineOptions:    provisioner.EngineOptions,
 		DockerOptionsDir: provisioner.DockerOptionsDir,
+		EngineFlags:      flags,
 	}
 
 	t.Execute(&engineCfg, engineConfigContext)
@@ -271,7 +296,7 @@ func generateYumRepoList(provisioner Provisioner) (*bytes.Buffer, error) {
 	return &buf, nil
 }
 
-func (provisioner *RedHatProvisioner) ConfigurePackageList() error {
+func (provisioner *RedHatProvisioner) ConfigurePackageList(ctx context.Context) error {
 	buf, err := generateYumRepoList(provisioner)
 	if err != nil {
 		return err
@@ -280,7 +305,7 @@ func (provisioner *RedHatProvisioner) ConfigurePackageList() error {
 	// we cannot use %q here as it combines the newlines in the formatting
 	// on transport causing yum to not use the repo
 	packageCmd := fmt.Sprintf("echo \"%s\" | sudo tee /etc/yum.repos.d/docker.repo", buf.String())
-	if _, err := provisioner.SSHCommand(packageCmd); err != nil {
+	if _, err := provisioner.SSHCommand(ctx, packageCmd); err != nil {
 		return err
 	}
 
@@ -3,13 +3,14 @@ package provision
 import (
 	"github.com/docker/machine/libmachine/drivers"
 	"github.com/docker/machine/libmachine/ssh"
+	"golang.org/x/net/context"
 )
 
 type RedHatSSHCommander struct {
 	Driver drivers.Driver
 }
 
-func (sshCmder RedHatSSHCommander) SSHCommand(args string) (string, error) {
+func (sshCmder RedHatSSHCommander) SSHCommand(ctx context.Context, args string) (string, error) {
 	client, err := drivers.GetSSHClientFromDriver(sshCmder.Driver)
 	if err != nil {
 		return "", err
@@ -24,8 +25,8 @@ func (sshCmder RedHatSSHCommander) SSHCommand(args string) (string, error) {
 		c.BaseArgs = append(c.BaseArgs, "-tt")
 		client = c
 	case ssh.NativeClient:
-		return c.OutputWithPty(args)
+		return c.OutputWithPtyContext(ctx, args)
 	}
 
-	return client.Output(args)
+	return client.OutputContext(ctx, args)
 }
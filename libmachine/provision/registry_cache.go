@@ -0,0 +1,195 @@
+package provision
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	registryCacheName  = "registry-cache"
+	registryCacheImage = "registry:2"
+	registryCachePort  = 5000
+	dockerHubRegistry  = "https://registry-1.docker.io"
+)
+
+// ErrNoRegistryCacheStore is returned when a registry cache is asked for
+// but no store was set with SetSharedStores.
+var ErrNoRegistryCacheStore = errors.New("The registry cache needs a store shared by the machines, set with SetSharedStores")
+
+// RegistryCache is the registry cache run by one of the machines.
+type RegistryCache struct {
+	MachineName string
+	URL         string
+}
+
+// RegistryCacheStore is shared by the machines provisioned with the
+// RegistryCache engine option. The first one to be elected runs the cache
+// and the others use it as their registry mirror.
+type RegistryCacheStore interface {
+	// Elect records cache unless another one is recorded already and
+	// returns the recorded cache. It must be atomic.
+	Elect(cache RegistryCache) (RegistryCache, error)
+	// Release forgets the recorded cache when the named machine runs it,
+	// so the next machine provisioned is elected instead.
+	Release(machineName string) error
+}
+
+// MemoryRegistryCacheStore is a RegistryCacheStore for machines provisioned
+// from the same process.
+type MemoryRegistryCacheStore struct {
+	mu    sync.Mutex
+	cache RegistryCache
+}
+
+func NewMemoryRegistryCacheStore() *MemoryRegistryCacheStore {
+	return &MemoryRegistryCacheStore{}
+}
+
+func (s *MemoryRegistryCacheStore) Elect(cache RegistryCache) (RegistryCache, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cache.URL == "" {
+		s.cache = cache
+	}
+
+	return s.cache, nil
+}
+
+func (s *MemoryRegistryCacheStore) Release(machineName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cache.MachineName == machineName {
+		s.cache = RegistryCache{}
+	}
+
+	return nil
+}
+
+// FileRegistryCacheStore is a RegistryCacheStore kept in a file, like one
+// in the machine store, for machines provisioned from separate processes.
+type FileRegistryCacheStore struct {
+	path string
+}
+
+func NewFileRegistryCacheStore(path string) *FileRegistryCacheStore {
+	return &FileRegistryCacheStore{path: path}
+}
+
+func (s *FileRegistryCacheStore) Elect(cache RegistryCache) (RegistryCache, error) {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return RegistryCache{}, err
+	}
+
+	elected, err := electFile(s.path, data)
+	if err != nil {
+		return RegistryCache{}, err
+	}
+
+	return unmarshalRegistryCache(s.path, elected)
+}
+
+// Release removes the file when the named machine runs the cache. Elect
+// never replaces the file, so it can't change between the read and the
+// removal.
+func (s *FileRegistryCacheStore) Release(machineName string) error {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	cache, err := unmarshalRegistryCache(s.path, data)
+	if err != nil {
+		return err
+	}
+	if cache.MachineName != machineName {
+		return nil
+	}
+
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func unmarshalRegistryCache(path string, data []byte) (RegistryCache, error) {
+	cache := RegistryCache{}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return RegistryCache{}, fmt.Errorf("Invalid registry cache in %s: %s", path, err)
+	}
+
+	return cache, nil
+}
+
+// electRegistryCache tells whether the node was elected to run the
+// registry cache. Otherwise the elected cache is added to the registry
+// mirrors of the node, and as the cache is served over plain HTTP to its
+// insecure registries, which must happen before the daemon configuration
+// is written.
+func electRegistryCache(p Provisioner, store RegistryCacheStore) (bool, error) {
+	if store == nil {
+		return false, ErrNoRegistryCacheStore
+	}
+
+	ip, err := p.GetDriver().GetIP()
+	if err != nil {
+		return false, err
+	}
+
+	own := RegistryCache{
+		MachineName: p.GetDriver().GetMachineName(),
+		URL:         fmt.Sprintf("http://%s:%d", ip, registryCachePort),
+	}
+	elected, err := store.Elect(own)
+	if err != nil {
+		return false, err
+	}
+	if elected == own {
+		return true, nil
+	}
+
+	u, err := url.Parse(elected.URL)
+	if err != nil || u.Host == "" {
+		return false, fmt.Errorf("Invalid registry cache %q in the store", elected.URL)
+	}
+
+	engineOptions := p.GetEngineOptions()
+	engineOptions.RegistryMirror = appendMissing(engineOptions.RegistryMirror, elected.URL)
+	engineOptions.InsecureRegistry = appendMissing(engineOptions.InsecureRegistry, u.Host)
+	p.SetEngineOptions(engineOptions)
+
+	return false, nil
+}
+
+func appendMissing(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+
+	return append(values, value)
+}
+
+// runRegistryCache starts the pull-through cache of Docker Hub on the
+// node, unless it is there already.
+func runRegistryCache(ctx context.Context, p SSHCommander) error {
+	command := fmt.Sprintf("sudo docker inspect %s >/dev/null 2>&1 || sudo docker run -d --restart=always --name %s -p %d:5000 -e REGISTRY_PROXY_REMOTEURL=%s %s",
+		registryCacheName, registryCacheName, registryCachePort, dockerHubRegistry, registryCacheImage)
+
+	_, err := p.SSHCommand(withCommandTimeout(ctx, installCommandTimeout), command)
+	return err
+}
@@ -0,0 +1,141 @@
+package provision
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"github.com/docker/machine/libmachine/state"
+	"golang.org/x/net/context"
+)
+
+func newFakeRegistryCacheNode(name, ip string) *DebianProvisioner {
+	p := NewDebianProvisioner(&fakedriver.Driver{
+		MockState: state.Running,
+		MockIP:    ip,
+		MockName:  name,
+	}).(*DebianProvisioner)
+	p.SSHCommander = &provisiontest.FakeSSHCommander{}
+	p.EngineOptions.RegistryCache = true
+	return p
+}
+
+func TestElectRegistryCache(t *testing.T) {
+	store := NewMemoryRegistryCacheStore()
+
+	first := newFakeRegistryCacheNode("node1", "10.0.0.1")
+	elected, err := electRegistryCache(first, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !elected {
+		t.Fatal("expected the first node to run the registry cache")
+	}
+	if len(first.EngineOptions.RegistryMirror) != 0 {
+		t.Fatalf("expected no mirror on the cache node; received %v", first.EngineOptions.RegistryMirror)
+	}
+
+	second := newFakeRegistryCacheNode("node2", "10.0.0.2")
+	second.EngineOptions.RegistryMirror = []string{"https://mirror.local"}
+
+	for i := 0; i < 2; i++ {
+		elected, err = electRegistryCache(second, store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if elected {
+			t.Fatal("expected the second node to use the registry cache")
+		}
+	}
+
+	expected := []string{"https://mirror.local", "http://10.0.0.1:5000"}
+	if !reflect.DeepEqual(second.EngineOptions.RegistryMirror, expected) {
+		t.Fatalf("expected mirrors %v; received %v", expected, second.EngineOptions.RegistryMirror)
+	}
+
+	expected = []string{"10.0.0.1:5000"}
+	if !reflect.DeepEqual(second.EngineOptions.InsecureRegistry, expected) {
+		t.Fatalf("expected insecure registries %v; received %v", expected, second.EngineOptions.InsecureRegistry)
+	}
+}
+
+func TestElectRegistryCacheReleased(t *testing.T) {
+	store := NewMemoryRegistryCacheStore()
+
+	if _, err := electRegistryCache(newFakeRegistryCacheNode("node1", "10.0.0.1"), store); err != nil {
+		t.Fatal(err)
+	}
+
+	// releasing another machine keeps the election
+	if err := store.Release("node2"); err != nil {
+		t.Fatal(err)
+	}
+	if elected, err := electRegistryCache(newFakeRegistryCacheNode("node2", "10.0.0.2"), store); err != nil || elected {
+		t.Fatalf("expected the first node to stay elected; received %t, %v", elected, err)
+	}
+
+	if err := store.Release("node1"); err != nil {
+		t.Fatal(err)
+	}
+	if elected, err := electRegistryCache(newFakeRegistryCacheNode("node2", "10.0.0.2"), store); err != nil || !elected {
+		t.Fatalf("expected the second node to be elected once the first is removed; received %t, %v", elected, err)
+	}
+}
+
+func TestElectRegistryCacheNoStore(t *testing.T) {
+	if _, err := electRegistryCache(newFakeRegistryCacheNode("node1", "10.0.0.1"), nil); err != ErrNoRegistryCacheStore {
+		t.Fatalf("expected %s; received %v", ErrNoRegistryCacheStore, err)
+	}
+}
+
+func TestRunRegistryCache(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := runRegistryCache(context.Background(), commander); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo docker inspect registry-cache >/dev/null 2>&1 || sudo docker run -d --restart=always --name registry-cache -p 5000:5000 -e REGISTRY_PROXY_REMOTEURL=https://registry-1.docker.io registry:2",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestFileRegistryCacheStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "registry-cache")
+	first := RegistryCache{MachineName: "node1", URL: "http://10.0.0.1:5000"}
+	second := RegistryCache{MachineName: "node2", URL: "http://10.0.0.2:5000"}
+
+	if elected, err := NewFileRegistryCacheStore(path).Elect(first); err != nil || elected != first {
+		t.Fatalf("expected the first cache to be elected; received %v, %v", elected, err)
+	}
+	if elected, err := NewFileRegistryCacheStore(path).Elect(second); err != nil || elected != first {
+		t.Fatalf("expected the first cache to stay elected; received %v, %v", elected, err)
+	}
+
+	if err := NewFileRegistryCacheStore(path).Release("node2"); err != nil {
+		t.Fatal(err)
+	}
+	if elected, err := NewFileRegistryCacheStore(path).Elect(second); err != nil || elected != first {
+		t.Fatalf("expected the first cache to stay elected; received %v, %v", elected, err)
+	}
+
+	if err := NewFileRegistryCacheStore(path).Release("node1"); err != nil {
+		t.Fatal(err)
+	}
+	if elected, err := NewFileRegistryCacheStore(path).Elect(second); err != nil || elected != second {
+		t.Fatalf("expected the second cache to be elected once the first is released; received %v, %v", elected, err)
+	}
+}
@@ -0,0 +1,116 @@
+package provision
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	registryCertsDir = "/etc/docker/certs.d"
+	systemCACertsDir = "/usr/local/share/ca-certificates"
+)
+
+var reRegistryHost = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9.-]*[a-zA-Z0-9])?(:[0-9]+)?$`)
+
+// readCACert reads a PEM encoded certificate from a local file, making
+// sure it parses before it ends up on the host.
+func readCACert(certPath string) ([]byte, error) {
+	data, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("No PEM encoded certificate in %s", certPath)
+	}
+
+	if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+		return nil, fmt.Errorf("Unable to parse the certificate in %s: %s", certPath, err)
+	}
+
+	return data, nil
+}
+
+// installRegistryCACerts installs the CA of each private registry where
+// the daemon looks for it when talking to that registry. The daemon reads
+// them on every pull, no restart is needed.
+func installRegistryCACerts(ctx context.Context, p SSHCommander, certs map[string]string) error {
+	registries := []string{}
+	for registry := range certs {
+		registries = append(registries, registry)
+	}
+	sort.Strings(registries)
+
+	// every cert is checked before the first one is installed
+	contents := map[string][]byte{}
+	for _, registry := range registries {
+		if !reRegistryHost.MatchString(registry) {
+			return fmt.Errorf("Invalid registry %q, expected a host with an optional port", registry)
+		}
+
+		cert, err := readCACert(certs[registry])
+		if err != nil {
+			return err
+		}
+		contents[registry] = cert
+	}
+
+	for _, registry := range registries {
+		dir := path.Join(registryCertsDir, registry)
+		commands := []string{
+			fmt.Sprintf("sudo mkdir -p %s", dir),
+			fmt.Sprintf("printf '%%s' '%s' | sudo tee %s", contents[registry], path.Join(dir, "ca.crt")),
+		}
+
+		for _, cmd := range commands {
+			if _, err := p.SSHCommand(ctx, cmd); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// systemCACertPath is where the i-th system CA certificate goes,
+// update-ca-certificates only picks up .crt files.
+func systemCACertPath(i int) string {
+	return path.Join(systemCACertsDir, fmt.Sprintf("docker-machine-%d.crt", i))
+}
+
+// installSystemCACerts adds the certificates to the host trust store. The
+// daemon reads the trust store when it starts, the restart of ConfigureAuth
+// picks them up.
+func installSystemCACerts(ctx context.Context, p SSHCommander, certPaths []string) error {
+	// every cert is checked before the first one is installed
+	contents := [][]byte{}
+	for _, certPath := range certPaths {
+		cert, err := readCACert(certPath)
+		if err != nil {
+			return err
+		}
+		contents = append(contents, cert)
+	}
+
+	commands := []string{fmt.Sprintf("sudo mkdir -p %s", systemCACertsDir)}
+	for i, cert := range contents {
+		commands = append(commands, fmt.Sprintf("printf '%%s' '%s' | sudo tee %s", cert, systemCACertPath(i)))
+	}
+	commands = append(commands, "sudo update-ca-certificates")
+
+	for _, cmd := range commands {
+		if _, err := p.SSHCommand(ctx, cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package provision
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/libmachine/cert"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func TestInstallRegistryCACerts(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	caPath := filepath.Join(tmpDir, "ca.pem")
+	if err := cert.GenerateCACertificate(caPath, filepath.Join(tmpDir, "ca-key.pem"), "test-org", 2048); err != nil {
+		t.Fatal(err)
+	}
+	ca, err := ioutil.ReadFile(caPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commander := &provisiontest.FakeSSHCommander{}
+	certs := map[string]string{
+		"registry.local:5000": caPath,
+		"hub.corp":            caPath,
+	}
+
+	if err := installRegistryCACerts(context.Background(), commander, certs); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo mkdir -p /etc/docker/certs.d/hub.corp",
+		"printf '%s' '" + string(ca) + "' | sudo tee /etc/docker/certs.d/hub.corp/ca.crt",
+		"sudo mkdir -p /etc/docker/certs.d/registry.local:5000",
+		"printf '%s' '" + string(ca) + "' | sudo tee /etc/docker/certs.d/registry.local:5000/ca.crt",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestInstallRegistryCACertsInvalid(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	garbage := filepath.Join(tmpDir, "garbage.pem")
+	if err := ioutil.WriteFile(garbage, []byte("-----BEGIN CERTIFICATE-----\nbm90IGEgY2VydA==\n-----END CERTIFICATE-----\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, certs := range []map[string]string{
+		{"registry.local": garbage},
+		{"registry.local": filepath.Join(tmpDir, "missing.pem")},
+		{"../etc": garbage},
+	} {
+		commander := &provisiontest.FakeSSHCommander{}
+
+		if err := installRegistryCACerts(context.Background(), commander, certs); err == nil {
+			t.Fatalf("expected an error for %v", certs)
+		}
+		if len(commander.Commands) != 0 {
+			t.Fatalf("expected no commands for %v; received %v", certs, commander.Commands)
+		}
+	}
+}
+
+func TestInstallSystemCACerts(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	caPath := filepath.Join(tmpDir, "proxy-ca.pem")
+	if err := cert.GenerateCACertificate(caPath, filepath.Join(tmpDir, "proxy-ca-key.pem"), "test-org", 2048); err != nil {
+		t.Fatal(err)
+	}
+	ca, err := ioutil.ReadFile(caPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := installSystemCACerts(context.Background(), commander, []string{caPath, caPath}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo mkdir -p /usr/local/share/ca-certificates",
+		"printf '%s' '" + string(ca) + "' | sudo tee /usr/local/share/ca-certificates/docker-machine-0.crt",
+		"printf '%s' '" + string(ca) + "' | sudo tee /usr/local/share/ca-certificates/docker-machine-1.crt",
+		"sudo update-ca-certificates",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestInstallSystemCACertsMissing(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := installSystemCACerts(context.Background(), commander, []string{"/nonexistent/proxy-ca.pem"}); err == nil {
+		t.Fatal("expected an error for a missing certificate")
+	}
+
+	if len(commander.Commands) != 0 {
+		t.Fatalf("expected no commands; received %v", commander.Commands)
+	}
+}
@@ -0,0 +1,73 @@
+package provision
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"golang.org/x/net/context"
+)
+
+// hosts of Docker Hub, which the daemon falls back to on its own
+var dockerHubHosts = map[string]bool{
+	"registry-1.docker.io": true,
+	"index.docker.io":      true,
+	"docker.io":            true,
+}
+
+// validateRegistryMirrors checks the mirrors are URLs the daemon accepts.
+// The daemon tries them in order and always falls back to Docker Hub, there
+// is no setting to turn that off, so listing Docker Hub or the same mirror
+// twice only delays the pulls.
+func validateRegistryMirrors(mirrors []string) error {
+	seen := map[string]bool{}
+
+	for _, mirror := range mirrors {
+		u, err := url.Parse(mirror)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+			return fmt.Errorf("Invalid registry mirror %q, expected a URL like https://mirror.example.com:5000", mirror)
+		}
+
+		if dockerHubHosts[u.Hostname()] {
+			return fmt.Errorf("Invalid registry mirror %q, the daemon falls back to Docker Hub after the mirrors anyway", mirror)
+		}
+
+		key := u.Scheme + "://" + u.Host
+		if seen[key] {
+			return fmt.Errorf("Invalid registry mirror %q, it is listed more than once", mirror)
+		}
+		seen[key] = true
+	}
+
+	return nil
+}
+
+// mirrorReachable asks the host, which is the one pulling through the
+// mirror, whether the mirror answers on its registry API. A 401 still
+// means it is up, it just wants credentials.
+func mirrorReachable(ctx context.Context, p SSHCommander, mirror string) bool {
+	out, err := p.SSHCommand(ctx, fmt.Sprintf("curl -s -o /dev/null -w '%%{http_code}' --max-time 5 %s/v2/", strings.TrimSuffix(mirror, "/")))
+	if err != nil {
+		return false
+	}
+
+	code := strings.TrimSpace(out)
+	return code == "200" || code == "401"
+}
+
+// reachableMirrors drops the registry mirrors the host can't reach, since
+// the daemon tries a dead mirror first on every pull.
+func reachableMirrors(ctx context.Context, p SSHCommander, mirrors []string) []string {
+	reachable := []string{}
+
+	for _, mirror := range mirrors {
+		if !mirrorReachable(ctx, p, mirror) {
+			log.Warnf("The registry mirror %s is unreachable from the host, leaving it out of the daemon configuration.", mirror)
+			continue
+		}
+		reachable = append(reachable, mirror)
+	}
+
+	return reachable
+}
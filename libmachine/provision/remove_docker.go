@@ -0,0 +1,173 @@
+package provision
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/provision/pkgaction"
+	"github.com/docker/machine/libmachine/provision/serviceaction"
+	"golang.org/x/net/context"
+)
+
+// dockerAptSourcePath is the apt source added by the docker install script.
+const dockerAptSourcePath = "/etc/apt/sources.list.d/docker.list"
+
+// the packages the docker install script installs, and the docker-engine
+// package of older hosts
+var scriptDockerPackages = []string{
+	"docker-ce",
+	"docker-ce-cli",
+	"containerd.io",
+	"docker-buildx-plugin",
+	"docker-compose-plugin",
+	"docker-ce-rootless-extras",
+	"docker-engine",
+}
+
+// installedDockerPackages returns the packages of the install strategy
+// which are installed on the host, with dpkg or rpm.
+func installedDockerPackages(ctx context.Context, p SSHCommander, strategy string) ([]string, error) {
+	packages := scriptDockerPackages
+	if strategy == InstallStrategyDockerOfficial {
+		packages = dockerOfficialPackages
+	}
+
+	out, err := p.SSHCommand(ctx, fmt.Sprintf("for pkg in %s; do if dpkg-query -W $pkg >/dev/null 2>&1 || rpm -q --quiet $pkg >/dev/null 2>&1; then echo $pkg; fi; done", strings.Join(packages, " ")))
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Fields(out), nil
+}
+
+// RemoveDocker stops the daemon, purges the packages its install strategy
+// installed and deletes the daemon configuration, units and server certs
+// put in place by Provision. Running it on a host without docker only
+// removes the leftover files.
+func RemoveDocker(ctx context.Context, p Provisioner, authOptions auth.Options, engineOptions engine.Options) error {
+	p.SetEngineOptions(engineOptions)
+	p.SetAuthOptions(authOptions)
+	authOptions = setRemoteAuthOptions(p)
+
+	dockerPort, err := getDockerPort(p.GetDriver())
+	if err != nil {
+		return err
+	}
+
+	dkrcfg, err := p.GenerateDockerOptions(dockerPort)
+	if err != nil {
+		return err
+	}
+
+	out, err := p.SSHCommand(ctx, "command -v docker || true")
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(out) != "" {
+		log.Info("Stopping docker...")
+		if err := p.Service(ctx, "docker", serviceaction.Stop); err != nil {
+			return err
+		}
+
+		log.Info("Removing docker...")
+		packages, err := installedDockerPackages(ctx, p, engineOptions.InstallStrategy)
+		if err != nil {
+			return err
+		}
+
+		// hosts without dpkg or rpm name the package their own way
+		if len(packages) == 0 {
+			packages = []string{"docker"}
+		}
+
+		for _, name := range packages {
+			if err := p.Package(ctx, name, pkgaction.Purge); err != nil {
+				return err
+			}
+		}
+	} else {
+		log.Info("Docker is not installed, only removing its configuration...")
+	}
+
+	files := []string{
+		dkrcfg.EngineOptionsPath,
+		daemonConfigFile(engineOptions),
+		authOptions.CaCertRemotePath,
+		authOptions.ServerCertRemotePath,
+		authOptions.ServerKeyRemotePath,
+		dockerAptSourcePath,
+		dockerOfficialKeyPath,
+		ipForwardConfPath,
+		// written by UpdateProxy after provisioning, so it may be there either way
+		dockerDropInPath(p, proxyDropInName),
+	}
+
+	if len(engineOptions.BuildDNS) != 0 {
+		files = append(files, buildkitdConfigPath)
+	}
+
+	if engineOptions.AptProxy != "" {
+		files = append(files, aptProxyConfPath)
+	}
+
+	if engineOptions.AptParallelDownloads != 0 {
+		files = append(files, aptDownloadsConfPath)
+	}
+
+	if engineOptions.InstallComposePlugin {
+		files = append(files, composePluginDir+"/docker-compose")
+	}
+
+	if len(engineOptions.SocketAliases) != 0 {
+		files = append(files, socketAliasesTmpfiles)
+		files = append(files, engineOptions.SocketAliases...)
+	}
+
+	if len(engineOptions.Sysctls) != 0 {
+		files = append(files, sysctlConfPath)
+	}
+
+	if engineOptions.RestartPolicy != "" {
+		files = append(files, dockerDropInPath(p, restartDropInName))
+	}
+
+	if engineOptions.VsockAddress != "" {
+		if _, err := p.SSHCommand(ctx, fmt.Sprintf("if systemctl cat %s.service >/dev/null 2>&1; then sudo systemctl disable --now %s.service; fi", vsockServiceName, vsockServiceName)); err != nil {
+			return err
+		}
+		files = append(files, vsockUnitPath)
+	}
+
+	if engineOptions.OOMScoreAdjust != 0 {
+		files = append(files, dockerDropInPath(p, oomDropInName))
+	}
+
+	if hasServiceLimits(engineOptions.ServiceLimits) {
+		files = append(files, dockerDropInPath(p, serviceLimitsDropInName))
+	}
+
+	if engineOptions.Slice != "" {
+		files = append(files, sliceDropInPaths(p)...)
+	}
+
+	if hasResourceSlice(engineOptions.ResourceSlice) {
+		files = append(files, dockerSlicePath)
+	}
+
+	if _, err := p.SSHCommand(ctx, fmt.Sprintf("sudo rm -f %s", strings.Join(files, " "))); err != nil {
+		return err
+	}
+
+	// systemd keeps the removed units and drop-ins loaded until a reload
+	if p.Capabilities().Systemd {
+		if _, err := p.SSHCommand(ctx, "sudo systemctl daemon-reload"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"github.com/docker/machine/libmachine/state"
+	"golang.org/x/net/context"
+)
+
+func newRemoveDockerProvisioner(commander SSHCommander) *DebianProvisioner {
+	p := NewDebianProvisioner(&fakedriver.Driver{
+		MockState: state.Running,
+		MockIP:    "1.2.3.4",
+	}).(*DebianProvisioner)
+	p.SSHCommander = commander
+	return p
+}
+
+const removeDockerFilesCmd = "sudo rm -f /etc/systemd/system/docker.service /etc/docker/daemon.json /etc/docker/ca.pem /etc/docker/server.pem /etc/docker/server-key.pem /etc/apt/sources.list.d/docker.list /etc/apt/keyrings/docker.asc /etc/sysctl.d/98-docker-machine-ip-forward.conf /etc/systemd/system/docker.service.d/http-proxy.conf"
+
+const installedScriptPackagesCmd = "for pkg in docker-ce docker-ce-cli containerd.io docker-buildx-plugin docker-compose-plugin docker-ce-rootless-extras docker-engine; do if dpkg-query -W $pkg >/dev/null 2>&1 || rpm -q --quiet $pkg >/dev/null 2>&1; then echo $pkg; fi; done"
+
+func TestRemoveDocker(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"command -v docker || true": "/usr/bin/docker\n",
+			installedScriptPackagesCmd:  "docker-ce\ndocker-ce-cli\ncontainerd.io\n",
+		},
+	}
+
+	if err := RemoveDocker(context.Background(), newRemoveDockerProvisioner(commander), auth.Options{}, engine.Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"command -v docker || true",
+		"sudo systemctl -f stop docker",
+		installedScriptPackagesCmd,
+		"DEBIAN_FRONTEND=noninteractive sudo -E apt-get purge -y -o DPkg::Lock::Timeout=120 docker-ce",
+		"DEBIAN_FRONTEND=noninteractive sudo -E apt-get purge -y -o DPkg::Lock::Timeout=120 docker-ce-cli",
+		"DEBIAN_FRONTEND=noninteractive sudo -E apt-get purge -y -o DPkg::Lock::Timeout=120 containerd.io",
+		removeDockerFilesCmd,
+		"sudo systemctl daemon-reload",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestRemoveDockerNotInstalled(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := RemoveDocker(context.Background(), newRemoveDockerProvisioner(commander), auth.Options{}, engine.Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"command -v docker || true",
+		removeDockerFilesCmd,
+		"sudo systemctl daemon-reload",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestRemoveDockerOfficial(t *testing.T) {
+	installedCmd := "for pkg in docker-ce docker-ce-cli containerd.io; do if dpkg-query -W $pkg >/dev/null 2>&1 || rpm -q --quiet $pkg >/dev/null 2>&1; then echo $pkg; fi; done"
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"command -v docker || true": "/usr/bin/docker\n",
+			installedCmd:                "docker-ce\ndocker-ce-cli\ncontainerd.io\n",
+		},
+	}
+	p := newRemoveDockerProvisioner(commander)
+
+	engineOptions := engine.Options{
+		InstallStrategy: InstallStrategyDockerOfficial,
+		VsockAddress:    "vsock://any:2376",
+		RestartPolicy:   "on-failure",
+	}
+	if err := RemoveDocker(context.Background(), p, auth.Options{}, engineOptions); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"command -v docker || true",
+		"sudo systemctl -f stop docker",
+		installedCmd,
+		"DEBIAN_FRONTEND=noninteractive sudo -E apt-get purge -y -o DPkg::Lock::Timeout=120 docker-ce",
+		"DEBIAN_FRONTEND=noninteractive sudo -E apt-get purge -y -o DPkg::Lock::Timeout=120 docker-ce-cli",
+		"DEBIAN_FRONTEND=noninteractive sudo -E apt-get purge -y -o DPkg::Lock::Timeout=120 containerd.io",
+		"if systemctl cat docker-vsock.service >/dev/null 2>&1; then sudo systemctl disable --now docker-vsock.service; fi",
+		removeDockerFilesCmd + " /etc/systemd/system/docker.service.d/restart.conf /etc/systemd/system/docker-vsock.service",
+		"sudo systemctl daemon-reload",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
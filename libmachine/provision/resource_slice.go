@@ -0,0 +1,128 @@
+package provision
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+
+	"github.com/docker/docker/pkg/units"
+	"github.com/docker/machine/libmachine/engine"
+	"golang.org/x/net/context"
+)
+
+const (
+	dockerSliceName = "docker.slice"
+	dockerSlicePath = "/etc/systemd/system/docker.slice"
+
+	sliceDropInName = "slice.conf"
+)
+
+var cpuQuotaRegexp = regexp.MustCompile(`^[1-9][0-9]*%$`)
+
+// systemd slice names, like system-docker.slice
+var sliceNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9:_.-]+\.slice$`)
+
+// the services moved into the slice given with the Slice engine option
+var slicedServices = []string{"docker", "containerd"}
+
+func hasResourceSlice(slice engine.ResourceSlice) bool {
+	return slice.CPUQuota != "" || slice.MemoryMax != ""
+}
+
+// cgroupParentFlag moves the containers into the docker slice. The
+// systemd cgroup driver expects a slice name, cgroupfs a path.
+func cgroupParentFlag(flags []string) string {
+	for _, flag := range flags {
+		if flag == "exec-opt=native.cgroupdriver=systemd" {
+			return "cgroup-parent=" + dockerSliceName
+		}
+	}
+
+	return "cgroup-parent=/" + dockerSliceName
+}
+
+// resourceSliceUnit renders the systemd slice unit for the limits.
+func resourceSliceUnit(slice engine.ResourceSlice) (string, error) {
+	unit := "[Unit]\nDescription=Docker daemon and containers\n\n[Slice]\n"
+
+	if slice.CPUQuota != "" {
+		if !cpuQuotaRegexp.MatchString(slice.CPUQuota) {
+			return "", fmt.Errorf("Invalid CPU quota %q, expected a percentage like 200%%", slice.CPUQuota)
+		}
+		unit += fmt.Sprintf("CPUAccounting=true\nCPUQuota=%s\n", slice.CPUQuota)
+	}
+
+	if slice.MemoryMax != "" {
+		size, err := units.RAMInBytes(slice.MemoryMax)
+		if err != nil || size <= 0 {
+			return "", fmt.Errorf("Invalid memory limit %q, expected a size like 512M", slice.MemoryMax)
+		}
+		unit += fmt.Sprintf("MemoryAccounting=true\nMemoryMax=%d\n", size)
+	}
+
+	return unit, nil
+}
+
+// writeResourceSlice installs the docker slice, so the limits apply to the
+// daemon and all of its containers together. This keeps a constrained Pi
+// responsive when containers misbehave.
+func writeResourceSlice(ctx context.Context, p SSHCommander, slice engine.ResourceSlice) error {
+	unit, err := resourceSliceUnit(slice)
+	if err != nil {
+		return err
+	}
+
+	commands := []string{
+		fmt.Sprintf("printf '%%s' '%s' | sudo tee %s", unit, dockerSlicePath),
+		"sudo systemctl daemon-reload",
+	}
+
+	for _, cmd := range commands {
+		if _, err := p.SSHCommand(ctx, cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func sliceDropInPaths(p SSHCommander) []string {
+	paths := []string{}
+	for _, service := range slicedServices {
+		paths = append(paths, serviceDropInPath(serviceName(service, dockerServiceNameOf(p)), sliceDropInName))
+	}
+	return paths
+}
+
+func sliceDropIn(slice string) (string, error) {
+	if !sliceNameRegexp.MatchString(slice) {
+		return "", fmt.Errorf("Invalid slice %q, expected a systemd slice name like system-docker.slice", slice)
+	}
+	return fmt.Sprintf("[Service]\nSlice=%s\n", slice), nil
+}
+
+// configureSlice runs the daemon and containerd in an existing slice, set
+// up for resource isolation outside of docker-machine.
+func configureSlice(ctx context.Context, p SSHCommander, slice string) error {
+	dropIn, err := sliceDropIn(slice)
+	if err != nil {
+		return err
+	}
+
+	commands := []string{}
+	for _, dropInPath := range sliceDropInPaths(p) {
+		commands = append(commands,
+			fmt.Sprintf("sudo mkdir -p %s", path.Dir(dropInPath)),
+			fmt.Sprintf("printf '%%s' '%s' | sudo tee %s", dropIn, dropInPath),
+		)
+	}
+	commands = append(commands, "sudo systemctl daemon-reload")
+
+	for _, cmd := range commands {
+		if _, err := p.SSHCommand(ctx, cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package provision
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func TestWriteResourceSlice(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+	slice := engine.ResourceSlice{
+		CPUQuota:  "200%",
+		MemoryMax: "512M",
+	}
+
+	if err := writeResourceSlice(context.Background(), commander, slice); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"printf '%s' '[Unit]\nDescription=Docker daemon and containers\n\n[Slice]\nCPUAccounting=true\nCPUQuota=200%\nMemoryAccounting=true\nMemoryMax=536870912\n' | sudo tee /etc/systemd/system/docker.slice",
+		"sudo systemctl daemon-reload",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestResourceSliceUnitInvalid(t *testing.T) {
+	for _, slice := range []engine.ResourceSlice{
+		{CPUQuota: "200"},
+		{CPUQuota: "0%"},
+		{MemoryMax: "lots"},
+		{MemoryMax: "-1G"},
+	} {
+		if _, err := resourceSliceUnit(slice); err == nil {
+			t.Fatalf("expected an error for %+v", slice)
+		}
+	}
+}
+
+func TestGenerateDockerOptionsResourceSlice(t *testing.T) {
+	p := NewDebianProvisioner(&fakedriver.Driver{}).(*DebianProvisioner)
+	p.EngineOptions.ResourceSlice = engine.ResourceSlice{MemoryMax: "512M"}
+
+	dockerCfg, err := p.GenerateDockerOptions(2376)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dockerCfg.EngineOptions, "\nSlice=docker.slice\n") {
+		t.Fatalf("expected the docker service in the docker slice; received %s", dockerCfg.EngineOptions)
+	}
+	if !strings.Contains(dockerCfg.EngineOptions, "--cgroup-parent=/docker.slice ") {
+		t.Fatalf("expected the containers in the docker slice; received %s", dockerCfg.EngineOptions)
+	}
+
+	p.EngineOptions.KubernetesReady = true
+
+	dockerCfg, err = p.GenerateDockerOptions(2376)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dockerCfg.EngineOptions, "--cgroup-parent=docker.slice ") {
+		t.Fatalf("expected a slice name with the systemd cgroup driver; received %s", dockerCfg.EngineOptions)
+	}
+}
+
+func TestSliceDropIn(t *testing.T) {
+	dropIn, err := sliceDropIn("system-docker.slice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "[Service]\nSlice=system-docker.slice\n"; dropIn != expected {
+		t.Fatalf("expected drop-in %q; received %q", expected, dropIn)
+	}
+
+	for _, slice := range []string{"", "docker", "docker.service", "my slice.slice", "a/b.slice"} {
+		if _, err := sliceDropIn(slice); err == nil {
+			t.Fatalf("expected an error for %q", slice)
+		}
+	}
+}
+
+func TestConfigureSlice(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := configureSlice(context.Background(), commander, "system-docker.slice"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo mkdir -p /etc/systemd/system/docker.service.d",
+		"printf '%s' '[Service]\nSlice=system-docker.slice\n' | sudo tee /etc/systemd/system/docker.service.d/slice.conf",
+		"sudo mkdir -p /etc/systemd/system/containerd.service.d",
+		"printf '%s' '[Service]\nSlice=system-docker.slice\n' | sudo tee /etc/systemd/system/containerd.service.d/slice.conf",
+		"sudo systemctl daemon-reload",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
@@ -0,0 +1,142 @@
+package provision
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/docker/machine/libmachine/engine"
+	"golang.org/x/net/context"
+)
+
+const restartDropInName = "restart.conf"
+
+// the values systemd accepts for Restart=
+var restartPolicies = map[string]bool{
+	"no":          true,
+	"on-success":  true,
+	"on-failure":  true,
+	"on-abnormal": true,
+	"on-watchdog": true,
+	"on-abort":    true,
+	"always":      true,
+}
+
+// restartDropIn renders the docker.service drop-in for the restart policy.
+func restartDropIn(policy string, restartSec int) (string, error) {
+	if !restartPolicies[policy] {
+		return "", fmt.Errorf("Invalid restart policy %q, expected one of no, on-success, on-failure, on-abnormal, on-watchdog, on-abort or always", policy)
+	}
+	if restartSec < 0 {
+		return "", fmt.Errorf("Invalid restart delay %d, it must not be negative", restartSec)
+	}
+
+	dropIn := fmt.Sprintf("[Service]\nRestart=%s\n", policy)
+	if restartSec > 0 {
+		dropIn += fmt.Sprintf("RestartSec=%d\n", restartSec)
+	}
+
+	return dropIn, nil
+}
+
+// configureRestartPolicy has systemd restart a crashed daemon according to
+// the policy, waiting restartSec seconds in between.
+func configureRestartPolicy(ctx context.Context, p SSHCommander, policy string, restartSec int) error {
+	dropIn, err := restartDropIn(policy, restartSec)
+	if err != nil {
+		return err
+	}
+
+	return writeDockerDropIn(ctx, p, dockerDropInPath(p, restartDropInName), dropIn)
+}
+
+// dockerServiceNamer is implemented by the provisioners that can run the
+// daemon under another service than "docker".
+type dockerServiceNamer interface {
+	dockerService() string
+}
+
+// dockerServiceNameOf returns the service the daemon runs under on the host
+// of p, empty when it is "docker".
+func dockerServiceNameOf(p SSHCommander) string {
+	if namer, ok := p.(dockerServiceNamer); ok {
+		return namer.dockerService()
+	}
+
+	return ""
+}
+
+// serviceDropInPath is the path of the named drop-in of a systemd service.
+func serviceDropInPath(service, name string) string {
+	return path.Join(systemdUnitDir, service+".service.d", name)
+}
+
+// dockerDropInPath is the path of the named drop-in of the service the
+// daemon runs under on the host of p.
+func dockerDropInPath(p SSHCommander, name string) string {
+	return path.Join(dockerUnitDir(p), serviceName("docker", dockerServiceNameOf(p))+".service.d", name)
+}
+
+// writeDockerDropIn writes a drop-in of the docker service and has systemd
+// reload the units, so the next (re)start of the daemon picks it up.
+func writeDockerDropIn(ctx context.Context, p SSHCommander, dropInPath, content string) error {
+	commands := []string{
+		fmt.Sprintf("sudo mkdir -p %s", path.Dir(dropInPath)),
+		fmt.Sprintf("printf '%%s' '%s' | sudo tee %s", content, dropInPath),
+		"sudo systemctl daemon-reload",
+	}
+
+	for _, cmd := range commands {
+		if _, err := p.SSHCommand(ctx, cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unsetDropInPaths lists the drop-ins, and the docker slice, of the options
+// left unset, which an earlier provisioning may have written.
+func unsetDropInPaths(p SSHCommander, engineOptions engine.Options) []string {
+	paths := []string{}
+
+	if engineOptions.RestartPolicy == "" {
+		paths = append(paths, dockerDropInPath(p, restartDropInName))
+	}
+	if engineOptions.OOMScoreAdjust == 0 {
+		paths = append(paths, dockerDropInPath(p, oomDropInName))
+	}
+	if !hasServiceLimits(engineOptions.ServiceLimits) {
+		paths = append(paths, dockerDropInPath(p, serviceLimitsDropInName))
+	}
+	if engineOptions.Slice == "" {
+		paths = append(paths, sliceDropInPaths(p)...)
+	}
+	if !hasResourceSlice(engineOptions.ResourceSlice) {
+		paths = append(paths, dockerSlicePath)
+	}
+
+	return paths
+}
+
+// removeUnsetDropIns removes the drop-ins of the unset options, so turning
+// an option off on reprovisioning takes effect.
+func removeUnsetDropIns(ctx context.Context, p SSHCommander, engineOptions engine.Options) error {
+	paths := unsetDropInPaths(p, engineOptions)
+	if len(paths) == 0 {
+		return nil
+	}
+
+	commands := []string{
+		fmt.Sprintf("sudo rm -f %s", strings.Join(paths, " ")),
+		"sudo systemctl daemon-reload",
+	}
+
+	for _, cmd := range commands {
+		if _, err := p.SSHCommand(ctx, cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
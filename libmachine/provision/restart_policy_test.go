@@ -0,0 +1,101 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func TestConfigureRestartPolicy(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := configureRestartPolicy(context.Background(), commander, "on-failure", 5); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo mkdir -p /etc/systemd/system/docker.service.d",
+		"printf '%s' '[Service]\nRestart=on-failure\nRestartSec=5\n' | sudo tee /etc/systemd/system/docker.service.d/restart.conf",
+		"sudo systemctl daemon-reload",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestConfigureRestartPolicyServiceName(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+	p := newFakeDebianProvisioner(commander)
+	p.DockerServiceName = "docker-ce"
+
+	if err := configureRestartPolicy(context.Background(), p, "always", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo mkdir -p /etc/systemd/system/docker-ce.service.d",
+		"printf '%s' '[Service]\nRestart=always\n' | sudo tee /etc/systemd/system/docker-ce.service.d/restart.conf",
+		"sudo systemctl daemon-reload",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestRestartDropIn(t *testing.T) {
+	dropIn, err := restartDropIn("always", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "[Service]\nRestart=always\n"; dropIn != expected {
+		t.Fatalf("expected drop-in %q; received %q", expected, dropIn)
+	}
+
+	if _, err := restartDropIn("sometimes", 0); err == nil {
+		t.Fatal("expected an error for an unknown policy")
+	}
+
+	if _, err := restartDropIn("always", -1); err == nil {
+		t.Fatal("expected an error for a negative delay")
+	}
+}
+
+func TestRemoveUnsetDropIns(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := removeUnsetDropIns(context.Background(), newFakeDebianProvisioner(commander), engine.Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo rm -f /etc/systemd/system/docker.service.d/restart.conf /etc/systemd/system/docker.service.d/oom.conf /etc/systemd/system/docker.service.d/limits.conf /etc/systemd/system/docker.service.d/slice.conf /etc/systemd/system/containerd.service.d/slice.conf /etc/systemd/system/docker.slice",
+		"sudo systemctl daemon-reload",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestRemoveUnsetDropInsAllSet(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	engineOptions := engine.Options{
+		RestartPolicy:  "always",
+		OOMScoreAdjust: -500,
+		ServiceLimits:  engine.ServiceLimits{NOFILE: "1048576"},
+		Slice:          "system-docker.slice",
+		ResourceSlice:  engine.ResourceSlice{CPUQuota: "200%"},
+	}
+
+	if err := removeUnsetDropIns(context.Background(), newFakeDebianProvisioner(commander), engineOptions); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(commander.Commands) != 0 {
+		t.Fatalf("expected the drop-ins of set options to be kept; received %v", commander.Commands)
+	}
+}
@@ -0,0 +1,81 @@
+package provision
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/provision/serviceaction"
+	"golang.org/x/net/context"
+)
+
+func liveRestoreEnabled(ctx context.Context, p SSHCommander) (bool, error) {
+	out, err := p.SSHCommand(ctx, "sudo docker info --format '{{.LiveRestoreEnabled}}'")
+	if err != nil {
+		return false, err
+	}
+
+	return strings.TrimSpace(out) == "true", nil
+}
+
+// RotateServerCertNoRestart replaces the server certificate of the daemon
+// while its containers keep running. The daemon doesn't reload its TLS
+// settings on SIGHUP, so it is still restarted, but with live-restore the
+// containers survive that. Without live-restore nothing is changed and
+// ErrLiveRestoreDisabled is returned: ConfigureAuth rotates the certificate
+// with a full restart instead.
+func RotateServerCertNoRestart(ctx context.Context, p Provisioner, authOptions auth.Options) error {
+	if p.GetEngineOptions().DisableTCP {
+		return fmt.Errorf("The daemon only listens on the unix socket, it has no server certificate")
+	}
+
+	liveRestore, err := liveRestoreEnabled(ctx, p)
+	if err != nil {
+		return err
+	}
+	if !liveRestore {
+		return ErrLiveRestoreDisabled
+	}
+
+	p.SetAuthOptions(authOptions)
+	authOptions = setRemoteAuthOptions(p)
+
+	if err := generateServerCert(p.GetDriver(), authOptions); err != nil {
+		return err
+	}
+
+	authOptions, err = redirectReadOnlyRoot(ctx, p, authOptions)
+	if err != nil {
+		return err
+	}
+	p.SetAuthOptions(authOptions)
+
+	log.Info("Copying the new server cert to the remote machine...")
+
+	for _, paths := range [][2]string{
+		{authOptions.ServerCertPath, authOptions.ServerCertRemotePath},
+		{authOptions.ServerKeyPath, authOptions.ServerKeyRemotePath},
+	} {
+		data, err := ioutil.ReadFile(paths[0])
+		if err != nil {
+			return err
+		}
+
+		if _, err := p.SSHCommand(ctx, fmt.Sprintf("printf '%%s' '%s' | sudo tee %s", string(data), paths[1])); err != nil {
+			return err
+		}
+	}
+
+	dockerPort, err := getDockerPort(p.GetDriver())
+	if err != nil {
+		return err
+	}
+
+	if err := p.Service(ctx, "docker", serviceaction.Restart); err != nil {
+		return err
+	}
+
+	return waitForDocker(ctx, p, dockerPort)
+}
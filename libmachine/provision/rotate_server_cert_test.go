@@ -0,0 +1,89 @@
+package provision
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/cert"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"github.com/docker/machine/libmachine/state"
+	"golang.org/x/net/context"
+)
+
+func TestRotateServerCertNoRestart(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	generator := &fakeCertGenerator{}
+	cert.SetCertGenerator(generator)
+	defer cert.SetCertGenerator(cert.NewX509CertGenerator())
+
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo docker info --format '{{.LiveRestoreEnabled}}'": "true\n",
+			"netstat -an": "tcp        0      0 :::2376                 :::*                    LISTEN",
+		},
+	}
+	p := NewDebianProvisioner(&fakedriver.Driver{
+		MockState: state.Running,
+		MockIP:    "1.2.3.4",
+	}).(*DebianProvisioner)
+	p.SSHCommander = commander
+
+	authOptions := auth.Options{
+		ServerCertPath: filepath.Join(tmpDir, "server.pem"),
+		ServerKeyPath:  filepath.Join(tmpDir, "server-key.pem"),
+	}
+	if err := RotateServerCertNoRestart(context.Background(), p, authOptions); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(generator.hosts, []string{"1.2.3.4", "localhost"}) {
+		t.Fatalf("expected the server cert for the machine IP; received %v", generator.hosts)
+	}
+
+	expected := []string{
+		"sudo docker info --format '{{.LiveRestoreEnabled}}'",
+		"awk '$2 == \"/\" {o=$4} END {print o}' /proc/mounts",
+		"printf '%s' 'FAKE SERVER CERT' | sudo tee /etc/docker/server.pem",
+		"printf '%s' 'FAKE SERVER KEY' | sudo tee /etc/docker/server-key.pem",
+		"sudo systemctl daemon-reload",
+		"sudo systemctl -f restart docker",
+		"netstat -an",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestRotateServerCertNoRestartLiveRestoreDisabled(t *testing.T) {
+	generator := &fakeCertGenerator{}
+	cert.SetCertGenerator(generator)
+	defer cert.SetCertGenerator(cert.NewX509CertGenerator())
+
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo docker info --format '{{.LiveRestoreEnabled}}'": "false\n",
+		},
+	}
+
+	if err := RotateServerCertNoRestart(context.Background(), newFakeDebianProvisioner(commander), auth.Options{}); err != ErrLiveRestoreDisabled {
+		t.Fatalf("expected %s; received %v", ErrLiveRestoreDisabled, err)
+	}
+
+	if generator.hosts != nil {
+		t.Fatal("expected no server cert to be generated")
+	}
+
+	if len(commander.Commands) != 1 {
+		t.Fatalf("expected only the live-restore check; received %v", commander.Commands)
+	}
+}
@@ -0,0 +1,40 @@
+package provision
+
+import (
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// distributions shipping an SELinux enabled kernel and policy
+var selinuxOsIDs = map[string]bool{
+	"centos": true,
+	"fedora": true,
+	"rhel":   true,
+}
+
+func supportsSelinux(info *OsRelease) bool {
+	if info == nil {
+		return false
+	}
+
+	for _, id := range append([]string{info.ID}, strings.Fields(info.IDLike)...) {
+		if selinuxOsIDs[id] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// warnSelinuxUnsupported warns when the daemon is asked for SELinux support
+// on a distribution without it, like Debian. The daemon still starts, but
+// containers run without SELinux labels.
+func warnSelinuxUnsupported(p Provisioner) {
+	info, err := p.GetOsReleaseInfo()
+	if err != nil || supportsSelinux(info) {
+		return
+	}
+
+	log.Warnf("SELinux support was requested, but %s doesn't enable SELinux; containers won't be confined by it.", info.PrettyName)
+}
@@ -0,0 +1,58 @@
+package provision
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+func TestSupportsSelinux(t *testing.T) {
+	for _, info := range []*OsRelease{
+		{ID: "centos", IDLike: "rhel fedora"},
+		{ID: "fedora"},
+		{ID: "rocky", IDLike: "rhel centos fedora"},
+	} {
+		if !supportsSelinux(info) {
+			t.Fatalf("expected SELinux support on %+v", info)
+		}
+	}
+
+	for _, info := range []*OsRelease{
+		nil,
+		{ID: "debian"},
+		{ID: "raspbian", IDLike: "debian"},
+	} {
+		if supportsSelinux(info) {
+			t.Fatalf("expected no SELinux support on %+v", info)
+		}
+	}
+}
+
+func TestWarnSelinuxUnsupported(t *testing.T) {
+	out := &bytes.Buffer{}
+	log.SetOutWriter(out)
+	log.SetErrWriter(out)
+	defer func() {
+		log.SetOutWriter(os.Stdout)
+		log.SetErrWriter(os.Stderr)
+	}()
+
+	p := newFakeDebianProvisioner(nil)
+	p.SetOsReleaseInfo(&OsRelease{ID: "raspbian", IDLike: "debian", PrettyName: "Raspbian GNU/Linux 10 (buster)"})
+	warnSelinuxUnsupported(p)
+
+	if !strings.Contains(out.String(), "Raspbian GNU/Linux 10 (buster) doesn't enable SELinux") {
+		t.Fatalf("expected an SELinux warning; received %q", out.String())
+	}
+
+	out.Reset()
+	p.SetOsReleaseInfo(&OsRelease{ID: "centos", PrettyName: "CentOS Linux 7 (Core)"})
+	warnSelinuxUnsupported(p)
+
+	if out.Len() != 0 {
+		t.Fatalf("expected no warning on CentOS; received %q", out.String())
+	}
+}
@@ -0,0 +1,50 @@
+package provision
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/docker/machine/libmachine/engine"
+	"golang.org/x/net/context"
+)
+
+const serviceLimitsDropInName = "limits.conf"
+
+var reServiceLimit = regexp.MustCompile(`^([0-9]+(:[0-9]+)?|infinity)$`)
+
+func hasServiceLimits(limits engine.ServiceLimits) bool {
+	return limits.NOFILE != "" || limits.NPROC != "" || limits.CORE != ""
+}
+
+// serviceLimitsDropIn renders the docker.service drop-in overriding the
+// process limits the unit sets, leaving out the empty ones.
+func serviceLimitsDropIn(limits engine.ServiceLimits) (string, error) {
+	dropIn := "[Service]\n"
+
+	for _, limit := range []struct{ name, value string }{
+		{"LimitNOFILE", limits.NOFILE},
+		{"LimitNPROC", limits.NPROC},
+		{"LimitCORE", limits.CORE},
+	} {
+		if limit.value == "" {
+			continue
+		}
+		if !reServiceLimit.MatchString(limit.value) {
+			return "", fmt.Errorf("Invalid %s %q, expected a number, soft:hard numbers or infinity", limit.name, limit.value)
+		}
+		dropIn += fmt.Sprintf("%s=%s\n", limit.name, limit.value)
+	}
+
+	return dropIn, nil
+}
+
+// configureServiceLimits raises, or lowers, the limits of the daemon, like
+// the open files limit it hits with many containers.
+func configureServiceLimits(ctx context.Context, p SSHCommander, limits engine.ServiceLimits) error {
+	dropIn, err := serviceLimitsDropIn(limits)
+	if err != nil {
+		return err
+	}
+
+	return writeDockerDropIn(ctx, p, dockerDropInPath(p, serviceLimitsDropInName), dropIn)
+}
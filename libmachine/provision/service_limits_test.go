@@ -0,0 +1,48 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func TestServiceLimitsDropIn(t *testing.T) {
+	dropIn, err := serviceLimitsDropIn(engine.ServiceLimits{NOFILE: "65536:1048576", CORE: "infinity"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "[Service]\nLimitNOFILE=65536:1048576\nLimitCORE=infinity\n"; dropIn != expected {
+		t.Fatalf("expected drop-in %q; received %q", expected, dropIn)
+	}
+
+	for _, limits := range []engine.ServiceLimits{
+		{NOFILE: "-1"},
+		{NPROC: "unlimited"},
+		{CORE: "1M"},
+	} {
+		if _, err := serviceLimitsDropIn(limits); err == nil {
+			t.Fatalf("expected an error for %+v", limits)
+		}
+	}
+}
+
+func TestConfigureServiceLimits(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := configureServiceLimits(context.Background(), commander, engine.ServiceLimits{NOFILE: "1048576", NPROC: "infinity"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo mkdir -p /etc/systemd/system/docker.service.d",
+		"printf '%s' '[Service]\nLimitNOFILE=1048576\nLimitNPROC=infinity\n' | sudo tee /etc/systemd/system/docker.service.d/limits.conf",
+		"sudo systemctl daemon-reload",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
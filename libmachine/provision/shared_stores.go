@@ -0,0 +1,31 @@
+package provision
+
+// SharedStores are shared by the machines of a machine store, for the
+// RegistryCache engine option and the AutoRole swarm option.
+// libmachine.Client keeps them in the machine store.
+type SharedStores struct {
+	RegistryCache RegistryCacheStore
+	SwarmTokens   SwarmTokenStore
+}
+
+// sharedStoresUser is implemented by the provisioners using the shared
+// stores.
+type sharedStoresUser interface {
+	GetSharedStores() SharedStores
+	SetSharedStores(stores SharedStores)
+}
+
+// SetSharedStores hands the shared stores to p, when it uses them.
+func SetSharedStores(p Provisioner, stores SharedStores) {
+	if user, ok := p.(sharedStoresUser); ok {
+		user.SetSharedStores(stores)
+	}
+}
+
+func sharedStoresOf(p Provisioner) SharedStores {
+	if user, ok := p.(sharedStoresUser); ok {
+		return user.GetSharedStores()
+	}
+
+	return SharedStores{}
+}
@@ -0,0 +1,54 @@
+package provision
+
+import (
+	"fmt"
+	"path"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	dockerSocketPath      = "/var/run/docker.sock"
+	socketAliasesTmpfiles = "/etc/tmpfiles.d/docker-socket-aliases.conf"
+)
+
+// socketAliasesConf renders a tmpfiles.d config with a symlink to the docker
+// socket for each alias. /var/run is a tmpfs, so the links have to be
+// recreated on every boot.
+func socketAliasesConf(aliases []string) (string, error) {
+	conf := ""
+
+	for _, alias := range aliases {
+		if err := validateHostPath("socket alias", alias); err != nil {
+			return "", err
+		}
+		if clean := path.Clean(alias); clean == dockerSocketPath || clean == "/run/docker.sock" {
+			return "", fmt.Errorf("The socket alias %s is the docker socket itself", alias)
+		}
+		conf += fmt.Sprintf("L+ %s - - - - %s\n", alias, dockerSocketPath)
+	}
+
+	return conf, nil
+}
+
+// createSocketAliases links the aliases to the docker socket, now and on
+// every boot, for tooling which expects the socket elsewhere.
+func createSocketAliases(ctx context.Context, p SSHCommander, aliases []string) error {
+	conf, err := socketAliasesConf(aliases)
+	if err != nil {
+		return err
+	}
+
+	commands := []string{
+		fmt.Sprintf("printf '%%s' '%s' | sudo tee %s", conf, socketAliasesTmpfiles),
+		fmt.Sprintf("sudo systemd-tmpfiles --create %s", socketAliasesTmpfiles),
+	}
+
+	for _, cmd := range commands {
+		if _, err := p.SSHCommand(ctx, cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
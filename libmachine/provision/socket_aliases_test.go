@@ -0,0 +1,38 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func TestCreateSocketAliases(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := createSocketAliases(context.Background(), commander, []string{"/var/run/balena-engine.sock", "/run/user/1000/docker.sock"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"printf '%s' 'L+ /var/run/balena-engine.sock - - - - /var/run/docker.sock\nL+ /run/user/1000/docker.sock - - - - /var/run/docker.sock\n' | sudo tee /etc/tmpfiles.d/docker-socket-aliases.conf",
+		"sudo systemd-tmpfiles --create /etc/tmpfiles.d/docker-socket-aliases.conf",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestCreateSocketAliasesInvalid(t *testing.T) {
+	for _, alias := range []string{"docker.sock", "/var/run/my docker.sock", "/var/run/docker.sock", "/run/./docker.sock"} {
+		commander := &provisiontest.FakeSSHCommander{}
+
+		if err := createSocketAliases(context.Background(), commander, []string{alias}); err == nil {
+			t.Fatalf("expected an error for alias %q", alias)
+		}
+		if len(commander.Commands) != 0 {
+			t.Fatalf("expected no commands for alias %q; received %v", alias, commander.Commands)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package provision
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/docker/machine/libmachine/provision/pkgaction"
+	"github.com/docker/machine/libmachine/provision/serviceaction"
+	"golang.org/x/net/context"
+)
+
+const (
+	sshdConfigDir         = "/etc/ssh/sshd_config.d"
+	sshdHardeningConfPath = sshdConfigDir + "/50-docker-machine-hardening.conf"
+	fail2banJailPath      = "/etc/fail2ban/jail.d/docker-machine.local"
+)
+
+const sshdHardeningConf = `PermitRootLogin no
+PasswordAuthentication no
+KbdInteractiveAuthentication no
+ChallengeResponseAuthentication no
+PubkeyAuthentication yes
+`
+
+// the sshd jail reads the journal, as recent Debian releases have no
+// auth.log anymore
+const fail2banJail = `[sshd]
+enabled = true
+backend = systemd
+`
+
+// checkSSHKeyLogin makes sure the SSH user logs in with the machine key,
+// so turning off root and password logins can't lock us out of the host.
+func checkSSHKeyLogin(ctx context.Context, p Provisioner) error {
+	driver := p.GetDriver()
+
+	if user := driver.GetSSHUsername(); user == "" || user == "root" {
+		return fmt.Errorf("Hardening SSH turns off root logins, but the machine is accessed as %q", user)
+	}
+
+	keyPath := driver.GetSSHKeyPath()
+	if keyPath == "" {
+		return fmt.Errorf("Hardening SSH turns off password logins, but the machine has no SSH key")
+	}
+
+	publicKey, err := ioutil.ReadFile(keyPath + ".pub")
+	if err != nil {
+		return fmt.Errorf("Reading the public SSH key failed: %s", err)
+	}
+
+	fields := strings.Fields(string(publicKey))
+	if len(fields) < 2 {
+		return fmt.Errorf("Invalid public SSH key %s.pub", keyPath)
+	}
+
+	out, err := p.SSHCommand(ctx, fmt.Sprintf("if grep -qF '%s' ~/.ssh/authorized_keys 2>/dev/null; then echo authorized; fi", fields[1]))
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(out) != "authorized" {
+		return fmt.Errorf("The SSH key %s is not in the authorized keys of %s, hardening SSH would lock it out", keyPath, driver.GetSSHUsername())
+	}
+
+	return nil
+}
+
+// hardenSSH installs fail2ban and turns off root and password logins on
+// hosts exposed to the internet. The new sshd config is checked with
+// sshd -t before sshd is restarted, which keeps the open sessions, and
+// removed again when sshd rejects it.
+func hardenSSH(ctx context.Context, p Provisioner) error {
+	if err := checkSSHKeyLogin(ctx, p); err != nil {
+		return err
+	}
+
+	// the drop-in is ignored by sshd configs without the include, like the
+	// ones of Debian releases before bullseye
+	out, err := p.SSHCommand(ctx, fmt.Sprintf("if grep -q '^Include %s/' /etc/ssh/sshd_config; then echo included; fi", sshdConfigDir))
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(out) != "included" {
+		return fmt.Errorf("The sshd_config of the host doesn't include %s, the SSH hardening drop-in would be ignored", sshdConfigDir)
+	}
+
+	if err := aptPackages(ctx, p, []string{"fail2ban"}, pkgaction.Install); err != nil {
+		return err
+	}
+
+	if _, err := p.SSHCommand(ctx, fmt.Sprintf("printf '%%s' '%s' | sudo tee %s", sshdHardeningConf, sshdHardeningConfPath)); err != nil {
+		return err
+	}
+
+	if _, err := p.SSHCommand(ctx, "sudo sshd -t"); err != nil {
+		// left in place, the drop-in would keep sshd from starting again
+		if _, rmErr := p.SSHCommand(ctx, fmt.Sprintf("sudo rm -f %s", sshdHardeningConfPath)); rmErr != nil {
+			return fmt.Errorf("sshd rejects the SSH hardening drop-in: %s, and removing %s failed: %s", err, sshdHardeningConfPath, rmErr)
+		}
+		return fmt.Errorf("sshd rejects the SSH hardening drop-in, it was removed: %s", err)
+	}
+
+	if _, err := p.SSHCommand(ctx, fmt.Sprintf("printf '%%s' '%s' | sudo tee %s", fail2banJail, fail2banJailPath)); err != nil {
+		return err
+	}
+
+	if err := p.Service(ctx, "ssh", serviceaction.Restart); err != nil {
+		return err
+	}
+
+	if err := p.Service(ctx, "fail2ban", serviceaction.Enable); err != nil {
+		return err
+	}
+
+	return p.Service(ctx, "fail2ban", serviceaction.Restart)
+}
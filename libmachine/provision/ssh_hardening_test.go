@@ -0,0 +1,165 @@
+package provision
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+// sshKeyDriver is a fake driver logging in with a key, as a given user
+type sshKeyDriver struct {
+	fakedriver.Driver
+	keyPath  string
+	username string
+}
+
+func (d *sshKeyDriver) GetSSHKeyPath() string {
+	return d.keyPath
+}
+
+func (d *sshKeyDriver) GetSSHUsername() string {
+	return d.username
+}
+
+const (
+	authorizedKeyCmd = "if grep -qF 'AAAAC3NzaC1lZDI1NTE5AAAAIFake' ~/.ssh/authorized_keys 2>/dev/null; then echo authorized; fi"
+	sshdIncludeCmd   = "if grep -q '^Include /etc/ssh/sshd_config.d/' /etc/ssh/sshd_config; then echo included; fi"
+)
+
+func newSSHKeyProvisioner(t *testing.T, commander SSHCommander, username string) (*DebianProvisioner, string) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyPath := filepath.Join(tmpDir, "id_ed25519")
+	if err := ioutil.WriteFile(keyPath+".pub", []byte("ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIFake docker-machine\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewDebianProvisioner(&sshKeyDriver{keyPath: keyPath, username: username}).(*DebianProvisioner)
+	p.SSHCommander = commander
+	return p, tmpDir
+}
+
+func TestHardenSSH(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			authorizedKeyCmd: "authorized\n",
+			sshdIncludeCmd:   "included\n",
+		},
+	}
+	p, tmpDir := newSSHKeyProvisioner(t, commander, "pi")
+	defer os.RemoveAll(tmpDir)
+
+	if err := hardenSSH(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		authorizedKeyCmd,
+		sshdIncludeCmd,
+		"sudo apt-get update",
+		"DEBIAN_FRONTEND=noninteractive sudo -E apt-get install -y -o DPkg::Lock::Timeout=120 fail2ban",
+		"printf '%s' 'PermitRootLogin no\nPasswordAuthentication no\nKbdInteractiveAuthentication no\nChallengeResponseAuthentication no\nPubkeyAuthentication yes\n' | sudo tee /etc/ssh/sshd_config.d/50-docker-machine-hardening.conf",
+		"sudo sshd -t",
+		"printf '%s' '[sshd]\nenabled = true\nbackend = systemd\n' | sudo tee /etc/fail2ban/jail.d/docker-machine.local",
+		"sudo systemctl daemon-reload",
+		"sudo systemctl -f restart ssh",
+		"sudo systemctl -f enable fail2ban",
+		"sudo systemctl daemon-reload",
+		"sudo systemctl -f restart fail2ban",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestHardenSSHNoInclude(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			authorizedKeyCmd: "authorized\n",
+		},
+	}
+	p, tmpDir := newSSHKeyProvisioner(t, commander, "pi")
+	defer os.RemoveAll(tmpDir)
+
+	err := hardenSSH(context.Background(), p)
+	if err == nil || !strings.Contains(err.Error(), "doesn't include /etc/ssh/sshd_config.d") {
+		t.Fatalf("expected an error for an sshd_config without the include; received %v", err)
+	}
+
+	if !reflect.DeepEqual(commander.Commands, []string{authorizedKeyCmd, sshdIncludeCmd}) {
+		t.Fatalf("expected to stop before changing sshd; received %v", commander.Commands)
+	}
+}
+
+func TestHardenSSHRejected(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			authorizedKeyCmd: "authorized\n",
+			sshdIncludeCmd:   "included\n",
+		},
+		Errors: map[string]error{
+			"sudo sshd -t": errors.New("Bad configuration option"),
+		},
+	}
+	p, tmpDir := newSSHKeyProvisioner(t, commander, "pi")
+	defer os.RemoveAll(tmpDir)
+
+	if err := hardenSSH(context.Background(), p); err == nil {
+		t.Fatal("expected an error for a drop-in sshd rejects")
+	}
+
+	if last := commander.Commands[len(commander.Commands)-1]; last != "sudo rm -f /etc/ssh/sshd_config.d/50-docker-machine-hardening.conf" {
+		t.Fatalf("expected the drop-in to be removed; received %v", commander.Commands)
+	}
+}
+
+func TestHardenSSHKeyNotAuthorized(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+	p, tmpDir := newSSHKeyProvisioner(t, commander, "pi")
+	defer os.RemoveAll(tmpDir)
+
+	if err := hardenSSH(context.Background(), p); err == nil {
+		t.Fatal("expected an error for a key missing from the authorized keys")
+	}
+
+	if !reflect.DeepEqual(commander.Commands, []string{authorizedKeyCmd}) {
+		t.Fatalf("expected to stop before changing sshd; received %v", commander.Commands)
+	}
+}
+
+func TestHardenSSHRootLogin(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+	p, tmpDir := newSSHKeyProvisioner(t, commander, "root")
+	defer os.RemoveAll(tmpDir)
+
+	if err := hardenSSH(context.Background(), p); err == nil {
+		t.Fatal("expected an error for a machine accessed as root")
+	}
+	if len(commander.Commands) != 0 {
+		t.Fatalf("expected no commands; received %v", commander.Commands)
+	}
+}
+
+func TestHardenSSHNoKey(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+	p := NewDebianProvisioner(&sshKeyDriver{username: "pi"}).(*DebianProvisioner)
+	p.SSHCommander = commander
+
+	if err := hardenSSH(context.Background(), p); err == nil {
+		t.Fatal("expected an error for a machine without SSH key")
+	}
+	if len(commander.Commands) != 0 {
+		t.Fatalf("expected no commands; received %v", commander.Commands)
+	}
+}
@@ -0,0 +1,21 @@
+package provision
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// checkSudo makes sure the SSH user can run sudo without a password. All
+// the provisioning commands rely on it, and a sudo waiting for a password
+// would otherwise only surface as an obscure failure halfway through.
+func checkSudo(ctx context.Context, p Provisioner) error {
+	_, err := p.SSHCommand(ctx, "sudo -n true")
+	if err == nil || !strings.Contains(err.Error(), "password is required") {
+		return err
+	}
+
+	user := p.GetDriver().GetSSHUsername()
+	return fmt.Errorf("The user %q needs passwordless sudo on the host, add '%s ALL=(ALL) NOPASSWD:ALL' to a file in /etc/sudoers.d", user, user)
+}
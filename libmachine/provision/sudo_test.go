@@ -0,0 +1,54 @@
+package provision
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"github.com/docker/machine/libmachine/swarm"
+	"golang.org/x/net/context"
+)
+
+func TestCheckSudo(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := checkSudo(context.Background(), newFakeDebianProvisioner(commander)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProvisionSudoPasswordRequired(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Errors: map[string]error{
+			"sudo -n true": errors.New("Something went wrong running an SSH command!\ncommand : sudo -n true\nerr     : exit status 1\noutput  : sudo: a password is required\n"),
+		},
+	}
+	p := NewUbuntuSystemdProvisioner(&fakedriver.Driver{}).(*UbuntuSystemdProvisioner)
+	p.SSHCommander = commander
+
+	err := p.Provision(context.Background(), swarm.Options{}, auth.Options{}, engine.Options{})
+	if err == nil || !strings.Contains(err.Error(), "NOPASSWD") {
+		t.Fatalf("expected an actionable sudo error; received %v", err)
+	}
+
+	if len(commander.Commands) != 1 {
+		t.Fatalf("expected provisioning to stop at the sudo check; received %v", commander.Commands)
+	}
+}
+
+func TestCheckSudoOtherError(t *testing.T) {
+	sshErr := errors.New("connection refused")
+	commander := &provisiontest.FakeSSHCommander{
+		Errors: map[string]error{
+			"sudo -n true": sshErr,
+		},
+	}
+
+	if err := checkSudo(context.Background(), newFakeDebianProvisioner(commander)); err != sshErr {
+		t.Fatalf("expected the SSH error to be returned as is; received %v", err)
+	}
+}
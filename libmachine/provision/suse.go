@@ -9,10 +9,10 @@ import (
 	"github.com/docker/machine/libmachine/drivers"
 	"github.com/docker/machine/libmachine/engine"
 	"github.com/docker/machine/libmachine/log"
-	"github.com/docker/machine/libmachine/mcnutils"
 	"github.com/docker/machine/libmachine/provision/pkgaction"
 	"github.com/docker/machine/libmachine/provision/serviceaction"
 	"github.com/docker/machine/libmachine/swarm"
+	"golang.org/x/net/context"
 )
 
 func init() {
@@ -80,7 +80,7 @@ func (provisioner *SUSEProvisioner) String() string {
 	return "suse"
 }
 
-func (provisioner *SUSEProvisioner) Service(name string, action serviceaction.ServiceAction) error {
+func (provisioner *SUSEProvisioner) Service(ctx context.Context, name string, action serviceaction.ServiceAction) error {
 	reloadDaemon := false
 	switch action {
 	case serviceaction.Start, serviceaction.Restart:
@@ -91,27 +91,27 @@ func (provisioner *SUSEProvisioner) Service(name string, action serviceaction.Se
 	// be sure exactly when it changes from the provisioner so
 	// we call a reload on every restart to be safe
 	if reloadDaemon {
-		if _, err := provisioner.SSHCommand("sudo systemctl daemon-reload"); err != nil {
+		if _, err := provisioner.SSHCommand(ctx, "sudo systemctl daemon-reload"); err != nil {
 			return err
 		}
 	}
 
-	command := fmt.Sprintf("sudo systemctl %s %s", action.String(), name)
+	command := fmt.Sprintf("sudo systemctl %s %s", action.String(), serviceName(name, provisioner.dockerService()))
 
-	if _, err := provisioner.SSHCommand(command); err != nil {
+	if _, err := provisioner.SSHCommand(ctx, command); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (provisioner *SUSEProvisioner) Package(name string, action pkgaction.PackageAction) error {
+func (provisioner *SUSEProvisioner) Package(ctx context.Context, name string, action pkgaction.PackageAction) error {
 	var packageAction string
 
 	switch action {
 	case pkgaction.Install:
 		packageAction = "install"
-	case pkgaction.Remove:
+	case pkgaction.Remove, pkgaction.Purge:
 		packageAction = "remove"
 	case pkgaction.Upgrade:
 		packageAction = "upgrade"
@@ -119,17 +119,17 @@ func (provisioner *SUSEProvisioner) Package(name string, action pkgaction.Packag
 
 	command := fmt.Sprintf("sudo -E zypper -n %s %s", packageAction, name)
 
-	if _, err := provisioner.SSHCommand(command); err != nil {
+	if _, err := provisioner.SSHCommand(ctx, command); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (provisioner *SUSEProvisioner) dockerDaemonResponding() bool {
+func (provisioner *SUSEProvisioner) dockerDaemonResponding(ctx context.Context) bool {
 	log.Debug("checking docker daemon")
 
-	if out, err := provisioner.SSHCommand("sudo docker version"); err != nil {
+	if out, err := provisioner.SSHCommand(ctx, "sudo docker version"); err != nil {
 		log.Warnf("Error getting SSH command to check if the daemon is up: %s", err)
 		log.Debugf("'sudo docker version' output:\n%s", out)
 		return false
@@ -139,58 +139,77 @@ func (provisioner *SUSEProvisioner) dockerDaemonResponding() bool {
 	return true
 }
 
-func (provisioner *SUSEProvisioner) Provision(swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error {
+func (provisioner *SUSEProvisioner) Provision(ctx context.Context, swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error {
+	ctx, cancel := provisionContext(ctx, engineOptions)
+	defer cancel()
+
+	if err := ValidateOptions(provisioner, swarmOptions, authOptions, engineOptions); err != nil {
+		return err
+	}
+
 	provisioner.SwarmOptions = swarmOptions
 	provisioner.AuthOptions = authOptions
 	provisioner.EngineOptions = engineOptions
 	swarmOptions.Env = engineOptions.Env
 
-	if err := provisioner.SetHostname(provisioner.Driver.GetMachineName()); err != nil {
+	log.Debug("checking for passwordless sudo")
+	if err := checkSudo(ctx, provisioner); err != nil {
+		return err
+	}
+
+	if !provisioner.EngineOptions.SkipCloudInitWait {
+		log.Debug("waiting for cloud-init")
+		if err := waitForCloudInit(ctx, provisioner, cloudInitTimeout(provisioner.EngineOptions.CloudInitTimeout)); err != nil {
+			return err
+		}
+	}
+
+	if err := provisioner.SetHostname(ctx, provisioner.Driver.GetMachineName()); err != nil {
 		return err
 	}
 
 	for _, pkg := range provisioner.Packages {
-		if err := provisioner.Package(pkg, pkgaction.Install); err != nil {
+		if err := provisioner.Package(ctx, pkg, pkgaction.Install); err != nil {
 			return err
 		}
 	}
 
 	// update OS -- this is needed for libdevicemapper and the docker install
-	if _, err := provisioner.SSHCommand("sudo zypper ref"); err != nil {
+	if _, err := provisioner.SSHCommand(ctx, "sudo zypper ref"); err != nil {
 		return err
 	}
-	if _, err := provisioner.SSHCommand("sudo zypper -n update"); err != nil {
+	if _, err := provisioner.SSHCommand(ctx, "sudo zypper -n update"); err != nil {
 		return err
 	}
 
-	if err := installDockerGeneric(provisioner, engineOptions.InstallURL); err != nil {
+	if err := installDockerGeneric(ctx, provisioner, engineOptions.InstallURL); err != nil {
 		return err
 	}
 
-	if _, err := provisioner.SSHCommand("sudo systemctl start docker"); err != nil {
+	if _, err := provisioner.SSHCommand(ctx, fmt.Sprintf("sudo systemctl start %s", serviceName("docker", provisioner.dockerService()))); err != nil {
 		return err
 	}
 
-	if err := mcnutils.WaitFor(provisioner.dockerDaemonResponding); err != nil {
+	if err := waitFor(ctx, provisioner.dockerDaemonResponding); err != nil {
 		return err
 	}
 
-	if _, err := provisioner.SSHCommand("sudo systemctl stop docker"); err != nil {
+	if _, err := provisioner.SSHCommand(ctx, fmt.Sprintf("sudo systemctl stop %s", serviceName("docker", provisioner.dockerService()))); err != nil {
 		return err
 	}
 
 	// open firewall port required by docker
-	if _, err := provisioner.SSHCommand("sudo /sbin/yast2 firewall services add ipprotocol=tcp tcpport=2376 zone=EXT"); err != nil {
+	if _, err := provisioner.SSHCommand(ctx, "sudo /sbin/yast2 firewall services add ipprotocol=tcp tcpport=2376 zone=EXT"); err != nil {
 		return err
 	}
 
-	if err := makeDockerOptionsDir(provisioner); err != nil {
+	if err := makeDockerOptionsDir(ctx, provisioner); err != nil {
 		return err
 	}
 
 	provisioner.AuthOptions = setRemoteAuthOptions(provisioner)
 
-	if err := ConfigureAuth(provisioner); err != nil {
+	if err := ConfigureAuth(ctx, provisioner); err != nil {
 		return err
 	}
 
@@ -204,11 +223,11 @@ func (provisioner *SUSEProvisioner) Provision(swarmOptions swarm.Options, authOp
 func (provisioner *SUSEProvisioner) GenerateDockerOptions(dockerPort int) (*DockerOptions, error) {
 	var (
 		engineCfg  bytes.Buffer
-		configPath = provisioner.DaemonOptionsFile
+		configPath = provisioner.daemonOptionsFile()
 	)
 
 	// remove existing
-	if _, err := provisioner.SSHCommand(fmt.Sprintf("sudo rm %s", configPath)); err != nil {
+	if _, err := provisioner.SSHCommand(context.TODO(), fmt.Sprintf("sudo rm %s", configPath)); err != nil {
 		return nil, err
 	}
 
@@ -216,8 +235,13 @@ func (provisioner *SUSEProvisioner) GenerateDockerOptions(dockerPort int) (*Dock
 	provisioner.EngineOptions.Labels = append(provisioner.EngineOptions.Labels, driverNameLabel)
 
 	engineConfigTmpl := `# File automatically generated by docker-machine
-DOCKER_OPTS=' -H tcp://0.0.0.0:{{.DockerPort}} {{ if .EngineOptions.StorageDriver }} --storage-driver {{.EngineOptions.StorageDriver}} {{ end }} --tlsverify --tlscacert {{.AuthOptions.CaCertRemotePath}} --tlscert {{.AuthOptions.ServerCertRemotePath}} --tlskey {{.AuthOptions.ServerKeyRemotePath}} {{ range .EngineOptions.Labels }}--label {{.}} {{ end }}{{ range .EngineOptions.InsecureRegistry }}--insecure-registry {{.}} {{ end }}{{ range .EngineOptions.RegistryMirror }}--registry-mirror {{.}} {{ end }}{{ range .EngineOptions.ArbitraryFlags }}--{{.}} {{ end }}'
+DOCKER_OPTS=' {{ if not .EngineOptions.DisableTCP }}-H tcp://0.0.0.0:{{.DockerPort}} {{ end }}{{ if .EngineOptions.StorageDriver }} --storage-driver {{.EngineOptions.StorageDriver}} {{ end }} {{ if not .EngineOptions.DisableTCP }}--tlsverify --tlscacert {{.AuthOptions.CaCertRemotePath}} --tlscert {{.AuthOptions.ServerCertRemotePath}} --tlskey {{.AuthOptions.ServerKeyRemotePath}} {{ end }}{{ range .EngineOptions.Labels }}--label {{.}} {{ end }}{{ range .EngineOptions.InsecureRegistry }}--insecure-registry {{.}} {{ end }}{{ range .EngineOptions.RegistryMirror }}--registry-mirror {{.}} {{ end }}{{ range .EngineFlags }}--{{.}} {{ end }}'
 `
+	flags, err := engineFlags(provisioner.EngineOptions)
+	if err != nil {
+		return nil, err
+	}
+
 	t, err := template.New("engineConfig").Parse(engineConfigTmpl)
 	if err != nil {
 		return nil, err
@@ -228,6 +252,7 @@ DOCKER_OPTS=' -H tcp://0.0.0.0:{{.DockerPort}} {{ if .EngineOptions.StorageDrive
 		AuthOptions:      provisioner.AuthOptions,
 		EngineOptions:    provisioner.EngineOptions,
 		DockerOptionsDir: provisioner.DockerOptionsDir,
+		EngineFlags:      flags,
 	}
 
 	t.Execute(&engineCfg, engineConfigContext)
@@ -0,0 +1,207 @@
+package provision
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/swarm"
+	"golang.org/x/net/context"
+)
+
+const swarmManagerPort = 2377
+
+// ErrNoSwarmTokenStore is returned when a node should pick its swarm role
+// itself but no token store was set with SetSharedStores.
+var ErrNoSwarmTokenStore = errors.New("Picking the swarm role automatically needs a token store shared by the machines, set with SetSharedStores")
+
+// SwarmCluster is what a node needs to join a swarm mode cluster.
+type SwarmCluster struct {
+	ManagerAddr string
+	Tokens      SwarmJoinTokens
+}
+
+// SwarmTokenStore is shared by the machines provisioned with the AutoRole
+// swarm option. The first one to be elected becomes the manager.
+type SwarmTokenStore interface {
+	// Get returns the cluster recorded by the elected manager, nil when
+	// no node was elected yet.
+	Get() (*SwarmCluster, error)
+	// Elect records cluster unless another one is recorded already and
+	// returns the recorded cluster. It must be atomic.
+	Elect(cluster *SwarmCluster) (*SwarmCluster, error)
+}
+
+// MemorySwarmTokenStore is a SwarmTokenStore for machines provisioned
+// from the same process.
+type MemorySwarmTokenStore struct {
+	mu      sync.Mutex
+	cluster *SwarmCluster
+}
+
+func NewMemorySwarmTokenStore() *MemorySwarmTokenStore {
+	return &MemorySwarmTokenStore{}
+}
+
+func (s *MemorySwarmTokenStore) Get() (*SwarmCluster, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.cluster, nil
+}
+
+func (s *MemorySwarmTokenStore) Elect(cluster *SwarmCluster) (*SwarmCluster, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cluster == nil {
+		s.cluster = cluster
+	}
+
+	return s.cluster, nil
+}
+
+// FileSwarmTokenStore is a SwarmTokenStore kept in a file, like one in the
+// machine store, for machines provisioned from separate processes. The file
+// holds the join tokens, so it is only readable by its owner.
+type FileSwarmTokenStore struct {
+	path string
+}
+
+func NewFileSwarmTokenStore(path string) *FileSwarmTokenStore {
+	return &FileSwarmTokenStore{path: path}
+}
+
+func (s *FileSwarmTokenStore) Get() (*SwarmCluster, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return unmarshalSwarmCluster(s.path, data)
+}
+
+func (s *FileSwarmTokenStore) Elect(cluster *SwarmCluster) (*SwarmCluster, error) {
+	data, err := json.Marshal(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	elected, err := electFile(s.path, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return unmarshalSwarmCluster(s.path, elected)
+}
+
+func unmarshalSwarmCluster(path string, data []byte) (*SwarmCluster, error) {
+	cluster := &SwarmCluster{}
+	if err := json.Unmarshal(data, cluster); err != nil {
+		return nil, fmt.Errorf("Invalid swarm cluster in %s: %s", path, err)
+	}
+
+	return cluster, nil
+}
+
+func joinToken(ctx context.Context, p Provisioner, role string) (string, error) {
+	out, err := p.SSHCommand(ctx, fmt.Sprintf("sudo docker swarm join-token -q %s", role))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(out), nil
+}
+
+func joinSwarm(ctx context.Context, p Provisioner, cluster *SwarmCluster) error {
+	_, err := p.SSHCommand(withCommandTimeout(ctx, installCommandTimeout), fmt.Sprintf("sudo docker swarm join --token %s %s", cluster.Tokens.Worker, cluster.ManagerAddr))
+	return err
+}
+
+// configureSwarmAutoRole makes the node the manager of a new swarm mode
+// cluster when it is the first one to get elected in the store, and a
+// worker of the elected manager's cluster otherwise. It returns the role
+// the node got. Provisioning the node again keeps the role it has.
+func configureSwarmAutoRole(ctx context.Context, p Provisioner, swarmOptions swarm.Options, store SwarmTokenStore) (string, error) {
+	if store == nil {
+		return "", ErrNoSwarmTokenStore
+	}
+
+	cluster, err := store.Get()
+	if err != nil {
+		return "", err
+	}
+
+	ip, err := p.GetDriver().GetIP()
+	if err != nil {
+		return "", err
+	}
+	managerAddr := fmt.Sprintf("%s:%d", ip, swarmManagerPort)
+
+	member, err := isSwarmMember(ctx, p)
+	if err != nil {
+		return "", err
+	}
+
+	if cluster != nil && cluster.ManagerAddr == managerAddr {
+		if !member {
+			return "", fmt.Errorf("The swarm token store records %s as the swarm manager, but the node is no longer in a swarm", managerAddr)
+		}
+		log.Debug("already the elected swarm manager")
+		return "manager", nil
+	}
+
+	if cluster != nil && member {
+		log.Debug("already in the swarm of the elected manager")
+		return "worker", nil
+	}
+
+	if cluster == nil {
+		// a node which initialized its swarm but wasn't elected yet,
+		// like when provisioning failed right after, runs for it again
+		if !member {
+			if _, err := InitSwarmMode(ctx, p, swarmOptions); err != nil {
+				return "", err
+			}
+		}
+
+		own := &SwarmCluster{ManagerAddr: managerAddr}
+		if own.Tokens.Worker, err = joinToken(ctx, p, "worker"); err != nil {
+			return "", err
+		}
+		if own.Tokens.Manager, err = joinToken(ctx, p, "manager"); err != nil {
+			return "", err
+		}
+
+		if cluster, err = store.Elect(own); err != nil {
+			return "", err
+		}
+		if cluster.ManagerAddr == own.ManagerAddr {
+			log.Info("Elected as the swarm manager")
+			if swarmOptions.Autolock {
+				log.Info("Swarm autolock is enabled, run docker swarm unlock-key on the manager and keep the key: it is needed to unlock it after a restart")
+			}
+			return "manager", nil
+		}
+
+		// another node was elected meanwhile, its cluster wins
+		log.Info("Another node was elected as the swarm manager, joining it...")
+		if _, err := p.SSHCommand(ctx, "sudo docker swarm leave --force"); err != nil {
+			return "", err
+		}
+	}
+
+	if err := joinSwarm(ctx, p, cluster); err != nil {
+		return "", err
+	}
+
+	return "worker", nil
+}
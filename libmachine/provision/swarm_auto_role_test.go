@@ -0,0 +1,229 @@
+package provision
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"github.com/docker/machine/libmachine/state"
+	"github.com/docker/machine/libmachine/swarm"
+	"golang.org/x/net/context"
+)
+
+// fakeSwarmTokenStore records its calls. A cluster set in raced is elected
+// in place of the first node asking, as if another node got there first.
+type fakeSwarmTokenStore struct {
+	cluster *SwarmCluster
+	raced   *SwarmCluster
+	elected []*SwarmCluster
+}
+
+func (s *fakeSwarmTokenStore) Get() (*SwarmCluster, error) {
+	return s.cluster, nil
+}
+
+func (s *fakeSwarmTokenStore) Elect(cluster *SwarmCluster) (*SwarmCluster, error) {
+	s.elected = append(s.elected, cluster)
+	if s.cluster == nil {
+		s.cluster = s.raced
+	}
+	if s.cluster == nil {
+		s.cluster = cluster
+	}
+	return s.cluster, nil
+}
+
+func newFakeSwarmNode(ip string) (*DebianProvisioner, *provisiontest.FakeSSHCommander) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo docker swarm join-token -q worker":  "SWMTKN-1-abc-worker\n",
+			"sudo docker swarm join-token -q manager": "SWMTKN-1-abc-manager\n",
+		},
+	}
+	p := NewDebianProvisioner(&fakedriver.Driver{MockState: state.Running, MockIP: ip}).(*DebianProvisioner)
+	p.SSHCommander = commander
+	return p, commander
+}
+
+func TestConfigureSwarmAutoRole(t *testing.T) {
+	store := &fakeSwarmTokenStore{}
+
+	manager, managerCommander := newFakeSwarmNode("10.0.0.1")
+	role, err := configureSwarmAutoRole(context.Background(), manager, swarm.Options{AutoRole: true}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role != "manager" {
+		t.Fatalf("expected the first node to be the manager; received %s", role)
+	}
+
+	expected := []string{
+		"sudo docker info --format '{{.Swarm.LocalNodeState}}'",
+		"sudo docker swarm init --advertise-addr 10.0.0.1",
+		"sudo docker swarm join-token -q worker",
+		"sudo docker swarm join-token -q manager",
+	}
+	if !reflect.DeepEqual(managerCommander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, managerCommander.Commands)
+	}
+
+	worker, workerCommander := newFakeSwarmNode("10.0.0.2")
+	role, err = configureSwarmAutoRole(context.Background(), worker, swarm.Options{AutoRole: true}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role != "worker" {
+		t.Fatalf("expected the second node to be a worker; received %s", role)
+	}
+
+	expected = []string{
+		"sudo docker info --format '{{.Swarm.LocalNodeState}}'",
+		"sudo docker swarm join --token SWMTKN-1-abc-worker 10.0.0.1:2377",
+	}
+	if !reflect.DeepEqual(workerCommander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, workerCommander.Commands)
+	}
+
+	if len(store.elected) != 1 {
+		t.Fatalf("expected a single election; received %v", store.elected)
+	}
+}
+
+func TestConfigureSwarmAutoRoleLostElection(t *testing.T) {
+	store := &fakeSwarmTokenStore{
+		raced: &SwarmCluster{
+			ManagerAddr: "10.0.0.9:2377",
+			Tokens:      SwarmJoinTokens{Worker: "SWMTKN-1-xyz-worker", Manager: "SWMTKN-1-xyz-manager"},
+		},
+	}
+
+	p, commander := newFakeSwarmNode("10.0.0.1")
+	role, err := configureSwarmAutoRole(context.Background(), p, swarm.Options{AutoRole: true}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role != "worker" {
+		t.Fatalf("expected the node losing the election to be a worker; received %s", role)
+	}
+
+	expected := []string{
+		"sudo docker info --format '{{.Swarm.LocalNodeState}}'",
+		"sudo docker swarm init --advertise-addr 10.0.0.1",
+		"sudo docker swarm join-token -q worker",
+		"sudo docker swarm join-token -q manager",
+		"sudo docker swarm leave --force",
+		"sudo docker swarm join --token SWMTKN-1-xyz-worker 10.0.0.9:2377",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestConfigureSwarmAutoRoleAgain(t *testing.T) {
+	store := &fakeSwarmTokenStore{
+		cluster: &SwarmCluster{
+			ManagerAddr: "10.0.0.1:2377",
+			Tokens:      SwarmJoinTokens{Worker: "SWMTKN-1-abc-worker", Manager: "SWMTKN-1-abc-manager"},
+		},
+	}
+
+	for ip, expectedRole := range map[string]string{"10.0.0.1": "manager", "10.0.0.2": "worker"} {
+		p, commander := newFakeSwarmNode(ip)
+		commander.Responses["sudo docker info --format '{{.Swarm.LocalNodeState}}'"] = "active\n"
+
+		role, err := configureSwarmAutoRole(context.Background(), p, swarm.Options{AutoRole: true}, store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if role != expectedRole {
+			t.Fatalf("expected %s to stay a %s; received %s", ip, expectedRole, role)
+		}
+
+		expected := []string{"sudo docker info --format '{{.Swarm.LocalNodeState}}'"}
+		if !reflect.DeepEqual(commander.Commands, expected) {
+			t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+		}
+	}
+
+	if len(store.elected) != 0 {
+		t.Fatalf("expected no election; received %v", store.elected)
+	}
+}
+
+func TestConfigureSwarmAutoRoleManagerLeft(t *testing.T) {
+	store := &fakeSwarmTokenStore{
+		cluster: &SwarmCluster{ManagerAddr: "10.0.0.1:2377"},
+	}
+
+	p, _ := newFakeSwarmNode("10.0.0.1")
+	if _, err := configureSwarmAutoRole(context.Background(), p, swarm.Options{AutoRole: true}, store); err == nil {
+		t.Fatal("expected an error for a recorded manager which left its swarm")
+	}
+}
+
+func TestConfigureSwarmAutoRoleNoStore(t *testing.T) {
+	p, commander := newFakeSwarmNode("10.0.0.1")
+
+	if _, err := configureSwarmAutoRole(context.Background(), p, swarm.Options{AutoRole: true}, nil); err != ErrNoSwarmTokenStore {
+		t.Fatalf("expected %s; received %v", ErrNoSwarmTokenStore, err)
+	}
+	if len(commander.Commands) != 0 {
+		t.Fatalf("expected no commands; received %v", commander.Commands)
+	}
+}
+
+func TestMemorySwarmTokenStore(t *testing.T) {
+	store := NewMemorySwarmTokenStore()
+
+	first := &SwarmCluster{ManagerAddr: "10.0.0.1:2377"}
+	second := &SwarmCluster{ManagerAddr: "10.0.0.2:2377"}
+
+	if elected, _ := store.Elect(first); elected != first {
+		t.Fatalf("expected the first cluster to be elected; received %+v", elected)
+	}
+	if elected, _ := store.Elect(second); elected != first {
+		t.Fatalf("expected the first cluster to stay elected; received %+v", elected)
+	}
+	if cluster, _ := store.Get(); cluster != first {
+		t.Fatalf("expected the first cluster; received %+v", cluster)
+	}
+}
+
+func TestFileSwarmTokenStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "swarm-cluster.json")
+	first := &SwarmCluster{
+		ManagerAddr: "10.0.0.1:2377",
+		Tokens:      SwarmJoinTokens{Worker: "SWMTKN-1-abc-worker", Manager: "SWMTKN-1-abc-manager"},
+	}
+
+	if cluster, err := NewFileSwarmTokenStore(path).Get(); err != nil || cluster != nil {
+		t.Fatalf("expected no cluster; received %+v, %v", cluster, err)
+	}
+	if elected, err := NewFileSwarmTokenStore(path).Elect(first); err != nil || !reflect.DeepEqual(elected, first) {
+		t.Fatalf("expected the first cluster to be elected; received %+v, %v", elected, err)
+	}
+	if elected, err := NewFileSwarmTokenStore(path).Elect(&SwarmCluster{ManagerAddr: "10.0.0.2:2377"}); err != nil || !reflect.DeepEqual(elected, first) {
+		t.Fatalf("expected the first cluster to stay elected; received %+v, %v", elected, err)
+	}
+	if cluster, err := NewFileSwarmTokenStore(path).Get(); err != nil || !reflect.DeepEqual(cluster, first) {
+		t.Fatalf("expected the first cluster; received %+v, %v", cluster, err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Fatalf("expected the store to be only readable by its owner; received %v", mode)
+	}
+}
@@ -0,0 +1,327 @@
+package provision
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/swarm"
+	"golang.org/x/net/context"
+)
+
+// SwarmJoinTokens holds the tokens nodes use to join a swarm mode cluster.
+type SwarmJoinTokens struct {
+	Worker  string
+	Manager string
+}
+
+var nodeLabelRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*(=[a-zA-Z0-9._:/-]*)?$`)
+
+func isSwarmManager(ctx context.Context, p Provisioner) (bool, error) {
+	out, err := p.SSHCommand(ctx, "sudo docker info --format '{{.Swarm.ControlAvailable}}'")
+	if err != nil {
+		return false, err
+	}
+
+	return strings.TrimSpace(out) == "true", nil
+}
+
+func rotateJoinToken(ctx context.Context, p Provisioner, role string) (string, error) {
+	out, err := p.SSHCommand(ctx, fmt.Sprintf("sudo docker swarm join-token --rotate -q %s", role))
+	if err != nil {
+		return "", err
+	}
+
+	token := strings.TrimSpace(out)
+	if !strings.HasPrefix(token, "SWMTKN-") {
+		return "", fmt.Errorf("Unexpected %s join token: %q", role, token)
+	}
+
+	return token, nil
+}
+
+// RotateJoinTokens invalidates the current worker and manager join tokens
+// of a swarm mode manager and returns the new ones.
+func RotateJoinTokens(ctx context.Context, p Provisioner) (*SwarmJoinTokens, error) {
+	manager, err := isSwarmManager(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if !manager {
+		return nil, ErrNotSwarmManager
+	}
+
+	tokens := &SwarmJoinTokens{}
+
+	if tokens.Worker, err = rotateJoinToken(ctx, p, "worker"); err != nil {
+		return nil, err
+	}
+
+	if tokens.Manager, err = rotateJoinToken(ctx, p, "manager"); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func nodeUpdateFlags(swarmOptions swarm.Options) ([]string, error) {
+	flags := []string{}
+
+	for _, label := range swarmOptions.NodeLabels {
+		if !nodeLabelRegexp.MatchString(label) {
+			return nil, fmt.Errorf("Invalid node label %q, expected key=value", label)
+		}
+		flags = append(flags, fmt.Sprintf("--label-add %s", label))
+	}
+
+	switch swarmOptions.NodeAvailability {
+	case "":
+	case "active", "pause", "drain":
+		flags = append(flags, fmt.Sprintf("--availability %s", swarmOptions.NodeAvailability))
+	default:
+		return nil, fmt.Errorf("Invalid node availability %q, expected active, pause or drain", swarmOptions.NodeAvailability)
+	}
+
+	return flags, nil
+}
+
+// UpdateSwarmNode applies the node labels and availability of swarmOptions
+// to node, which has already joined the swarm. Only a manager can update
+// nodes, so the commands run on the manager p.
+func UpdateSwarmNode(ctx context.Context, p Provisioner, node string, swarmOptions swarm.Options) error {
+	flags, err := nodeUpdateFlags(swarmOptions)
+	if err != nil {
+		return err
+	}
+	if len(flags) == 0 {
+		return nil
+	}
+
+	manager, err := isSwarmManager(ctx, p)
+	if err != nil {
+		return err
+	}
+	if !manager {
+		return ErrNotSwarmManager
+	}
+
+	if _, err := p.SSHCommand(ctx, fmt.Sprintf("sudo docker node update %s %s", strings.Join(flags, " "), node)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ApplySwarmNodeLabels sets the labels of the manifest, keyed by machine
+// name, on the nodes which have joined the swarm mode cluster managed by p.
+// Nodes joining later are labelled by running it again.
+func ApplySwarmNodeLabels(ctx context.Context, p Provisioner, manifest map[string][]string) error {
+	manager, err := isSwarmManager(ctx, p)
+	if err != nil {
+		return err
+	}
+	if !manager {
+		return ErrNotSwarmManager
+	}
+
+	out, err := p.SSHCommand(ctx, "sudo docker node ls --format '{{.ID}} {{.Hostname}}'")
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || len(manifest[fields[1]]) == 0 {
+			continue
+		}
+
+		flags, err := nodeUpdateFlags(swarm.Options{NodeLabels: manifest[fields[1]]})
+		if err != nil {
+			return err
+		}
+
+		if _, err := p.SSHCommand(ctx, fmt.Sprintf("sudo docker node update %s %s", strings.Join(flags, " "), fields[0])); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func swarmInitFlags(swarmOptions swarm.Options) ([]string, error) {
+	flags := []string{}
+
+	if swarmOptions.DispatcherHeartbeat != "" {
+		heartbeat, err := time.ParseDuration(swarmOptions.DispatcherHeartbeat)
+		if err != nil || heartbeat <= 0 {
+			return nil, fmt.Errorf("Invalid dispatcher heartbeat %q, expected a duration like 10s", swarmOptions.DispatcherHeartbeat)
+		}
+		flags = append(flags, fmt.Sprintf("--dispatcher-heartbeat %s", heartbeat))
+	}
+
+	if swarmOptions.SnapshotInterval < 0 {
+		return nil, fmt.Errorf("Invalid snapshot interval %d, it must not be negative", swarmOptions.SnapshotInterval)
+	}
+	if swarmOptions.SnapshotInterval > 0 {
+		flags = append(flags, fmt.Sprintf("--snapshot-interval %d", swarmOptions.SnapshotInterval))
+	}
+
+	if swarmOptions.MaxSnapshots < 0 {
+		return nil, fmt.Errorf("Invalid number of snapshots %d, it must not be negative", swarmOptions.MaxSnapshots)
+	}
+	if swarmOptions.MaxSnapshots > 0 {
+		flags = append(flags, fmt.Sprintf("--max-snapshots %d", swarmOptions.MaxSnapshots))
+	}
+
+	if swarmOptions.Autolock {
+		flags = append(flags, "--autolock")
+	}
+
+	return flags, nil
+}
+
+func parseUnlockKey(out string) (string, error) {
+	key := strings.TrimSpace(out)
+	if !strings.HasPrefix(key, "SWMKEY-") {
+		return "", fmt.Errorf("Unexpected swarm unlock key: %q", key)
+	}
+
+	return key, nil
+}
+
+func swarmUnlockKey(ctx context.Context, p Provisioner) (string, error) {
+	out, err := p.SSHCommand(ctx, "sudo docker swarm unlock-key -q")
+	if err != nil {
+		return "", err
+	}
+
+	return parseUnlockKey(out)
+}
+
+// InitSwarmMode creates a new swarm mode cluster with p as its first
+// manager, advertised on the machine IP and tuned by swarmOptions. With
+// Autolock, it returns the key the managers need to be unlocked after a
+// restart.
+func InitSwarmMode(ctx context.Context, p Provisioner, swarmOptions swarm.Options) (string, error) {
+	flags, err := swarmInitFlags(swarmOptions)
+	if err != nil {
+		return "", err
+	}
+
+	ip, err := p.GetDriver().GetIP()
+	if err != nil {
+		return "", err
+	}
+
+	cmd := append([]string{"sudo docker swarm init --advertise-addr", ip}, flags...)
+	if _, err := p.SSHCommand(withCommandTimeout(ctx, installCommandTimeout), strings.Join(cmd, " ")); err != nil {
+		return "", err
+	}
+
+	if !swarmOptions.Autolock {
+		return "", nil
+	}
+
+	return swarmUnlockKey(ctx, p)
+}
+
+// EnableSwarmAutolock turns on autolock on the existing swarm mode cluster
+// managed by p and returns the unlock key. Every manager restarted from
+// then on needs the key to rejoin the cluster.
+func EnableSwarmAutolock(ctx context.Context, p Provisioner) (string, error) {
+	manager, err := isSwarmManager(ctx, p)
+	if err != nil {
+		return "", err
+	}
+	if !manager {
+		return "", ErrNotSwarmManager
+	}
+
+	if _, err := p.SSHCommand(ctx, "sudo docker swarm update --autolock=true"); err != nil {
+		return "", err
+	}
+
+	return swarmUnlockKey(ctx, p)
+}
+
+const swarmReadyInterval = 2 * time.Second
+
+// swarmNodeReady reports whether the node is part of an active swarm and,
+// on a manager, whether the managers consider it ready.
+func swarmNodeReady(p Provisioner) func(context.Context) bool {
+	return func(ctx context.Context) bool {
+		out, err := p.SSHCommand(ctx, "sudo docker info --format '{{.Swarm.LocalNodeState}} {{.Swarm.ControlAvailable}}'")
+		if err != nil {
+			return false
+		}
+
+		fields := strings.Fields(out)
+		if len(fields) != 2 || fields[0] != "active" {
+			return false
+		}
+		if fields[1] != "true" {
+			return true
+		}
+
+		out, err = p.SSHCommand(ctx, "sudo docker node inspect self --format '{{.Status.State}}'")
+		if err != nil {
+			return false
+		}
+
+		return strings.TrimSpace(out) == "ready"
+	}
+}
+
+// WaitForSwarmReady polls the node until it is a usable member of the
+// swarm, so orchestration doesn't start on a node still joining. It gives
+// up after timeout.
+func WaitForSwarmReady(ctx context.Context, p Provisioner, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return waitForSwarmReady(ctx, p, int(timeout/swarmReadyInterval)+1, swarmReadyInterval)
+}
+
+func waitForSwarmReady(ctx context.Context, p Provisioner, attempts int, interval time.Duration) error {
+	if err := waitForSpecific(ctx, swarmNodeReady(p), attempts, interval); err != nil {
+		return fmt.Errorf("Swarm node not ready: %s", err)
+	}
+
+	return nil
+}
+
+func swarmNodeState(ctx context.Context, p Provisioner) (string, error) {
+	out, err := p.SSHCommand(ctx, "sudo docker info --format '{{.Swarm.LocalNodeState}}'")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(out), nil
+}
+
+// isSwarmMember reports whether the node is part of a swarm mode cluster,
+// to know if it has to get back in it after the daemon restarts.
+func isSwarmMember(ctx context.Context, p Provisioner) (bool, error) {
+	state, err := swarmNodeState(ctx, p)
+	if err != nil {
+		return false, err
+	}
+
+	return state == "active" || state == "locked", nil
+}
+
+// waitForSwarmRejoin waits for the node to be back in its swarm mode
+// cluster after a daemon restart. A locked manager never gets back without
+// its unlock key, so it fails right away with ErrSwarmLocked.
+func waitForSwarmRejoin(ctx context.Context, p Provisioner, attempts int, interval time.Duration) error {
+	if state, err := swarmNodeState(ctx, p); err == nil && state == "locked" {
+		return ErrSwarmLocked
+	}
+
+	if err := waitForSpecific(ctx, swarmNodeReady(p), attempts, interval); err != nil {
+		return fmt.Errorf("Swarm membership not restored after the daemon restart: %s", err)
+	}
+
+	return nil
+}
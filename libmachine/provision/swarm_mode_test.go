@@ -0,0 +1,471 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"github.com/docker/machine/libmachine/state"
+	"github.com/docker/machine/libmachine/swarm"
+	"golang.org/x/net/context"
+)
+
+func newFakeDebianProvisioner(commander SSHCommander) *DebianProvisioner {
+	p := NewDebianProvisioner(&fakedriver.Driver{}).(*DebianProvisioner)
+	p.SSHCommander = commander
+	return p
+}
+
+func TestRotateJoinTokens(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo docker info --format '{{.Swarm.ControlAvailable}}'": "true\n",
+			"sudo docker swarm join-token --rotate -q worker":         "SWMTKN-1-abc-worker\n",
+			"sudo docker swarm join-token --rotate -q manager":        "SWMTKN-1-abc-manager\n",
+		},
+	}
+
+	tokens, err := RotateJoinTokens(context.Background(), newFakeDebianProvisioner(commander))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedTokens := &SwarmJoinTokens{
+		Worker:  "SWMTKN-1-abc-worker",
+		Manager: "SWMTKN-1-abc-manager",
+	}
+	if !reflect.DeepEqual(tokens, expectedTokens) {
+		t.Fatalf("expected tokens %+v; received %+v", expectedTokens, tokens)
+	}
+
+	expectedCommands := []string{
+		"sudo docker info --format '{{.Swarm.ControlAvailable}}'",
+		"sudo docker swarm join-token --rotate -q worker",
+		"sudo docker swarm join-token --rotate -q manager",
+	}
+	if !reflect.DeepEqual(commander.Commands, expectedCommands) {
+		t.Fatalf("expected commands %v; received %v", expectedCommands, commander.Commands)
+	}
+}
+
+func TestRotateJoinTokensNotManager(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo docker info --format '{{.Swarm.ControlAvailable}}'": "false\n",
+		},
+	}
+
+	if _, err := RotateJoinTokens(context.Background(), newFakeDebianProvisioner(commander)); err != ErrNotSwarmManager {
+		t.Fatalf("expected %s; received %v", ErrNotSwarmManager, err)
+	}
+	if len(commander.Commands) != 1 {
+		t.Fatalf("expected no token rotation on a non manager; received %v", commander.Commands)
+	}
+}
+
+func TestRotateJoinTokensUnexpectedOutput(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo docker info --format '{{.Swarm.ControlAvailable}}'": "true\n",
+			"sudo docker swarm join-token --rotate -q worker":         "Error response from daemon: This node is not a swarm manager.",
+		},
+	}
+
+	if _, err := RotateJoinTokens(context.Background(), newFakeDebianProvisioner(commander)); err == nil {
+		t.Fatal("expected an error for unexpected join-token output")
+	}
+}
+
+func TestUpdateSwarmNode(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo docker info --format '{{.Swarm.ControlAvailable}}'": "true\n",
+		},
+	}
+	swarmOptions := swarm.Options{
+		NodeLabels:       []string{"rpi=true", "zone=eu-west"},
+		NodeAvailability: "active",
+	}
+
+	if err := UpdateSwarmNode(context.Background(), newFakeDebianProvisioner(commander), "worker1", swarmOptions); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo docker info --format '{{.Swarm.ControlAvailable}}'",
+		"sudo docker node update --label-add rpi=true --label-add zone=eu-west --availability active worker1",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestUpdateSwarmNodeNothingToDo(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := UpdateSwarmNode(context.Background(), newFakeDebianProvisioner(commander), "worker1", swarm.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(commander.Commands) != 0 {
+		t.Fatalf("expected no commands; received %v", commander.Commands)
+	}
+}
+
+func TestUpdateSwarmNodeNotManager(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo docker info --format '{{.Swarm.ControlAvailable}}'": "false\n",
+		},
+	}
+	swarmOptions := swarm.Options{NodeLabels: []string{"rpi=true"}}
+
+	if err := UpdateSwarmNode(context.Background(), newFakeDebianProvisioner(commander), "worker1", swarmOptions); err != ErrNotSwarmManager {
+		t.Fatalf("expected %s; received %v", ErrNotSwarmManager, err)
+	}
+}
+
+func TestUpdateSwarmNodeInvalid(t *testing.T) {
+	for _, swarmOptions := range []swarm.Options{
+		{NodeLabels: []string{"rpi = true"}},
+		{NodeLabels: []string{"=true"}},
+		{NodeLabels: []string{"rpi=true;reboot"}},
+		{NodeAvailability: "paused"},
+	} {
+		commander := &provisiontest.FakeSSHCommander{}
+
+		if err := UpdateSwarmNode(context.Background(), newFakeDebianProvisioner(commander), "worker1", swarmOptions); err == nil {
+			t.Fatalf("expected an error for %+v", swarmOptions)
+		}
+		if len(commander.Commands) != 0 {
+			t.Fatalf("expected no commands for %+v; received %v", swarmOptions, commander.Commands)
+		}
+	}
+}
+
+func TestInitSwarmMode(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+	p := NewDebianProvisioner(&fakedriver.Driver{MockState: state.Running, MockIP: "1.2.3.4"}).(*DebianProvisioner)
+	p.SSHCommander = commander
+	swarmOptions := swarm.Options{
+		DispatcherHeartbeat: "20s",
+		SnapshotInterval:    5000,
+		MaxSnapshots:        2,
+	}
+
+	key, err := InitSwarmMode(context.Background(), p, swarmOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "" {
+		t.Fatalf("expected no unlock key; received %q", key)
+	}
+
+	expected := []string{
+		"sudo docker swarm init --advertise-addr 1.2.3.4 --dispatcher-heartbeat 20s --snapshot-interval 5000 --max-snapshots 2",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestInitSwarmModeInvalid(t *testing.T) {
+	for _, swarmOptions := range []swarm.Options{
+		{DispatcherHeartbeat: "often"},
+		{DispatcherHeartbeat: "-5s"},
+		{SnapshotInterval: -1},
+		{MaxSnapshots: -1},
+	} {
+		commander := &provisiontest.FakeSSHCommander{}
+		p := NewDebianProvisioner(&fakedriver.Driver{MockState: state.Running, MockIP: "1.2.3.4"}).(*DebianProvisioner)
+		p.SSHCommander = commander
+
+		if _, err := InitSwarmMode(context.Background(), p, swarmOptions); err == nil {
+			t.Fatalf("expected an error for %+v", swarmOptions)
+		}
+		if len(commander.Commands) != 0 {
+			t.Fatalf("expected no commands for %+v; received %v", swarmOptions, commander.Commands)
+		}
+	}
+}
+
+func TestInitSwarmModeAutolock(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo docker swarm unlock-key -q": "SWMKEY-1-abcdef\n",
+		},
+	}
+	p := NewDebianProvisioner(&fakedriver.Driver{MockState: state.Running, MockIP: "1.2.3.4"}).(*DebianProvisioner)
+	p.SSHCommander = commander
+
+	key, err := InitSwarmMode(context.Background(), p, swarm.Options{Autolock: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "SWMKEY-1-abcdef" {
+		t.Fatalf("expected unlock key SWMKEY-1-abcdef; received %q", key)
+	}
+
+	expected := []string{
+		"sudo docker swarm init --advertise-addr 1.2.3.4 --autolock",
+		"sudo docker swarm unlock-key -q",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestEnableSwarmAutolock(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo docker info --format '{{.Swarm.ControlAvailable}}'": "true\n",
+			"sudo docker swarm unlock-key -q":                         "SWMKEY-1-abcdef\n",
+		},
+	}
+	p := NewDebianProvisioner(&fakedriver.Driver{MockState: state.Running}).(*DebianProvisioner)
+	p.SSHCommander = commander
+
+	key, err := EnableSwarmAutolock(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "SWMKEY-1-abcdef" {
+		t.Fatalf("expected unlock key SWMKEY-1-abcdef; received %q", key)
+	}
+
+	expected := []string{
+		"sudo docker info --format '{{.Swarm.ControlAvailable}}'",
+		"sudo docker swarm update --autolock=true",
+		"sudo docker swarm unlock-key -q",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestEnableSwarmAutolockNotManager(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo docker info --format '{{.Swarm.ControlAvailable}}'": "false\n",
+		},
+	}
+	p := NewDebianProvisioner(&fakedriver.Driver{MockState: state.Running}).(*DebianProvisioner)
+	p.SSHCommander = commander
+
+	if _, err := EnableSwarmAutolock(context.Background(), p); err != ErrNotSwarmManager {
+		t.Fatalf("expected %v; received %v", ErrNotSwarmManager, err)
+	}
+}
+
+func TestParseUnlockKey(t *testing.T) {
+	key, err := parseUnlockKey("  SWMKEY-1-abcdef\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "SWMKEY-1-abcdef" {
+		t.Fatalf("expected unlock key SWMKEY-1-abcdef; received %q", key)
+	}
+
+	for _, out := range []string{"", "Swarm is encrypted and locked.", "SWMTKN-1-abcdef"} {
+		if _, err := parseUnlockKey(out); err == nil {
+			t.Fatalf("expected an error for %q", out)
+		}
+	}
+}
+
+// sequenceSSHCommander answers each command with the next of its queued
+// responses, the last one being repeated.
+type sequenceSSHCommander struct {
+	responses map[string][]string
+	commands  []string
+}
+
+func (c *sequenceSSHCommander) SSHCommand(ctx context.Context, args string) (string, error) {
+	c.commands = append(c.commands, args)
+
+	queue := c.responses[args]
+	if len(queue) == 0 {
+		return "", nil
+	}
+	if len(queue) > 1 {
+		c.responses[args] = queue[1:]
+	}
+
+	return queue[0], nil
+}
+
+func TestWaitForSwarmReadyWorker(t *testing.T) {
+	commander := &sequenceSSHCommander{
+		responses: map[string][]string{
+			"sudo docker info --format '{{.Swarm.LocalNodeState}} {{.Swarm.ControlAvailable}}'": {"pending false\n", "pending false\n", "active false\n"},
+		},
+	}
+
+	if err := waitForSwarmReady(context.Background(), newFakeDebianProvisioner(commander), 5, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(commander.commands) != 3 {
+		t.Fatalf("expected to poll until the node is active; received %v", commander.commands)
+	}
+}
+
+func TestWaitForSwarmReadyManager(t *testing.T) {
+	commander := &sequenceSSHCommander{
+		responses: map[string][]string{
+			"sudo docker info --format '{{.Swarm.LocalNodeState}} {{.Swarm.ControlAvailable}}'": {"active true\n"},
+			"sudo docker node inspect self --format '{{.Status.State}}'":                        {"unknown\n", "ready\n"},
+		},
+	}
+
+	if err := waitForSwarmReady(context.Background(), newFakeDebianProvisioner(commander), 5, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo docker info --format '{{.Swarm.LocalNodeState}} {{.Swarm.ControlAvailable}}'",
+		"sudo docker node inspect self --format '{{.Status.State}}'",
+		"sudo docker info --format '{{.Swarm.LocalNodeState}} {{.Swarm.ControlAvailable}}'",
+		"sudo docker node inspect self --format '{{.Status.State}}'",
+	}
+	if !reflect.DeepEqual(commander.commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.commands)
+	}
+}
+
+func TestWaitForSwarmReadyTimeout(t *testing.T) {
+	commander := &sequenceSSHCommander{
+		responses: map[string][]string{
+			"sudo docker info --format '{{.Swarm.LocalNodeState}} {{.Swarm.ControlAvailable}}'": {"inactive false\n"},
+		},
+	}
+
+	if err := waitForSwarmReady(context.Background(), newFakeDebianProvisioner(commander), 3, time.Millisecond); err == nil {
+		t.Fatal("expected an error for a node which never joins")
+	}
+
+	if len(commander.commands) != 3 {
+		t.Fatalf("expected three attempts; received %v", commander.commands)
+	}
+}
+
+func TestIsSwarmMember(t *testing.T) {
+	for state, expected := range map[string]bool{
+		"active\n":   true,
+		"locked\n":   true,
+		"inactive\n": false,
+		"pending\n":  false,
+	} {
+		commander := &provisiontest.FakeSSHCommander{
+			Responses: map[string]string{
+				"sudo docker info --format '{{.Swarm.LocalNodeState}}'": state,
+			},
+		}
+
+		member, err := isSwarmMember(context.Background(), newFakeDebianProvisioner(commander))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if member != expected {
+			t.Fatalf("expected member %t for %q; received %t", expected, state, member)
+		}
+	}
+}
+
+func TestWaitForSwarmRejoin(t *testing.T) {
+	commander := &sequenceSSHCommander{
+		responses: map[string][]string{
+			"sudo docker info --format '{{.Swarm.LocalNodeState}}'":                             {"pending\n"},
+			"sudo docker info --format '{{.Swarm.LocalNodeState}} {{.Swarm.ControlAvailable}}'": {"inactive false\n", "pending false\n", "active false\n"},
+		},
+	}
+
+	if err := waitForSwarmRejoin(context.Background(), newFakeDebianProvisioner(commander), 5, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(commander.commands) != 4 {
+		t.Fatalf("expected to poll until the node is active again; received %v", commander.commands)
+	}
+}
+
+func TestWaitForSwarmRejoinTimeout(t *testing.T) {
+	commander := &sequenceSSHCommander{
+		responses: map[string][]string{
+			"sudo docker info --format '{{.Swarm.LocalNodeState}} {{.Swarm.ControlAvailable}}'": {"inactive false\n"},
+		},
+	}
+
+	if err := waitForSwarmRejoin(context.Background(), newFakeDebianProvisioner(commander), 3, time.Millisecond); err == nil {
+		t.Fatal("expected an error for a node which doesn't rejoin")
+	}
+}
+
+func TestWaitForSwarmRejoinLocked(t *testing.T) {
+	commander := &sequenceSSHCommander{
+		responses: map[string][]string{
+			"sudo docker info --format '{{.Swarm.LocalNodeState}}'": {"locked\n"},
+		},
+	}
+
+	if err := waitForSwarmRejoin(context.Background(), newFakeDebianProvisioner(commander), 3, time.Millisecond); err != ErrSwarmLocked {
+		t.Fatalf("expected %v; received %v", ErrSwarmLocked, err)
+	}
+	if len(commander.commands) != 1 {
+		t.Fatalf("expected no polling of a locked manager; received %v", commander.commands)
+	}
+}
+
+func TestApplySwarmNodeLabels(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo docker info --format '{{.Swarm.ControlAvailable}}'": "true\n",
+			"sudo docker node ls --format '{{.ID}} {{.Hostname}}'":    "abc123 rpi-1\ndef456 rpi-2\nghi789 rpi-3\n",
+		},
+	}
+	manifest := map[string][]string{
+		"rpi-1":   {"role=storage", "zone=eu-west"},
+		"rpi-3":   {"hardware=pi4"},
+		"missing": {"zone=us-east"},
+	}
+
+	if err := ApplySwarmNodeLabels(context.Background(), newFakeDebianProvisioner(commander), manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo docker info --format '{{.Swarm.ControlAvailable}}'",
+		"sudo docker node ls --format '{{.ID}} {{.Hostname}}'",
+		"sudo docker node update --label-add role=storage --label-add zone=eu-west abc123",
+		"sudo docker node update --label-add hardware=pi4 ghi789",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestApplySwarmNodeLabelsInvalid(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo docker info --format '{{.Swarm.ControlAvailable}}'": "true\n",
+			"sudo docker node ls --format '{{.ID}} {{.Hostname}}'":    "abc123 rpi-1\n",
+		},
+	}
+
+	if err := ApplySwarmNodeLabels(context.Background(), newFakeDebianProvisioner(commander), map[string][]string{"rpi-1": {"zone eu"}}); err == nil {
+		t.Fatal("expected an error for an invalid label")
+	}
+}
+
+func TestApplySwarmNodeLabelsNotManager(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"sudo docker info --format '{{.Swarm.ControlAvailable}}'": "false\n",
+		},
+	}
+
+	if err := ApplySwarmNodeLabels(context.Background(), newFakeDebianProvisioner(commander), map[string][]string{"rpi-1": {"zone=eu"}}); err != ErrNotSwarmManager {
+		t.Fatalf("expected %s; received %v", ErrNotSwarmManager, err)
+	}
+}
@@ -0,0 +1,101 @@
+package provision
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/docker/machine/libmachine/engine"
+	"golang.org/x/net/context"
+)
+
+const sysctlConfPath = "/etc/sysctl.d/99-docker-machine.conf"
+
+var (
+	reSysctlKey   = regexp.MustCompile(`^[a-z0-9_]+([./][a-zA-Z0-9_-]+)+$`)
+	reSysctlValue = regexp.MustCompile(`^[a-zA-Z0-9_.:,/ -]+$`)
+)
+
+// sysctlConf renders the sysctls as a sysctl.d file, sorted by key so the
+// file is stable across runs.
+func sysctlConf(sysctls map[string]string) (string, error) {
+	keys := []string{}
+	for key, value := range sysctls {
+		if !reSysctlKey.MatchString(key) {
+			return "", fmt.Errorf("Invalid sysctl key %q, expected a dotted name like net.core.somaxconn", key)
+		}
+		if !reSysctlValue.MatchString(value) {
+			return "", fmt.Errorf("Invalid value %q for sysctl %s", value, key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lines := []string{}
+	for _, key := range keys {
+		lines = append(lines, fmt.Sprintf("%s = %s\n", key, sysctls[key]))
+	}
+
+	return strings.Join(lines, ""), nil
+}
+
+// applySysctls sets the host kernel parameters now and on every boot.
+// Containers inherit the namespaced ones from the host defaults.
+func applySysctls(ctx context.Context, p SSHCommander, sysctls map[string]string) error {
+	conf, err := sysctlConf(sysctls)
+	if err != nil {
+		return err
+	}
+
+	commands := []string{
+		fmt.Sprintf("printf '%%s' '%s' | sudo tee %s", conf, sysctlConfPath),
+		"sudo sysctl --system",
+	}
+
+	for _, cmd := range commands {
+		if _, err := p.SSHCommand(ctx, cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const ipForwardConfPath = "/etc/sysctl.d/98-docker-machine-ip-forward.conf"
+
+// ipForwardNeeded tells whether IPv4 forwarding must be enabled for the
+// engine options: it is left alone when the daemon is told not to forward,
+// or when the sysctls set it explicitly.
+func ipForwardNeeded(engineOptions engine.Options) bool {
+	if _, ok := engineOptions.Sysctls["net.ipv4.ip_forward"]; ok {
+		return false
+	}
+
+	for _, flag := range engineOptions.ArbitraryFlags {
+		if flag == "ip-forward=false" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// enableIPForward turns on IPv4 forwarding, without which containers on
+// the default bridge have no network, now and on every boot. Hardened
+// images ship with it off, and the daemon only turns it on when it starts,
+// so a later sysctl reload would turn it off again.
+func enableIPForward(ctx context.Context, p SSHCommander) error {
+	commands := []string{
+		fmt.Sprintf("printf '%%s\\n' 'net.ipv4.ip_forward = 1' | sudo tee %s", ipForwardConfPath),
+		fmt.Sprintf("sudo sysctl -p %s", ipForwardConfPath),
+	}
+
+	for _, cmd := range commands {
+		if _, err := p.SSHCommand(ctx, cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func TestApplySysctls(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+	sysctls := map[string]string{
+		"vm.swappiness":                "10",
+		"net.core.somaxconn":           "1024",
+		"net.ipv4.ip_local_port_range": "1024 65000",
+	}
+
+	if err := applySysctls(context.Background(), commander, sysctls); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"printf '%s' 'net.core.somaxconn = 1024\nnet.ipv4.ip_local_port_range = 1024 65000\nvm.swappiness = 10\n' | sudo tee /etc/sysctl.d/99-docker-machine.conf",
+		"sudo sysctl --system",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestApplySysctlsInvalid(t *testing.T) {
+	for _, sysctls := range []map[string]string{
+		{"swappiness": "10"},
+		{"net.core.somaxconn ": "1024"},
+		{"Net.core.somaxconn": "1024"},
+		{"net.core.somaxconn": "1024'; reboot; '"},
+		{"net.core.somaxconn": ""},
+	} {
+		commander := &provisiontest.FakeSSHCommander{}
+
+		if err := applySysctls(context.Background(), commander, sysctls); err == nil {
+			t.Fatalf("expected an error for %v", sysctls)
+		}
+		if len(commander.Commands) != 0 {
+			t.Fatalf("expected no commands for %v; received %v", sysctls, commander.Commands)
+		}
+	}
+}
+
+func TestEnableIPForward(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := enableIPForward(context.Background(), commander); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"printf '%s\\n' 'net.ipv4.ip_forward = 1' | sudo tee /etc/sysctl.d/98-docker-machine-ip-forward.conf",
+		"sudo sysctl -p /etc/sysctl.d/98-docker-machine-ip-forward.conf",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestIPForwardNeeded(t *testing.T) {
+	if !ipForwardNeeded(engine.Options{}) {
+		t.Fatal("expected IP forwarding to be enabled by default")
+	}
+
+	if ipForwardNeeded(engine.Options{ArbitraryFlags: []string{"ip-forward=false"}}) {
+		t.Fatal("expected IP forwarding to be left alone with ip-forward=false")
+	}
+
+	if ipForwardNeeded(engine.Options{Sysctls: map[string]string{"net.ipv4.ip_forward": "0"}}) {
+		t.Fatal("expected IP forwarding to be left to the sysctls setting it")
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/docker/machine/libmachine/drivers"
 	"github.com/docker/machine/libmachine/provision/serviceaction"
+	"golang.org/x/net/context"
 )
 
 type SystemdProvisioner struct {
@@ -41,9 +42,10 @@ func (p *SystemdProvisioner) GenerateDockerOptions(dockerPort int) (*DockerOptio
 	p.EngineOptions.Labels = append(p.EngineOptions.Labels, driverNameLabel)
 
 	engineConfigTmpl := `[Service]
-ExecStart=/usr/bin/docker -d -H tcp://0.0.0.0:{{.DockerPort}} -H unix:///var/run/docker.sock --storage-driver {{.EngineOptions.StorageDriver}} --tlsverify --tlscacert {{.AuthOptions.CaCertRemotePath}} --tlscert {{.AuthOptions.ServerCertRemotePath}} --tlskey {{.AuthOptions.ServerKeyRemotePath}} {{ range .EngineOptions.Labels }}--label {{.}} {{ end }}{{ range .EngineOptions.InsecureRegistry }}--insecure-registry {{.}} {{ end }}{{ range .EngineOptions.RegistryMirror }}--registry-mirror {{.}} {{ end }}{{ range .EngineOptions.ArbitraryFlags }}--{{.}} {{ end }}
+ExecStart=/usr/bin/docker -d {{ if not .EngineOptions.DisableTCP }}-H tcp://0.0.0.0:{{.DockerPort}} {{ end }}-H unix:///var/run/docker.sock --storage-driver {{.EngineOptions.StorageDriver}} {{ if not .EngineOptions.DisableTCP }}--tlsverify --tlscacert {{.AuthOptions.CaCertRemotePath}} --tlscert {{.AuthOptions.ServerCertRemotePath}} --tlskey {{.AuthOptions.ServerKeyRemotePath}} {{ end }}{{ range .EngineOptions.Labels }}--label {{.}} {{ end }}{{ range .EngineOptions.InsecureRegistry }}--insecure-registry {{.}} {{ end }}{{ range .EngineOptions.RegistryMirror }}--registry-mirror {{.}} {{ end }}{{ range .EngineFlags }}--{{.}} {{ end }}
 MountFlags=slave
-LimitNOFILE=1048576
+{{ if .Slice }}Slice={{.Slice}}
+{{ end }}LimitNOFILE=1048576
 LimitNPROC=1048576
 LimitCORE=infinity
 Environment={{range .EngineOptions.Env}}{{ printf "%q" . }} {{end}}
@@ -51,6 +53,17 @@ Environment={{range .EngineOptions.Env}}{{ printf "%q" . }} {{end}}
 [Install]
 WantedBy=multi-user.target
 `
+	flags, err := engineFlags(p.EngineOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	slice := ""
+	if hasResourceSlice(p.EngineOptions.ResourceSlice) {
+		slice = dockerSliceName
+		flags = append(flags, cgroupParentFlag(flags))
+	}
+
 	t, err := template.New("engineConfig").Parse(engineConfigTmpl)
 	if err != nil {
 		return nil, err
@@ -60,17 +73,19 @@ WantedBy=multi-user.target
 		DockerPort:    dockerPort,
 		AuthOptions:   p.AuthOptions,
 		EngineOptions: p.EngineOptions,
+		EngineFlags:   flags,
+		Slice:         slice,
 	}
 
 	t.Execute(&engineCfg, engineConfigContext)
 
 	return &DockerOptions{
 		EngineOptions:     engineCfg.String(),
-		EngineOptionsPath: p.DaemonOptionsFile,
+		EngineOptionsPath: p.daemonOptionsFile(),
 	}, nil
 }
 
-func (p *SystemdProvisioner) Service(name string, action serviceaction.ServiceAction) error {
+func (p *SystemdProvisioner) Service(ctx context.Context, name string, action serviceaction.ServiceAction) error {
 	reloadDaemon := false
 	switch action {
 	case serviceaction.Start, serviceaction.Restart:
@@ -81,14 +96,14 @@ func (p *SystemdProvisioner) Service(name string, action serviceaction.ServiceAc
 	// be sure exactly when it changes from the provisioner so
 	// we call a reload on every restart to be safe
 	if reloadDaemon {
-		if _, err := p.SSHCommand("sudo systemctl daemon-reload"); err != nil {
+		if _, err := p.SSHCommand(ctx, "sudo systemctl daemon-reload"); err != nil {
 			return err
 		}
 	}
 
-	command := fmt.Sprintf("sudo systemctl -f %s %s", action.String(), name)
+	command := fmt.Sprintf("sudo systemctl -f %s %s", action.String(), serviceName(name, p.dockerService()))
 
-	if _, err := p.SSHCommand(command); err != nil {
+	if _, err := p.SSHCommand(ctx, command); err != nil {
 		return err
 	}
 
@@ -0,0 +1,43 @@
+package provision
+
+import (
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/provision/pkgaction"
+	"github.com/docker/machine/libmachine/provision/serviceaction"
+	"golang.org/x/net/context"
+)
+
+// enableTimeSync installs and enables chrony and steps the clock right
+// away. Hosts without a hardware clock, like the Raspberry Pi, can boot far
+// in the past, which breaks TLS validation of the generated certificates.
+func enableTimeSync(ctx context.Context, p Provisioner) error {
+	log.Debug("installing chrony")
+	if err := p.Package(ctx, "chrony", pkgaction.Install); err != nil {
+		return err
+	}
+
+	if err := p.Service(ctx, "chrony", serviceaction.Enable); err != nil {
+		return err
+	}
+
+	if err := p.Service(ctx, "chrony", serviceaction.Restart); err != nil {
+		return err
+	}
+
+	log.Debug("stepping the clock")
+	if _, err := p.SSHCommand(ctx, "sudo chronyc makestep"); err != nil {
+		return err
+	}
+
+	log.Debug("waiting for the clock to be synchronized")
+	// waitsync polls up to 10 times, 10 seconds apart. A host which can't
+	// reach the time servers yet is provisioned anyway, chrony keeps trying.
+	if _, err := p.SSHCommand(withCommandTimeout(ctx, installCommandTimeout), "sudo chronyc waitsync 10"); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Warnf("The clock isn't synchronized yet, provisioning anyway: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package provision
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func TestEnableTimeSync(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := enableTimeSync(context.Background(), newFakeDebianProvisioner(commander)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo apt-get update",
+		"DEBIAN_FRONTEND=noninteractive sudo -E apt-get install -y -o DPkg::Lock::Timeout=120 chrony",
+		"sudo systemctl -f enable chrony",
+		"sudo systemctl daemon-reload",
+		"sudo systemctl -f restart chrony",
+		"sudo chronyc makestep",
+		"sudo chronyc waitsync 10",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestEnableTimeSyncNotSynchronized(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Errors: map[string]error{
+			"sudo chronyc waitsync 10": errors.New("exit status 1"),
+		},
+	}
+
+	if err := enableTimeSync(context.Background(), newFakeDebianProvisioner(commander)); err != nil {
+		t.Fatalf("expected a sync timeout to only be warned about; received %s", err)
+	}
+}
@@ -0,0 +1,55 @@
+package provision
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"golang.org/x/net/context"
+)
+
+const zoneinfoDir = "/usr/share/zoneinfo"
+
+// getTimezone returns the timezone the host is configured with.
+func getTimezone(ctx context.Context, p Provisioner) (string, error) {
+	command := "cat /etc/timezone"
+	if p.Capabilities().Systemd {
+		command = "timedatectl show --property=Timezone --value"
+	}
+
+	output, err := p.SSHCommand(ctx, command)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(output), nil
+}
+
+// setTimezone sets the host timezone, so that the daemon and container
+// logs carry local timestamps. systemd hosts go through timedatectl, SysV
+// hosts get /etc/timezone rewritten and tzdata reconfigured.
+func setTimezone(ctx context.Context, p Provisioner, tz string) error {
+	if tz == "" || strings.HasPrefix(tz, "/") || strings.Contains(tz, "..") || strings.ContainsAny(tz, `'" `) {
+		return fmt.Errorf("Invalid timezone %q", tz)
+	}
+
+	if _, err := p.SSHCommand(ctx, fmt.Sprintf("test -f %s/%s", zoneinfoDir, tz)); err != nil {
+		return fmt.Errorf("Unknown timezone %q, it is not in %s", tz, zoneinfoDir)
+	}
+
+	if current, err := getTimezone(ctx, p); err == nil && current == tz {
+		log.Debugf("timezone is already %s", tz)
+		return nil
+	}
+
+	command := fmt.Sprintf("printf '%%s\\n' '%s' | sudo tee /etc/timezone && sudo ln -sf %s/%s /etc/localtime && sudo dpkg-reconfigure -f noninteractive tzdata", tz, zoneinfoDir, tz)
+	if p.Capabilities().Systemd {
+		command = fmt.Sprintf("sudo timedatectl set-timezone %s", tz)
+	}
+
+	if _, err := p.SSHCommand(ctx, command); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package provision
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+func TestSetTimezoneSystemd(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"timedatectl show --property=Timezone --value": "Etc/UTC\n",
+		},
+	}
+
+	if err := setTimezone(context.Background(), newFakeDebianProvisioner(commander), "Europe/Berlin"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"test -f /usr/share/zoneinfo/Europe/Berlin",
+		"timedatectl show --property=Timezone --value",
+		"sudo timedatectl set-timezone Europe/Berlin",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestSetTimezoneSysV(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"cat /etc/timezone": "Etc/UTC\n",
+		},
+	}
+	p := NewUbuntuProvisioner(&fakedriver.Driver{}).(*UbuntuProvisioner)
+	p.SSHCommander = commander
+
+	if err := setTimezone(context.Background(), p, "Europe/Berlin"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"test -f /usr/share/zoneinfo/Europe/Berlin",
+		"cat /etc/timezone",
+		"printf '%s\\n' 'Europe/Berlin' | sudo tee /etc/timezone && sudo ln -sf /usr/share/zoneinfo/Europe/Berlin /etc/localtime && sudo dpkg-reconfigure -f noninteractive tzdata",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestSetTimezoneUnchanged(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"timedatectl show --property=Timezone --value": "Europe/Berlin\n",
+		},
+	}
+
+	if err := setTimezone(context.Background(), newFakeDebianProvisioner(commander), "Europe/Berlin"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(commander.Commands) != 2 {
+		t.Fatalf("expected the timezone to be left alone; received %v", commander.Commands)
+	}
+}
+
+func TestSetTimezoneInvalid(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Errors: map[string]error{
+			"test -f /usr/share/zoneinfo/Mars/Olympus": errors.New("exit status 1"),
+		},
+	}
+	p := newFakeDebianProvisioner(commander)
+
+	for _, tz := range []string{"", "../etc/passwd", "/etc/passwd", "Europe/'Berlin", "Mars/Olympus"} {
+		if err := setTimezone(context.Background(), p, tz); err == nil {
+			t.Fatalf("expected an error for timezone %q", tz)
+		}
+	}
+
+	if len(commander.Commands) != 1 {
+		t.Fatalf("expected only the zoneinfo lookup to run; received %v", commander.Commands)
+	}
+}
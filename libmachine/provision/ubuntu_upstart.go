@@ -8,10 +8,10 @@ import (
 	"github.com/docker/machine/libmachine/drivers"
 	"github.com/docker/machine/libmachine/engine"
 	"github.com/docker/machine/libmachine/log"
-	"github.com/docker/machine/libmachine/mcnutils"
 	"github.com/docker/machine/libmachine/provision/pkgaction"
 	"github.com/docker/machine/libmachine/provision/serviceaction"
 	"github.com/docker/machine/libmachine/swarm"
+	"golang.org/x/net/context"
 )
 
 func init() {
@@ -58,74 +58,24 @@ func (provisioner *UbuntuProvisioner) CompatibleWithHost() bool {
 
 }
 
-func (provisioner *UbuntuProvisioner) Service(name string, action serviceaction.ServiceAction) error {
-	command := fmt.Sprintf("sudo service %s %s", name, action.String())
+func (provisioner *UbuntuProvisioner) Service(ctx context.Context, name string, action serviceaction.ServiceAction) error {
+	command := fmt.Sprintf("sudo service %s %s", serviceName(name, provisioner.dockerService()), action.String())
 
-	if _, err := provisioner.SSHCommand(command); err != nil {
+	if _, err := provisioner.SSHCommand(ctx, command); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (provisioner *UbuntuProvisioner) Package(name string, action pkgaction.PackageAction) error {
-	var packageAction string
-
-	updateMetadata := true
-
-	switch action {
-	case pkgaction.Install, pkgaction.Upgrade:
-		packageAction = "install"
-	case pkgaction.Remove:
-		packageAction = "remove"
-		updateMetadata = false
-	}
-
-	switch name {
-	case "docker":
-		name = "docker-engine"
-	}
-
-	if updateMetadata {
-		if _, err := provisioner.SSHCommand("sudo apt-get update"); err != nil {
-			return err
-		}
-	}
-
-	// handle the new docker-engine package; we can probably remove this
-	// after we have a few versions
-	if action == pkgaction.Upgrade && name == "docker-engine" {
-		// run the force remove on the existing lxc-docker package
-		// and remove the existing apt source list
-
-		commands := []string{
-			"rm /etc/apt/sources.list.d/docker.list || true",
-			"apt-get remove -y lxc-docker || true",
-		}
-
-		for _, cmd := range commands {
-			command := fmt.Sprintf("sudo DEBIAN_FRONTEND=noninteractive %s", cmd)
-			if _, err := provisioner.SSHCommand(command); err != nil {
-				return err
-			}
-		}
-	}
-
-	command := fmt.Sprintf("DEBIAN_FRONTEND=noninteractive sudo -E apt-get %s -y  %s", packageAction, name)
-
-	log.Debugf("package: action=%s name=%s", action.String(), name)
-
-	if _, err := provisioner.SSHCommand(command); err != nil {
-		return err
-	}
-
-	return nil
+func (provisioner *UbuntuProvisioner) Package(ctx context.Context, name string, action pkgaction.PackageAction) error {
+	return aptPackages(ctx, provisioner, []string{name}, action)
 }
 
-func (provisioner *UbuntuProvisioner) dockerDaemonResponding() bool {
+func (provisioner *UbuntuProvisioner) dockerDaemonResponding(ctx context.Context) bool {
 	log.Debug("checking docker daemon")
 
-	if out, err := provisioner.SSHCommand("sudo docker version"); err != nil {
+	if out, err := provisioner.SSHCommand(ctx, "sudo docker version"); err != nil {
 		log.Warnf("Error getting SSH command to check if the daemon is up: %s", err)
 		log.Debugf("'sudo docker version' output:\n%s", out)
 		return false
@@ -135,7 +85,14 @@ func (provisioner *UbuntuProvisioner) dockerDaemonResponding() bool {
 	return true
 }
 
-func (provisioner *UbuntuProvisioner) Provision(swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error {
+func (provisioner *UbuntuProvisioner) Provision(ctx context.Context, swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error {
+	ctx, cancel := provisionContext(ctx, engineOptions)
+	defer cancel()
+
+	if err := ValidateOptions(provisioner, swarmOptions, authOptions, engineOptions); err != nil {
+		return err
+	}
+
 	provisioner.SwarmOptions = swarmOptions
 	provisioner.AuthOptions = authOptions
 	provisioner.EngineOptions = engineOptions
@@ -145,32 +102,97 @@ func (provisioner *UbuntuProvisioner) Provision(swarmOptions swarm.Options, auth
 		provisioner.EngineOptions.StorageDriver = "aufs"
 	}
 
-	if err := provisioner.SetHostname(provisioner.Driver.GetMachineName()); err != nil {
+	log.Debug("checking for passwordless sudo")
+	if err := checkSudo(ctx, provisioner); err != nil {
 		return err
 	}
 
-	for _, pkg := range provisioner.Packages {
-		if err := provisioner.Package(pkg, pkgaction.Install); err != nil {
+	if !provisioner.EngineOptions.SkipCloudInitWait {
+		log.Debug("waiting for cloud-init")
+		if err := waitForCloudInit(ctx, provisioner, cloudInitTimeout(provisioner.EngineOptions.CloudInitTimeout)); err != nil {
 			return err
 		}
 	}
 
+	if err := provisioner.SetHostname(ctx, provisioner.Driver.GetMachineName()); err != nil {
+		return err
+	}
+
+	if provisioner.EngineOptions.Timezone != "" {
+		log.Debug("setting the timezone")
+		if err := setTimezone(ctx, provisioner, provisioner.EngineOptions.Timezone); err != nil {
+			return err
+		}
+	}
+
+	if len(provisioner.EngineOptions.SystemCACerts) != 0 {
+		log.Debug("installing the system CA certificates")
+		if err := installSystemCACerts(ctx, provisioner, provisioner.EngineOptions.SystemCACerts); err != nil {
+			return err
+		}
+	}
+
+	if provisioner.EngineOptions.AptProxy != "" {
+		log.Debug("configuring the apt proxy")
+		if err := configureAptProxy(ctx, provisioner, provisioner.EngineOptions.AptProxy); err != nil {
+			return err
+		}
+	}
+
+	if provisioner.EngineOptions.AptParallelDownloads != 0 {
+		log.Debug("configuring parallel apt downloads")
+		if err := configureAptDownloads(ctx, provisioner, provisioner.EngineOptions.AptParallelDownloads); err != nil {
+			return err
+		}
+	}
+
+	if len(provisioner.EngineOptions.AptMirrors) != 0 {
+		log.Debug("configuring the apt mirrors")
+		if err := configureAptMirrors(ctx, provisioner, provisioner.EngineOptions.AptMirrors); err != nil {
+			return err
+		}
+	}
+
+	if err := aptPackages(ctx, provisioner, provisioner.Packages, pkgaction.Install); err != nil {
+		return err
+	}
+
+	if ipForwardNeeded(provisioner.EngineOptions) {
+		log.Debug("enabling IP forwarding")
+		if err := enableIPForward(ctx, provisioner); err != nil {
+			return err
+		}
+	}
+
+	log.Debug("checking the kernel config")
+	if err := CheckKernelConfig(ctx, provisioner, provisioner.EngineOptions); err != nil {
+		return err
+	}
+
 	log.Info("Installing Docker...")
-	if err := installDockerGeneric(provisioner, engineOptions.InstallURL); err != nil {
+	if err := installDockerGeneric(ctx, provisioner, engineOptions.InstallURL); err != nil {
 		return err
 	}
 
-	if err := mcnutils.WaitFor(provisioner.dockerDaemonResponding); err != nil {
+	// the install script fetches the docker packages through apt
+	if provisioner.EngineOptions.CleanAptCache {
+		log.Debug("cleaning the apt cache")
+		if err := cleanAptCache(ctx, provisioner); err != nil {
+			return err
+		}
+	}
+
+	if err := waitFor(ctx, provisioner.dockerDaemonResponding); err != nil {
 		return err
 	}
 
-	if err := makeDockerOptionsDir(provisioner); err != nil {
+	if err := makeDockerOptionsDir(ctx, provisioner); err != nil {
 		return err
 	}
 
 	provisioner.AuthOptions = setRemoteAuthOptions(provisioner)
 
-	if err := ConfigureAuth(provisioner); err != nil {
+	if err := ConfigureAuth(ctx, provisioner); err != nil {
 		return err
 	}
 
@@ -0,0 +1,95 @@
+package provision
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+	"golang.org/x/net/context"
+)
+
+const (
+	// rebootAttempts and rebootInterval give the host five minutes to come
+	// back after an upgrade reboot.
+	rebootAttempts = 60
+	rebootInterval = 5 * time.Second
+
+	bootIDCmd = "cat /proc/sys/kernel/random/boot_id"
+)
+
+func isDebianBased(info *OsRelease) bool {
+	if info == nil {
+		return false
+	}
+
+	return info.ID == "debian" || strings.Contains(" "+info.IDLike+" ", " debian ")
+}
+
+// UpgradeSystem upgrades the base OS packages of a Debian based host,
+// keeping the local changes to configuration files. It has nothing to do
+// with the docker upgrade of Package. When a new kernel was installed the
+// host is rebooted, and UpgradeSystem returns once it is back.
+func UpgradeSystem(ctx context.Context, p Provisioner) error {
+	return upgradeSystem(ctx, p, rebootAttempts, rebootInterval)
+}
+
+func upgradeSystem(ctx context.Context, p Provisioner, attempts int, interval time.Duration) error {
+	info, err := p.GetOsReleaseInfo()
+	if err != nil {
+		return err
+	}
+	if !isDebianBased(info) {
+		return fmt.Errorf("Upgrading the system is only supported on Debian based hosts")
+	}
+
+	kernelsBefore, err := p.SSHCommand(ctx, "ls /lib/modules")
+	if err != nil {
+		return err
+	}
+
+	bootID, err := p.SSHCommand(ctx, bootIDCmd)
+	if err != nil {
+		return err
+	}
+
+	upgradeOpts := "-o Dpkg::Options::=--force-confdef -o Dpkg::Options::=--force-confold"
+	if lockTimeout := aptLockTimeout(p.GetEngineOptions().AptLockTimeout); lockTimeout > 0 {
+		upgradeOpts = fmt.Sprintf("-o DPkg::Lock::Timeout=%d %s", lockTimeout, upgradeOpts)
+	}
+
+	log.Info("Upgrading the system packages...")
+
+	if _, err := p.SSHCommand(ctx, "sudo apt-get update"); err != nil {
+		return err
+	}
+
+	if err := runAptCommand(withCommandTimeout(ctx, installCommandTimeout), p, fmt.Sprintf("DEBIAN_FRONTEND=noninteractive sudo -E apt-get dist-upgrade -y %s", upgradeOpts)); err != nil {
+		return err
+	}
+
+	kernelsAfter, err := p.SSHCommand(ctx, "ls /lib/modules")
+	if err != nil {
+		return err
+	}
+
+	if kernelsAfter == kernelsBefore {
+		return nil
+	}
+
+	log.Info("A new kernel was installed, rebooting...")
+
+	// ignore errors here because the SSH connection will close
+	p.SSHCommand(ctx, "sudo reboot")
+
+	rebooted := func(ctx context.Context) bool {
+		id, err := p.SSHCommand(ctx, bootIDCmd)
+		return err == nil && strings.TrimSpace(id) != "" && id != bootID
+	}
+
+	if err := waitForSpecific(ctx, rebooted, attempts, interval); err != nil {
+		return fmt.Errorf("Host did not come back after the reboot: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const distUpgradeCmd = "DEBIAN_FRONTEND=noninteractive sudo -E apt-get dist-upgrade -y -o DPkg::Lock::Timeout=120 -o Dpkg::Options::=--force-confdef -o Dpkg::Options::=--force-confold"
+
+func TestUpgradeSystemNoNewKernel(t *testing.T) {
+	commander := &sequenceSSHCommander{
+		responses: map[string][]string{
+			"ls /lib/modules": {"5.10.103-v7l+\n"},
+			bootIDCmd:         {"1e0b6a0c\n"},
+		},
+	}
+	p := newFakeDebianProvisioner(commander)
+	p.SetOsReleaseInfo(&OsRelease{ID: "raspbian", IDLike: "debian"})
+
+	if err := upgradeSystem(context.Background(), p, 5, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"ls /lib/modules",
+		bootIDCmd,
+		"sudo apt-get update",
+		distUpgradeCmd,
+		"ls /lib/modules",
+	}
+	if !reflect.DeepEqual(commander.commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.commands)
+	}
+}
+
+func TestUpgradeSystemNewKernel(t *testing.T) {
+	commander := &sequenceSSHCommander{
+		responses: map[string][]string{
+			"ls /lib/modules": {"5.10.103-v7l+\n", "6.1.21-v7l+\n"},
+			bootIDCmd:         {"1e0b6a0c\n", "1e0b6a0c\n", "", "7f3c9d21\n"},
+		},
+	}
+	p := newFakeDebianProvisioner(commander)
+	p.SetOsReleaseInfo(&OsRelease{ID: "raspbian", IDLike: "debian"})
+
+	if err := upgradeSystem(context.Background(), p, 5, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"ls /lib/modules",
+		bootIDCmd,
+		"sudo apt-get update",
+		distUpgradeCmd,
+		"ls /lib/modules",
+		"sudo reboot",
+		bootIDCmd,
+		bootIDCmd,
+		bootIDCmd,
+	}
+	if !reflect.DeepEqual(commander.commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.commands)
+	}
+}
+
+func TestUpgradeSystemNotBack(t *testing.T) {
+	commander := &sequenceSSHCommander{
+		responses: map[string][]string{
+			"ls /lib/modules": {"5.10.103-v7l+\n", "6.1.21-v7l+\n"},
+			bootIDCmd:         {"1e0b6a0c\n"},
+		},
+	}
+	p := newFakeDebianProvisioner(commander)
+	p.SetOsReleaseInfo(&OsRelease{ID: "debian"})
+
+	if err := upgradeSystem(context.Background(), p, 3, time.Millisecond); err == nil {
+		t.Fatal("expected an error when the host doesn't reboot")
+	}
+}
+
+func TestUpgradeSystemUnsupported(t *testing.T) {
+	commander := &sequenceSSHCommander{}
+	p := newFakeDebianProvisioner(commander)
+	p.SetOsReleaseInfo(&OsRelease{ID: "fedora"})
+
+	if err := upgradeSystem(context.Background(), p, 3, time.Millisecond); err == nil {
+		t.Fatal("expected an error on a non Debian host")
+	}
+	if len(commander.commands) != 0 {
+		t.Fatalf("expected no commands; received %v", commander.commands)
+	}
+}
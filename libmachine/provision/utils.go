@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/url"
+	"os"
 	"path"
 	"path/filepath"
 	"regexp"
@@ -13,9 +14,12 @@ import (
 
 	"github.com/docker/machine/libmachine/auth"
 	"github.com/docker/machine/libmachine/cert"
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/engine"
 	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/mcnutils"
 	"github.com/docker/machine/libmachine/provision/serviceaction"
+	"golang.org/x/net/context"
 )
 
 type DockerOptions struct {
@@ -23,19 +27,69 @@ type DockerOptions struct {
 	EngineOptionsPath string
 }
 
-func installDockerGeneric(p Provisioner, baseURL string) error {
+const installScriptPath = "/tmp/install-docker.sh"
+
+func installDockerGeneric(ctx context.Context, p Provisioner, baseURL string) error {
+	if p.GetEngineOptions().InstallStrategy == InstallStrategyDockerOfficial {
+		return installDockerOfficial(ctx, p)
+	}
+
+	if sum := p.GetEngineOptions().InstallURLSHA256; sum != "" {
+		return installDockerVerified(ctx, p, baseURL, sum)
+	}
+
 	// install docker - until cloudinit we use ubuntu everywhere so we
 	// just install it using the docker repos
-	if output, err := p.SSHCommand(fmt.Sprintf("if ! type docker; then curl -sSL %s | sh -; fi", baseURL)); err != nil {
+	if output, err := p.SSHCommand(withCommandTimeout(ctx, installCommandTimeout), fmt.Sprintf("if ! type docker; then curl -sSL %s | sh -; fi", baseURL)); err != nil {
 		return fmt.Errorf("error installing docker: %s\n", output)
 	}
 
 	return nil
 }
 
-func makeDockerOptionsDir(p Provisioner) error {
+// installDockerVerified is installDockerGeneric for a pinned install
+// script: the script is only run once its checksum matches.
+func installDockerVerified(ctx context.Context, p Provisioner, baseURL, sum string) error {
+	out, err := p.SSHCommand(ctx, "command -v docker || true")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(out) != "" {
+		return nil
+	}
+
+	if err := downloadAndVerify(ctx, p, baseURL, sum, installScriptPath); err != nil {
+		return err
+	}
+
+	if _, err := p.SSHCommand(withCommandTimeout(ctx, installCommandTimeout), fmt.Sprintf("sh %s && rm -f %s", installScriptPath, installScriptPath)); err != nil {
+		return fmt.Errorf("error installing docker: %s", err)
+	}
+
+	return nil
+}
+
+func makeDockerOptionsDir(ctx context.Context, p Provisioner) error {
 	dockerDir := p.GetDockerOptionsDir()
-	if _, err := p.SSHCommand(fmt.Sprintf("sudo mkdir -p %s", dockerDir)); err != nil {
+
+	// on a read-only root the certs are moved by ConfigureAuth, the
+	// options dir is only needed when it can be written to
+	readOnly, err := rootReadOnly(ctx, p)
+	if err != nil {
+		return err
+	}
+	if readOnly {
+		writable, err := remoteWritable(ctx, p, dockerDir)
+		if err != nil {
+			return err
+		}
+		if !writable {
+			log.Debugf("the root filesystem is read-only, not creating %s", dockerDir)
+			return nil
+		}
+	}
+
+	if _, err := p.SSHCommand(ctx, fmt.Sprintf("sudo mkdir -p %s", dockerDir)); err != nil {
 		return err
 	}
 
@@ -46,45 +100,273 @@ func setRemoteAuthOptions(p Provisioner) auth.Options {
 	dockerDir := p.GetDockerOptionsDir()
 	authOptions := p.GetAuthOptions()
 
+	// remote paths which are already set are kept, so that certs can be
+	// stored outside of the docker options dir, e.g. on a read-only /etc
+
 	// due to windows clients, we cannot use filepath.Join as the paths
 	// will be mucked on the linux hosts
-	authOptions.CaCertRemotePath = path.Join(dockerDir, "ca.pem")
-	authOptions.ServerCertRemotePath = path.Join(dockerDir, "server.pem")
-	authOptions.ServerKeyRemotePath = path.Join(dockerDir, "server-key.pem")
+	if authOptions.CaCertRemotePath == "" {
+		authOptions.CaCertRemotePath = path.Join(dockerDir, "ca.pem")
+	}
+	if authOptions.ServerCertRemotePath == "" {
+		authOptions.ServerCertRemotePath = path.Join(dockerDir, "server.pem")
+	}
+	if authOptions.ServerKeyRemotePath == "" {
+		authOptions.ServerKeyRemotePath = path.Join(dockerDir, "server-key.pem")
+	}
 
 	return authOptions
 }
 
-func ConfigureAuth(p Provisioner) error {
+// makeRemoteCertDirs creates the directories the certs are uploaded to,
+// which may differ from the docker options dir.
+func makeRemoteCertDirs(ctx context.Context, p Provisioner, authOptions auth.Options) error {
+	dirs := []string{}
+	for _, remotePath := range []string{authOptions.CaCertRemotePath, authOptions.ServerCertRemotePath, authOptions.ServerKeyRemotePath} {
+		dir := path.Dir(remotePath)
+		found := false
+		for _, d := range dirs {
+			if d == dir {
+				found = true
+				break
+			}
+		}
+		if !found {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	if _, err := p.SSHCommand(ctx, fmt.Sprintf("sudo mkdir -p %s", strings.Join(dirs, " "))); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// getDockerPort returns the port the daemon listens on according to the
+// driver URL, defaulting to 2376.
+func getDockerPort(driver drivers.Driver) (int, error) {
+	dockerURL, err := driver.GetURL()
+	if err != nil {
+		return 0, err
+	}
+	u, err := url.Parse(dockerURL)
+	if err != nil {
+		return 0, err
+	}
+	dockerPort := 2376
+	parts := strings.Split(u.Host, ":")
+	if len(parts) == 2 {
+		dPort, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return 0, err
+		}
+		dockerPort = dPort
+	}
+
+	return dockerPort, nil
+}
+
+// writeDockerOptions generates the daemon configuration and writes it to
+// the host. The daemon has to be (re)started for it to take effect.
+func writeDockerOptions(ctx context.Context, p Provisioner, dockerPort int) error {
+	if err := gateLegacyRegistry(ctx, p); err != nil {
+		return err
+	}
+
+	dkrcfg, err := p.GenerateDockerOptions(dockerPort)
+	if err != nil {
+		return err
+	}
+
+	if p.GetEngineOptions().SelinuxEnabled {
+		warnSelinuxUnsupported(p)
+	}
+
+	if p.GetEngineOptions().AllowAllInsecureRegistries {
+		log.Warnf("The daemon accepts every registry in %s over plain HTTP, image pulls and pushes can be intercepted. Only use this on an isolated network!", allInsecureRegistriesCIDR)
+	}
+
+	log.Info("Setting Docker configuration on the remote daemon...")
+
+	engineOptions := p.GetEngineOptions()
+
+	// systemd hosts set the OOM score adjustment in a drop-in of the docker
+	// service, which doesn't depend on the daemon version
+	if capabilities := p.Capabilities(); capabilities.Systemd && capabilities.HostConfig {
+		engineOptions.OOMScoreAdjust = 0
+	}
+
+	// daemon.json goes first: when it is validated, the daemon flags are
+	// checked with it before the unit using them is written
+	if err := writeDaemonConfig(ctx, p, engineOptions); err != nil {
+		return err
+	}
+
+	if _, err = p.SSHCommand(ctx, fmt.Sprintf("printf %%s \"%s\" | sudo tee %s", dkrcfg.EngineOptions, dkrcfg.EngineOptionsPath)); err != nil {
+		return err
+	}
+
+	if p.GetEngineOptions().ExportConfig {
+		return exportDockerOptions(p.GetAuthOptions().StorePath, dkrcfg)
+	}
+
+	return nil
+}
+
+// exportDockerOptions writes the daemon configuration to the machine
+// directory, under the base name of its path on the host.
+func exportDockerOptions(storePath string, dkrcfg *DockerOptions) error {
+	exportPath := filepath.Join(storePath, path.Base(dkrcfg.EngineOptionsPath))
+
+	log.Infof("Exporting the Docker configuration to %s", exportPath)
+
+	return ioutil.WriteFile(exportPath, []byte(dkrcfg.EngineOptions), 0644)
+}
+
+// UpdateLabels replaces the engine labels and restarts the daemon with the
+// new configuration, skipping the package and certificate steps of a full
+// Provision. The certificates must already be in place on the host.
+func UpdateLabels(ctx context.Context, p Provisioner, authOptions auth.Options, engineOptions engine.Options, labels []string) error {
+	engineOptions.Labels = labels
+
+	p.SetEngineOptions(engineOptions)
+	p.SetAuthOptions(authOptions)
+	p.SetAuthOptions(setRemoteAuthOptions(p))
+
+	dockerPort, err := getDockerPort(p.GetDriver())
+	if err != nil {
+		return err
+	}
+
+	if err := writeDockerOptions(ctx, p, dockerPort); err != nil {
+		return err
+	}
+
+	stopped, err := stopContainersForReconfigure(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	if err := p.Service(ctx, "docker", serviceaction.Restart); err != nil {
+		return err
+	}
+
+	if err := waitForDocker(ctx, p, dockerPort); err != nil {
+		return err
+	}
+
+	return StartContainers(ctx, p, stopped)
+}
+
+func ConfigureAuth(ctx context.Context, p Provisioner) error {
 	var (
 		err error
 	)
 
 	driver := p.GetDriver()
-	machineName := driver.GetMachineName()
-	authOptions := p.GetAuthOptions()
-	org := mcnutils.GetUsername() + "." + machineName
-	bits := 2048
 
-	ip, err := driver.GetIP()
+	engineOptions, err := redirectDaemonConfig(ctx, p, p.GetEngineOptions())
 	if err != nil {
 		return err
 	}
+	p.SetEngineOptions(engineOptions)
+
+	if engineOptions.DisableTCP {
+		log.Info("The daemon only listens on the unix socket, skipping the TLS setup...")
+		if err := stopDocker(ctx, p); err != nil {
+			return err
+		}
+		return startDocker(ctx, p)
+	}
+
+	authOptions := p.GetAuthOptions()
 
 	log.Info("Copying certs to the local machine directory...")
 
-	if err := mcnutils.CopyFile(authOptions.CaCertPath, filepath.Join(authOptions.StorePath, "ca.pem")); err != nil {
+	certDir, err := clientCertDir(authOptions)
+	if err != nil {
+		return err
+	}
+
+	if err := mcnutils.CopyFile(authOptions.CaCertPath, filepath.Join(certDir, "ca.pem")); err != nil {
 		return fmt.Errorf("Copying ca.pem to machine dir failed: %s", err)
 	}
 
-	if err := mcnutils.CopyFile(authOptions.ClientCertPath, filepath.Join(authOptions.StorePath, "cert.pem")); err != nil {
+	if err := mcnutils.CopyFile(authOptions.ClientCertPath, filepath.Join(certDir, "cert.pem")); err != nil {
 		return fmt.Errorf("Copying cert.pem to machine dir failed: %s", err)
 	}
 
-	if err := mcnutils.CopyFile(authOptions.ClientKeyPath, filepath.Join(authOptions.StorePath, "key.pem")); err != nil {
+	if err := mcnutils.CopyFile(authOptions.ClientKeyPath, filepath.Join(certDir, "key.pem")); err != nil {
 		return fmt.Errorf("Copying key.pem to machine dir failed: %s", err)
 	}
 
+	if err := generateServerCert(driver, authOptions); err != nil {
+		return err
+	}
+
+	// upload certs and configure TLS auth
+	caCert, err := ioutil.ReadFile(authOptions.CaCertPath)
+	if err != nil {
+		return err
+	}
+
+	serverCert, err := ioutil.ReadFile(authOptions.ServerCertPath)
+	if err != nil {
+		return err
+	}
+	serverKey, err := ioutil.ReadFile(authOptions.ServerKeyPath)
+	if err != nil {
+		return err
+	}
+
+	authOptions, err = redirectReadOnlyRoot(ctx, p, authOptions)
+	if err != nil {
+		return err
+	}
+	p.SetAuthOptions(authOptions)
+
+	if err := stopDocker(ctx, p); err != nil {
+		return err
+	}
+
+	log.Info("Copying certs to the remote machine...")
+
+	if err := makeRemoteCertDirs(ctx, p, authOptions); err != nil {
+		return err
+	}
+
+	// printf will choke if we don't pass a format string because of the
+	// dashes, so that's the reason for the '%%s'
+	certTransferCmdFmt := "printf '%%s' '%s' | sudo tee %s"
+
+	// These ones are for Jessie and Mike <3 <3 <3
+	if _, err := p.SSHCommand(ctx, fmt.Sprintf(certTransferCmdFmt, string(caCert), authOptions.CaCertRemotePath)); err != nil {
+		return err
+	}
+
+	if _, err := p.SSHCommand(ctx, fmt.Sprintf(certTransferCmdFmt, string(serverCert), authOptions.ServerCertRemotePath)); err != nil {
+		return err
+	}
+
+	if _, err := p.SSHCommand(ctx, fmt.Sprintf(certTransferCmdFmt, string(serverKey), authOptions.ServerKeyRemotePath)); err != nil {
+		return err
+	}
+
+	return startDocker(ctx, p)
+}
+
+// generateServerCert generates the server certificate of the machine,
+// signed by the CA of authOptions.
+func generateServerCert(driver drivers.Driver, authOptions auth.Options) error {
+	org := mcnutils.GetUsername() + "." + driver.GetMachineName()
+	bits := 2048
+
+	ip, err := driver.GetIP()
+	if err != nil {
+		return err
+	}
+
 	// The Host IP is always added to the certificate's SANs list
 	hosts := append(authOptions.ServerCertSANs, ip, "localhost")
 	log.Debugf("generating server cert: %s ca-key=%s private-key=%s org=%s san=%s",
@@ -111,82 +393,103 @@ func ConfigureAuth(p Provisioner) error {
 		return fmt.Errorf("error generating server cert: %s", err)
 	}
 
-	if err := p.Service("docker", serviceaction.Stop); err != nil {
-		return err
+	return nil
+}
+
+// clientCertDir returns the local directory the client bundle goes to. A
+// custom directory is created if needed and only readable by the user, the
+// bundle grants full access to the daemon.
+func clientCertDir(authOptions auth.Options) (string, error) {
+	if authOptions.ClientCertOutputDir == "" {
+		return authOptions.StorePath, nil
 	}
 
-	if _, err := p.SSHCommand(`if [ ! -z "$(ip link show docker0)" ]; then sudo ip link delete docker0; fi`); err != nil {
-		return err
+	if err := os.MkdirAll(authOptions.ClientCertOutputDir, 0700); err != nil {
+		return "", fmt.Errorf("Creating the client cert directory failed: %s", err)
 	}
 
-	// upload certs and configure TLS auth
-	caCert, err := ioutil.ReadFile(authOptions.CaCertPath)
-	if err != nil {
-		return err
+	if err := os.Chmod(authOptions.ClientCertOutputDir, 0700); err != nil {
+		return "", fmt.Errorf("Creating the client cert directory failed: %s", err)
 	}
 
-	serverCert, err := ioutil.ReadFile(authOptions.ServerCertPath)
+	return authOptions.ClientCertOutputDir, nil
+}
+
+// UploadCA distributes a new CA certificate to the host without touching
+// the server certificate and without restarting the daemon, which keeps
+// verifying clients against the CA it was started with until its next
+// restart. The CA is also copied to the machine directory for the clients.
+func UploadCA(ctx context.Context, p Provisioner) error {
+	authOptions := setRemoteAuthOptions(p)
+
+	certDir, err := clientCertDir(authOptions)
 	if err != nil {
 		return err
 	}
-	serverKey, err := ioutil.ReadFile(authOptions.ServerKeyPath)
+
+	if err := mcnutils.CopyFile(authOptions.CaCertPath, filepath.Join(certDir, "ca.pem")); err != nil {
+		return fmt.Errorf("Copying ca.pem to machine dir failed: %s", err)
+	}
+
+	caCert, err := ioutil.ReadFile(authOptions.CaCertPath)
 	if err != nil {
 		return err
 	}
 
-	log.Info("Copying certs to the remote machine...")
-
-	// printf will choke if we don't pass a format string because of the
-	// dashes, so that's the reason for the '%%s'
-	certTransferCmdFmt := "printf '%%s' '%s' | sudo tee %s"
+	log.Info("Copying the CA to the remote machine...")
 
-	// These ones are for Jessie and Mike <3 <3 <3
-	if _, err := p.SSHCommand(fmt.Sprintf(certTransferCmdFmt, string(caCert), authOptions.CaCertRemotePath)); err != nil {
+	if _, err := p.SSHCommand(ctx, fmt.Sprintf("sudo mkdir -p %s", path.Dir(authOptions.CaCertRemotePath))); err != nil {
 		return err
 	}
 
-	if _, err := p.SSHCommand(fmt.Sprintf(certTransferCmdFmt, string(serverCert), authOptions.ServerCertRemotePath)); err != nil {
+	if _, err := p.SSHCommand(ctx, fmt.Sprintf("printf '%%s' '%s' | sudo tee %s", string(caCert), authOptions.CaCertRemotePath)); err != nil {
 		return err
 	}
 
-	if _, err := p.SSHCommand(fmt.Sprintf(certTransferCmdFmt, string(serverKey), authOptions.ServerKeyRemotePath)); err != nil {
+	return nil
+}
+
+// stopDocker stops the daemon and removes its bridge, which is recreated
+// with the new configuration on start.
+func stopDocker(ctx context.Context, p Provisioner) error {
+	if err := p.Service(ctx, "docker", serviceaction.Stop); err != nil {
 		return err
 	}
 
-	dockerURL, err := driver.GetURL()
-	if err != nil {
+	if _, err := p.SSHCommand(ctx, `if [ ! -z "$(ip link show docker0)" ]; then sudo ip link delete docker0; fi`); err != nil {
 		return err
 	}
-	u, err := url.Parse(dockerURL)
+
+	return nil
+}
+
+// startDocker writes the daemon configuration, starts the daemon and waits
+// for it to answer.
+func startDocker(ctx context.Context, p Provisioner) error {
+	dockerPort, err := getDockerPort(p.GetDriver())
 	if err != nil {
 		return err
 	}
-	dockerPort := 2376
-	parts := strings.Split(u.Host, ":")
-	if len(parts) == 2 {
-		dPort, err := strconv.Atoi(parts[1])
-		if err != nil {
-			return err
-		}
-		dockerPort = dPort
-	}
 
-	dkrcfg, err := p.GenerateDockerOptions(dockerPort)
-	if err != nil {
+	if err := writeDockerOptions(ctx, p, dockerPort); err != nil {
 		return err
 	}
 
-	log.Info("Setting Docker configuration on the remote daemon...")
-
-	if _, err = p.SSHCommand(fmt.Sprintf("printf %%s \"%s\" | sudo tee %s", dkrcfg.EngineOptions, dkrcfg.EngineOptionsPath)); err != nil {
+	if err := p.Service(ctx, "docker", serviceaction.Start); err != nil {
 		return err
 	}
 
-	if err := p.Service("docker", serviceaction.Start); err != nil {
-		return err
+	return waitForDocker(ctx, p, dockerPort)
+}
+
+// serviceName maps the "docker" service to the name the daemon actually
+// runs under on the host, leaving other services alone.
+func serviceName(name, dockerServiceName string) string {
+	if name == "docker" && dockerServiceName != "" {
+		return dockerServiceName
 	}
 
-	return waitForDocker(p, dockerPort)
+	return name
 }
 
 func matchNetstatOut(reDaemonListening, netstatOut string) bool {
@@ -208,11 +511,27 @@ func matchNetstatOut(reDaemonListening, netstatOut string) bool {
 	return false
 }
 
-func checkDaemonUp(p Provisioner, dockerPort int) func() bool {
+// checkSocketUp reports whether the daemon answers on its unix socket.
+func checkSocketUp(p Provisioner) func(context.Context) bool {
+	return func(ctx context.Context) bool {
+		if _, err := p.SSHCommand(ctx, "sudo docker version"); err != nil {
+			log.Debugf("Error checking the docker daemon on its unix socket: %s", err)
+			return false
+		}
+
+		return true
+	}
+}
+
+func checkDaemonUp(p Provisioner, dockerPort int) func(context.Context) bool {
+	if p.GetEngineOptions().DisableTCP {
+		return checkSocketUp(p)
+	}
+
 	reDaemonListening := fmt.Sprintf(":%d.*LISTEN", dockerPort)
-	return func() bool {
+	return func(ctx context.Context) bool {
 		// HACK: Check netstat's output to see if anyone's listening on the Docker API port.
-		netstatOut, err := p.SSHCommand("netstat -an")
+		netstatOut, err := p.SSHCommand(ctx, "netstat -an")
 		if err != nil {
 			log.Warnf("Error running SSH command: %s", err)
 			return false
@@ -222,8 +541,11 @@ func checkDaemonUp(p Provisioner, dockerPort int) func() bool {
 	}
 }
 
-func waitForDocker(p Provisioner, dockerPort int) error {
-	if err := mcnutils.WaitForSpecific(checkDaemonUp(p, dockerPort), 10, 3*time.Second); err != nil {
+func waitForDocker(ctx context.Context, p Provisioner, dockerPort int) error {
+	if err := waitForSpecific(ctx, checkDaemonUp(p, dockerPort), 10, 3*time.Second); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		return NewErrDaemonAvailable(err)
 	}
 
@@ -1,13 +1,26 @@
 package provision
 
 import (
+	"bytes"
+	"crypto/tls"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
 	"testing"
 
 	"github.com/docker/machine/drivers/fakedriver"
 	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/cert"
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"github.com/docker/machine/libmachine/provision/serviceaction"
+	"github.com/docker/machine/libmachine/state"
+	"golang.org/x/net/context"
 )
 
 var (
@@ -156,3 +169,496 @@ func TestMachineCustomPortBoot2Docker(t *testing.T) {
 		t.Errorf("expected url %s; received %s", bindURL, url)
 	}
 }
+
+func TestSetRemoteAuthOptionsDefaults(t *testing.T) {
+	p := NewDebianProvisioner(&fakedriver.Driver{}).(*DebianProvisioner)
+
+	authOptions := setRemoteAuthOptions(p)
+
+	if authOptions.CaCertRemotePath != "/etc/docker/ca.pem" {
+		t.Fatalf("expected default CA cert path; received %s", authOptions.CaCertRemotePath)
+	}
+	if authOptions.ServerCertRemotePath != "/etc/docker/server.pem" {
+		t.Fatalf("expected default server cert path; received %s", authOptions.ServerCertRemotePath)
+	}
+	if authOptions.ServerKeyRemotePath != "/etc/docker/server-key.pem" {
+		t.Fatalf("expected default server key path; received %s", authOptions.ServerKeyRemotePath)
+	}
+}
+
+func TestSetRemoteAuthOptionsCustomPaths(t *testing.T) {
+	p := NewDebianProvisioner(&fakedriver.Driver{}).(*DebianProvisioner)
+	p.AuthOptions = auth.Options{
+		CaCertRemotePath:     "/var/lib/docker-certs/ca.pem",
+		ServerCertRemotePath: "/var/lib/docker-certs/server.pem",
+		ServerKeyRemotePath:  "/var/lib/docker-certs/server-key.pem",
+	}
+
+	p.AuthOptions = setRemoteAuthOptions(p)
+
+	dockerCfg, err := p.GenerateDockerOptions(2376)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, flag := range []string{
+		"--tlscacert /var/lib/docker-certs/ca.pem",
+		"--tlscert /var/lib/docker-certs/server.pem",
+		"--tlskey /var/lib/docker-certs/server-key.pem",
+	} {
+		if !strings.Contains(dockerCfg.EngineOptions, flag) {
+			t.Fatalf("expected %q in engine config; received %s", flag, dockerCfg.EngineOptions)
+		}
+	}
+}
+
+func TestMakeRemoteCertDirs(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+	p := newFakeDebianProvisioner(commander)
+
+	err := makeRemoteCertDirs(context.Background(), p, auth.Options{
+		CaCertRemotePath:     "/var/lib/docker-certs/ca.pem",
+		ServerCertRemotePath: "/var/lib/docker-certs/server.pem",
+		ServerKeyRemotePath:  "/var/lib/docker-keys/server-key.pem",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"sudo mkdir -p /var/lib/docker-certs /var/lib/docker-keys"}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestUpdateLabels(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"netstat -an": "tcp        0      0 :::2376                 :::*                    LISTEN",
+		},
+	}
+	p := NewDebianProvisioner(&fakedriver.Driver{
+		MockState: state.Running,
+		MockIP:    "1.2.3.4",
+	}).(*DebianProvisioner)
+	p.SSHCommander = commander
+
+	err := UpdateLabels(context.Background(), p, auth.Options{}, engine.Options{StorageDriver: "overlay", Labels: []string{"old=1"}}, []string{"rack=1", "zone=eu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(commander.Commands) != 5 {
+		t.Fatalf("expected only the config to be written and docker restarted; received %v", commander.Commands)
+	}
+
+	config := commander.Commands[1]
+	if !strings.HasSuffix(config, "| sudo tee /etc/systemd/system/docker.service") {
+		t.Fatalf("expected the daemon config to be written; received %s", config)
+	}
+	if !strings.Contains(config, "--label rack=1 --label zone=eu --label provider=Driver") {
+		t.Fatalf("expected the new labels in the daemon config; received %s", config)
+	}
+	if strings.Contains(config, "old=1") {
+		t.Fatalf("expected the old labels to be replaced; received %s", config)
+	}
+	if !strings.Contains(config, "--tlscacert /etc/docker/ca.pem") {
+		t.Fatalf("expected the existing remote certs to be referenced; received %s", config)
+	}
+
+	expected := []string{
+		"sudo systemctl daemon-reload",
+		"sudo systemctl -f restart docker",
+		"netstat -an",
+	}
+	if !reflect.DeepEqual(commander.Commands[2:], expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands[2:])
+	}
+}
+
+func TestServiceRemappedDockerName(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+	p := newFakeDebianProvisioner(commander)
+	p.DockerServiceName = "docker-ce"
+
+	if err := p.Service(context.Background(), "docker", serviceaction.Start); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Service(context.Background(), "chrony", serviceaction.Restart); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo systemctl daemon-reload",
+		"sudo systemctl -f start docker-ce",
+		"sudo systemctl daemon-reload",
+		"sudo systemctl -f restart chrony",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestEngineServiceName(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+	p := newFakeDebianProvisioner(commander)
+	p.EngineOptions = engine.Options{StorageDriver: "overlay2", ServiceName: "docker-ce"}
+
+	dkrcfg, err := p.GenerateDockerOptions(2376)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dkrcfg.EngineOptionsPath != "/etc/systemd/system/docker-ce.service" {
+		t.Fatalf("expected the unit of the docker-ce service; received %s", dkrcfg.EngineOptionsPath)
+	}
+
+	if err := p.Service(context.Background(), "docker", serviceaction.Restart); err != nil {
+		t.Fatal(err)
+	}
+	if last := commander.Commands[len(commander.Commands)-1]; last != "sudo systemctl -f restart docker-ce" {
+		t.Fatalf("expected docker-ce to be restarted; received %s", last)
+	}
+
+	if dropIn := dockerDropInPath(p, restartDropInName); dropIn != "/etc/systemd/system/docker-ce.service.d/"+restartDropInName {
+		t.Fatalf("expected the drop-ins of docker-ce; received %s", dropIn)
+	}
+}
+
+func TestServiceRemappedDockerNameUpstart(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+	p := NewUbuntuProvisioner(&fakedriver.Driver{}).(*UbuntuProvisioner)
+	p.SSHCommander = commander
+	p.DockerServiceName = "docker-ce"
+
+	if err := p.Service(context.Background(), "docker", serviceaction.Stop); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"sudo service docker-ce stop"}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestGenerateDockerOptionsUnixSocketOnly(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+	provisioners := []Provisioner{
+		NewDebianProvisioner(&fakedriver.Driver{}),
+		NewUbuntuProvisioner(&fakedriver.Driver{}),
+		NewCoreOSProvisioner(&fakedriver.Driver{}),
+		NewCentosProvisioner(&fakedriver.Driver{}),
+		NewOpenSUSEProvisioner(&fakedriver.Driver{}),
+	}
+
+	for _, p := range provisioners {
+		p.SetAuthOptions(auth.Options{CaCertRemotePath: "/etc/docker/ca.pem"})
+		p.SetEngineOptions(engine.Options{StorageDriver: "overlay", DisableTCP: true})
+		if sp, ok := p.(*SUSEProvisioner); ok {
+			sp.SSHCommander = commander
+		}
+
+		dockerCfg, err := p.GenerateDockerOptions(2376)
+		if err != nil {
+			t.Fatalf("%s: %s", p, err)
+		}
+
+		for _, unexpected := range []string{"tcp://", "--tls", "ca.pem"} {
+			if strings.Contains(dockerCfg.EngineOptions, unexpected) {
+				t.Errorf("%s: expected no %q in the socket only config; received %s", p, unexpected, dockerCfg.EngineOptions)
+			}
+		}
+		if _, ok := p.(*SUSEProvisioner); !ok && !strings.Contains(dockerCfg.EngineOptions, "unix:///var/run/docker.sock") {
+			t.Errorf("%s: expected the unix socket in the config; received %s", p, dockerCfg.EngineOptions)
+		}
+	}
+}
+
+func TestGenerateDockerOptionsUnixSocketOnlyBoot2Docker(t *testing.T) {
+	p := NewBoot2DockerProvisioner(&fakedriver.Driver{})
+	p.SetEngineOptions(engine.Options{DisableTCP: true})
+
+	if _, err := p.GenerateDockerOptions(2376); err != ErrDisableTCPUnsupported {
+		t.Fatalf("expected %s; received %v", ErrDisableTCPUnsupported, err)
+	}
+}
+
+func TestConfigureAuthUnixSocketOnly(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+	p := NewDebianProvisioner(&fakedriver.Driver{
+		MockState: state.Running,
+		MockIP:    "1.2.3.4",
+	}).(*DebianProvisioner)
+	p.SSHCommander = commander
+	p.EngineOptions = engine.Options{StorageDriver: "overlay", DisableTCP: true}
+
+	if err := ConfigureAuth(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(commander.Commands) != 8 {
+		t.Fatalf("expected no certs to be copied; received %v", commander.Commands)
+	}
+
+	expected := []string{
+		rootMountCmd,
+		"sudo systemctl -f stop docker",
+		`if [ ! -z "$(ip link show docker0)" ]; then sudo ip link delete docker0; fi`,
+	}
+	if !reflect.DeepEqual(commander.Commands[:3], expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands[:3])
+	}
+
+	expected = []string{
+		"sudo systemctl daemon-reload",
+		"sudo systemctl -f start docker",
+		"sudo docker version",
+	}
+	if !reflect.DeepEqual(commander.Commands[5:], expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands[5:])
+	}
+}
+
+type fakeCertGenerator struct {
+	hosts []string
+}
+
+func (g *fakeCertGenerator) GenerateCACertificate(certFile, keyFile, org string, bits int) error {
+	return nil
+}
+
+func (g *fakeCertGenerator) GenerateCert(hosts []string, certFile, keyFile, caFile, caKeyFile, org string, bits int) error {
+	g.hosts = hosts
+	if err := ioutil.WriteFile(certFile, []byte("FAKE SERVER CERT"), 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(keyFile, []byte("FAKE SERVER KEY"), 0600)
+}
+
+func (g *fakeCertGenerator) ReadTLSConfig(addr string, authOptions *auth.Options) (*tls.Config, error) {
+	return nil, nil
+}
+
+func (g *fakeCertGenerator) ValidateCertificate(addr string, authOptions *auth.Options) (bool, error) {
+	return true, nil
+}
+
+func TestConfigureAuthCertGenerator(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	authOptions := auth.Options{
+		StorePath:        tmpDir,
+		CaCertPath:       filepath.Join(tmpDir, "certs-ca.pem"),
+		CaPrivateKeyPath: filepath.Join(tmpDir, "certs-ca-key.pem"),
+		ClientCertPath:   filepath.Join(tmpDir, "certs-cert.pem"),
+		ClientKeyPath:    filepath.Join(tmpDir, "certs-key.pem"),
+		ServerCertPath:   filepath.Join(tmpDir, "server.pem"),
+		ServerKeyPath:    filepath.Join(tmpDir, "server-key.pem"),
+	}
+	for _, path := range []string{authOptions.CaCertPath, authOptions.ClientCertPath, authOptions.ClientKeyPath} {
+		if err := ioutil.WriteFile(path, []byte("FAKE"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	generator := &fakeCertGenerator{}
+	cert.SetCertGenerator(generator)
+	defer cert.SetCertGenerator(cert.NewX509CertGenerator())
+
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"netstat -an": "tcp        0      0 :::2376                 :::*                    LISTEN",
+		},
+	}
+	p := NewDebianProvisioner(&fakedriver.Driver{
+		MockState: state.Running,
+		MockIP:    "1.2.3.4",
+	}).(*DebianProvisioner)
+	p.SSHCommander = commander
+	p.EngineOptions = engine.Options{StorageDriver: "overlay"}
+	p.AuthOptions = authOptions
+	p.AuthOptions = setRemoteAuthOptions(p)
+
+	if err := ConfigureAuth(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(generator.hosts, []string{"1.2.3.4", "localhost"}) {
+		t.Fatalf("expected the server cert for the machine IP; received %v", generator.hosts)
+	}
+
+	for _, expected := range []string{
+		"printf '%s' 'FAKE SERVER CERT' | sudo tee /etc/docker/server.pem",
+		"printf '%s' 'FAKE SERVER KEY' | sudo tee /etc/docker/server-key.pem",
+	} {
+		found := false
+		for _, cmd := range commander.Commands {
+			if cmd == expected {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("expected %q to be run; received %v", expected, commander.Commands)
+		}
+	}
+}
+
+func TestWriteDockerOptionsExportConfig(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	commander := &provisiontest.FakeSSHCommander{}
+	p := newFakeDebianProvisioner(commander)
+	p.EngineOptions = engine.Options{StorageDriver: "overlay", ExportConfig: true}
+	p.AuthOptions = auth.Options{StorePath: tmpDir}
+
+	if err := writeDockerOptions(context.Background(), p, 2376); err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err := ioutil.ReadFile(filepath.Join(tmpDir, "docker.service"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploaded := fmt.Sprintf("printf %%s \"%s\" | sudo tee /etc/systemd/system/docker.service", exported)
+	if len(commander.Commands) != 2 || commander.Commands[1] != uploaded {
+		t.Fatalf("expected the exported config to match the uploaded one %q; received %v", uploaded, commander.Commands)
+	}
+}
+
+func TestUploadCA(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	caCertPath := filepath.Join(tmpDir, "certs-ca.pem")
+	if err := ioutil.WriteFile(caCertPath, []byte("NEW CA"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	commander := &provisiontest.FakeSSHCommander{}
+	p := newFakeDebianProvisioner(commander)
+	p.AuthOptions = auth.Options{StorePath: tmpDir, CaCertPath: caCertPath}
+
+	if err := UploadCA(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"sudo mkdir -p /etc/docker",
+		"printf '%s' 'NEW CA' | sudo tee /etc/docker/ca.pem",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected only the CA upload without a restart %v; received %v", expected, commander.Commands)
+	}
+
+	if copied, err := ioutil.ReadFile(filepath.Join(tmpDir, "ca.pem")); err != nil || string(copied) != "NEW CA" {
+		t.Fatalf("expected the CA in the machine dir; received %q, %v", copied, err)
+	}
+}
+
+func TestUploadCAClientCertOutputDir(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	caCertPath := filepath.Join(tmpDir, "certs-ca.pem")
+	if err := ioutil.WriteFile(caCertPath, []byte("NEW CA"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	outputDir := filepath.Join(tmpDir, "bundles", "machine-1")
+
+	p := newFakeDebianProvisioner(&provisiontest.FakeSSHCommander{})
+	p.AuthOptions = auth.Options{StorePath: tmpDir, CaCertPath: caCertPath, ClientCertOutputDir: outputDir}
+
+	if err := UploadCA(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+
+	if copied, err := ioutil.ReadFile(filepath.Join(outputDir, "ca.pem")); err != nil || string(copied) != "NEW CA" {
+		t.Fatalf("expected the CA in the output dir; received %q, %v", copied, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tmpDir, "ca.pem")); !os.IsNotExist(err) {
+		t.Fatalf("expected no CA in the machine dir; received %v", err)
+	}
+
+	info, err := os.Stat(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Fatalf("expected the output dir to be created with 0700; received %v", info.Mode().Perm())
+	}
+}
+
+func TestClientCertDirExisting(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	outputDir := filepath.Join(tmpDir, "bundle")
+	if err := os.Mkdir(outputDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := clientCertDir(auth.Options{StorePath: tmpDir, ClientCertOutputDir: outputDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir != outputDir {
+		t.Fatalf("expected %s; received %s", outputDir, dir)
+	}
+
+	info, err := os.Stat(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Fatalf("expected the output dir to be restricted to 0700; received %v", info.Mode().Perm())
+	}
+
+	if dir, err := clientCertDir(auth.Options{StorePath: tmpDir}); err != nil || dir != tmpDir {
+		t.Fatalf("expected the store path %s by default; received %s, %v", tmpDir, dir, err)
+	}
+}
+
+func TestWriteDockerOptionsAllowAllInsecureRegistries(t *testing.T) {
+	out := &bytes.Buffer{}
+	log.SetOutWriter(out)
+	log.SetErrWriter(out)
+	defer func() {
+		log.SetOutWriter(os.Stdout)
+		log.SetErrWriter(os.Stderr)
+	}()
+
+	commander := &provisiontest.FakeSSHCommander{}
+	p := newFakeDebianProvisioner(commander)
+	p.EngineOptions = engine.Options{StorageDriver: "overlay2", AllowAllInsecureRegistries: true}
+
+	if err := writeDockerOptions(context.Background(), p, 2376); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(commander.Commands) != 2 || !strings.Contains(commander.Commands[1], "--insecure-registry=0.0.0.0/0 ") {
+		t.Fatalf("expected the daemon to allow every insecure registry; received %v", commander.Commands)
+	}
+
+	if !strings.Contains(out.String(), "The daemon accepts every registry in 0.0.0.0/0 over plain HTTP") {
+		t.Fatalf("expected a warning; received %q", out.String())
+	}
+}
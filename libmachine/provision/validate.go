@@ -0,0 +1,248 @@
+package provision
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/swarm"
+)
+
+// systemd units and init scripts, without a suffix
+var reServiceName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9@._-]*$`)
+
+// storage drivers which need their data root on a filesystem of their own
+// kind
+var storageDriverFilesystems = map[string]string{
+	"btrfs": "btrfs",
+	"zfs":   "zfs",
+}
+
+// ValidateOptions checks the options of a Provision run against each other
+// and against what the provisioner supports, before anything is done on
+// the host. Every problem found is listed in the returned ErrInvalidOptions.
+func ValidateOptions(p Provisioner, swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error {
+	problems := []string{}
+	capabilities := p.Capabilities()
+
+	if _, err := engineFlags(engineOptions); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if engineOptions.DisableTCP {
+		if swarmOptions.IsSwarm {
+			problems = append(problems, "Swarm needs the Docker API over TCP, it can't be used with the daemon restricted to the unix socket")
+		}
+		if len(authOptions.ServerCertSANs) != 0 {
+			problems = append(problems, "Server certificate SANs are given, but no TLS certificates are set up with the daemon restricted to the unix socket")
+		}
+	}
+
+	if engineOptions.ServiceName != "" && (!reServiceName.MatchString(engineOptions.ServiceName) || strings.HasSuffix(engineOptions.ServiceName, ".service")) {
+		problems = append(problems, fmt.Sprintf("Invalid engine service name %q, expected a service name like docker-ce, without .service", engineOptions.ServiceName))
+	}
+
+	if err := validateInstallStrategy(engineOptions.InstallStrategy); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if engineOptions.InstallStrategy == InstallStrategyDockerOfficial && engineOptions.InstallURLSHA256 != "" {
+		problems = append(problems, "The docker-official install strategy runs no install script to check the checksum of")
+	}
+
+	if engineOptions.Slice != "" {
+		if _, err := sliceDropIn(engineOptions.Slice); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if engineOptions.Slice != "" && hasResourceSlice(engineOptions.ResourceSlice) {
+		problems = append(problems, "A slice and resource slice limits can't be combined, set the limits on the slice instead")
+	}
+
+	if len(engineOptions.BuildDNS) != 0 || len(engineOptions.BuildDNSSearch) != 0 {
+		if _, err := buildkitdConfig(engineOptions); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if engineOptions.VsockAddress != "" {
+		if _, _, err := parseVsockAddress(engineOptions.VsockAddress); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if _, err := serviceLimitsDropIn(engineOptions.ServiceLimits); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if err := validateOOMScoreAdjust(engineOptions.OOMScoreAdjust); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if err := validateCPURealtime(engineOptions.CPURTRuntime, engineOptions.CPURTPeriod); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if engineOptions.ProvisionTimeout < 0 {
+		problems = append(problems, fmt.Sprintf("Invalid provision timeout %d, it must not be negative", engineOptions.ProvisionTimeout))
+	}
+
+	if hasSwarmModeOptions(swarmOptions) && hasArbitraryFlag(engineOptions, "live-restore") {
+		problems = append(problems, "The live-restore daemon option is incompatible with swarm mode")
+	}
+
+	if fs, ok := storageDriverFilesystems[engineOptions.StorageDriver]; ok && engineOptions.DataDisk != "" && engineOptions.DataDiskFilesystem != fs {
+		problems = append(problems, fmt.Sprintf("The %s storage driver needs the data disk formatted with %s, not %q", engineOptions.StorageDriver, fs, engineOptions.DataDiskFilesystem))
+	}
+
+	if engineOptions.AptProxy != "" {
+		if err := validateAptProxy(engineOptions.AptProxy); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if len(engineOptions.AptMirrors) != 0 {
+		if _, err := aptMirrorList(engineOptions.AptMirrors); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	stores := sharedStoresOf(p)
+	if engineOptions.RegistryCache && capabilities.HostConfig && stores.RegistryCache == nil {
+		problems = append(problems, ErrNoRegistryCacheStore.Error())
+	}
+
+	if swarmOptions.AutoRole && capabilities.HostConfig && stores.SwarmTokens == nil {
+		problems = append(problems, ErrNoSwarmTokenStore.Error())
+	}
+
+	if swarmOptions.RejoinTimeout < 0 {
+		problems = append(problems, fmt.Sprintf("Invalid swarm rejoin timeout %d, it must not be negative", swarmOptions.RejoinTimeout))
+	}
+
+	for name, labels := range swarmOptions.NodeLabelManifest {
+		if _, err := nodeUpdateFlags(swarm.Options{NodeLabels: labels}); err != nil {
+			problems = append(problems, fmt.Sprintf("%s, in the node label manifest of %s", err, name))
+		}
+	}
+
+	if swarmOptions.IsSwarm {
+		if err := validateSwarmImage(swarmOptions.Image); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if !capabilities.Systemd || !capabilities.HostConfig {
+		for name, set := range map[string]bool{
+			"Kubernetes readiness":   engineOptions.KubernetesReady,
+			"Linking socket aliases": len(engineOptions.SocketAliases) != 0,
+			"A resource slice":       hasResourceSlice(engineOptions.ResourceSlice),
+			"A slice":                engineOptions.Slice != "",
+			"A restart policy":       engineOptions.RestartPolicy != "",
+			"Service limits":         hasServiceLimits(engineOptions.ServiceLimits),
+			"Hardening SSH":          engineOptions.HardenSSH,
+			"A vsock address":        engineOptions.VsockAddress != "",
+		} {
+			if !set {
+				continue
+			}
+			if !capabilities.Systemd {
+				problems = append(problems, fmt.Sprintf("%s needs a systemd host, which %s is not", name, p))
+			} else {
+				problems = append(problems, fmt.Sprintf("%s isn't applied by the %s provisioner", name, p))
+			}
+		}
+	}
+
+	if !capabilities.HostConfig {
+		for name, set := range map[string]bool{
+			"Setting sysctls":                   len(engineOptions.Sysctls) != 0,
+			"Time synchronization":              engineOptions.EnableNTP,
+			"A data disk":                       engineOptions.DataDisk != "",
+			"A timezone":                        engineOptions.Timezone != "" && !capabilities.Apt,
+			"Adding a user to the docker group": engineOptions.DockerGroupUser != "",
+			"Registry CA certificates":          len(engineOptions.RegistryCACerts) != 0,
+			"The compose plugin":                engineOptions.InstallComposePlugin,
+			"Preloading images":                 len(engineOptions.PreloadImages) != 0,
+			"The motd":                          engineOptions.WriteMotd,
+			"System CA certificates":            len(engineOptions.SystemCACerts) != 0 && !capabilities.Apt,
+			"Multiarch emulation":               engineOptions.EnableMultiarch,
+			"Limiting the journal size":         engineOptions.JournalMaxUse != "",
+			"Container log rotation":            engineOptions.ContainerLogRotateSize != "",
+			"Enabling the memory cgroup":        engineOptions.EnableMemoryCgroup,
+			"Resolving through the host DNS":    engineOptions.HostDNS,
+			"Checking the registry mirrors":     engineOptions.CheckRegistryMirrors,
+			"The registry cache":                engineOptions.RegistryCache,
+			"Build DNS settings":                len(engineOptions.BuildDNS) != 0 || len(engineOptions.BuildDNSSearch) != 0,
+			"The swarm auto role":               swarmOptions.AutoRole,
+			"A node label manifest":             len(swarmOptions.NodeLabelManifest) != 0,
+			"A swarm rejoin timeout":            swarmOptions.RejoinTimeout != 0,
+		} {
+			if set {
+				problems = append(problems, fmt.Sprintf("%s isn't applied by the %s provisioner", name, p))
+			}
+		}
+
+		// the daemon fails to start on a missing bridge or init binary,
+		// only the host level steps check them beforehand
+		if bridge := engineOptions.BridgeName; bridge != "" && bridge != "docker0" && bridge != "none" {
+			problems = append(problems, fmt.Sprintf("The bridge %s isn't checked by the %s provisioner, give it with --engine-opt bridge=%s instead", bridge, p, bridge))
+		}
+		if engineOptions.InitBinary != "" {
+			problems = append(problems, fmt.Sprintf("The init binary %s isn't checked by the %s provisioner, give it with --engine-opt init-path=%s instead", engineOptions.InitBinary, p, engineOptions.InitBinary))
+		}
+	}
+
+	if !capabilities.Apt {
+		for name, set := range map[string]bool{
+			"An apt proxy":                         engineOptions.AptProxy != "",
+			"Strict apt verification":              engineOptions.StrictAptVerify,
+			"Parallel apt downloads":               engineOptions.AptParallelDownloads != 0,
+			"Apt mirrors":                          len(engineOptions.AptMirrors) != 0,
+			"The docker-official install strategy": engineOptions.InstallStrategy == InstallStrategyDockerOfficial,
+		} {
+			if set {
+				problems = append(problems, fmt.Sprintf("%s needs a host installing its packages with apt, which %s doesn't", name, p))
+			}
+		}
+	}
+
+	if !capabilities.DaemonConfig {
+		for name, set := range map[string]bool{
+			"The containerd snapshotter":     engineOptions.ContainerdSnapshotter,
+			"Build cache garbage collection": engineOptions.BuilderGC || engineOptions.BuilderGCKeepStorage != "",
+			"Maximum download attempts":      engineOptions.MaxDownloadAttempts != 0,
+			"The OOM score adjustment":       engineOptions.OOMScoreAdjust != 0 && !(capabilities.Systemd && capabilities.HostConfig),
+			"The realtime CPU budget":        engineOptions.CPURTRuntime != 0 || engineOptions.CPURTPeriod != 0,
+		} {
+			if set {
+				problems = append(problems, fmt.Sprintf("%s needs /etc/docker/daemon.json, which %s doesn't keep", name, p))
+			}
+		}
+	}
+
+	if len(problems) != 0 {
+		sort.Strings(problems)
+		return ErrInvalidOptions{Problems: problems}
+	}
+
+	return nil
+}
+
+func hasSwarmModeOptions(swarmOptions swarm.Options) bool {
+	return swarmOptions.AutoRole || swarmOptions.DispatcherHeartbeat != "" || swarmOptions.SnapshotInterval != 0 || swarmOptions.MaxSnapshots != 0
+}
+
+func hasArbitraryFlag(engineOptions engine.Options, name string) bool {
+	for _, flag := range engineOptions.ArbitraryFlags {
+		if flag == name || strings.HasPrefix(flag, name+"=") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,265 @@
+package provision
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/swarm"
+)
+
+func TestValidateOptions(t *testing.T) {
+	p := newFakeDebianProvisioner(nil)
+
+	engineOptions := engine.Options{
+		StorageDriver:      "overlay2",
+		KubernetesReady:    true,
+		RestartPolicy:      "on-failure",
+		DataDisk:           "/dev/sda",
+		DataDiskFilesystem: "ext4",
+	}
+	if err := ValidateOptions(p, swarm.Options{}, auth.Options{}, engineOptions); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateOptionsAllProblems(t *testing.T) {
+	p := newFakeDebianProvisioner(nil)
+
+	swarmOptions := swarm.Options{
+		IsSwarm: true,
+		Image:   "swarm:latest",
+	}
+	authOptions := auth.Options{
+		ServerCertSANs: []string{"docker.local"},
+	}
+	engineOptions := engine.Options{
+		StorageDriver:      "btrfs",
+		DataDisk:           "/dev/sda",
+		DataDiskFilesystem: "ext4",
+		DisableTCP:         true,
+		AptProxy:           "proxy:3142",
+		DNS:                []string{"resolver.local"},
+	}
+
+	err := ValidateOptions(p, swarmOptions, authOptions, engineOptions)
+	invalid, ok := err.(ErrInvalidOptions)
+	if !ok {
+		t.Fatalf("expected ErrInvalidOptions; received %v", err)
+	}
+
+	expected := []string{
+		`Invalid DNS server "resolver.local", expected an IP address`,
+		`Invalid apt proxy "proxy:3142", expected a URL like http://proxy:3142`,
+		"Server certificate SANs are given, but no TLS certificates are set up with the daemon restricted to the unix socket",
+		"Swarm needs the Docker API over TCP, it can't be used with the daemon restricted to the unix socket",
+		`The btrfs storage driver needs the data disk formatted with btrfs, not "ext4"`,
+	}
+	if !reflect.DeepEqual(invalid.Problems, expected) {
+		t.Fatalf("expected problems %q; received %q", expected, invalid.Problems)
+	}
+}
+
+func TestValidateOptionsServiceName(t *testing.T) {
+	p := newFakeDebianProvisioner(nil)
+
+	for name, valid := range map[string]bool{
+		"docker-ce":         true,
+		"docker@default":    true,
+		"docker-ce.service": false,
+		"docker ce":         false,
+		"../docker":         false,
+	} {
+		err := ValidateOptions(p, swarm.Options{}, auth.Options{}, engine.Options{ServiceName: name})
+		if valid && err != nil {
+			t.Fatalf("expected %q to be accepted; received %s", name, err)
+		}
+		if !valid && err == nil {
+			t.Fatalf("expected %q to be rejected", name)
+		}
+	}
+}
+
+func TestValidateOptionsSharedStores(t *testing.T) {
+	p := newFakeDebianProvisioner(nil)
+
+	engineOptions := engine.Options{RegistryCache: true}
+	swarmOptions := swarm.Options{AutoRole: true}
+
+	err := ValidateOptions(p, swarmOptions, auth.Options{}, engineOptions)
+	if err == nil || !strings.Contains(err.Error(), ErrNoRegistryCacheStore.Error()) || !strings.Contains(err.Error(), ErrNoSwarmTokenStore.Error()) {
+		t.Fatalf("expected the missing stores to be reported; received %v", err)
+	}
+
+	SetSharedStores(p, SharedStores{
+		RegistryCache: NewMemoryRegistryCacheStore(),
+		SwarmTokens:   NewMemorySwarmTokenStore(),
+	})
+
+	if err := ValidateOptions(p, swarmOptions, auth.Options{}, engineOptions); err != nil {
+		t.Fatalf("expected the shared stores to be used; received %s", err)
+	}
+}
+
+func TestValidateOptionsCapabilities(t *testing.T) {
+	p := NewBoot2DockerProvisioner(&fakedriver.Driver{})
+
+	engineOptions := engine.Options{
+		SocketAliases:         []string{"/var/run/balena.sock"},
+		ContainerdSnapshotter: true,
+		ArbitraryFlags:        []string{"live-restore"},
+	}
+	swarmOptions := swarm.Options{
+		DispatcherHeartbeat: "10s",
+	}
+
+	err := ValidateOptions(p, swarmOptions, auth.Options{}, engineOptions)
+	invalid, ok := err.(ErrInvalidOptions)
+	if !ok {
+		t.Fatalf("expected ErrInvalidOptions; received %v", err)
+	}
+
+	expected := []string{
+		"Linking socket aliases needs a systemd host, which boot2docker is not",
+		"The containerd snapshotter needs /etc/docker/daemon.json, which boot2docker doesn't keep",
+		"The live-restore daemon option is incompatible with swarm mode",
+	}
+	if !reflect.DeepEqual(invalid.Problems, expected) {
+		t.Fatalf("expected problems %q; received %q", expected, invalid.Problems)
+	}
+}
+
+func TestValidateOptionsHostConfig(t *testing.T) {
+	p := NewCentosProvisioner(&fakedriver.Driver{})
+
+	engineOptions := engine.Options{
+		RestartPolicy:  "on-failure",
+		HardenSSH:      true,
+		OOMScoreAdjust: -500,
+		Sysctls:        map[string]string{"vm.max_map_count": "262144"},
+		AptProxy:       "http://proxy:3142",
+	}
+
+	err := ValidateOptions(p, swarm.Options{}, auth.Options{}, engineOptions)
+	invalid, ok := err.(ErrInvalidOptions)
+	if !ok {
+		t.Fatalf("expected ErrInvalidOptions; received %v", err)
+	}
+
+	expected := []string{
+		"A restart policy isn't applied by the centos provisioner",
+		"An apt proxy needs a host installing its packages with apt, which centos doesn't",
+		"Hardening SSH isn't applied by the centos provisioner",
+		"Setting sysctls isn't applied by the centos provisioner",
+	}
+	if !reflect.DeepEqual(invalid.Problems, expected) {
+		t.Fatalf("expected problems %q; received %q", expected, invalid.Problems)
+	}
+}
+
+// capabilityOption sets an option which only some provisioners apply, and
+// tells from the capabilities of a provisioner whether it does.
+type capabilityOption struct {
+	name      string
+	set       func(*engine.Options, *swarm.Options)
+	supported func(Capabilities) bool
+}
+
+func needsSystemdHost(c Capabilities) bool     { return c.Systemd && c.HostConfig }
+func needsHostConfig(c Capabilities) bool      { return c.HostConfig }
+func needsHostConfigOrApt(c Capabilities) bool { return c.HostConfig || c.Apt }
+func needsApt(c Capabilities) bool             { return c.Apt }
+func needsDaemonConfig(c Capabilities) bool    { return c.DaemonConfig }
+
+var capabilityOptions = []capabilityOption{
+	{"KubernetesReady", func(e *engine.Options, s *swarm.Options) { e.KubernetesReady = true }, needsSystemdHost},
+	{"SocketAliases", func(e *engine.Options, s *swarm.Options) { e.SocketAliases = []string{"/var/run/balena.sock"} }, needsSystemdHost},
+	{"ResourceSlice", func(e *engine.Options, s *swarm.Options) { e.ResourceSlice.MemoryMax = "512M" }, needsSystemdHost},
+	{"Slice", func(e *engine.Options, s *swarm.Options) { e.Slice = "system-docker.slice" }, needsSystemdHost},
+	{"RestartPolicy", func(e *engine.Options, s *swarm.Options) { e.RestartPolicy = "on-failure" }, needsSystemdHost},
+	{"ServiceLimits", func(e *engine.Options, s *swarm.Options) { e.ServiceLimits.NOFILE = "65536" }, needsSystemdHost},
+	{"HardenSSH", func(e *engine.Options, s *swarm.Options) { e.HardenSSH = true }, needsSystemdHost},
+	{"VsockAddress", func(e *engine.Options, s *swarm.Options) { e.VsockAddress = "vsock://any:2376" }, needsSystemdHost},
+	{"Sysctls", func(e *engine.Options, s *swarm.Options) { e.Sysctls = map[string]string{"vm.max_map_count": "262144"} }, needsHostConfig},
+	{"EnableNTP", func(e *engine.Options, s *swarm.Options) { e.EnableNTP = true }, needsHostConfig},
+	{"DataDisk", func(e *engine.Options, s *swarm.Options) { e.DataDisk, e.DataDiskFilesystem = "/dev/sdb", "ext4" }, needsHostConfig},
+	{"DockerGroupUser", func(e *engine.Options, s *swarm.Options) { e.DockerGroupUser = "docker" }, needsHostConfig},
+	{"RegistryCACerts", func(e *engine.Options, s *swarm.Options) {
+		e.RegistryCACerts = map[string]string{"registry.local:5000": "ca.pem"}
+	}, needsHostConfig},
+	{"InstallComposePlugin", func(e *engine.Options, s *swarm.Options) { e.InstallComposePlugin = true }, needsHostConfig},
+	{"PreloadImages", func(e *engine.Options, s *swarm.Options) { e.PreloadImages = []string{"alpine:3.19"} }, needsHostConfig},
+	{"WriteMotd", func(e *engine.Options, s *swarm.Options) { e.WriteMotd = true }, needsHostConfig},
+	{"EnableMultiarch", func(e *engine.Options, s *swarm.Options) { e.EnableMultiarch = true }, needsHostConfig},
+	{"JournalMaxUse", func(e *engine.Options, s *swarm.Options) { e.JournalMaxUse = "100M" }, needsHostConfig},
+	{"ContainerLogRotateSize", func(e *engine.Options, s *swarm.Options) { e.ContainerLogRotateSize = "10M" }, needsHostConfig},
+	{"EnableMemoryCgroup", func(e *engine.Options, s *swarm.Options) { e.EnableMemoryCgroup = true }, needsHostConfig},
+	{"HostDNS", func(e *engine.Options, s *swarm.Options) { e.HostDNS = true }, needsHostConfig},
+	{"CheckRegistryMirrors", func(e *engine.Options, s *swarm.Options) { e.CheckRegistryMirrors = true }, needsHostConfig},
+	{"RegistryCache", func(e *engine.Options, s *swarm.Options) { e.RegistryCache = true }, needsHostConfig},
+	{"BuildDNS", func(e *engine.Options, s *swarm.Options) { e.BuildDNS = []string{"10.0.0.2"} }, needsHostConfig},
+	{"BridgeName", func(e *engine.Options, s *swarm.Options) { e.BridgeName = "br0" }, needsHostConfig},
+	{"InitBinary", func(e *engine.Options, s *swarm.Options) { e.InitBinary = "/usr/bin/tini" }, needsHostConfig},
+	{"AutoRole", func(e *engine.Options, s *swarm.Options) { s.AutoRole = true }, needsHostConfig},
+	{"NodeLabelManifest", func(e *engine.Options, s *swarm.Options) {
+		s.NodeLabelManifest = map[string][]string{"node-1": {"zone=a"}}
+	}, needsHostConfig},
+	{"RejoinTimeout", func(e *engine.Options, s *swarm.Options) { s.RejoinTimeout = 60 }, needsHostConfig},
+	{"Timezone", func(e *engine.Options, s *swarm.Options) { e.Timezone = "Europe/Berlin" }, needsHostConfigOrApt},
+	{"SystemCACerts", func(e *engine.Options, s *swarm.Options) { e.SystemCACerts = []string{"proxy-ca.pem"} }, needsHostConfigOrApt},
+	{"AptProxy", func(e *engine.Options, s *swarm.Options) { e.AptProxy = "http://proxy:3142" }, needsApt},
+	{"StrictAptVerify", func(e *engine.Options, s *swarm.Options) { e.StrictAptVerify = true }, needsApt},
+	{"AptParallelDownloads", func(e *engine.Options, s *swarm.Options) { e.AptParallelDownloads = 4 }, needsApt},
+	{"AptMirrors", func(e *engine.Options, s *swarm.Options) { e.AptMirrors = []string{"http://mirror.example.com/debian"} }, needsApt},
+	{"InstallStrategy", func(e *engine.Options, s *swarm.Options) { e.InstallStrategy = InstallStrategyDockerOfficial }, needsApt},
+	{"ContainerdSnapshotter", func(e *engine.Options, s *swarm.Options) { e.ContainerdSnapshotter = true }, needsDaemonConfig},
+	{"BuilderGC", func(e *engine.Options, s *swarm.Options) { e.BuilderGC = true }, needsDaemonConfig},
+	{"MaxDownloadAttempts", func(e *engine.Options, s *swarm.Options) { e.MaxDownloadAttempts = 3 }, needsDaemonConfig},
+	{"CPURealtime", func(e *engine.Options, s *swarm.Options) { e.CPURTRuntime, e.CPURTPeriod = 950000, 1000000 }, needsDaemonConfig},
+	{"OOMScoreAdjust", func(e *engine.Options, s *swarm.Options) { e.OOMScoreAdjust = -500 }, func(c Capabilities) bool {
+		return c.DaemonConfig || needsSystemdHost(c)
+	}},
+}
+
+func TestValidateOptionsEveryProvisioner(t *testing.T) {
+	d := &fakedriver.Driver{}
+	provisioners := []Provisioner{
+		NewArchProvisioner(d),
+		NewBoot2DockerProvisioner(d),
+		NewCentosProvisioner(d),
+		NewCoreOSProvisioner(d),
+		NewDebianProvisioner(d),
+		NewFedoraProvisioner(d),
+		NewRancherProvisioner(d),
+		NewRedHatProvisioner("rhel", d),
+		NewOpenSUSEProvisioner(d),
+		NewSLEDProvisioner(d),
+		NewSLESProvisioner(d),
+		NewUbuntuSystemdProvisioner(d),
+		NewUbuntuProvisioner(d),
+	}
+
+	for _, p := range provisioners {
+		SetSharedStores(p, SharedStores{
+			RegistryCache: NewMemoryRegistryCacheStore(),
+			SwarmTokens:   NewMemorySwarmTokenStore(),
+		})
+
+		for _, option := range capabilityOptions {
+			engineOptions := engine.Options{StorageDriver: "overlay2"}
+			swarmOptions := swarm.Options{}
+			option.set(&engineOptions, &swarmOptions)
+
+			err := ValidateOptions(p, swarmOptions, auth.Options{}, engineOptions)
+			if option.supported(p.Capabilities()) && err != nil {
+				t.Errorf("expected %s to be accepted by %s; received %s", option.name, p, err)
+			}
+			if !option.supported(p.Capabilities()) && err == nil {
+				t.Errorf("expected %s to be rejected by %s", option.name, p)
+			}
+		}
+	}
+}
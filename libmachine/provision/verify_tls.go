@@ -0,0 +1,78 @@
+package provision
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// VerifyTLSConnection dials the Docker daemon over TCP using the client
+// certificates found in clientCertDir (ca.pem, cert.pem and key.pem) and
+// queries the version endpoint. Unlike the checks run over SSH, this
+// exercises the same path as the docker client, so a server certificate
+// whose SANs don't match the machine IP is caught here.
+func VerifyTLSConnection(p Provisioner, clientCertDir string) error {
+	dockerURL, err := p.GetDriver().GetURL()
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(dockerURL)
+	if err != nil {
+		return fmt.Errorf("Error parsing the Docker URL %q: %s", dockerURL, err)
+	}
+
+	caCert, err := ioutil.ReadFile(filepath.Join(clientCertDir, "ca.pem"))
+	if err != nil {
+		return err
+	}
+
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(caCert) {
+		return fmt.Errorf("Error reading CA certificate from %s", clientCertDir)
+	}
+
+	keypair, err := tls.LoadX509KeyPair(filepath.Join(clientCertDir, "cert.pem"), filepath.Join(clientCertDir, "key.pem"))
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:      certPool,
+				Certificates: []tls.Certificate{keypair},
+			},
+		},
+		Timeout: 10 * time.Second,
+	}
+
+	resp, err := client.Get(fmt.Sprintf("https://%s/version", u.Host))
+	if err != nil {
+		return fmt.Errorf("Error connecting to the Docker daemon at %s: %s", u.Host, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unexpected response from the Docker daemon at %s: %s", u.Host, resp.Status)
+	}
+
+	var version struct {
+		Version string
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil {
+		return fmt.Errorf("Error decoding the Docker daemon version: %s", err)
+	}
+
+	log.Debugf("docker daemon at %s responded with version %s", u.Host, version.Version)
+
+	return nil
+}
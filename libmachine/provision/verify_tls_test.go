@@ -0,0 +1,125 @@
+package provision
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/cert"
+)
+
+type fakeURLDriver struct {
+	*fakedriver.Driver
+	URL string
+}
+
+func (d *fakeURLDriver) GetURL() (string, error) {
+	return d.URL, nil
+}
+
+// startTLSDaemon starts an in-process server speaking the version endpoint
+// that requires client certificates signed by the CA in certDir.
+func startTLSDaemon(t *testing.T, certDir string, serverHosts []string) *httptest.Server {
+	caCertPath := filepath.Join(certDir, "ca.pem")
+	caKeyPath := filepath.Join(certDir, "ca-key.pem")
+	serverCertPath := filepath.Join(certDir, "server.pem")
+	serverKeyPath := filepath.Join(certDir, "server-key.pem")
+
+	if err := cert.GenerateCACertificate(caCertPath, caKeyPath, "test-org", 2048); err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.GenerateCert(serverHosts, serverCertPath, serverKeyPath, caCertPath, caKeyPath, "test-org", 2048); err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.GenerateCert([]string{""}, filepath.Join(certDir, "cert.pem"), filepath.Join(certDir, "key.pem"), caCertPath, caKeyPath, "test-org", 2048); err != nil {
+		t.Fatal(err)
+	}
+
+	caCert, err := ioutil.ReadFile(caCertPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPool := x509.NewCertPool()
+	certPool.AppendCertsFromPEM(caCert)
+
+	serverKeypair, err := tls.LoadX509KeyPair(serverCertPath, serverKeyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"Version":"1.10.0"}`)
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverKeypair},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    certPool,
+	}
+	server.StartTLS()
+
+	return server
+}
+
+func newTLSVerifyProvisioner(server *httptest.Server) Provisioner {
+	return NewDebianProvisioner(&fakeURLDriver{
+		Driver: &fakedriver.Driver{},
+		URL:    strings.Replace(server.URL, "https://", "tcp://", 1),
+	})
+}
+
+func TestVerifyTLSConnection(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	server := startTLSDaemon(t, tmpDir, []string{"127.0.0.1", "localhost"})
+	defer server.Close()
+
+	if err := VerifyTLSConnection(newTLSVerifyProvisioner(server), tmpDir); err != nil {
+		t.Fatalf("expected TLS connection to succeed; received %s", err)
+	}
+}
+
+func TestVerifyTLSConnectionSANMismatch(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	server := startTLSDaemon(t, tmpDir, []string{"10.0.0.1", "example.com"})
+	defer server.Close()
+
+	if err := VerifyTLSConnection(newTLSVerifyProvisioner(server), tmpDir); err == nil {
+		t.Fatal("expected TLS connection to fail with a server cert not matching the host IP")
+	}
+}
+
+func TestVerifyTLSConnectionMissingClientCerts(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	server := startTLSDaemon(t, tmpDir, []string{"127.0.0.1"})
+	defer server.Close()
+
+	if err := VerifyTLSConnection(newTLSVerifyProvisioner(server), filepath.Join(tmpDir, "missing")); err == nil {
+		t.Fatal("expected an error when the client certs are missing")
+	}
+}
@@ -0,0 +1,107 @@
+package provision
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/provision/pkgaction"
+	"github.com/docker/machine/libmachine/provision/serviceaction"
+	"golang.org/x/net/context"
+)
+
+const (
+	vsockServiceName = "docker-vsock"
+	vsockUnitPath    = "/etc/systemd/system/" + vsockServiceName + ".service"
+)
+
+// parseVsockAddress splits a vsock://CID:PORT address. The CID is the one
+// of the guest, 3 or more as 0 to 2 are reserved for the hypervisor and
+// the host, or any.
+func parseVsockAddress(address string) (string, int64, error) {
+	invalid := fmt.Errorf("Invalid vsock address %q, expected vsock://CID:PORT with CID a guest CID or any", address)
+
+	if !strings.HasPrefix(address, "vsock://") {
+		return "", 0, invalid
+	}
+
+	parts := strings.Split(strings.TrimPrefix(address, "vsock://"), ":")
+	if len(parts) != 2 {
+		return "", 0, invalid
+	}
+
+	if parts[0] != "any" {
+		cid, err := strconv.ParseUint(parts[0], 10, 32)
+		// the last CID is VMADDR_CID_ANY
+		if err != nil || cid < 3 || cid == math.MaxUint32 {
+			return "", 0, invalid
+		}
+	}
+
+	port, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil || port == 0 || port == math.MaxUint32 {
+		return "", 0, invalid
+	}
+
+	return parts[0], int64(port), nil
+}
+
+// vsockUnit renders the service forwarding the vsock port to the docker
+// socket. The daemon can't listen on vsock itself, its -H only takes tcp,
+// unix and fd addresses. A guest has a single CID, so listening on any CID
+// listens on the one of the address.
+func vsockUnit(address, dockerService string) (string, error) {
+	_, port, err := parseVsockAddress(address)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf(`[Unit]
+Description=Docker API over vsock
+After=%s.service
+Requires=%s.service
+
+[Service]
+ExecStart=/usr/bin/socat VSOCK-LISTEN:%d,fork UNIX-CONNECT:%s
+Restart=always
+
+[Install]
+WantedBy=multi-user.target
+`, dockerService, dockerService, port, dockerSocketPath), nil
+}
+
+// serveVsock makes the Docker API reachable over vsock from the hypervisor
+// host, which needs no network between it and the VM. The API is served
+// without TLS, like on the unix socket, as only the host can connect. VMs
+// without a vsock device are left alone.
+func serveVsock(ctx context.Context, p Provisioner, address string) error {
+	unit, err := vsockUnit(address, serviceName("docker", dockerServiceNameOf(p)))
+	if err != nil {
+		return err
+	}
+
+	out, err := p.SSHCommand(ctx, "if [ -e /dev/vsock ]; then echo vsock; fi")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(out) != "vsock" {
+		log.Warnf("The machine has no vsock device, the Docker API is not served on %s.", address)
+		return nil
+	}
+
+	if err := aptPackages(ctx, p, []string{"socat"}, pkgaction.Install); err != nil {
+		return err
+	}
+
+	if _, err := p.SSHCommand(ctx, fmt.Sprintf("printf '%%s' '%s' | sudo tee %s", unit, vsockUnitPath)); err != nil {
+		return err
+	}
+
+	if err := p.Service(ctx, vsockServiceName, serviceaction.Enable); err != nil {
+		return err
+	}
+
+	return p.Service(ctx, vsockServiceName, serviceaction.Restart)
+}
@@ -0,0 +1,108 @@
+package provision
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/libmachine/provision/provisiontest"
+	"golang.org/x/net/context"
+)
+
+const vsockTestUnit = `[Unit]
+Description=Docker API over vsock
+After=docker.service
+Requires=docker.service
+
+[Service]
+ExecStart=/usr/bin/socat VSOCK-LISTEN:2376,fork UNIX-CONNECT:/var/run/docker.sock
+Restart=always
+
+[Install]
+WantedBy=multi-user.target
+`
+
+func TestParseVsockAddress(t *testing.T) {
+	for address, expected := range map[string]struct {
+		cid  string
+		port int64
+	}{
+		"vsock://any:2376":      {"any", 2376},
+		"vsock://3:1024":        {"3", 1024},
+		"vsock://4294967294:1":  {"4294967294", 1},
+		"vsock://42:4294967294": {"42", 4294967294},
+	} {
+		cid, port, err := parseVsockAddress(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cid != expected.cid || port != expected.port {
+			t.Fatalf("expected %s and %d for %q; received %s and %d", expected.cid, expected.port, address, cid, port)
+		}
+	}
+}
+
+func TestParseVsockAddressInvalid(t *testing.T) {
+	for _, address := range []string{
+		"tcp://0.0.0.0:2376",
+		"vsock://2376",
+		"vsock://2:2376",
+		"vsock://4294967295:2376",
+		"vsock://-1:2376",
+		"vsock://host:2376",
+		"vsock://3:0",
+		"vsock://3:4294967295",
+		"vsock://3:2376:1",
+	} {
+		if _, _, err := parseVsockAddress(address); err == nil {
+			t.Fatalf("expected an error for %q", address)
+		}
+	}
+}
+
+func TestVsockUnit(t *testing.T) {
+	unit, err := vsockUnit("vsock://any:2376", "docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if unit != vsockTestUnit {
+		t.Fatalf("expected unit %q; received %q", vsockTestUnit, unit)
+	}
+}
+
+func TestServeVsock(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{
+		Responses: map[string]string{
+			"if [ -e /dev/vsock ]; then echo vsock; fi": "vsock\n",
+		},
+	}
+
+	if err := serveVsock(context.Background(), newFakeDebianProvisioner(commander), "vsock://any:2376"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"if [ -e /dev/vsock ]; then echo vsock; fi",
+		"sudo apt-get update",
+		"DEBIAN_FRONTEND=noninteractive sudo -E apt-get install -y -o DPkg::Lock::Timeout=120 socat",
+		"printf '%s' '" + vsockTestUnit + "' | sudo tee /etc/systemd/system/docker-vsock.service",
+		"sudo systemctl -f enable docker-vsock",
+		"sudo systemctl daemon-reload",
+		"sudo systemctl -f restart docker-vsock",
+	}
+	if !reflect.DeepEqual(commander.Commands, expected) {
+		t.Fatalf("expected commands %v; received %v", expected, commander.Commands)
+	}
+}
+
+func TestServeVsockNoDevice(t *testing.T) {
+	commander := &provisiontest.FakeSSHCommander{}
+
+	if err := serveVsock(context.Background(), newFakeDebianProvisioner(commander), "vsock://any:2376"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(commander.Commands) != 1 {
+		t.Fatalf("expected nothing set up without a vsock device; received %v", commander.Commands)
+	}
+}
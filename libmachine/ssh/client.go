@@ -1,21 +1,25 @@
 package ssh
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/docker/docker/pkg/term"
 	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/mcnutils"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/terminal"
+	"golang.org/x/net/context"
 )
 
 type Client interface {
 	Output(command string) (string, error)
+	OutputContext(ctx context.Context, command string) (string, error)
 	Shell(args ...string) error
 }
 
@@ -170,17 +174,70 @@ func (client NativeClient) Output(command string) (string, error) {
 	return string(output), err
 }
 
-func (client NativeClient) OutputWithPty(command string) (string, error) {
+// OutputContext is like Output but kills the remote command and closes the
+// session when ctx is done.
+func (client NativeClient) OutputContext(ctx context.Context, command string) (string, error) {
 	session, err := client.session(command)
 	if err != nil {
-		return "", nil
+		return "", err
+	}
+	defer session.Close()
+
+	return runSession(ctx, session, command)
+}
+
+// OutputWithPtyContext is like OutputWithPty but kills the remote command
+// and closes the session when ctx is done.
+func (client NativeClient) OutputWithPtyContext(ctx context.Context, command string) (string, error) {
+	session, err := client.ptySession(command)
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	return runSession(ctx, session, command)
+}
+
+func runSession(ctx context.Context, session *ssh.Session, command string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	type result struct {
+		output []byte
+		err    error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		output, err := session.CombinedOutput(command)
+		done <- result{output, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		if err := session.Signal(ssh.SIGKILL); err != nil {
+			log.Debugf("Error killing SSH command: %s", err)
+		}
+		session.Close()
+		return "", ctx.Err()
+	case r := <-done:
+		return string(r.output), r.err
+	}
+}
+
+func (client NativeClient) ptySession(command string) (*ssh.Session, error) {
+	session, err := client.session(command)
+	if err != nil {
+		return nil, err
 	}
 
 	fd := int(os.Stdin.Fd())
 
 	termWidth, termHeight, err := terminal.GetSize(fd)
 	if err != nil {
-		return "", err
+		session.Close()
+		return nil, err
 	}
 
 	modes := ssh.TerminalModes{
@@ -192,6 +249,16 @@ func (client NativeClient) OutputWithPty(command string) (string, error) {
 	// request tty -- fixes error with hosts that use
 	// "Defaults requiretty" in /etc/sudoers - I'm looking at you RedHat
 	if err := session.RequestPty("xterm", termHeight, termWidth, modes); err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (client NativeClient) OutputWithPty(command string) (string, error) {
+	session, err := client.ptySession(command)
+	if err != nil {
 		return "", err
 	}
 
@@ -300,6 +367,52 @@ func (client ExternalClient) Output(command string) (string, error) {
 	return string(output), err
 }
 
+// sshReapTimeout bounds the wait for a killed ssh process to be reaped
+const sshReapTimeout = 2 * time.Second
+
+// OutputContext is like Output but kills the ssh process when ctx is done.
+// A tty is forced so that sshd hangs up the remote command once the
+// connection drops, instead of leaving it running on the host.
+func (client ExternalClient) OutputContext(ctx context.Context, command string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	args := append(append([]string{}, client.BaseArgs...), "-tt", command)
+	cmd := getSSHCmd(client.BinaryPath, args...)
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case <-ctx.Done():
+		if err := cmd.Process.Kill(); err != nil {
+			log.Debugf("Error killing ssh process: %s", err)
+		}
+		// Wait reaps the killed process, then returns once its output is
+		// closed. Children still holding on to the output would keep it
+		// from returning, so it isn't waited for forever.
+		select {
+		case <-done:
+		case <-time.After(sshReapTimeout):
+			log.Debugf("The output of the killed ssh process is still held open")
+		}
+		return "", ctx.Err()
+	case err := <-done:
+		// The remote tty translates newlines
+		return strings.Replace(output.String(), "\r\n", "\n", -1), err
+	}
+}
+
 func (client ExternalClient) Shell(args ...string) error {
 	args = append(client.BaseArgs, args...)
 	cmd := getSSHCmd(client.BinaryPath, args...)
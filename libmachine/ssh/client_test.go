@@ -1,9 +1,18 @@
 package ssh
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
 )
 
 func TestGetSSHCmdArgs(t *testing.T) {
@@ -43,3 +52,108 @@ func TestGetSSHCmdArgs(t *testing.T) {
 		assert.Equal(t, cmd.Args, c.expectedArgs)
 	}
 }
+
+// fakeSSH runs the command locally. Like sshd does for sessions with a tty,
+// it hangs up the command once the connection, i.e. this process, is gone.
+const fakeSSH = `#!/bin/sh
+tty=
+while [ $# -gt 1 ]; do
+	[ "$1" = "-tt" ] && tty=1
+	shift
+done
+sh -c "$1" </dev/null &
+remote=$!
+if [ -n "$tty" ]; then
+	(while kill -0 $$; do sleep 0.1; done; kill $remote) >/dev/null 2>&1 &
+fi
+wait $remote
+`
+
+func newShellClient(t *testing.T) (ExternalClient, func()) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires /bin/sh")
+	}
+
+	dir, err := ioutil.TempDir("", "machine-ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	binaryPath := filepath.Join(dir, "ssh")
+	if err := ioutil.WriteFile(binaryPath, []byte(fakeSSH), 0755); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	client := ExternalClient{
+		BinaryPath: binaryPath,
+		BaseArgs:   []string{"docker@localhost"},
+	}
+
+	return client, func() { os.RemoveAll(dir) }
+}
+
+func TestExternalClientOutputContext(t *testing.T) {
+	client, cleanup := newShellClient(t)
+	defer cleanup()
+
+	output, err := client.OutputContext(context.Background(), "echo hello")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", output)
+}
+
+func TestExternalClientOutputContextCanceled(t *testing.T) {
+	client, cleanup := newShellClient(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := client.OutputContext(ctx, "sleep 30")
+
+	assert.Equal(t, context.Canceled, err)
+	assert.True(t, time.Since(start) < 10*time.Second, "expected the command to be killed")
+}
+
+func TestExternalClientOutputContextReaped(t *testing.T) {
+	client, cleanup := newShellClient(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := client.OutputContext(ctx, "exec sleep 30")
+
+	assert.Equal(t, context.Canceled, err)
+	assert.True(t, time.Since(start) < sshReapTimeout, "expected the killed process to be reaped")
+}
+
+func TestExternalClientOutputContextKillsRemoteCommand(t *testing.T) {
+	client, cleanup := newShellClient(t)
+	defer cleanup()
+
+	pidFile := filepath.Join(filepath.Dir(client.BinaryPath), "pid")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	_, err := client.OutputContext(ctx, "echo $$ > "+pidFile+"; exec sleep 30")
+	assert.Equal(t, context.Canceled, err)
+
+	content, err := ioutil.ReadFile(pidFile)
+	assert.NoError(t, err)
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	assert.NoError(t, err)
+
+	gone := false
+	for i := 0; i < 20 && !gone; i++ {
+		process, err := os.FindProcess(pid)
+		gone = err != nil || process.Signal(syscall.Signal(0)) != nil
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.True(t, gone, "expected the remote command to be gone")
+}
@@ -16,4 +16,33 @@ type Options struct {
 	Overcommit     float64
 	ArbitraryFlags []string
 	Env            []string
+	// NodeLabels are key=value labels set on a swarm mode node once it
+	// joined, so services can constrain their placement.
+	NodeLabels []string
+	// NodeLabelManifest holds key=value labels, like zone or hardware,
+	// for each machine name. They are set on the nodes from a manager,
+	// the one elected with AutoRole or ApplySwarmNodeLabels.
+	NodeLabelManifest map[string][]string
+	// NodeAvailability is active, pause or drain. The availability is left
+	// unchanged when empty.
+	NodeAvailability string
+	// DispatcherHeartbeat, like 10s, is how often swarm mode nodes report
+	// to the managers. Raising it helps on flaky networks.
+	DispatcherHeartbeat string
+	// SnapshotInterval is the number of raft log entries between snapshots
+	// and MaxSnapshots the number of old snapshots kept by the managers.
+	SnapshotInterval int
+	MaxSnapshots     int
+	// AutoRole makes the first machine provisioned the swarm mode manager
+	// and the following ones workers, through the token store the machines
+	// share.
+	AutoRole bool
+	// Autolock encrypts the raft logs and TLS key of the managers with an
+	// unlock key. A restarted manager stays locked until it is given the
+	// key with docker swarm unlock, so the key must be kept safe.
+	Autolock bool
+	// RejoinTimeout, in seconds, is how long Provision waits for a node
+	// which was part of a swarm mode cluster to be back in it after the
+	// daemon restarted. Zero skips the wait.
+	RejoinTimeout int
 }